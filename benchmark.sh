@@ -1,19 +0,0 @@
-#!/bin/bash
-requests="49.2570693,7.0458248|49.2361782,6.9974266
-49.2570693,7.0458248|49.2361782,6.9974266&travelmode=walking
-49.2361782,6.9974266|50.1164378,8.6828652
-49.2361782,6.9974266|52.5236651,13.4118367
-52.0271080,9.7716162|47.7723365,11.6696691|51.1568795,7.0703360|50.8816719,12.1021729|52.7762429,9.0019126|51.6694630,14.5941523|50.2898144,9.1067417|53.0602511,10.5348898|50.8998989,6.9838693|49.6366295,8.4471987
-52.0271080,9.7716162|47.7723365,11.6696691|51.1568795,7.0703360|50.8816719,12.1021729|52.7762429,9.0019126|51.6694630,14.5941523|50.2898144,9.1067417|53.0602511,10.5348898|50.8998989,6.9838693|49.6366295,8.4471987|48.0831436,11.8431966|50.3941875,11.0059454|50.5131935,13.0276643|49.4538645,7.3855687|48.7335476,11.6761576|51.2720908,9.9675982|50.7991070,12.4808782|50.9317594,6.9258104|48.8312116,13.5754012|49.3077946,9.6849447
-52.0271080,9.7716162|47.7723365,11.6696691|51.1568795,7.0703360|50.8816719,12.1021729|52.7762429,9.0019126|51.6694630,14.5941523|50.2898144,9.1067417|53.0602511,10.5348898|50.8998989,6.9838693|49.6366295,8.4471987|48.0831436,11.8431966|50.3941875,11.0059454|50.5131935,13.0276643|49.4538645,7.3855687|48.7335476,11.6761576|51.2720908,9.9675982|50.7991070,12.4808782|50.9317594,6.9258104|48.8312116,13.5754012|49.3077946,9.6849447|51.9506758,10.8248824|51.0337978,14.5539556|47.7536618,11.5716016|49.2266157,7.0223386|51.0638337,13.7467078|50.5860788,10.4167636|50.6506373,8.1798702|49.5108360,11.7194862|52.2229978,11.8198150|50.6182889,9.0670162|48.9974905,8.4769724|51.7507180,9.5213180|51.3846523,6.6838987|47.5179702,11.2836355|48.4439130,12.1430770|51.1216550,12.4885725|50.2938607,6.6598827|50.5381824,9.3766702|51.5422831,6.4416968|52.6935093,7.6157916|47.9382822,12.9350572|50.9995321,13.4553664|51.8530210,14.4068577|51.9704642,8.1702368|50.9502578,6.8033917|48.6233472,9.3281569|47.7375872,11.8573679|48.9854721,9.7857348|50.6515020,10.0174144|50.8667203,8.7227836|51.8627728,10.0272332|47.4914567,11.0831536|51.2399763,7.3565455|49.2422212,12.6728753|51.7516104,14.6184768|51.1506942,11.7986380|51.1226595,10.9275208|48.7092387,9.6336708|51.6227022,9.9530108|49.0216000,9.7456240|51.8530210,14.4068577|51.3536272,7.5451166|52.5562935,7.9199902|52.7825635,11.1048612|51.9549762,7.6198109|51.3873024,8.5963553|52.7201852,7.9397620|50.7201654,12.4799561|51.5734165,7.4024719|51.7862736,6.1581798|51.1703421,7.2623527|47.8864326,8.8135209|51.3288297,14.3416346|52.0271437,11.2237528|51.3577060,9.0414946|50.2179899,6.9118980|47.9469089,9.8773240|49.4711846,8.5088282|50.7336879,12.9280919|50.1420733,9.9986383|50.6722262,10.9736912|51.5351850,13.2888467|52.1042444,12.6786561|50.7079872,6.5462808|50.1052739,8.7100833|51.5388476,7.3180183|48.7274744,11.1486165|51.5325478,9.9266468|51.5142948,7.0970616|53.4519455,10.7710506|52.3787533,7.1244793|50.6940462,11.2297932|49.7539752,12.1961693|51.8462063,6.4379489|50.5331823,7.5005192|49.7697914,11.4058431|51.4585296,7.5588745|54.5370572,9.0163927|51.1267506,11.6465886|47.6891049,10.3106894
-49.2361782,6.9974266|51.0998769,17.0363061
-57.6911636,11.9510568|44.9341196,4.8875108|49.1999748,-0.4129867|45.3364277,4.1883602|41.8578681,14.8901462|41.4243135,-1.1483960|49.6995538,1.0686039|51.4045619,10.7374609|57.1712325,26.7497442|49.0934515,6.2341254
-57.6911636,11.9510568|44.9341196,4.8875108|49.1999748,-0.4129867|45.3364277,4.1883602|41.8578681,14.8901462|41.4243135,-1.1483960|49.6995538,1.0686039|51.4045619,10.7374609|57.1712325,26.7497442|49.0934515,6.2341254|58.4200190,15.5970309|49.6861131,12.2356132|50.4255432,6.8561424|50.0225956,12.0123039|60.4404309,15.8839231|49.1050781,6.0951413|44.4420148,-0.1149271|52.1511515,23.6916617|43.5154532,3.5111084|50.1505805,8.3750547
-57.6911636,11.9510568|44.9341196,4.8875108|49.1999748,-0.4129867|45.3364277,4.1883602|41.8578681,14.8901462|41.4243135,-1.1483960|49.6995538,1.0686039|51.4045619,10.7374609|57.1712325,26.7497442|49.0934515,6.2341254|58.4200190,15.5970309|49.6861131,12.2356132|50.4255432,6.8561424|50.0225956,12.0123039|60.4404309,15.8839231|49.1050781,6.0951413|44.4420148,-0.1149271|52.1511515,23.6916617|43.5154532,3.5111084|50.1505805,8.3750547|44.7410099,1.9462820|57.4060849,10.0298052|43.4374284,-3.8626251|44.6703687,-0.5021647|57.8328452,12.5606754|47.4247751,8.5601654|43.5368400,6.5401600|46.9448529,7.4383972|51.3562814,7.4773686|53.8332085,30.4023434|39.5535832,-0.3914096|45.1142241,1.5188902|53.9074326,10.7805201|48.3443194,13.4050148|46.5239102,19.2532732|47.9723558,13.8566140|51.4312637,6.7654620|48.9092981,18.3203849|43.4505111,-7.1816974|43.1801134,-2.6435011|49.3572746,9.3395967|54.8225541,28.6658357|40.2174403,-3.6538173|53.7141049,10.7863426|45.5764094,11.6036449|50.5150144,12.2940342|45.7082870,-0.5670960|44.2940784,2.7120933|42.9828139,11.9495387|52.2937314,21.0121946|46.7077472,17.5673398|43.2142188,2.5080337|52.2565309,17.0913909|49.0107117,14.0004210|49.8009187,7.9029767|50.8582294,10.8486091|49.7067016,-1.8641403|41.4468156,-8.4939864|52.1970095,5.4060122|47.7127435,2.6911701|50.0013329,10.1208447|41.2740325,-7.6422177|45.3921475,11.5865790|42.7999100,-6.9958475|49.1789192,9.5064920|48.6768194,6.7760373|40.2337867,-8.3286265|45.3239940,0.0741944|51.4731817,6.5000196|43.3398975,-3.8065067|50.3551050,4.2086472|46.6354600,10.9295900|45.0277706,15.1597518|50.7978860,18.9295174|50.6890833,3.1164382|50.9910417,3.3175907|47.2365741,-2.1178100|51.7655529,7.3900916|48.5416541,2.1754939|37.2912772,-5.9385585|48.5555909,9.3744020|50.2603521,9.5421242|46.1096714,12.1005669|42.6012243,-6.2321742|41.3645175,-3.6383665|47.5287266,5.0279369|45.4295989,4.6553817|45.9493803,-0.5588923|39.7401094,-8.8030793|48.5174800,7.6993387|50.1181194,14.1924719|43.2904477,6.1920553|50.7068545,6.7324622|49.6071155,2.0105298|49.9742937,14.6180857|49.6836817,10.4472971|43.7040255,-0.9192102|43.3341833,-5.8706662|39.6301003,-3.0720459|54.7732567,8.8577242"
-
-format="Connect time: %{time_connect} Time to first byte: %{time_starttransfer} Total time: %{time_total} \n"
-
-for request in $requests
-do
-	curl -w "$format" -o /dev/null -s "localhost:$1/routes?waypoints=$request"
-done
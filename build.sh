@@ -6,4 +6,5 @@ go install partition
 go install metric
 go install kdtreebuilder
 go install server
+go install replay
 go install drawcluster
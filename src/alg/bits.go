@@ -35,6 +35,10 @@ func SetBit(ary []byte, i uint) {
 	ary[i / 8] |= 1 << (i % 8)
 }
 
+func ClearBit(ary []byte, i uint) {
+	ary[i / 8] &^= 1 << (i % 8)
+}
+
 func Intersection(a, b []byte) []byte {
 	l := len(a)
 	if len(b) < l {
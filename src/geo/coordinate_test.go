@@ -19,15 +19,16 @@ package geo
 import (
 	"math"
 	"math/rand"
+	"reflect"
 	"testing"
 	"testing/quick"
 )
 
 // Generate random coordinates.
-func Generate(rand *rand.Rand, _ int) Coordinate {
+func (Coordinate) Generate(rand *rand.Rand, _ int) reflect.Value {
 	lng := rand.Float64() * 360.0 - 180.0
 	lat := rand.Float64() * 180.0 - 90.0
-	return Coordinate{lat, lng}
+	return reflect.ValueOf(Coordinate{lat, lng})
 }
 
 // Random tests for Encode/Decode.
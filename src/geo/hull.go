@@ -0,0 +1,70 @@
+/*
+ * Copyright 2014 Florian Benz, Steven Schäfer, Bernhard Schommer
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package geo
+
+import "sort"
+
+type byLngLat []Coordinate
+
+func (c byLngLat) Len() int      { return len(c) }
+func (c byLngLat) Swap(i, j int) { c[i], c[j] = c[j], c[i] }
+func (c byLngLat) Less(i, j int) bool {
+	if c[i].Lng != c[j].Lng {
+		return c[i].Lng < c[j].Lng
+	}
+	return c[i].Lat < c[j].Lat
+}
+
+// Cross product of the vectors o->a and o->b with longitude as the x-axis.
+// Positive for a counter-clockwise turn.
+func cross(o, a, b Coordinate) float64 {
+	return (a.Lng-o.Lng)*(b.Lat-o.Lat) - (a.Lat-o.Lat)*(b.Lng-o.Lng)
+}
+
+// ConvexHull computes the convex hull of the given points with Andrew's
+// monotone chain algorithm. The points are treated as planar (lng, lat)
+// coordinates, which is fine as long as the points do not wrap around the
+// antimeridian. The hull is returned in counter-clockwise order without
+// repeating the first point. The input slice is reordered.
+func ConvexHull(points []Coordinate) []Coordinate {
+	if len(points) < 3 {
+		hull := make([]Coordinate, len(points))
+		copy(hull, points)
+		return hull
+	}
+	sort.Sort(byLngLat(points))
+
+	hull := make([]Coordinate, 0, 2*len(points))
+	// Lower hull
+	for _, p := range points {
+		for len(hull) >= 2 && cross(hull[len(hull)-2], hull[len(hull)-1], p) <= 0 {
+			hull = hull[:len(hull)-1]
+		}
+		hull = append(hull, p)
+	}
+	// Upper hull
+	lower := len(hull) + 1
+	for i := len(points) - 2; i >= 0; i-- {
+		p := points[i]
+		for len(hull) >= lower && cross(hull[len(hull)-2], hull[len(hull)-1], p) <= 0 {
+			hull = hull[:len(hull)-1]
+		}
+		hull = append(hull, p)
+	}
+	// The last point is the first one again.
+	return hull[:len(hull)-1]
+}
@@ -0,0 +1,61 @@
+/*
+ * Copyright 2014 Florian Benz, Steven Schäfer, Bernhard Schommer
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package geo
+
+import (
+	"testing"
+	"testing/quick"
+)
+
+func TestConvexHullSquare(t *testing.T) {
+	points := []Coordinate{
+		{0, 0}, {1, 0}, {0.5, 0.5}, {1, 1}, {0, 1}, {0.2, 0.7}, {0, 0.5},
+	}
+	hull := ConvexHull(points)
+	if len(hull) != 4 {
+		t.Fatalf("Expected 4 hull points, got %v.", hull)
+	}
+	for i := range hull {
+		a, b, c := hull[i], hull[(i+1)%len(hull)], hull[(i+2)%len(hull)]
+		if cross(a, b, c) <= 0 {
+			t.Errorf("Hull %v is not counter-clockwise at %v.", hull, b)
+		}
+	}
+}
+
+// Every input point lies inside of or on the hull.
+func TestConvexHullContains(t *testing.T) {
+	contains := func(points []Coordinate) bool {
+		input := make([]Coordinate, len(points))
+		copy(input, points)
+		hull := ConvexHull(input)
+		if len(hull) < 3 {
+			return true
+		}
+		for _, p := range points {
+			for i := range hull {
+				if cross(hull[i], hull[(i+1)%len(hull)], p) < -1e-9 {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	if err := quick.Check(contains, nil); err != nil {
+		t.Error(err)
+	}
+}
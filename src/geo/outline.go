@@ -0,0 +1,201 @@
+/*
+ * Copyright 2014 Florian Benz, Steven Schäfer, Bernhard Schommer
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package geo
+
+import "math"
+
+// Upper bound for the number of grid cells of an outline. Larger grids are
+// coarsened by doubling the cell size.
+const maxOutlineCells = 1 << 22
+
+type outlineGrid struct {
+	width, height int
+	lat, lng      float64 // south west corner
+	cellLat       float64
+	cellLng       float64
+	cells         []bool
+}
+
+func (g *outlineGrid) cell(c Coordinate) (int, int) {
+	return int((c.Lng - g.lng) / g.cellLng), int((c.Lat - g.lat) / g.cellLat)
+}
+
+func (g *outlineGrid) corner(x, y int) Coordinate {
+	return Coordinate{Lat: g.lat + float64(y)*g.cellLat, Lng: g.lng + float64(x)*g.cellLng}
+}
+
+// Mark all cells crossed by the segment from a to b. Diagonal steps also
+// mark one of the two cells in between, so that a line always covers a
+// 4-connected set of cells.
+func (g *outlineGrid) markSegment(a, b Coordinate) {
+	px, py := g.cell(a)
+	g.cells[py*g.width+px] = true
+	steps := math.Max(math.Abs(b.Lng-a.Lng)/g.cellLng, math.Abs(b.Lat-a.Lat)/g.cellLat)
+	n := int(math.Ceil(2*steps)) + 1
+	for i := 1; i <= n; i++ {
+		t := float64(i) / float64(n)
+		x, y := g.cell(Coordinate{Lat: a.Lat + t*(b.Lat-a.Lat), Lng: a.Lng + t*(b.Lng-a.Lng)})
+		if x != px && y != py {
+			g.cells[py*g.width+x] = true
+		}
+		g.cells[y*g.width+x] = true
+		px, py = x, y
+	}
+}
+
+// Flood fill from the cell i over all 4-neighbors with cells[j] == value.
+func (g *outlineGrid) flood(i int, value bool) []bool {
+	visited := make([]bool, len(g.cells))
+	visited[i] = true
+	stack := []int{i}
+	for len(stack) > 0 {
+		i := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		x, y := i%g.width, i/g.width
+		neighbors := [4]int{-1, -1, -1, -1}
+		if x > 0 {
+			neighbors[0] = i - 1
+		}
+		if x < g.width-1 {
+			neighbors[1] = i + 1
+		}
+		if y > 0 {
+			neighbors[2] = i - g.width
+		}
+		if y < g.height-1 {
+			neighbors[3] = i + g.width
+		}
+		for _, j := range neighbors {
+			if j != -1 && !visited[j] && g.cells[j] == value {
+				visited[j] = true
+				stack = append(stack, j)
+			}
+		}
+	}
+	return visited
+}
+
+// Outline computes a concave outline of the given lines. The lines are
+// rasterized on a grid with the given cell size in meter, and the result is
+// the boundary of the cells which are connected to the cell of start, with
+// all enclosed holes filled. Unlike the convex hull, the outline follows
+// the lines into concave areas, up to the resolution of the grid. It is
+// returned in counter-clockwise order without repeating the first point.
+// As for ConvexHull, the lines must not wrap around the antimeridian.
+func Outline(lines [][]Coordinate, start Coordinate, cell float64) []Coordinate {
+	box := BBox{Min: start, Max: start}
+	for _, line := range lines {
+		for _, c := range line {
+			box.Min.Lat, box.Min.Lng = math.Min(box.Min.Lat, c.Lat), math.Min(box.Min.Lng, c.Lng)
+			box.Max.Lat, box.Max.Lng = math.Max(box.Max.Lat, c.Lat), math.Max(box.Max.Lng, c.Lng)
+		}
+	}
+
+	// Use a margin of one and a half cells, such that the border cells are
+	// empty and the extreme points do not lie on the outline.
+	g := &outlineGrid{cellLat: cell / (GreatCircleRadius * math.Pi / 180.0)}
+	for {
+		g.cellLng = g.cellLat / math.Max(math.Cos(start.Lat*math.Pi/180.0), 1e-3)
+		g.lat, g.lng = box.Min.Lat-1.5*g.cellLat, box.Min.Lng-1.5*g.cellLng
+		g.width = int((box.Max.Lng-box.Min.Lng)/g.cellLng) + 4
+		g.height = int((box.Max.Lat-box.Min.Lat)/g.cellLat) + 4
+		if g.width*g.height <= maxOutlineCells {
+			break
+		}
+		g.cellLat *= 2
+	}
+	g.cells = make([]bool, g.width*g.height)
+
+	for _, line := range lines {
+		for i := 0; i+1 < len(line); i++ {
+			g.markSegment(line[i], line[i+1])
+		}
+		if len(line) == 1 {
+			g.markSegment(line[0], line[0])
+		}
+	}
+	sx, sy := g.cell(start)
+	g.cells[sy*g.width+sx] = true
+
+	// The region consists of the component of start and everything which
+	// cannot be reached from the (empty) border without crossing it.
+	component := g.flood(sy*g.width+sx, true)
+	g.cells = component
+	outside := g.flood(0, false)
+	region := make([]bool, len(outside))
+	for i := range region {
+		region[i] = !outside[i]
+	}
+	return g.trace(region)
+}
+
+// Trace the boundary of a 4-connected region without holes, which has the
+// region on its left.
+func (g *outlineGrid) trace(region []bool) []Coordinate {
+	// Directed boundary edges between grid corners, indexed by the corner
+	// they start at. Since the region is 4-connected and has no holes, every
+	// corner has at most one outgoing edge.
+	stride := g.width + 1
+	next := make(map[int]int)
+	first := -1
+	for i, inside := range region {
+		if !inside {
+			continue
+		}
+		x, y := i%g.width, i/g.width
+		sw, se := y*stride+x, y*stride+x+1
+		nw, ne := sw+stride, se+stride
+		if !region[i-g.width] {
+			next[sw] = se
+			if first == -1 {
+				first = sw
+			}
+		}
+		if !region[i+1] {
+			next[se] = ne
+		}
+		if !region[i+g.width] {
+			next[ne] = nw
+		}
+		if !region[i-1] {
+			next[nw] = sw
+		}
+	}
+
+	// Only keep the corners at which the outline changes its direction.
+	result := []Coordinate(nil)
+	v := first
+	for {
+		prev, w := v, next[v]
+		for {
+			u := next[w]
+			if u-w != w-prev {
+				break
+			}
+			prev, w = w, u
+		}
+		result = append(result, g.corner(w%stride, w/stride))
+		v = w
+		if v == first || len(result) > len(next) {
+			break
+		}
+		if _, ok := next[v]; !ok {
+			break
+		}
+	}
+	return result
+}
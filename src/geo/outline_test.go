@@ -0,0 +1,97 @@
+/*
+ * Copyright 2014 Florian Benz, Steven Schäfer, Bernhard Schommer
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package geo
+
+import "testing"
+
+// Even-odd rule with longitude as the x-axis.
+func insidePolygon(polygon []Coordinate, p Coordinate) bool {
+	inside := false
+	for i := range polygon {
+		a, b := polygon[i], polygon[(i+1)%len(polygon)]
+		if (a.Lat > p.Lat) != (b.Lat > p.Lat) &&
+			p.Lng < a.Lng+(p.Lat-a.Lat)*(b.Lng-a.Lng)/(b.Lat-a.Lat) {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+func signedArea(polygon []Coordinate) float64 {
+	area := 0.0
+	for i := range polygon {
+		a, b := polygon[i], polygon[(i+1)%len(polygon)]
+		area += a.Lng*b.Lat - b.Lng*a.Lat
+	}
+	return area / 2
+}
+
+func TestOutlineConcave(t *testing.T) {
+	// A U-shape, the notch is inside of the convex hull.
+	lines := [][]Coordinate{
+		{{49.01, 7.0}, {49.0, 7.0}},
+		{{49.0, 7.0}, {49.0, 7.005}, {49.0, 7.01}},
+		{{49.0, 7.01}, {49.01, 7.01}},
+	}
+	outline := Outline(lines, Coordinate{49.0, 7.005}, 50)
+	if len(outline) < 8 {
+		t.Fatalf("Expected a concave outline, got %v.", outline)
+	}
+	if signedArea(outline) <= 0 {
+		t.Errorf("Outline %v is not counter-clockwise.", outline)
+	}
+	for _, line := range lines {
+		for _, p := range line {
+			if !insidePolygon(outline, p) {
+				t.Errorf("Point %v is not inside of the outline %v.", p, outline)
+			}
+		}
+	}
+	if notch := (Coordinate{49.007, 7.005}); insidePolygon(outline, notch) {
+		t.Errorf("The notch %v is inside of the outline %v.", notch, outline)
+	}
+	if p := (Coordinate{49.02, 7.005}); insidePolygon(outline, p) {
+		t.Errorf("Point %v is inside of the outline %v.", p, outline)
+	}
+}
+
+func TestOutlineHoles(t *testing.T) {
+	// A closed ring encloses its interior, and lines which are not
+	// connected to the start are ignored.
+	lines := [][]Coordinate{
+		{{49.0, 7.0}, {49.0, 7.01}, {49.01, 7.01}, {49.01, 7.0}, {49.0, 7.0}},
+		{{49.05, 7.05}, {49.06, 7.05}},
+	}
+	outline := Outline(lines, Coordinate{49.0, 7.0}, 50)
+	if len(outline) != 4 {
+		t.Fatalf("Expected a rectangle, got %v.", outline)
+	}
+	if p := (Coordinate{49.005, 7.005}); !insidePolygon(outline, p) {
+		t.Errorf("Point %v is not inside of the outline %v.", p, outline)
+	}
+	if p := (Coordinate{49.055, 7.05}); insidePolygon(outline, p) {
+		t.Errorf("Point %v is inside of the outline %v.", p, outline)
+	}
+}
+
+func TestOutlinePoint(t *testing.T) {
+	start := Coordinate{49.0, 7.0}
+	outline := Outline(nil, start, 50)
+	if len(outline) != 4 || !insidePolygon(outline, start) {
+		t.Errorf("Expected a single cell around %v, got %v.", start, outline)
+	}
+}
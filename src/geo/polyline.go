@@ -0,0 +1,155 @@
+/*
+ * Copyright 2014 Florian Benz, Steven Schäfer, Bernhard Schommer
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package geo
+
+// Google's encoded polyline format, see
+// https://developers.google.com/maps/documentation/utilities/polylinealgorithm
+// The coordinates are rounded to the given number of decimal digits (5 in
+// the original format, 6 for polyline6), then the differences between
+// consecutive coordinates are written as zigzag encoded varints in 5 bit
+// chunks, each chunk offset by 63 to make it printable.
+
+import (
+	"errors"
+	"math"
+)
+
+func polylineFactor(precision int) float64 {
+	return math.Pow(10, float64(precision))
+}
+
+func appendPolylineValue(buf []byte, value int64) []byte {
+	value <<= 1
+	if value < 0 {
+		value = ^value
+	}
+	for value >= 0x20 {
+		buf = append(buf, byte((0x20|(value&0x1f))+63))
+		value >>= 5
+	}
+	return append(buf, byte(value+63))
+}
+
+func EncodePolyline(cs []Coordinate, precision int) string {
+	factor := polylineFactor(precision)
+	buf := make([]byte, 0, 6*len(cs))
+	prevLat, prevLng := int64(0), int64(0)
+	for _, c := range cs {
+		lat := int64(math.Floor(c.Lat*factor + 0.5))
+		lng := int64(math.Floor(c.Lng*factor + 0.5))
+		buf = appendPolylineValue(buf, lat-prevLat)
+		buf = appendPolylineValue(buf, lng-prevLng)
+		prevLat, prevLng = lat, lng
+	}
+	return string(buf)
+}
+
+func decodePolylineValue(s string, i int) (int64, int, error) {
+	result, shift := int64(0), uint(0)
+	for {
+		if i >= len(s) {
+			return 0, i, errors.New("truncated polyline")
+		}
+		b := int64(s[i]) - 63
+		i++
+		if b < 0 || b > 0x3f {
+			return 0, i, errors.New("invalid character in polyline")
+		}
+		result |= (b & 0x1f) << shift
+		shift += 5
+		if b < 0x20 {
+			break
+		}
+	}
+	if result&1 != 0 {
+		return ^(result >> 1), i, nil
+	}
+	return result >> 1, i, nil
+}
+
+func DecodePolyline(s string, precision int) ([]Coordinate, error) {
+	factor := polylineFactor(precision)
+	result := []Coordinate(nil)
+	lat, lng := int64(0), int64(0)
+	for i := 0; i < len(s); {
+		var dlat, dlng int64
+		var err error
+		dlat, i, err = decodePolylineValue(s, i)
+		if err != nil {
+			return nil, err
+		}
+		dlng, i, err = decodePolylineValue(s, i)
+		if err != nil {
+			return nil, err
+		}
+		lat += dlat
+		lng += dlng
+		result = append(result, Coordinate{float64(lat) / factor, float64(lng) / factor})
+	}
+	return result, nil
+}
+
+// Approximate distance in meter between p and the segment from a to b,
+// using an equirectangular projection around a.
+func segmentDistance(p, a, b Coordinate) float64 {
+	scale := math.Cos(a.Lat * math.Pi / 180.0)
+	bx, by := (b.Lng-a.Lng)*scale, b.Lat-a.Lat
+	px, py := (p.Lng-a.Lng)*scale, p.Lat-a.Lat
+	t := 0.0
+	if length := bx*bx + by*by; length > 0 {
+		t = math.Max(0, math.Min(1, (px*bx+py*by)/length))
+	}
+	dx, dy := px-t*bx, py-t*by
+	return GreatCircleRadius * math.Sqrt(dx*dx+dy*dy) * math.Pi / 180.0
+}
+
+// SimplifyPolyline removes points with the Douglas-Peucker algorithm, such
+// that the result deviates at most tolerance meter from the input. The first
+// and the last point are always kept.
+func SimplifyPolyline(cs []Coordinate, tolerance float64) []Coordinate {
+	if len(cs) <= 2 {
+		return cs
+	}
+	keep := make([]bool, len(cs))
+	keep[0], keep[len(cs)-1] = true, true
+
+	// Use an explicit stack, the polylines of long routes are too large
+	// for recursion.
+	stack := [][2]int{{0, len(cs) - 1}}
+	for len(stack) > 0 {
+		first, last := stack[len(stack)-1][0], stack[len(stack)-1][1]
+		stack = stack[:len(stack)-1]
+		index, max := -1, tolerance
+		for i := first + 1; i < last; i++ {
+			if d := segmentDistance(cs[i], cs[first], cs[last]); d > max {
+				index, max = i, d
+			}
+		}
+		if index != -1 {
+			keep[index] = true
+			stack = append(stack, [2]int{first, index}, [2]int{index, last})
+		}
+	}
+
+	result := []Coordinate(nil)
+	for i, c := range cs {
+		if keep[i] {
+			result = append(result, c)
+		}
+	}
+	return result
+}
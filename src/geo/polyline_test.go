@@ -0,0 +1,71 @@
+/*
+ * Copyright 2014 Florian Benz, Steven Schäfer, Bernhard Schommer
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package geo
+
+import (
+	"math"
+	"testing"
+	"testing/quick"
+)
+
+// The example from the documentation of the format.
+func TestEncodePolylineExample(t *testing.T) {
+	cs := []Coordinate{{38.5, -120.2}, {40.7, -120.95}, {43.252, -126.453}}
+	expected := "_p~iF~ps|U_ulLnnqC_mqNvxq`@"
+	if s := EncodePolyline(cs, 5); s != expected {
+		t.Errorf("Expected %v, got %v.", expected, s)
+	}
+}
+
+func TestPolylineEncodeDecode(t *testing.T) {
+	for _, precision := range []int{5, 6} {
+		epsilon := 0.5 / polylineFactor(precision)
+		identity := func(cs []Coordinate) bool {
+			decoded, err := DecodePolyline(EncodePolyline(cs, precision), precision)
+			if err != nil || len(decoded) != len(cs) {
+				return false
+			}
+			for i := range cs {
+				if math.Abs(cs[i].Lat-decoded[i].Lat) > epsilon+1e-9 ||
+					math.Abs(cs[i].Lng-decoded[i].Lng) > epsilon+1e-9 {
+					return false
+				}
+			}
+			return true
+		}
+		if err := quick.Check(identity, nil); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestSimplifyPolyline(t *testing.T) {
+	// Points on a straight line are removed, the corner is kept.
+	cs := []Coordinate{
+		{48.0, 9.0}, {48.0, 9.001}, {48.0, 9.002}, {48.01, 9.002}, {48.02, 9.002},
+	}
+	simplified := SimplifyPolyline(cs, 1.0)
+	expected := []Coordinate{cs[0], cs[2], cs[4]}
+	if len(simplified) != len(expected) {
+		t.Fatalf("Expected %v, got %v.", expected, simplified)
+	}
+	for i := range expected {
+		if simplified[i] != expected[i] {
+			t.Errorf("Expected %v, got %v.", expected, simplified)
+		}
+	}
+}
@@ -27,7 +27,7 @@ func TestStepEncodeDecode(t *testing.T) {
 	embedProject := func(start Coordinate, step []Coordinate) bool {
 		// Encode it and Decode it again
 		encoding := EncodeStep(start, step)
-		decoded  := DecodeStep(start, encoding)
+		decoded  := DecodeStep(start, encoding, nil)
 		for i, _ := range step {
 			if !step[i].Equal(decoded[i]) {
 				return false
@@ -0,0 +1,107 @@
+/*
+ * Copyright 2014 Florian Benz, Steven Schäfer, Bernhard Schommer
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// GeoJSON objects (http://geojson.org/geojson-spec.html) for JSON encoding
+//
+// Note that GeoJSON positions are given as [longitude, latitude], while the
+// rest of the code base uses (latitude, longitude).
+
+package geojson
+
+import "geo"
+
+const (
+	TypeFeatureCollection = "FeatureCollection"
+	TypeFeature           = "Feature"
+	TypePoint             = "Point"
+	TypeLineString        = "LineString"
+	TypeMultiLineString   = "MultiLineString"
+	TypePolygon           = "Polygon"
+)
+
+type Position []float64
+
+type Geometry struct {
+	Type        string      `json:"type"`
+	Coordinates interface{} `json:"coordinates"`
+}
+
+type Feature struct {
+	Type       string                 `json:"type"`
+	Geometry   *Geometry              `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+type FeatureCollection struct {
+	Type     string     `json:"type"`
+	Features []*Feature `json:"features"`
+}
+
+func NewPosition(c geo.Coordinate) Position {
+	return Position{c.Lng, c.Lat}
+}
+
+func NewPositions(cs []geo.Coordinate) []Position {
+	positions := make([]Position, len(cs))
+	for i, c := range cs {
+		positions[i] = NewPosition(c)
+	}
+	return positions
+}
+
+func NewPoint(c geo.Coordinate) *Geometry {
+	return &Geometry{Type: TypePoint, Coordinates: NewPosition(c)}
+}
+
+func NewLineString(cs []geo.Coordinate) *Geometry {
+	return &Geometry{Type: TypeLineString, Coordinates: NewPositions(cs)}
+}
+
+func NewMultiLineString(lines [][]geo.Coordinate) *Geometry {
+	coordinates := make([][]Position, len(lines))
+	for i, line := range lines {
+		coordinates[i] = NewPositions(line)
+	}
+	return &Geometry{Type: TypeMultiLineString, Coordinates: coordinates}
+}
+
+// NewPolygon expects closed rings, the first one being the outer boundary.
+func NewPolygon(rings [][]geo.Coordinate) *Geometry {
+	coordinates := make([][]Position, len(rings))
+	for i, ring := range rings {
+		coordinates[i] = NewPositions(ring)
+	}
+	return &Geometry{Type: TypePolygon, Coordinates: coordinates}
+}
+
+func NewFeature(g *Geometry) *Feature {
+	return &Feature{
+		Type:       TypeFeature,
+		Geometry:   g,
+		Properties: make(map[string]interface{}),
+	}
+}
+
+func NewFeatureCollection() *FeatureCollection {
+	return &FeatureCollection{
+		Type:     TypeFeatureCollection,
+		Features: []*Feature{},
+	}
+}
+
+func (c *FeatureCollection) AddFeature(f *Feature) {
+	c.Features = append(c.Features, f)
+}
@@ -0,0 +1,44 @@
+/*
+ * Copyright 2014 Florian Benz, Steven Schäfer, Bernhard Schommer
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package geojson
+
+import (
+	"encoding/json"
+	"geo"
+	"testing"
+)
+
+func TestFeatureCollectionEncoding(t *testing.T) {
+	c := NewFeatureCollection()
+	f := NewFeature(NewLineString([]geo.Coordinate{
+		{Lat: 48.5, Lng: 9.0},
+		{Lat: 48.6, Lng: 9.1},
+	}))
+	f.Properties["name"] = "leg"
+	c.AddFeature(f)
+
+	encoded, err := json.Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"type":"FeatureCollection","features":[{"type":"Feature",` +
+		`"geometry":{"type":"LineString","coordinates":[[9,48.5],[9.1,48.6]]},` +
+		`"properties":{"name":"leg"}}]}`
+	if string(encoded) != expected {
+		t.Errorf("Expected %v, got %v.", expected, string(encoded))
+	}
+}
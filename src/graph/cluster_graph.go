@@ -17,6 +17,7 @@
 package graph
 
 import (
+	"errors"
 	"fmt"
 	"path"
 )
@@ -37,9 +38,83 @@ func OpenClusterGraph(base string, loadMatrices bool) (*ClusterGraph, error) {
 		clusterDir := fmt.Sprintf("/cluster%d", i+1)
 		g, err := OpenGraphFile(path.Join(base, clusterDir), false /* ignoreErrors */)
 		if err != nil {
+			// Do not leak the files opened so far, the server may keep
+			// running with another graph.
+			CloseClusterGraph(&ClusterGraph{Overlay: overlay, Cluster: cluster[:i]})
 			return nil, err
 		}
 		cluster[i] = g
 	}
-	return &ClusterGraph{Overlay: overlay, Cluster: cluster}, nil
+	g := &ClusterGraph{Overlay: overlay, Cluster: cluster}
+
+	// The matrices include the turn costs, so we have to use the same ones.
+	costs, err := ReadTurnCosts(base)
+	if err != nil {
+		CloseClusterGraph(g)
+		return nil, err
+	}
+	if costs != nil {
+		g.SetTurnCosts(costs)
+	}
+	return g, nil
+}
+
+// CloseClusterGraph unmaps all files of the graph, which must not be used
+// afterwards.
+func CloseClusterGraph(g *ClusterGraph) error {
+	var result error
+	for _, cluster := range g.Cluster {
+		if err := CloseGraphFile(cluster); err != nil && result == nil {
+			result = err
+		}
+	}
+	if err := CloseOverlay(g.Overlay); err != nil && result == nil {
+		result = err
+	}
+	return result
+}
+
+// MappedSize returns the size in bytes of all memory mapped files.
+func (g *ClusterGraph) MappedSize() int {
+	size := g.Overlay.MappedSize()
+	for _, cluster := range g.Cluster {
+		size += cluster.MappedSize()
+	}
+	return size
+}
+
+// Validate does some cheap consistency checks between the overlay graph,
+// the cluster graphs and the matrices.
+func (g *ClusterGraph) Validate() error {
+	overlay := g.Overlay
+	if len(overlay.Cluster) == 0 || int(overlay.Cluster[len(overlay.Cluster)-1]) != overlay.VertexCount() {
+		return errors.New("partition does not match the overlay vertex count")
+	}
+	if len(g.Cluster) != overlay.ClusterCount() {
+		return errors.New("number of clusters does not match the partition")
+	}
+	graphs := append([]*GraphFile{overlay.GraphFile}, g.Cluster...)
+	for i, cluster := range graphs {
+		if len(cluster.Coordinates) != 2*cluster.VertexCount() ||
+			len(cluster.FirstOut) != cluster.VertexCount()+1 ||
+			len(cluster.Edges) != cluster.EdgeCount() ||
+			len(cluster.NextIn) != cluster.EdgeCount() ||
+			len(cluster.Distances) != cluster.EdgeCount() {
+			return fmt.Errorf("inconsistent file sizes in graph %d", i)
+		}
+		if i > 0 && cluster.VertexCount() < overlay.ClusterSize(i-1) {
+			return fmt.Errorf("cluster %d has less vertices than boundary vertices", i)
+		}
+	}
+	for t := range overlay.Matrices {
+		for m := range overlay.Matrices[t] {
+			if overlay.Matrices[t][m] == nil && Metric(m).AvoidsFerries() {
+				continue
+			}
+			if len(overlay.Matrices[t][m]) != overlay.ClusterEdgeCount {
+				return fmt.Errorf("matrix for transport %d and metric %d has the wrong size", t+1, m+1)
+			}
+		}
+	}
+	return nil
 }
@@ -0,0 +1,362 @@
+/*
+ * Copyright 2014 Florian Benz, Steven Schäfer, Bernhard Schommer
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package graph
+
+import (
+	"alg"
+	"sort"
+	"time"
+)
+
+// Conditional restrictions
+//
+// Some restrictions only apply at certain times of the week, e.g., a road
+// which is closed for cars during the rush hour or a lower speed limit at
+// night. The file conditions.ftf (optional) stores one record per condition:
+//
+//   header, edge, value, time windows...
+//
+// The header contains the transport modes in the lowest 8 bits (bit 1 << t
+// for transport t), the maxspeed flag in bit 8 and the number of time
+// windows in the upper 16 bits. The value is the speed in km/h for a
+// maxspeed condition and otherwise 1 if the edge is open during the time
+// windows and 0 if it is closed. Every time window is packed into one word:
+// the days in the lowest 7 bits (bit 0 for Monday), followed by the first
+// and the last minute of the day with 12 bits each. A window which ends
+// before it starts continues over midnight. If several conditions of an
+// edge apply at the same time, the last one wins.
+//
+// The cluster matrices cannot depend on the time, so the searches without a
+// departure time ignore the conditions which only apply at some times (see
+// AccessStatic) and always use the static maxspeed. A search which knows the
+// moment at which it reaches a vertex evaluates the conditions of the
+// cluster edges instead, see StateNeighborsAt, and replaces the shortcuts of
+// the clusters which are TimeDependent by their cluster edges.
+
+const (
+	conditionMaxSpeed  = 1 << 8
+	conditionSizeShift = 16
+	windowDaysMask     = 0x7f
+	windowFromShift    = 7
+	windowToShift      = 19
+	windowMinuteMask   = 0xfff
+	MinutesPerWeek     = 7 * 24 * 60
+)
+
+// A Moment is a time of the week in minutes since Monday 00:00, which is all
+// that the conditions depend on. Static stands for an unknown time.
+type Moment int
+
+const Static Moment = -1
+
+// A time window on some days of the week, see osm.TimeRange.
+type TimeWindow struct {
+	Days     uint8 // bit 0 for Monday
+	From, To int   // minutes after midnight
+}
+
+type Condition struct {
+	Transports uint8 // bit 1 << t is set if the condition applies to transport t
+	Edge       Edge
+	Open       bool // access during the time windows, unless this is a maxspeed condition
+	MaxSpeed   int  // maxspeed in km/h during the time windows, or 0
+	Windows    []TimeWindow
+}
+
+// A TimedGraph evaluates the conditions at the moment at which the search
+// reaches a vertex.
+type TimedGraph interface {
+	VertexNeighborsAt(Vertex, bool, Transport, Metric, Moment, []Dart) []Dart
+}
+
+// MomentOf returns the moment of the time t, in the time zone of t.
+func MomentOf(t time.Time) Moment {
+	day := (int(t.Weekday()) + 6) % 7
+	return Moment(day*24*60 + t.Hour()*60 + t.Minute())
+}
+
+// After returns the moment the given number of seconds later.
+func (m Moment) After(seconds float64) Moment {
+	if m == Static {
+		return Static
+	}
+	return Moment((int(m) + int(seconds/60)) % MinutesPerWeek)
+}
+
+// Average speeds in m/s, which estimate the travel time in the Distance
+// metrics.
+var AverageSpeed = [TransportMax]float64{Car: 50 / 3.6, Bike: 15 / 3.6, Foot: 5 / 3.6}
+
+// Arrival returns the moment at which a search with transport t, which
+// started at the moment m, reaches a vertex with the distance dist in the
+// metric metric. The Distance metrics do not tell us the travel time, so we
+// estimate it with the AverageSpeed.
+func (m Moment) Arrival(dist float32, t Transport, metric Metric) Moment {
+	if metric.Base() != Time {
+		return m.After(float64(dist) / AverageSpeed[t])
+	}
+	return m.After(float64(dist) * SecondsPerTimeUnit)
+}
+
+func (w TimeWindow) Contains(m Moment) bool {
+	today := uint(int(m) / (24 * 60))
+	yesterday := (today + 6) % 7
+	minute := int(m) % (24 * 60)
+	if w.From < w.To {
+		return w.Days&(1<<today) != 0 && minute >= w.From && minute < w.To
+	}
+	return w.Days&(1<<today) != 0 && minute >= w.From ||
+		w.Days&(1<<yesterday) != 0 && minute < w.To
+}
+
+func (c Condition) Applies(t Transport) bool {
+	return c.Transports&(1<<uint(t)) != 0
+}
+
+// Always returns true if the time windows cover the whole week, e.g. for
+// 24/7.
+func (c Condition) Always() bool {
+	days := uint8(0)
+	for _, w := range c.Windows {
+		if w.From == 0 && w.To >= 24*60 {
+			days |= w.Days
+		}
+	}
+	return days&windowDaysMask == windowDaysMask
+}
+
+// ActiveAt returns true if one of the time windows contains the moment m.
+func (c Condition) ActiveAt(m Moment) bool {
+	for _, w := range c.Windows {
+		if w.Contains(m) {
+			return true
+		}
+	}
+	return false
+}
+
+// DecodeConditions returns the conditions stored in a conditions.ftf file.
+func DecodeConditions(data []uint32) []Condition {
+	result := []Condition(nil)
+	for i := 0; i+2 < len(data); {
+		header := data[i]
+		n := int(header >> conditionSizeShift)
+		if i+3+n > len(data) {
+			break // truncated file
+		}
+		c := Condition{
+			Transports: uint8(header),
+			Edge:       Edge(data[i+1]),
+			Windows:    make([]TimeWindow, n),
+		}
+		if header&conditionMaxSpeed != 0 {
+			c.MaxSpeed = int(data[i+2])
+		} else {
+			c.Open = data[i+2] != 0
+		}
+		for j := range c.Windows {
+			w := data[i+3+j]
+			c.Windows[j] = TimeWindow{
+				Days: uint8(w & windowDaysMask),
+				From: int(w >> windowFromShift & windowMinuteMask),
+				To:   int(w >> windowToShift & windowMinuteMask),
+			}
+		}
+		result = append(result, c)
+		i += 3 + n
+	}
+	return result
+}
+
+// EncodeConditions is the inverse of DecodeConditions.
+func EncodeConditions(conditions []Condition) []uint32 {
+	result := []uint32(nil)
+	for _, c := range conditions {
+		header := uint32(c.Transports) | uint32(len(c.Windows))<<conditionSizeShift
+		value := uint32(0)
+		if c.MaxSpeed != 0 {
+			header |= conditionMaxSpeed
+			value = uint32(c.MaxSpeed)
+		} else if c.Open {
+			value = 1
+		}
+		result = append(result, header, uint32(c.Edge), value)
+		for _, w := range c.Windows {
+			result = append(result, uint32(w.Days)&windowDaysMask|
+				uint32(w.From)<<windowFromShift|uint32(w.To)<<windowToShift)
+		}
+	}
+	return result
+}
+
+type byEdge []Condition
+
+func (c byEdge) Len() int           { return len(c) }
+func (c byEdge) Swap(i, j int)      { c[i], c[j] = c[j], c[i] }
+func (c byEdge) Less(i, j int) bool { return c[i].Edge < c[j].Edge }
+
+// The conditions sorted by their edge, computed when the graph is opened.
+type conditionIndex struct {
+	conditions []Condition
+	edges      []byte // bit vector of the edges with a condition
+}
+
+func computeConditionIndex(g *GraphFile) {
+	g.conditions = conditionIndex{}
+	if len(g.Conditions) == 0 {
+		return
+	}
+	conditions := []Condition(nil)
+	for _, c := range DecodeConditions(g.Conditions) {
+		if int(c.Edge) < g.EdgeCount() {
+			conditions = append(conditions, c)
+		}
+	}
+	sort.Stable(byEdge(conditions))
+	edges := make([]byte, (g.EdgeCount()+7)/8)
+	for _, c := range conditions {
+		alg.SetBit(edges, uint(c.Edge))
+	}
+	g.conditions = conditionIndex{conditions, edges}
+}
+
+// Compute AccessStatic and AccessNoFerries: AccessEdge with the access
+// conditions which apply at all times, and the same without the ferries.
+func computeSearchAccess(g *GraphFile) {
+	for t := range g.AccessEdge {
+		static := g.AccessEdge[t]
+		copied := false
+		for _, c := range g.conditions.conditions {
+			if c.MaxSpeed != 0 || !c.Applies(Transport(t)) || !c.Always() {
+				continue
+			}
+			if !copied {
+				static = append([]byte(nil), static...)
+				copied = true
+			}
+			if c.Open {
+				alg.SetBit(static, uint(c.Edge))
+			} else {
+				alg.ClearBit(static, uint(c.Edge))
+			}
+		}
+		g.AccessStatic[t] = static
+
+		access := make([]byte, len(static))
+		for i, b := range static {
+			if i < len(g.Ferries) {
+				b &^= g.Ferries[i]
+			}
+			access[i] = b
+		}
+		g.AccessNoFerries[t] = access
+	}
+}
+
+// SetConditions replaces the conditions of g, e.g., for a graph which is
+// built in memory.
+func (g *GraphFile) SetConditions(conditions []Condition) {
+	g.Conditions = EncodeConditions(conditions)
+	computeConditionIndex(g)
+	computeSearchAccess(g)
+}
+
+// EdgeConditions returns the conditions of the edge e.
+func (g *GraphFile) EdgeConditions(e Edge) []Condition {
+	if !g.EdgeConditional(e) {
+		return nil
+	}
+	conditions := g.conditions.conditions
+	first := sort.Search(len(conditions), func(i int) bool { return conditions[i].Edge >= e })
+	last := first
+	for last < len(conditions) && conditions[last].Edge == e {
+		last++
+	}
+	return conditions[first:last]
+}
+
+// EdgeConditional returns true if some condition applies to the edge e.
+func (g *GraphFile) EdgeConditional(e Edge) bool {
+	edges := g.conditions.edges
+	return edges != nil && alg.GetBit(edges, uint(e))
+}
+
+// TimeDependent returns true if a search with transport t in the metric m
+// depends on the time on some edge of g, i.e., if an access condition only
+// applies at some times or a maxspeed condition changes the travel time.
+func (g *GraphFile) TimeDependent(t Transport, m Metric) bool {
+	for _, c := range g.conditions.conditions {
+		if !c.Applies(t) {
+			continue
+		}
+		if c.MaxSpeed == 0 && !c.Always() || c.MaxSpeed != 0 && m.Base() == Time {
+			return true
+		}
+	}
+	return false
+}
+
+// EdgeOpenAt returns true if the edge e is accessible with transport t at
+// the moment m. For Static, only the conditions which always apply count.
+func (g *GraphFile) EdgeOpenAt(e Edge, t Transport, m Moment) bool {
+	if m == Static {
+		return alg.GetBit(g.AccessStatic[t], uint(e))
+	}
+	open := alg.GetBit(g.AccessEdge[t], uint(e))
+	for _, c := range g.EdgeConditions(e) {
+		if c.MaxSpeed == 0 && c.Applies(t) && c.ActiveAt(m) {
+			open = c.Open
+		}
+	}
+	return open
+}
+
+// EdgeMaxSpeedAt returns the maxspeed of the edge e for transport t at the
+// moment m, in km/h.
+func (g *GraphFile) EdgeMaxSpeedAt(e Edge, t Transport, m Moment) int {
+	speed := g.EdgeMaxSpeed(e)
+	if m == Static {
+		return speed
+	}
+	for _, c := range g.EdgeConditions(e) {
+		if c.MaxSpeed != 0 && c.Applies(t) && c.ActiveAt(m) {
+			speed = c.MaxSpeed
+		}
+	}
+	return speed
+}
+
+// Returns true if the edge e can be used to leave (forward) or to reach the
+// vertex v at the moment m, see edgeUsable.
+func (g *GraphFile) edgeUsableAt(e Edge, v Vertex, forward bool, t Transport, m Metric, access []byte, at Moment) bool {
+	if at == Static || !g.EdgeConditional(e) {
+		return g.edgeUsable(e, v, forward, t, access)
+	}
+	if !g.EdgeOpenAt(e, t, at) || m.AvoidsFerries() && g.EdgeFerry(e) {
+		return false
+	}
+	return g.edgeDirectionUsable(e, v, forward, t)
+}
+
+// The weight of the edge e with the maxspeed at the moment at.
+func (g *GraphFile) edgeWeightAt(e Edge, t Transport, m Metric, at Moment) float32 {
+	weight := g.EdgeWeight32(e, t, m)
+	if at == Static || m.Base() != Time || !g.EdgeConditional(e) {
+		return weight
+	}
+	return weight * float32(g.EdgeMaxSpeed(e)) / float32(g.EdgeMaxSpeedAt(e, t, at))
+}
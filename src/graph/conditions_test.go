@@ -0,0 +1,147 @@
+/*
+ * Copyright 2014 Florian Benz, Steven Schäfer, Bernhard Schommer
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package graph
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestConditionEncoding(t *testing.T) {
+	conditions := []Condition{
+		{Transports: 1 << uint(Car), Edge: 3, Windows: []TimeWindow{{0x1f, 420, 540}, {0x60, 1320, 360}}},
+		{Transports: 7, Edge: 1, Open: true, Windows: []TimeWindow{{0x7f, 0, 1440}}},
+		{Transports: 7, Edge: 2, MaxSpeed: 30, Windows: []TimeWindow{{0x01, 0, 60}}},
+	}
+	decoded := DecodeConditions(EncodeConditions(conditions))
+	if !reflect.DeepEqual(decoded, conditions) {
+		t.Errorf("got %v, expected %v", decoded, conditions)
+	}
+}
+
+func TestMoment(t *testing.T) {
+	// 2014-06-02 was a Monday.
+	if m := MomentOf(time.Date(2014, 6, 2, 7, 30, 0, 0, time.UTC)); m != 450 {
+		t.Errorf("got %v for Monday 07:30", m)
+	}
+	sunday := MomentOf(time.Date(2014, 6, 8, 23, 59, 0, 0, time.UTC))
+	if sunday != MinutesPerWeek-1 {
+		t.Errorf("got %v for Sunday 23:59", sunday)
+	}
+	if m := sunday.After(120); m != 1 {
+		t.Errorf("got %v two minutes after Sunday 23:59", m)
+	}
+	if m := Moment(0).Arrival(100, Car, Time); m != 6 {
+		t.Errorf("got %v for the arrival after 360 seconds", m)
+	}
+	// 1 km on foot takes 12 minutes at the average speed.
+	if m := Moment(0).Arrival(1000, Foot, Distance); m != 12 {
+		t.Errorf("got %v for the arrival in the Distance metric", m)
+	}
+
+	// Saturday night until Sunday morning
+	w := TimeWindow{Days: 0x20, From: 1320, To: 360}
+	for m, contains := range map[Moment]bool{
+		5*1440 + 1380: true, 6*1440 + 60: true, 6*1440 + 1380: false, 60: false,
+	} {
+		if w.Contains(m) != contains {
+			t.Errorf("Contains(%v) should be %t", m, contains)
+		}
+	}
+}
+
+func TestStateNeighborsAt(t *testing.T) {
+	// The edge 0 -> 2 is closed for cars in the morning rush hour and the
+	// ferry 0 -> 1 is slower at night.
+	g := ferryGraph()
+	g.Conditions = EncodeConditions([]Condition{
+		{Transports: 1 << uint(Car), Edge: 1, Windows: []TimeWindow{{0x1f, 420, 540}}},
+		{Transports: 7, Edge: 0, MaxSpeed: 5, Windows: []TimeWindow{{0x7f, 1320, 360}}},
+	})
+	computeConditionIndex(g)
+	computeSearchAccess(g)
+
+	count := func(darts []Dart, v Vertex) int {
+		n := 0
+		for _, d := range darts {
+			if d.Vertex == v {
+				n++
+			}
+		}
+		return n
+	}
+	if darts := g.StateNeighbors(0, true, Car, Distance, nil); count(darts, 2) != 1 {
+		t.Errorf("static search respects the rush hour: %v", darts)
+	}
+	if darts := g.StateNeighborsAt(0, true, Car, Distance, 480, nil); count(darts, 2) != 0 {
+		t.Errorf("closed edge used during the rush hour: %v", darts)
+	}
+	if darts := g.StateNeighborsAt(0, true, Car, Distance, 600, nil); count(darts, 2) != 1 {
+		t.Errorf("open edge not used after the rush hour: %v", darts)
+	}
+	if darts := g.StateNeighborsAt(0, true, Car, DistanceNoFerries, 600, nil); len(darts) != 1 {
+		t.Errorf("ferry used although avoided: %v", darts)
+	}
+	if darts := g.StateNeighborsAt(2, false, Car, Distance, 600, nil); count(darts, 0) != 1 {
+		t.Errorf("open edge not used backward: %v", darts)
+	}
+
+	static := g.EdgeWeight32(0, Car, Time)
+	for _, d := range g.StateNeighborsAt(0, true, Car, Time, 1380, nil) {
+		if d.Vertex == 1 && d.Weight != 2*static {
+			t.Errorf("got weight %v at night, expected %v", d.Weight, 2*static)
+		}
+	}
+}
+
+func TestEdgeOpenAt(t *testing.T) {
+	// The edge 0 -> 2 is closed for cars in the morning rush hour, the ferry
+	// 0 -> 1 is closed for bikes at all times.
+	g := ferryGraph()
+	g.Conditions = EncodeConditions([]Condition{
+		{Transports: 1 << uint(Car), Edge: 1, Windows: []TimeWindow{{0x1f, 420, 540}}},
+		{Transports: 1 << uint(Bike), Edge: 0, Windows: []TimeWindow{{0x7f, 0, 1440}}},
+	})
+	computeConditionIndex(g)
+	computeSearchAccess(g)
+
+	tests := []struct {
+		e         Edge
+		transport Transport
+		at        Moment
+		open      bool
+	}{
+		// Inside and outside of the time window on Monday
+		{1, Car, 480, false},
+		{1, Car, 600, true},
+		{1, Car, 400, true},
+		// Not on Saturday, nor without a departure
+		{1, Car, 5*1440 + 480, true},
+		{1, Car, Static, true},
+		{1, Bike, 480, true},
+		// The 24/7 condition applies without a departure as well.
+		{0, Bike, 480, false},
+		{0, Bike, Static, false},
+		{0, Car, Static, true},
+	}
+	for _, test := range tests {
+		if open := g.EdgeOpenAt(test.e, test.transport, test.at); open != test.open {
+			t.Errorf("edge %d for %v at %v: got open %t", test.e, test.transport, test.at, open)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+/*
+ * Copyright 2014 Florian Benz, Steven Schäfer, Bernhard Schommer
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package graph
+
+// Node delays
+//
+// Traffic signals, stop signs, give way signs and crossings delay the
+// traffic which passes through a vertex. The file delays.ftf (optional)
+// stores one NodeDelay per vertex. In the Time metrics, the delay of a vertex
+// is added to the weight of every edge which leaves it, so it is part of the
+// in-cluster searches and the cluster matrices. A path which ends at a vertex
+// does not wait there, but a path which starts at a vertex does. The
+// planners add the delay of the last vertex if a route continues on a part
+// of an edge to its destination. The boundary vertices of the clusters are
+// synthetic and never have a delay.
+
+type NodeDelay uint8
+
+// The same order as osm.TrafficControl.
+const (
+	NoDelay NodeDelay = iota
+	DelayTrafficSignals
+	DelayStop
+	DelayGiveWay
+	DelayCrossing
+	NodeDelayMax
+)
+
+// Average delays in seconds.
+var NodeDelaySeconds = [TransportMax][NodeDelayMax]float64{
+	Car:  {DelayTrafficSignals: 12, DelayStop: 5, DelayGiveWay: 2, DelayCrossing: 2},
+	Bike: {DelayTrafficSignals: 12, DelayStop: 3, DelayGiveWay: 1, DelayCrossing: 1},
+	Foot: {DelayTrafficSignals: 15},
+}
+
+// VertexDelay returns the delay in seconds when passing through v.
+func (g *GraphFile) VertexDelay(v Vertex, t Transport) float64 {
+	if g.Delays == nil {
+		return 0
+	}
+	d := NodeDelay(g.Delays[v])
+	if d >= NodeDelayMax {
+		return 0
+	}
+	return NodeDelaySeconds[t][d]
+}
+
+// The delay of v as a weight in the metric m.
+func (g *GraphFile) delayWeight(v Vertex, t Transport, m Metric) float32 {
+	if g.Delays == nil || m.Base() != Time {
+		return 0
+	}
+	return float32(g.VertexDelay(v, t) / SecondsPerTimeUnit)
+}
+
+// Add the delays to the darts of v: the delay of v itself in the forward
+// direction and the delays of the neighbors in the backward direction.
+func (g *GraphFile) addDelays(v Vertex, forward bool, t Transport, m Metric, darts []Dart) {
+	if g.Delays == nil || m.Base() != Time {
+		return
+	}
+	delay := g.delayWeight(v, t, m)
+	for i := range darts {
+		if !forward {
+			delay = g.delayWeight(darts[i].Vertex, t, m)
+		}
+		darts[i].Weight += delay
+	}
+}
@@ -0,0 +1,384 @@
+/*
+ * Copyright 2014 Florian Benz, Steven Schäfer, Bernhard Schommer
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package graph
+
+import (
+	"alg"
+	"geo"
+)
+
+// Graph extensions
+//
+// Some preprocessing steps change the structure of the graph: partition
+// splits the cut edges and refine replaces the restrictions with via ways
+// by copies of the via ways. A GraphExtension describes such a change as a
+// set of removed edges of the base graph plus new vertices and edges. The
+// new edges take their remaining attributes (maxspeed, names, flags and
+// conditions) from an edge of the base graph. Build returns the resulting
+// graph in memory, it can be written to disk with WriteSubgraph.
+
+type GraphExtension struct {
+	Base     *GraphFile
+	Vertices []ExtensionVertex
+	Edges    []ExtensionEdge
+	// bit vector of the removed edges of the base graph
+	Removed []byte
+	// Restrictions of the new graph. Vertex ids refer to the base vertices
+	// followed by the new vertices, and edge ids to the base edges followed by
+	// the new edges. Restrictions with a removed edge are dropped.
+	Restrictions []Restriction
+}
+
+type ExtensionVertex struct {
+	Coordinate geo.Coordinate
+	Access     uint8 // bit 1 << t is set if the vertex is accessible with transport t
+	Delay      NodeDelay
+}
+
+type ExtensionEdge struct {
+	From, To Vertex
+	Original Edge             // edge of the base graph with the remaining attributes
+	Steps    []geo.Coordinate // the points between From and To
+	Distance float64          // in meter
+	Access   uint8            // bit 1 << t is set if the edge is accessible with transport t
+	Oneway   uint8            // bit 1 << t is set if the edge is a oneway for transport t
+}
+
+func NewGraphExtension(base *GraphFile) *GraphExtension {
+	return &GraphExtension{
+		Base:         base,
+		Removed:      make([]byte, (base.EdgeCount()+7)/8),
+		Restrictions: DecodeRestrictions(base.Restrictions),
+	}
+}
+
+// AddVertex returns the id of the new vertex.
+func (x *GraphExtension) AddVertex(c geo.Coordinate, access uint8) Vertex {
+	x.Vertices = append(x.Vertices, ExtensionVertex{Coordinate: c, Access: access})
+	return Vertex(x.Base.VertexCount() + len(x.Vertices) - 1)
+}
+
+// AddEdge returns the id of the new edge, as used by the restrictions.
+func (x *GraphExtension) AddEdge(e ExtensionEdge) Edge {
+	x.Edges = append(x.Edges, e)
+	return Edge(x.Base.EdgeCount() + len(x.Edges) - 1)
+}
+
+func (x *GraphExtension) RemoveEdge(e Edge) {
+	alg.SetBit(x.Removed, uint(e))
+}
+
+// The vertex with the given id, which may be a new vertex.
+func (x *GraphExtension) VertexCoordinate(v Vertex) geo.Coordinate {
+	if int(v) < x.Base.VertexCount() {
+		return x.Base.VertexCoordinate(v)
+	}
+	return x.Vertices[int(v)-x.Base.VertexCount()].Coordinate
+}
+
+// EdgeTail returns the vertex at which e is stored, i.e., the vertex from
+// which a oneway edge can be used.
+func (g *GraphFile) EdgeTail(e Edge) Vertex {
+	lo, hi := 0, g.VertexCount()
+	for lo < hi {
+		mid := (lo + hi) / 2
+		if g.FirstOut[mid+1] <= uint32(e) {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	return Vertex(lo)
+}
+
+// EdgeGeometry returns the points between the endpoints of e, in the
+// direction from the vertex from. Unlike EdgeSteps, the result never
+// contains one of the endpoints.
+func (g *GraphFile) EdgeGeometry(e Edge, from Vertex) []geo.Coordinate {
+	tail := from
+	if uint32(e) < g.FirstOut[from] || uint32(e) >= g.FirstOut[from+1] {
+		tail = g.EdgeOpposite(e, from)
+	}
+	steps := geo.DecodeStep(g.VertexCoordinate(tail), g.StepPositions[g.Steps[e]:g.Steps[e+1]], nil)
+	if len(steps) > 0 {
+		// The encoded steps end at the head of the edge.
+		steps = steps[:len(steps)-1]
+	}
+	if tail != from {
+		for i, j := 0, len(steps)-1; i < j; i, j = i+1, j-1 {
+			steps[i], steps[j] = steps[j], steps[i]
+		}
+	}
+	return steps
+}
+
+// EdgeAccessMask returns the transport modes which may use the edge e, as
+// a bit mask.
+func (g *GraphFile) EdgeAccessMask(e Edge) uint8 {
+	mask := uint8(0)
+	for t := range g.AccessEdge {
+		if alg.GetBit(g.AccessEdge[t], uint(e)) {
+			mask |= 1 << uint(t)
+		}
+	}
+	return mask
+}
+
+// EdgeOnewayMask returns the transport modes for which the edge e is a
+// oneway, as a bit mask.
+func (g *GraphFile) EdgeOnewayMask(e Edge) uint8 {
+	mask := uint8(0)
+	for t := range g.Oneway {
+		if alg.GetBit(g.Oneway[t], uint(e)) {
+			mask |= 1 << uint(t)
+		}
+	}
+	return mask
+}
+
+// VertexAccessMask returns the transport modes which may use the vertex v,
+// as a bit mask.
+func (g *GraphFile) VertexAccessMask(v Vertex) uint8 {
+	mask := uint8(0)
+	for t := range g.Access {
+		if alg.GetBit(g.Access[t], uint(v)) {
+			mask |= 1 << uint(t)
+		}
+	}
+	return mask
+}
+
+// Converts a length in meter to a float16, without rounding to 0 or infinity.
+func distanceToHalf(d float64) uint16 {
+	w := alg.Float64ToHalf(d)
+	if alg.IsInfHalf(w) {
+		return alg.MaxHalf
+	} else if w == 0 {
+		return alg.MinHalf
+	}
+	return w
+}
+
+// Build returns the extended graph.
+func (x *GraphExtension) Build() *GraphFile {
+	base := x.Base
+	baseVertices, baseEdges := base.VertexCount(), base.EdgeCount()
+	vertexCount := baseVertices + len(x.Vertices)
+
+	// Sort the new edges by their tail.
+	outDegree := make([]uint32, vertexCount+1)
+	for _, e := range x.Edges {
+		outDegree[e.From+1]++
+	}
+	for i := 1; i <= vertexCount; i++ {
+		outDegree[i] += outDegree[i-1]
+	}
+	byTail := make([]int, len(x.Edges))
+	next := append([]uint32(nil), outDegree...)
+	for i, e := range x.Edges {
+		byTail[next[e.From]] = i
+		next[e.From]++
+	}
+
+	// Number the edges, the out edges of every vertex are consecutive.
+	edgeMap := make([]int, baseEdges+len(x.Edges))
+	firstOut := make([]uint32, vertexCount+1)
+	edgeCount := 0
+	for u := 0; u < vertexCount; u++ {
+		firstOut[u] = uint32(edgeCount)
+		if u < baseVertices {
+			for e := base.FirstOut[u]; e < base.FirstOut[u+1]; e++ {
+				if alg.GetBit(x.Removed, uint(e)) {
+					edgeMap[e] = -1
+					continue
+				}
+				edgeMap[e] = edgeCount
+				edgeCount++
+			}
+		}
+		for _, i := range byTail[outDegree[u]:outDegree[u+1]] {
+			edgeMap[baseEdges+i] = edgeCount
+			edgeCount++
+		}
+	}
+	firstOut[vertexCount] = uint32(edgeCount)
+
+	vertexBits := (vertexCount + 7) / 8
+	edgeBits := (edgeCount + 7) / 8
+	g := &GraphFile{
+		FirstOut:      firstOut,
+		FirstIn:       make([]uint32, vertexCount),
+		Coordinates:   make([]int32, 2*vertexCount),
+		Delays:        make([]byte, vertexCount),
+		NextIn:        make([]uint32, edgeCount),
+		Edges:         make([]uint32, edgeCount),
+		Distances:     make([]uint16, edgeCount),
+		MaxSpeeds:     make([]uint16, edgeCount),
+		Steps:         make([]uint32, edgeCount+1),
+		Ferries:       make([]byte, edgeBits),
+		Roundabouts:   make([]byte, edgeBits),
+		StringOffsets: base.StringOffsets,
+		Strings:       base.Strings,
+	}
+	for t := range g.Access {
+		g.Access[t] = make([]byte, vertexBits)
+		g.AccessEdge[t] = make([]byte, edgeBits)
+		g.Oneway[t] = make([]byte, edgeBits)
+	}
+	if base.StringOffsets != nil {
+		g.Names = make([]uint32, edgeCount)
+		g.Refs = make([]uint32, edgeCount)
+		g.Destinations = make([]uint32, edgeCount)
+	}
+
+	// Vertex attributes
+	copy(g.Coordinates, base.Coordinates)
+	copy(g.Delays, base.Delays)
+	for t := range g.Access {
+		copy(g.Access[t], base.Access[t])
+	}
+	for i, v := range x.Vertices {
+		lat, lng := v.Coordinate.Encode()
+		g.Coordinates[2*(baseVertices+i)] = lat
+		g.Coordinates[2*(baseVertices+i)+1] = lng
+		g.Delays[baseVertices+i] = byte(v.Delay)
+		for t := range g.Access {
+			if v.Access&(1<<uint(t)) != 0 {
+				alg.SetBit(g.Access[t], uint(baseVertices+i))
+			}
+		}
+	}
+
+	// Edge attributes, heads and steps
+	heads := make([]Vertex, edgeCount)
+	steps := make([][]byte, edgeCount)
+	copyAttributes := func(e Edge, f int) {
+		g.MaxSpeeds[f] = base.MaxSpeeds[e]
+		if base.EdgeFerry(e) {
+			alg.SetBit(g.Ferries, uint(f))
+		}
+		if base.EdgeRoundabout(e) {
+			alg.SetBit(g.Roundabouts, uint(f))
+		}
+		if g.Names != nil {
+			g.Names[f] = base.Names[e]
+			g.Refs[f] = base.Refs[e]
+			g.Destinations[f] = base.Destinations[e]
+		}
+	}
+	for u := 0; u < baseVertices; u++ {
+		for e := base.FirstOut[u]; e < base.FirstOut[u+1]; e++ {
+			f := edgeMap[e]
+			if f == -1 {
+				continue
+			}
+			heads[f] = base.EdgeOpposite(Edge(e), Vertex(u))
+			steps[f] = base.StepPositions[base.Steps[e]:base.Steps[e+1]]
+			g.Distances[f] = base.Distances[e]
+			for t := range g.AccessEdge {
+				if alg.GetBit(base.AccessEdge[t], uint(e)) {
+					alg.SetBit(g.AccessEdge[t], uint(f))
+				}
+				if alg.GetBit(base.Oneway[t], uint(e)) {
+					alg.SetBit(g.Oneway[t], uint(f))
+				}
+			}
+			copyAttributes(Edge(e), f)
+		}
+	}
+	for i, e := range x.Edges {
+		f := edgeMap[baseEdges+i]
+		heads[f] = e.To
+		if len(e.Steps) > 0 {
+			points := append(append([]geo.Coordinate(nil), e.Steps...), x.VertexCoordinate(e.To))
+			steps[f] = geo.EncodeStep(x.VertexCoordinate(e.From), points)
+		}
+		g.Distances[f] = distanceToHalf(e.Distance)
+		for t := range g.AccessEdge {
+			if e.Access&(1<<uint(t)) != 0 {
+				alg.SetBit(g.AccessEdge[t], uint(f))
+			}
+			if e.Oneway&(1<<uint(t)) != 0 {
+				alg.SetBit(g.Oneway[t], uint(f))
+			}
+		}
+		copyAttributes(e.Original, f)
+	}
+
+	// Store the steps and the edges, and link the in edges.
+	for i := range g.FirstIn {
+		g.FirstIn[i] = Sentinel
+	}
+	size := 0
+	for _, s := range steps {
+		size += len(s)
+	}
+	g.StepPositions = make([]byte, 0, size)
+	for u := 0; u < vertexCount; u++ {
+		for f := firstOut[u]; f < firstOut[u+1]; f++ {
+			g.Steps[f] = uint32(len(g.StepPositions))
+			g.StepPositions = append(g.StepPositions, steps[f]...)
+
+			v := heads[f]
+			g.Edges[f] = uint32(u) ^ uint32(v)
+			if g.FirstIn[v] != Sentinel {
+				g.NextIn[f] = g.FirstIn[v]
+			} else {
+				g.NextIn[f] = f
+			}
+			g.FirstIn[v] = f
+		}
+	}
+	g.Steps[edgeCount] = uint32(len(g.StepPositions))
+
+	// Restrictions
+	restrictions := []Restriction(nil)
+	for _, r := range x.Restrictions {
+		edges := make([]Edge, len(r.Edges))
+		mapped := true
+		for i, e := range r.Edges {
+			edges[i] = Edge(edgeMap[e])
+			mapped = mapped && edgeMap[e] != -1
+		}
+		if mapped {
+			r.Edges = edges
+			restrictions = append(restrictions, r)
+		}
+	}
+	g.Restrictions = EncodeRestrictions(restrictions)
+
+	// Conditions, the new edges inherit them from their original edge.
+	conditions := []Condition(nil)
+	for _, c := range base.conditions.conditions {
+		if f := edgeMap[c.Edge]; f != -1 {
+			c.Edge = Edge(f)
+			conditions = append(conditions, c)
+		}
+	}
+	for i, e := range x.Edges {
+		for _, c := range base.EdgeConditions(e.Original) {
+			c.Edge = Edge(edgeMap[baseEdges+i])
+			conditions = append(conditions, c)
+		}
+	}
+	g.Conditions = EncodeConditions(conditions)
+
+	computeConditionIndex(g)
+	computeSearchAccess(g)
+	computeTurnIndex(g)
+	return g
+}
@@ -19,7 +19,9 @@ package graph
 import (
 	"alg"
 	"geo"
+	"math"
 	"mm"
+	"os"
 	"path"
 )
 
@@ -35,7 +37,11 @@ type GraphFile struct {
 	// Accessibility bit vectors
 	Access     [TransportMax][]byte
 	AccessEdge [TransportMax][]byte
-	Oneway     []byte // should be distinguished by transport type
+	Oneway     [TransportMax][]byte
+	// AccessEdge with the access conditions which apply at all times, and
+	// the same without the ferries, computed when the graph is opened
+	AccessStatic    [TransportMax][]byte
+	AccessNoFerries [TransportMax][]byte
 
 	// edge -> next edge (or to the same edge if this is the last in edge)
 	NextIn []uint32
@@ -51,7 +57,31 @@ type GraphFile struct {
 	StepPositions []byte
 
 	// extended osm attributes
-	Ferries []byte
+	Ferries     []byte
+	Roundabouts []byte // optional, junction=roundabout
+
+	// edge -> string id of the name, ref and destination tags
+	Names        []uint32
+	Refs         []uint32
+	Destinations []uint32
+	// string id -> offset in Strings. The strings are zero terminated and
+	// string 0 is always the empty string.
+	StringOffsets []uint32
+	Strings       []byte
+
+	// vertex -> NodeDelay (optional), see delays.go
+	Delays []byte
+
+	// Turn restrictions (optional), see restriction.go
+	Restrictions []uint32
+	// forbidden turns, computed when the graph is opened
+	turns turnIndex
+	// Conditional restrictions (optional), see conditions.go
+	Conditions []uint32
+	// conditions by edge, computed when the graph is opened
+	conditions conditionIndex
+	// turn costs (optional), see turn_costs.go
+	turnCosts *TurnCosts
 }
 
 // I/O
@@ -71,7 +101,7 @@ func OpenGraphFile(base string, ignoreErrors bool) (*GraphFile, error) {
 		{"access-car.ftf", &g.AccessEdge[Car]},
 		{"access-bike.ftf", &g.AccessEdge[Bike]},
 		{"access-foot.ftf", &g.AccessEdge[Foot]},
-		{"oneway.ftf", &g.Oneway},
+		{"oneway.ftf", &g.Oneway[Car]},
 		{"edges-next.ftf", &g.NextIn},
 		{"edges.ftf", &g.Edges},
 		{"distances.ftf", &g.Distances},
@@ -88,11 +118,41 @@ func OpenGraphFile(base string, ignoreErrors bool) (*GraphFile, error) {
 		}
 	}
 
+	// Optional files, older graphs do not contain them.
+	err := openOptionalFile(path.Join(base, "roundabouts.ftf"), &g.Roundabouts)
+	if err != nil && !ignoreErrors {
+		return nil, err
+	}
+	err = openStringTable(g, base)
+	if err != nil && !ignoreErrors {
+		return nil, err
+	}
+	err = openOptionalWords(path.Join(base, "restrictions.ftf"), &g.Restrictions)
+	if err != nil && !ignoreErrors {
+		return nil, err
+	}
+	err = openOptionalFile(path.Join(base, "delays.ftf"), &g.Delays)
+	if err != nil && !ignoreErrors {
+		return nil, err
+	}
+	err = openOptionalWords(path.Join(base, "conditions.ftf"), &g.Conditions)
+	if err != nil && !ignoreErrors {
+		return nil, err
+	}
+	err = openOptionalFile(path.Join(base, "oneway-bike.ftf"), &g.Oneway[Bike])
+	if err != nil && !ignoreErrors {
+		return nil, err
+	}
+	err = openOptionalFile(path.Join(base, "oneway-foot.ftf"), &g.Oneway[Foot])
+	if err != nil && !ignoreErrors {
+		return nil, err
+	}
+
 	// Ugly hack: we can't have too many open files...
 	bitvectors := []*[]byte{
 		&g.Access[Car], &g.Access[Bike], &g.Access[Foot],
 		&g.AccessEdge[Car], &g.AccessEdge[Bike], &g.AccessEdge[Foot],
-		&g.Oneway, &g.Ferries,
+		&g.Oneway[Car], &g.Ferries,
 	}
 	for _, bv := range bitvectors {
 		p := *bv
@@ -103,6 +163,10 @@ func OpenGraphFile(base string, ignoreErrors bool) (*GraphFile, error) {
 			return nil, err
 		}
 	}
+	computeOneways(g)
+	computeConditionIndex(g)
+	computeSearchAccess(g)
+	computeTurnIndex(g)
 	attributes := []*[]uint16{
 		&g.Distances, &g.MaxSpeeds,
 	}
@@ -119,12 +183,71 @@ func OpenGraphFile(base string, ignoreErrors bool) (*GraphFile, error) {
 	return g, nil
 }
 
+// Load a small file into memory, leaving p untouched if the file does not exist.
+func openOptionalFile(name string, p *[]byte) error {
+	var m []byte
+	err := mm.Open(name, &m)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	*p = make([]byte, len(m))
+	copy(*p, m)
+	return mm.Close(&m)
+}
+
+// Same as openOptionalFile, for files of 32 bit words.
+func openOptionalWords(name string, p *[]uint32) error {
+	var m []uint32
+	err := mm.Open(name, &m)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	*p = make([]uint32, len(m))
+	copy(*p, m)
+	return mm.Close(&m)
+}
+
+func openStringTable(g *GraphFile, base string) error {
+	_, err := os.Stat(path.Join(base, "strings.ftf"))
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	// The string table stays memory mapped, see CloseGraphFile.
+	files := []struct {
+		name string
+		p    interface{}
+	}{
+		{"names.ftf", &g.Names},
+		{"refs.ftf", &g.Refs},
+		{"destinations.ftf", &g.Destinations},
+		{"string_offsets.ftf", &g.StringOffsets},
+		{"strings.ftf", &g.Strings},
+	}
+	for _, file := range files {
+		err := mm.Open(path.Join(base, file.name), file.p)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func CloseGraphFile(g *GraphFile) error {
 	files := []interface{}{
 		&g.FirstOut, &g.FirstIn, &g.Coordinates,
 		&g.NextIn, &g.Edges,
 		&g.Steps, &g.StepPositions,
 	}
+	// The string table is optional.
+	if g.StringOffsets != nil {
+		files = append(files, &g.Names, &g.Refs, &g.Destinations,
+			&g.StringOffsets, &g.Strings)
+	}
 	for _, p := range files {
 		err := mm.Close(p)
 		if err != nil {
@@ -134,6 +257,15 @@ func CloseGraphFile(g *GraphFile) error {
 	return nil
 }
 
+// MappedSize returns the size in bytes of the files which stay memory
+// mapped after OpenGraphFile.
+func (g *GraphFile) MappedSize() int {
+	size := 4 * (len(g.FirstOut) + len(g.FirstIn) + len(g.Coordinates) +
+		len(g.NextIn) + len(g.Edges) + len(g.Steps))
+	size += 4 * (len(g.Names) + len(g.Refs) + len(g.Destinations) + len(g.StringOffsets))
+	return size + len(g.StepPositions) + len(g.Strings)
+}
+
 // Graph Interface
 
 func (g *GraphFile) VertexCount() int {
@@ -167,11 +299,12 @@ func (g *GraphFile) VertexEdges(v Vertex, forward bool, t Transport, buf []Edge)
 	// saved 8 seconds (~25%) of the running time in the scc finding program.
 	// TODO: Implement loop unswitching, cse and some algebraic identities in the go compiler.
 
-	// Add the out edges for v
+	// Add the out edges for v. These are the edges which the searches use,
+	// except that avoiding the ferries is up to the caller (see edgeAccess).
 	first := g.FirstOut[v]
 	last := g.FirstOut[v+1]
-	access := g.AccessEdge[t]
-	if forward || t == Foot {
+	access := g.AccessStatic[t]
+	if forward {
 		// No need to consider the oneway flags
 		for i := first; i < last; i++ {
 			index := i >> 3
@@ -183,7 +316,7 @@ func (g *GraphFile) VertexEdges(v Vertex, forward bool, t Transport, buf []Edge)
 		}
 	} else {
 		// Consider the oneway flags...
-		oneway := g.Oneway
+		oneway := g.Oneway[t]
 		for i := first; i < last; i++ {
 			index := i >> 3
 			bit := byte(1 << (i & 7))
@@ -200,7 +333,7 @@ func (g *GraphFile) VertexEdges(v Vertex, forward bool, t Transport, buf []Edge)
 		return result
 	}
 
-	if !forward || t == Foot {
+	if !forward {
 		// As above, no need to consider the oneway flags
 		for {
 			index := i >> 3
@@ -215,7 +348,7 @@ func (g *GraphFile) VertexEdges(v Vertex, forward bool, t Transport, buf []Edge)
 		}
 	} else {
 		// Need to consider the oneway flags.
-		oneway := g.Oneway
+		oneway := g.Oneway[t]
 		for {
 			index := i >> 3
 			bit := byte(1 << (i & 7))
@@ -263,8 +396,11 @@ func (g *GraphFile) EdgeSteps(e Edge, from Vertex, buf []geo.Coordinate) []geo.C
 }
 
 func (g *GraphFile) EdgeWeight32(e Edge, t Transport, m Metric) float32 {
+	if m.AvoidsFerries() && g.EdgeFerry(e) {
+		return float32(math.Inf(1))
+	}
 	dist := alg.HalfToFloat32(g.Distances[e])
-	if m == Distance {
+	if m.Base() == Distance {
 		return dist
 	}
 	// Time in seconds, for a car.
@@ -315,8 +451,8 @@ func (g *GraphFile) VertexNeighbors(v Vertex, forward bool, t Transport, m Metri
 	// Add the out edges for v
 	first := g.FirstOut[v]
 	last := g.FirstOut[v+1]
-	access := g.AccessEdge[t]
-	if forward || t == Foot {
+	access := g.edgeAccess(t, m)
+	if forward {
 		// No need to consider the oneway flags
 		for i := first; i < last; i++ {
 			index := i >> 3
@@ -330,7 +466,7 @@ func (g *GraphFile) VertexNeighbors(v Vertex, forward bool, t Transport, m Metri
 		}
 	} else {
 		// Consider the oneway flags...
-		oneway := g.Oneway
+		oneway := g.Oneway[t]
 		for i := first; i < last; i++ {
 			index := i >> 3
 			bit := byte(1 << (i & 7))
@@ -346,10 +482,11 @@ func (g *GraphFile) VertexNeighbors(v Vertex, forward bool, t Transport, m Metri
 	// The in edges are stored as a linked list.
 	i := g.FirstIn[v]
 	if i == Sentinel {
+		g.addDelays(v, forward, t, m, result)
 		return result
 	}
 
-	if !forward || t == Foot {
+	if !forward {
 		// As above, no need to consider the oneway flags
 		for {
 			index := i >> 3
@@ -366,7 +503,7 @@ func (g *GraphFile) VertexNeighbors(v Vertex, forward bool, t Transport, m Metri
 		}
 	} else {
 		// Need to consider the oneway flags.
-		oneway := g.Oneway
+		oneway := g.Oneway[t]
 		for {
 			index := i >> 3
 			bit := byte(1 << (i & 7))
@@ -382,15 +519,24 @@ func (g *GraphFile) VertexNeighbors(v Vertex, forward bool, t Transport, m Metri
 		}
 	}
 
+	g.addDelays(v, forward, t, m, result)
 	return result
 }
 
 func (g *GraphFile) VertexNeighborsAppend(v Vertex, forward bool, t Transport, m Metric, result []Dart) []Dart {
+	start := len(result)
+	result = g.edgeNeighborsAppend(v, forward, t, m, result)
+	g.addDelays(v, forward, t, m, result[start:])
+	return result
+}
+
+// The neighbors of v along with the edge weights, without the node delays.
+func (g *GraphFile) edgeNeighborsAppend(v Vertex, forward bool, t Transport, m Metric, result []Dart) []Dart {
 	// Add the out edges for v
 	first := g.FirstOut[v]
 	last := g.FirstOut[v+1]
-	access := g.AccessEdge[t]
-	if forward || t == Foot {
+	access := g.edgeAccess(t, m)
+	if forward {
 		// No need to consider the oneway flags
 		for i := first; i < last; i++ {
 			index := i >> 3
@@ -404,7 +550,7 @@ func (g *GraphFile) VertexNeighborsAppend(v Vertex, forward bool, t Transport, m
 		}
 	} else {
 		// Consider the oneway flags...
-		oneway := g.Oneway
+		oneway := g.Oneway[t]
 		for i := first; i < last; i++ {
 			index := i >> 3
 			bit := byte(1 << (i & 7))
@@ -423,7 +569,7 @@ func (g *GraphFile) VertexNeighborsAppend(v Vertex, forward bool, t Transport, m
 		return result
 	}
 
-	if !forward || t == Foot {
+	if !forward {
 		// As above, no need to consider the oneway flags
 		for {
 			index := i >> 3
@@ -440,7 +586,7 @@ func (g *GraphFile) VertexNeighborsAppend(v Vertex, forward bool, t Transport, m
 		}
 	} else {
 		// Need to consider the oneway flags.
-		oneway := g.Oneway
+		oneway := g.Oneway[t]
 		for {
 			index := i >> 3
 			bit := byte(1 << (i & 7))
@@ -459,6 +605,26 @@ func (g *GraphFile) VertexNeighborsAppend(v Vertex, forward bool, t Transport, m
 	return result
 }
 
+// The edges accessible with the transport mode without a departure time,
+// without the ferries if the metric avoids them.
+func (g *GraphFile) edgeAccess(t Transport, m Metric) []byte {
+	if m.AvoidsFerries() {
+		return g.AccessNoFerries[t]
+	}
+	return g.AccessStatic[t]
+}
+
+// Older graphs only have the oneway flags for cars. Bikes use the same ones
+// and pedestrians ignore them.
+func computeOneways(g *GraphFile) {
+	if g.Oneway[Bike] == nil {
+		g.Oneway[Bike] = g.Oneway[Car]
+	}
+	if g.Oneway[Foot] == nil {
+		g.Oneway[Foot] = make([]byte, len(g.Oneway[Car]))
+	}
+}
+
 func (g *GraphFile) EdgeAccessible(e Edge, t Transport) bool {
 	return alg.GetBit(g.AccessEdge[t], uint(e))
 }
@@ -467,15 +633,54 @@ func (g *GraphFile) EdgeFerry(e Edge) bool {
 	return alg.GetBit(g.Ferries, uint(e))
 }
 
+func (g *GraphFile) EdgeRoundabout(e Edge) bool {
+	return g.Roundabouts != nil && alg.GetBit(g.Roundabouts, uint(e))
+}
+
 func (g *GraphFile) EdgeMaxSpeed(e Edge) int {
 	return int(g.MaxSpeeds[e])
 }
 
 func (g *GraphFile) EdgeOneway(e Edge, t Transport) bool {
-	if t == Foot {
-		return false
+	return alg.GetBit(g.Oneway[t], uint(e))
+}
+
+func (g *GraphFile) EdgeName(e Edge) string {
+	if g.Names == nil {
+		return ""
+	}
+	return g.String(g.Names[e])
+}
+
+func (g *GraphFile) EdgeRef(e Edge) string {
+	if g.Refs == nil {
+		return ""
+	}
+	return g.String(g.Refs[e])
+}
+
+func (g *GraphFile) EdgeDestination(e Edge) string {
+	if g.Destinations == nil {
+		return ""
+	}
+	return g.String(g.Destinations[e])
+}
+
+// String table
+
+func (g *GraphFile) StringCount() int {
+	if g.StringOffsets == nil {
+		return 1 // the empty string
+	}
+	return len(g.StringOffsets) - 1
+}
+
+func (g *GraphFile) String(id uint32) string {
+	if id == 0 || g.StringOffsets == nil {
+		return ""
 	}
-	return alg.GetBit(g.Oneway, uint(e))
+	// Strip the terminating zero.
+	return string(g.Strings[g.StringOffsets[id] : g.StringOffsets[id+1]-1])
 }
 
 // Raw Interface (used to implement other tools working with GraphFiles)
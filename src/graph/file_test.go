@@ -0,0 +1,168 @@
+/*
+ * Copyright 2014 Florian Benz, Steven Schäfer, Bernhard Schommer
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package graph
+
+import (
+	"alg"
+	"math"
+	"testing"
+)
+
+// A star with the edges 0 -> 1 (ferry) and 0 -> 2, both 100 m long.
+func ferryGraph() *GraphFile {
+	g := &GraphFile{
+		FirstOut:  []uint32{0, 2, 2, 2},
+		FirstIn:   []uint32{Sentinel, 0, 1},
+		NextIn:    []uint32{0, 1},
+		Edges:     []uint32{0 ^ 1, 0 ^ 2},
+		Ferries:   []byte{1},
+		Distances: []uint16{alg.Float32ToHalf(100), alg.Float32ToHalf(100)},
+		MaxSpeeds: []uint16{10, 10},
+	}
+	for t := range g.AccessEdge {
+		g.AccessEdge[t] = []byte{3}
+		g.Oneway[t] = []byte{0}
+	}
+	computeSearchAccess(g)
+	return g
+}
+
+func TestVertexNeighborsNoFerries(t *testing.T) {
+	g := ferryGraph()
+	for _, m := range []Metric{Distance, Time} {
+		darts := g.VertexNeighbors(0, true, Car, m, nil)
+		if len(darts) != 2 {
+			t.Errorf("%v: got %v, expected both edges", m, darts)
+		}
+		darts = g.VertexNeighbors(0, true, Car, m.WithoutFerries(), nil)
+		if len(darts) != 1 || darts[0].Vertex != 2 {
+			t.Errorf("%v: got %v, expected only the edge to 2", m.WithoutFerries(), darts)
+		}
+		if w := g.EdgeWeight(0, Car, m.WithoutFerries()); !math.IsInf(w, 1) {
+			t.Errorf("%v: ferry has weight %v", m.WithoutFerries(), w)
+		}
+		if g.EdgeWeight(1, Car, m.WithoutFerries()) != g.EdgeWeight(1, Car, m) {
+			t.Errorf("%v: weight of a road changed", m.WithoutFerries())
+		}
+		if m.WithoutFerries().Base() != m || !m.WithoutFerries().AvoidsFerries() || m.AvoidsFerries() {
+			t.Errorf("%v: inconsistent metric variants", m)
+		}
+	}
+}
+
+func TestVertexNeighborsDelays(t *testing.T) {
+	g := ferryGraph()
+	g.Delays = []byte{byte(DelayTrafficSignals), byte(DelayStop), 0}
+	delay := func(v Vertex) float32 {
+		return float32(NodeDelaySeconds[Car][g.Delays[v]] / SecondsPerTimeUnit)
+	}
+	for _, m := range []Metric{Distance, Time} {
+		// The delay of a vertex is charged when leaving it.
+		for _, d := range g.VertexNeighbors(0, true, Car, m, nil) {
+			expected := g.EdgeWeight32(Edge(d.Vertex-1), Car, m)
+			if m == Time {
+				expected += delay(0)
+			}
+			if d.Weight != expected {
+				t.Errorf("%v: got weight %v to %v, expected %v", m, d.Weight, d.Vertex, expected)
+			}
+		}
+		// Arriving at the traffic signals at 0 is not delayed.
+		for _, d := range g.VertexNeighbors(1, true, Car, m, nil) {
+			expected := g.EdgeWeight32(0, Car, m)
+			if m == Time {
+				expected += delay(1)
+			}
+			if d.Weight != expected {
+				t.Errorf("%v: got weight %v to %v, expected %v", m, d.Weight, d.Vertex, expected)
+			}
+		}
+		// Backward, the delay belongs to the predecessor.
+		for _, d := range g.VertexNeighbors(2, false, Car, m, nil) {
+			expected := g.EdgeWeight32(1, Car, m)
+			if m == Time {
+				expected += delay(0)
+			}
+			if d.Weight != expected {
+				t.Errorf("%v: got backward weight %v, expected %v", m, d.Weight, expected)
+			}
+		}
+	}
+}
+
+func TestVertexNeighborsOneway(t *testing.T) {
+	// The edge 0 -> 2 is a oneway for cars only.
+	g := ferryGraph()
+	g.Oneway[Car] = []byte{2}
+	expected := [TransportMax]int{Car: 0, Bike: 1, Foot: 1}
+	for tr, count := range expected {
+		transport := Transport(tr)
+		if g.EdgeOneway(1, transport) != (transport == Car) {
+			t.Errorf("%v: wrong oneway flag", transport)
+		}
+		if darts := g.VertexNeighbors(2, true, transport, Distance, nil); len(darts) != count {
+			t.Errorf("%v: got %v, expected %v edges", transport, darts, count)
+		}
+		if edges := g.VertexEdges(0, false, transport, nil); len(edges) != 1+count {
+			t.Errorf("%v: got in edges %v", transport, edges)
+		}
+	}
+}
+
+// The string table survives a round trip and stays memory mapped.
+func TestStringTableFile(t *testing.T) {
+	g := ferryGraph()
+	g.Coordinates = []int32{0, 0, 1000, 0, 0, 1000}
+	// The writer cannot create empty files, so every edge gets one byte of
+	// (unused) step data.
+	g.Steps = []uint32{0, 1, 2}
+	g.StepPositions = []byte{0, 0}
+	for i := range g.Access {
+		g.Access[i] = []byte{7}
+	}
+	// Strings 1 and 2 are "Rhein" and "B 9".
+	g.Strings = []byte("\x00Rhein\x00B 9\x00")
+	g.StringOffsets = []uint32{0, 1, 7, 11}
+	g.Names = []uint32{1, 0}
+	g.Refs = []uint32{0, 2}
+	g.Destinations = []uint32{0, 0}
+
+	base := t.TempDir()
+	if err := g.WriteInducedSubgraph(base, []byte{7}); err != nil {
+		t.Fatal(err)
+	}
+	h, err := OpenGraphFile(base, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.EdgeName(0) != "Rhein" || h.EdgeRef(0) != "" || h.EdgeName(1) != "" || h.EdgeRef(1) != "B 9" {
+		t.Errorf("got names %q, %q and refs %q, %q",
+			h.EdgeName(0), h.EdgeName(1), h.EdgeRef(0), h.EdgeRef(1))
+	}
+	withoutStrings := *h
+	withoutStrings.Names, withoutStrings.Refs, withoutStrings.Destinations = nil, nil, nil
+	withoutStrings.StringOffsets, withoutStrings.Strings = nil, nil
+	if d := h.MappedSize() - withoutStrings.MappedSize(); d != 4*(2+2+2+4)+11 {
+		t.Errorf("the string table accounts for %d mapped bytes", d)
+	}
+	if err := CloseGraphFile(h); err != nil {
+		t.Fatal(err)
+	}
+	if h.Names != nil || h.Strings != nil {
+		t.Errorf("the string table is still mapped")
+	}
+}
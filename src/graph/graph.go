@@ -35,13 +35,20 @@ type Metric int
 const (
 	Distance Metric = iota
 	Time
+	// The same metrics on the graph without ferries
+	DistanceNoFerries
+	TimeNoFerries
 	MetricMax
 )
 
+// Weights in the Time metric are given in m / (km/h), i.e., in units of 3.6s.
+const SecondsPerTimeUnit = 3600.0 / 1000.0
+
 // Way is a "partial edge" that is returned by the k-d tree
 type Way struct {
 	Length  float64
 	Vertex  Vertex // start or end point
+	Edge    Edge   // the edge containing the way, -1 if the target is a vertex
 	Steps   []geo.Coordinate
 	Target  geo.Coordinate
 	Forward bool
@@ -69,8 +76,11 @@ type Graph interface {
 
 	// direct access to edge attributes
 	EdgeFerry(Edge) bool
+	EdgeRoundabout(Edge) bool
 	EdgeMaxSpeed(Edge) int
 	EdgeOneway(Edge, Transport) bool
+	EdgeName(Edge) string
+	EdgeRef(Edge) string
 }
 
 type OverlayGraph interface {
@@ -100,8 +110,31 @@ func (m Metric) String() string {
 	switch m {
 	case Distance:
 		return "MetricDistance"
+	case Time:
+		return "MetricTime"
+	case DistanceNoFerries:
+		return "MetricDistanceNoFerries"
+	case TimeNoFerries:
+		return "MetricTimeNoFerries"
 	case MetricMax:
 		return "MetricMax"
 	}
 	return "Invalid Metric Enum"
 }
+
+// Base returns the unrestricted metric, i.e., Distance or Time.
+func (m Metric) Base() Metric {
+	if m == DistanceNoFerries || m == TimeNoFerries {
+		return m - DistanceNoFerries
+	}
+	return m
+}
+
+func (m Metric) AvoidsFerries() bool {
+	return m == DistanceNoFerries || m == TimeNoFerries
+}
+
+// WithoutFerries returns the variant of the metric which avoids ferries.
+func (m Metric) WithoutFerries() Metric {
+	return m.Base() + DistanceNoFerries
+}
@@ -21,6 +21,7 @@ import (
 	"geo"
 	"math"
 	"mm"
+	"os"
 	"path"
 	//"sort"
 )
@@ -61,7 +62,11 @@ func loadAllMatrices(g *OverlayGraphFile, base string) error {
 			var matrixFile []float32
 			fileName := fmt.Sprintf("matrices.trans%d.metric%d.ftf", t+1, m+1)
 			err := mm.Open(path.Join(base, fileName), &matrixFile)
-			if err != nil {
+			if os.IsNotExist(err) && Metric(m).AvoidsFerries() {
+				// Older graphs do not have the ferry-free metrics, see
+				// FerryFreeMatrices.
+				continue
+			} else if err != nil {
 				return err
 			}
 			g.Matrices[t][m] = matrixFile
@@ -70,6 +75,22 @@ func loadAllMatrices(g *OverlayGraphFile, base string) error {
 	return nil
 }
 
+// FerryFreeMatrices returns true if the matrices of the ferry-free metrics
+// are loaded, which avoiding ferries requires.
+func (g *OverlayGraphFile) FerryFreeMatrices() bool {
+	if g.Matrices == nil {
+		return false
+	}
+	for t := range g.Matrices {
+		for m := range g.Matrices[t] {
+			if Metric(m).AvoidsFerries() && g.Matrices[t][m] == nil {
+				return false
+			}
+		}
+	}
+	return true
+}
+
 func OpenOverlay(base string, loadMatrices, ignoreErrors bool) (*OverlayGraphFile, error) {
 	overlayBaseDir := path.Join(base, "/overlay")
 	g, err := OpenGraphFile(overlayBaseDir, ignoreErrors)
@@ -92,8 +113,7 @@ func OpenOverlay(base string, loadMatrices, ignoreErrors bool) (*OverlayGraphFil
 		}
 	}
 
-	computeVertexIndices(overlay)
-	computeEdgeCounts(overlay)
+	computeClusterIndex(overlay)
 	if loadMatrices {
 		err = loadAllMatrices(overlay, base)
 		if err != nil && !ignoreErrors {
@@ -101,13 +121,27 @@ func OpenOverlay(base string, loadMatrices, ignoreErrors bool) (*OverlayGraphFil
 		}
 	}
 
-	for i := 0; i < overlay.ClusterCount(); i++ {
-		overlay.ClusterEdgeCount += overlay.ClusterSize(i) * overlay.ClusterSize(i)
-	}
-
 	return overlay, nil
 }
 
+// NewOverlayGraph returns the overlay graph with the cut edges g and the
+// partition cluster (cluster id -> first vertex, plus sentinel). The
+// matrices have to be set separately.
+func NewOverlayGraph(g *GraphFile, cluster []uint32) *OverlayGraphFile {
+	overlay := &OverlayGraphFile{GraphFile: g, Cluster: cluster}
+	computeClusterIndex(overlay)
+	return overlay
+}
+
+func computeClusterIndex(g *OverlayGraphFile) {
+	computeVertexIndices(g)
+	computeEdgeCounts(g)
+	g.ClusterEdgeCount = 0
+	for i := 0; i < g.ClusterCount(); i++ {
+		g.ClusterEdgeCount += g.ClusterSize(i) * g.ClusterSize(i)
+	}
+}
+
 func CloseOverlay(overlay *OverlayGraphFile) error {
 	err := CloseGraphFile(overlay.GraphFile)
 	if err != nil {
@@ -125,9 +159,33 @@ func CloseOverlay(overlay *OverlayGraphFile) error {
 		}
 	}
 
+	for t := range overlay.Matrices {
+		for m := range overlay.Matrices[t] {
+			if overlay.Matrices[t][m] == nil {
+				continue
+			}
+			err = mm.Close(&overlay.Matrices[t][m])
+			if err != nil {
+				return err
+			}
+		}
+	}
+
 	return nil
 }
 
+// MappedSize returns the size in bytes of all memory mapped files,
+// including the matrices.
+func (g *OverlayGraphFile) MappedSize() int {
+	size := g.GraphFile.MappedSize() + 4*len(g.Cluster)
+	for t := range g.Matrices {
+		for m := range g.Matrices[t] {
+			size += 4 * len(g.Matrices[t][m])
+		}
+	}
+	return size
+}
+
 // Graph Interface
 
 func (g *OverlayGraphFile) EdgeCount() int {
@@ -218,6 +276,21 @@ func (g *OverlayGraphFile) EdgeWeight(e Edge, t Transport, m Metric) float64 {
 	return float64(g.Matrices[t][m][edgeIndex])
 }
 
+func (g *OverlayGraphFile) EdgeName(e Edge) string {
+	// Shortcut edges have no name.
+	if g.IsCutEdge(e) {
+		return g.GraphFile.EdgeName(e)
+	}
+	return ""
+}
+
+func (g *OverlayGraphFile) EdgeRef(e Edge) string {
+	if g.IsCutEdge(e) {
+		return g.GraphFile.EdgeRef(e)
+	}
+	return ""
+}
+
 // Overlay Interface
 
 func (g *OverlayGraphFile) ClusterCount() int {
@@ -0,0 +1,250 @@
+/*
+ * Copyright 2014 Florian Benz, Steven Schäfer, Bernhard Schommer
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package graph
+
+import (
+	"sort"
+)
+
+// Turn restrictions
+//
+// A restriction forbids a sequence of edges for some transport modes. For
+// example, a no_left_turn restriction forbids to continue with the edge "to"
+// after arriving at the via vertex over the edge "from". Restrictions with
+// via ways forbid longer sequences. The file restrictions.ftf stores one
+// record per restriction:
+//
+//   header, via vertex, from edge, via edges..., to edge
+//
+// The header contains the transport modes in the lowest 8 bits (bit 1 << t
+// for transport t), the "only" flag in bit 8 and the number of edges in the
+// upper 16 bits. The via vertex is the vertex between the first two edges,
+// which determines the direction of travel along the from edge.
+//
+// An "only" restriction forbids every other turn instead. The searches only
+// handle restrictions with a single via vertex, restrictions with via ways
+// are replaced by copies of the via ways in refine (see ExpandRestrictions).
+//
+// A barrier, e.g., a bollard, blocks the passage through a vertex. It is
+// stored as one "only" restriction per edge of the vertex, which only allows
+// to turn around (see BarrierRestrictions).
+
+const (
+	restrictionOnly      = 1 << 8
+	restrictionSizeShift = 16
+)
+
+type Restriction struct {
+	Transports uint8 // bit 1 << t is set if the restriction applies to transport t
+	Only       bool
+	Via        Vertex
+	Edges      []Edge // from edge, via edges and to edge
+}
+
+func (r Restriction) From() Edge {
+	return r.Edges[0]
+}
+
+func (r Restriction) To() Edge {
+	return r.Edges[len(r.Edges)-1]
+}
+
+func (r Restriction) Applies(t Transport) bool {
+	return r.Transports&(1<<uint(t)) != 0
+}
+
+// BarrierRestrictions returns the restrictions for a barrier at the vertex v
+// with the given edges, which blocks the given transport modes.
+func BarrierRestrictions(v Vertex, edges []Edge, transports uint8) []Restriction {
+	result := make([]Restriction, len(edges))
+	for i, e := range edges {
+		result[i] = Restriction{
+			Transports: transports,
+			Only:       true,
+			Via:        v,
+			Edges:      []Edge{e, e},
+		}
+	}
+	return result
+}
+
+// DecodeRestrictions returns the restrictions stored in a restrictions.ftf file.
+func DecodeRestrictions(data []uint32) []Restriction {
+	result := []Restriction(nil)
+	for i := 0; i+1 < len(data); {
+		header := data[i]
+		n := int(header >> restrictionSizeShift)
+		if i+2+n > len(data) {
+			break // truncated file
+		}
+		edges := make([]Edge, n)
+		for j := range edges {
+			edges[j] = Edge(data[i+2+j])
+		}
+		result = append(result, Restriction{
+			Transports: uint8(header),
+			Only:       header&restrictionOnly != 0,
+			Via:        Vertex(data[i+1]),
+			Edges:      edges,
+		})
+		i += 2 + n
+	}
+	return result
+}
+
+// EncodeRestrictions is the inverse of DecodeRestrictions.
+func EncodeRestrictions(restrictions []Restriction) []uint32 {
+	result := []uint32(nil)
+	for _, r := range restrictions {
+		header := uint32(r.Transports) | uint32(len(r.Edges))<<restrictionSizeShift
+		if r.Only {
+			header |= restrictionOnly
+		}
+		result = append(result, header, uint32(r.Via))
+		for _, e := range r.Edges {
+			result = append(result, uint32(e))
+		}
+	}
+	return result
+}
+
+// A forbidden turn at a vertex, derived from the restrictions.
+type forbiddenTurn struct {
+	via        Vertex
+	from, to   Edge
+	transports uint8
+}
+
+type byVia []forbiddenTurn
+
+func (t byVia) Len() int           { return len(t) }
+func (t byVia) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
+func (t byVia) Less(i, j int) bool { return t[i].via < t[j].via }
+
+// The forbidden turns sorted by their via vertex. The turn-aware vertices,
+// i.e., the restricted vertices and, with turn costs, all junctions, define
+// the arc states of the turn-aware search, see turn_graph.go.
+type turnIndex struct {
+	vertices []Vertex // sorted turn-aware vertices
+	first    []int    // vertex index -> first forbidden turn, plus sentinel
+	states   []int    // vertex index -> first arc state - VertexCount, plus sentinel
+	turns    []forbiddenTurn
+	aware    []byte  // bit vector of the turn-aware vertices
+	bearings []uint8 // arc state - VertexCount -> bearing of the edge, only with turn costs
+}
+
+// Compute the forbidden turns, an "only" restriction forbids all other edges
+// at the via vertex. Restrictions with via ways are ignored.
+func computeTurnIndex(g *GraphFile) {
+	g.turns = turnIndex{}
+	if len(g.Restrictions) == 0 && g.turnCosts == nil {
+		return
+	}
+
+	turns := []forbiddenTurn(nil)
+	edges := []Edge(nil)
+	for _, r := range DecodeRestrictions(g.Restrictions) {
+		if len(r.Edges) != 2 || int(r.Via) >= g.VertexCount() {
+			continue
+		}
+		if !r.Only {
+			turns = append(turns, forbiddenTurn{r.Via, r.From(), r.To(), r.Transports})
+			continue
+		}
+		edges = g.VertexRawEdges(r.Via, edges)
+		for _, e := range edges {
+			if e != r.To() {
+				turns = append(turns, forbiddenTurn{r.Via, r.From(), e, r.Transports})
+			}
+		}
+	}
+	sort.Stable(byVia(turns))
+
+	index := turnIndex{
+		turns: turns,
+		aware: make([]byte, (g.VertexCount()+7)/8),
+	}
+	states, k := 0, 0
+	for i := 0; i < g.VertexCount(); i++ {
+		v := Vertex(i)
+		first := k
+		for k < len(turns) && turns[k].via == v {
+			k++
+		}
+		degree := g.vertexDegree(v)
+		if k == first && (g.turnCosts == nil || degree < 3) {
+			continue
+		}
+		index.vertices = append(index.vertices, v)
+		index.first = append(index.first, first)
+		index.states = append(index.states, states)
+		states += degree
+		index.aware[v/8] |= 1 << uint(v%8)
+		if g.turnCosts != nil {
+			g.visitRawEdges(v, func(e Edge) {
+				index.bearings = append(index.bearings, g.edgeBearing(e, v))
+			})
+		}
+	}
+	index.first = append(index.first, len(turns))
+	index.states = append(index.states, states)
+	g.turns = index
+}
+
+// The number of edges incident to v, i.e., len(VertexRawEdges(v)).
+func (g *GraphFile) vertexDegree(v Vertex) int {
+	degree := int(g.FirstOut[v+1] - g.FirstOut[v])
+	for i := g.FirstIn[v]; i != Sentinel; i = g.NextIn[i] {
+		degree++
+		if i == g.NextIn[i] {
+			break
+		}
+	}
+	return degree
+}
+
+// The index of v in the list of turn-aware vertices, or -1.
+func (g *GraphFile) awareIndex(v Vertex) int {
+	if !g.VertexTurnAware(v) {
+		return -1
+	}
+	vertices := g.turns.vertices
+	return sort.Search(len(vertices), func(i int) bool { return vertices[i] >= v })
+}
+
+// VertexTurnAware returns true if the search distinguishes the edges over
+// which it arrives at v, i.e., if some turn at v is forbidden or has a cost.
+func (g *GraphFile) VertexTurnAware(v Vertex) bool {
+	aware := g.turns.aware
+	return aware != nil && aware[v/8]&(1<<uint(v%8)) != 0
+}
+
+// TurnAllowed returns false if a restriction forbids to continue with the
+// edge to after arriving at the vertex via over the edge from.
+func (g *GraphFile) TurnAllowed(from Edge, via Vertex, to Edge, t Transport) bool {
+	i := g.awareIndex(via)
+	if i == -1 {
+		return true
+	}
+	mask := uint8(1 << uint(t))
+	for _, turn := range g.turns.turns[g.turns.first[i]:g.turns.first[i+1]] {
+		if turn.from == from && turn.to == to && turn.transports&mask != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,177 @@
+/*
+ * Copyright 2014 Florian Benz, Steven Schäfer, Bernhard Schommer
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package graph
+
+import (
+	"alg"
+	"reflect"
+	"testing"
+)
+
+// A junction at vertex 0 with the edges 0 -> 2, 0 -> 3 and 1 -> 0, all of
+// them 100 m long and open in both directions.
+func junctionGraph(restrictions ...Restriction) *GraphFile {
+	g := &GraphFile{
+		FirstOut:     []uint32{0, 2, 3, 3, 3},
+		FirstIn:      []uint32{2, Sentinel, 0, 1},
+		NextIn:       []uint32{0, 1, 2},
+		Edges:        []uint32{0 ^ 2, 0 ^ 3, 1 ^ 0},
+		Coordinates:  make([]int32, 8),
+		Steps:        []uint32{0, 0, 0, 0},
+		Ferries:      []byte{0},
+		Roundabouts:  []byte{0},
+		Distances:    []uint16{alg.Float32ToHalf(100), alg.Float32ToHalf(100), alg.Float32ToHalf(100)},
+		MaxSpeeds:    []uint16{10, 10, 10},
+		Restrictions: EncodeRestrictions(restrictions),
+	}
+	for t := range g.AccessEdge {
+		g.Access[t] = []byte{0xf}
+		g.AccessEdge[t] = []byte{7}
+		g.Oneway[t] = []byte{0}
+	}
+	computeSearchAccess(g)
+	computeTurnIndex(g)
+	return g
+}
+
+func TestRestrictionEncoding(t *testing.T) {
+	restrictions := []Restriction{
+		{Transports: 1 << uint(Car), Via: 0, Edges: []Edge{2, 1}},
+		{Transports: 1<<uint(Car) | 1<<uint(Bike), Only: true, Via: 7, Edges: []Edge{3, 4, 5}},
+	}
+	decoded := DecodeRestrictions(EncodeRestrictions(restrictions))
+	if !reflect.DeepEqual(decoded, restrictions) {
+		t.Errorf("got %v, expected %v", decoded, restrictions)
+	}
+}
+
+func TestTurnAllowed(t *testing.T) {
+	g := junctionGraph(Restriction{Transports: 1 << uint(Car), Via: 0, Edges: []Edge{2, 1}})
+	if g.TurnAllowed(2, 0, 1, Car) {
+		t.Errorf("turn 1 -> 0 -> 3 is allowed for cars")
+	}
+	if !g.TurnAllowed(2, 0, 1, Bike) {
+		t.Errorf("turn 1 -> 0 -> 3 is forbidden for bikes")
+	}
+	if !g.TurnAllowed(2, 0, 0, Car) || !g.TurnAllowed(0, 0, 1, Car) {
+		t.Errorf("unrestricted turn is forbidden")
+	}
+
+	g = junctionGraph(Restriction{Transports: 1 << uint(Car), Only: true, Via: 0, Edges: []Edge{2, 0}})
+	if !g.TurnAllowed(2, 0, 0, Car) || g.TurnAllowed(2, 0, 1, Car) || g.TurnAllowed(2, 0, 2, Car) {
+		t.Errorf("only restriction does not forbid the other turns")
+	}
+}
+
+func TestBarrierRestrictions(t *testing.T) {
+	g := junctionGraph(BarrierRestrictions(0, []Edge{0, 1, 2}, 1<<uint(Car))...)
+	for _, from := range []Edge{0, 1, 2} {
+		for _, to := range []Edge{0, 1, 2} {
+			if allowed := g.TurnAllowed(from, 0, to, Car); allowed != (from == to) {
+				t.Errorf("car: turn %v -> %v allowed: %v, expected %v", from, to, allowed, from == to)
+			}
+			if !g.TurnAllowed(from, 0, to, Foot) {
+				t.Errorf("foot: turn %v -> %v is forbidden", from, to)
+			}
+		}
+	}
+
+	// The barrier itself can still be reached and left.
+	if darts := g.StateNeighbors(0, true, Car, Distance, nil); len(darts) != 3 {
+		t.Errorf("got successors %v of the barrier, expected all edges", darts)
+	}
+	s := g.StateNeighbors(1, true, Car, Distance, nil)[0].Vertex
+	darts := g.StateNeighbors(s, true, Car, Distance, nil)
+	if len(darts) != 1 || darts[0].Vertex != 1 {
+		t.Errorf("got successors %v behind the barrier, expected [1]", darts)
+	}
+}
+
+func TestStateNeighbors(t *testing.T) {
+	g := junctionGraph(Restriction{Transports: 1 << uint(Car), Via: 0, Edges: []Edge{2, 1}})
+	if g.StateCount() != g.VertexCount()+3 {
+		t.Fatalf("got %v states, expected %v", g.StateCount(), g.VertexCount()+3)
+	}
+
+	// From vertex 1 we arrive at the arc state of 0 for the edge 2.
+	darts := g.StateNeighbors(1, true, Car, Distance, nil)
+	if len(darts) != 1 || g.StateVertex(darts[0].Vertex) != 0 || g.StateEdge(darts[0].Vertex) != 2 {
+		t.Fatalf("got %v, expected the arc state of edge 2", darts)
+	}
+	s := darts[0].Vertex
+	next := []Vertex(nil)
+	for _, d := range g.StateNeighbors(s, true, Car, Distance, nil) {
+		next = append(next, d.Vertex)
+	}
+	if !reflect.DeepEqual(next, []Vertex{2, 1}) {
+		t.Errorf("car: got successors %v, expected [2 1]", next)
+	}
+	if darts := g.StateNeighbors(s, true, Bike, Distance, nil); len(darts) != 3 {
+		t.Errorf("bike: got successors %v, expected all edges", darts)
+	}
+
+	// Backward: vertex 3 cannot be reached from the arc state of edge 2.
+	for _, d := range g.StateNeighbors(3, false, Car, Distance, nil) {
+		if d.Vertex == s {
+			t.Errorf("car: the arc state of edge 2 is a predecessor of 3")
+		}
+	}
+	if e := g.StateEdgeBetween(s, 2, Car, Distance); e != 0 {
+		t.Errorf("got edge %v between the arc state and 2, expected 0", e)
+	}
+	if e := g.StateEdgeBetween(s, 3, Car, Distance); int(e) != -1 {
+		t.Errorf("got edge %v between the arc state and 3, expected none", e)
+	}
+}
+
+func TestExtensionBuild(t *testing.T) {
+	g := junctionGraph(Restriction{Transports: 1 << uint(Car), Via: 0, Edges: []Edge{2, 1}})
+	x := NewGraphExtension(g)
+	v := x.AddVertex(g.VertexCoordinate(3), 1<<uint(Car))
+	x.RemoveEdge(1)
+	e := x.AddEdge(ExtensionEdge{From: 0, To: v, Original: 1, Distance: 50, Access: 1 << uint(Car)})
+	x.Restrictions[0].Edges[1] = e
+	h := x.Build()
+
+	if h.VertexCount() != 5 || h.EdgeCount() != 3 {
+		t.Fatalf("got %v vertices and %v edges, expected 5 and 3", h.VertexCount(), h.EdgeCount())
+	}
+	if int(e) != g.EdgeCount() {
+		t.Errorf("got extended edge id %v, expected %v", e, g.EdgeCount())
+	}
+	found := false
+	for _, d := range h.VertexNeighbors(0, true, Car, Distance, nil) {
+		if d.Vertex == v {
+			found = true
+			if d.Weight != 50 {
+				t.Errorf("got weight %v for the new edge, expected 50", d.Weight)
+			}
+		}
+		if d.Vertex == 3 {
+			t.Errorf("removed edge is still present")
+		}
+	}
+	if !found {
+		t.Errorf("new edge is missing")
+	}
+	restrictions := DecodeRestrictions(h.Restrictions)
+	if len(restrictions) != 1 || h.EdgeOpposite(restrictions[0].To(), 0) != v {
+		t.Errorf("restriction was not mapped to the new edge: %v", restrictions)
+	} else if h.TurnAllowed(restrictions[0].From(), 0, restrictions[0].To(), Car) {
+		t.Errorf("restricted turn is allowed after the extension")
+	}
+}
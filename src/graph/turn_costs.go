@@ -0,0 +1,242 @@
+/*
+ * Copyright 2014 Florian Benz, Steven Schäfer, Bernhard Schommer
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package graph
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"path"
+)
+
+// Turn costs
+//
+// A turn cost is a penalty in seconds for the turn from one edge onto the
+// next one. It depends on the turn angle, on whether the turn is a U-turn and
+// on whether we cross a major road at the junction, which we approximate by
+// a road with a higher speed limit than the edges of the turn on both sides.
+// Turn costs only change the Time metrics; the Distance metrics stay the
+// shortest paths.
+//
+// The metric customization writes the costs to TurnCostsFile and includes
+// them in the cluster matrices. Every junction of a cluster then becomes a
+// turn-aware vertex, see turn_graph.go. The overlay graph consists of the
+// synthetic boundary vertices only and never has turn costs.
+
+const TurnCostsFile = "turncosts.json"
+
+// Upper bounds (in degrees) of the absolute turn angle for each class of
+// turns, the same as for the maneuvers of a route.
+const (
+	straightAngle = 20
+	slightAngle   = 60
+	turnAngle     = 120
+	sharpAngle    = 170
+)
+
+// Penalties in seconds for a single transport mode.
+type TurnPenalties struct {
+	Straight          float64 `json:"straight"`
+	SlightRight       float64 `json:"slight_right"`
+	Right             float64 `json:"right"`
+	SharpRight        float64 `json:"sharp_right"`
+	UTurn             float64 `json:"uturn"`
+	SharpLeft         float64 `json:"sharp_left"`
+	Left              float64 `json:"left"`
+	SlightLeft        float64 `json:"slight_left"`
+	CrossingMajorRoad float64 `json:"crossing_major_road"`
+}
+
+type TurnCosts struct {
+	Car  TurnPenalties `json:"car"`
+	Bike TurnPenalties `json:"bike"`
+	Foot TurnPenalties `json:"foot"`
+}
+
+// Default turn costs for right-hand traffic, left turns have to give way to
+// the oncoming traffic.
+var DefaultTurnCosts = TurnCosts{
+	Car: TurnPenalties{
+		SlightRight: 1, Right: 4, SharpRight: 6, UTurn: 20,
+		SharpLeft: 10, Left: 8, SlightLeft: 2, CrossingMajorRoad: 6,
+	},
+	Bike: TurnPenalties{
+		Right: 1, SharpRight: 2, UTurn: 5,
+		SharpLeft: 4, Left: 3, SlightLeft: 1, CrossingMajorRoad: 4,
+	},
+}
+
+func (c *TurnCosts) Penalties(t Transport) *TurnPenalties {
+	switch t {
+	case Car:
+		return &c.Car
+	case Bike:
+		return &c.Bike
+	}
+	return &c.Foot
+}
+
+// ReadTurnCosts returns the turn costs stored in the graph directory base,
+// or nil if there are none.
+func ReadTurnCosts(base string) (*TurnCosts, error) {
+	file, err := os.Open(path.Join(base, TurnCostsFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	costs := &TurnCosts{}
+	if err := json.NewDecoder(file).Decode(costs); err != nil {
+		return nil, err
+	}
+	return costs, nil
+}
+
+// WriteTurnCosts stores the turn costs in the graph directory base. A nil
+// value removes them.
+func WriteTurnCosts(base string, costs *TurnCosts) error {
+	name := path.Join(base, TurnCostsFile)
+	if costs == nil {
+		if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	data, err := json.MarshalIndent(costs, "", "  ")
+	if err != nil {
+		return err
+	}
+	file, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// SetTurnCosts enables (or with nil, disables) the turn costs, which changes
+// the states of the graph. It must not be called while the graph is in use.
+func (g *GraphFile) SetTurnCosts(costs *TurnCosts) {
+	if costs == nil {
+		g.turnCosts = nil
+	} else {
+		c := *costs
+		g.turnCosts = &c
+	}
+	computeTurnIndex(g)
+}
+
+func (g *ClusterGraph) SetTurnCosts(costs *TurnCosts) {
+	for _, cluster := range g.Cluster {
+		cluster.SetTurnCosts(costs)
+	}
+}
+
+// The bearing of the edge e when leaving v, in 1/256 of a full circle
+// clockwise from north. For short distances, a planar approximation is
+// precise enough.
+func (g *GraphFile) edgeBearing(e Edge, v Vertex) uint8 {
+	p := g.VertexCoordinate(v)
+	q := g.VertexCoordinate(g.EdgeOpposite(e, v))
+	for _, c := range g.EdgeGeometry(e, v) {
+		if c != p {
+			q = c
+			break
+		}
+	}
+	dlat := q.Lat - p.Lat
+	dlng := (q.Lng - p.Lng) * math.Cos(p.Lat*math.Pi/180)
+	bearing := math.Atan2(dlng, dlat) / (2 * math.Pi) * 256
+	return uint8(int(math.Floor(bearing+0.5)) & 255)
+}
+
+// The penalty for a turn with the given angle in degrees, positive angles
+// are right turns.
+func (p *TurnPenalties) angle(angle float64) float64 {
+	abs := math.Abs(angle)
+	switch {
+	case abs < straightAngle:
+		return p.Straight
+	case abs >= sharpAngle:
+		return p.UTurn
+	case angle > 0 && abs < slightAngle:
+		return p.SlightRight
+	case angle > 0 && abs < turnAngle:
+		return p.Right
+	case angle > 0:
+		return p.SharpRight
+	case abs < slightAngle:
+		return p.SlightLeft
+	case abs < turnAngle:
+		return p.Left
+	}
+	return p.SharpLeft
+}
+
+// Returns true if at least two other edges at v have a higher speed limit
+// than the edges in and out, i.e., if the turn crosses a major road.
+func (g *GraphFile) crossesMajorRoad(in Edge, v Vertex, out Edge) bool {
+	limit := g.MaxSpeeds[in]
+	if g.MaxSpeeds[out] > limit {
+		limit = g.MaxSpeeds[out]
+	}
+	major := 0
+	g.visitRawEdges(v, func(e Edge) {
+		if e != in && e != out && g.MaxSpeeds[e] > limit {
+			major++
+		}
+	})
+	return major >= 2
+}
+
+// TurnCost returns the penalty in seconds for the turn from the edge in over
+// the vertex v onto the edge out. It is 0 without turn costs or if in is -1,
+// i.e., at the start of a path.
+func (g *GraphFile) TurnCost(in Edge, v Vertex, out Edge, t Transport) float64 {
+	i := g.awareIndex(v)
+	if g.turnCosts == nil || int(in) == -1 || i == -1 {
+		return 0
+	}
+	p := g.turnCosts.Penalties(t)
+	cost := 0.0
+	if in == out {
+		cost = p.UTurn
+	} else {
+		first := g.turns.states[i]
+		// We arrive in the opposite direction of the bearing of in at v.
+		before := int(g.turns.bearings[first+g.arcPosition(in, v)]) + 128
+		after := int(g.turns.bearings[first+g.arcPosition(out, v)])
+		diff := int(int8(uint8(after - before)))
+		cost = p.angle(float64(diff) * 360 / 256)
+	}
+	if p.CrossingMajorRoad != 0 && g.crossesMajorRoad(in, v, out) {
+		cost += p.CrossingMajorRoad
+	}
+	return cost
+}
+
+// The turn cost as a weight in the metric m.
+func (g *GraphFile) turnWeight(in Edge, v Vertex, out Edge, t Transport, m Metric) float32 {
+	if g.turnCosts == nil || m.Base() != Time {
+		return 0
+	}
+	return float32(g.TurnCost(in, v, out, t) / SecondsPerTimeUnit)
+}
@@ -0,0 +1,110 @@
+/*
+ * Copyright 2014 Florian Benz, Steven Schäfer, Bernhard Schommer
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package graph
+
+import (
+	"alg"
+	"geo"
+	"math"
+	"testing"
+)
+
+// A crossing at vertex 0 with a minor road from 1 (south) to 2 (north) and
+// a major road from 3 (east) to 4 (west).
+func crossingGraph() *GraphFile {
+	g := &GraphFile{
+		FirstOut:    []uint32{0, 4, 4, 4, 4, 4},
+		FirstIn:     []uint32{Sentinel, 0, 1, 2, 3},
+		NextIn:      []uint32{0, 1, 2, 3},
+		Edges:       []uint32{0 ^ 1, 0 ^ 2, 0 ^ 3, 0 ^ 4},
+		Coordinates: make([]int32, 10),
+		Steps:       []uint32{0, 0, 0, 0, 0},
+		Ferries:     []byte{0},
+		Roundabouts: []byte{0},
+		MaxSpeeds:   []uint16{30, 30, 50, 50},
+	}
+	for i := 0; i < 4; i++ {
+		g.Distances = append(g.Distances, alg.Float32ToHalf(100))
+	}
+	positions := []geo.Coordinate{
+		{Lat: 0, Lng: 0},
+		{Lat: -0.001, Lng: 0},
+		{Lat: 0.001, Lng: 0},
+		{Lat: 0, Lng: 0.001},
+		{Lat: 0, Lng: -0.001},
+	}
+	for i, c := range positions {
+		g.Coordinates[2*i], g.Coordinates[2*i+1] = c.Encode()
+	}
+	for t := range g.AccessEdge {
+		g.Access[t] = []byte{0x1f}
+		g.AccessEdge[t] = []byte{0xf}
+		g.Oneway[t] = []byte{0}
+	}
+	computeSearchAccess(g)
+	g.SetTurnCosts(&DefaultTurnCosts)
+	return g
+}
+
+func TestTurnCost(t *testing.T) {
+	g := crossingGraph()
+	car := DefaultTurnCosts.Car
+	tests := []struct {
+		in, out  Edge
+		expected float64
+	}{
+		{0, 1, car.Straight + car.CrossingMajorRoad},
+		{0, 2, car.Right},
+		{0, 3, car.Left},
+		{2, 3, car.Straight},
+		{2, 2, car.UTurn},
+	}
+	for _, test := range tests {
+		if cost := g.TurnCost(test.in, 0, test.out, Car); cost != test.expected {
+			t.Errorf("turn %v -> %v: got cost %v, expected %v", test.in, test.out, cost, test.expected)
+		}
+	}
+	if cost := g.TurnCost(-1, 0, 1, Car); cost != 0 {
+		t.Errorf("got cost %v at the start of a path", cost)
+	}
+	if cost := g.TurnCost(0, 0, 3, Foot); cost != 0 {
+		t.Errorf("got cost %v for pedestrians", cost)
+	}
+}
+
+func TestStateNeighborsTurnCosts(t *testing.T) {
+	g := crossingGraph()
+	s := g.arcState(0, 0)
+	for _, m := range []Metric{Distance, Time} {
+		for _, d := range g.StateNeighbors(s, true, Car, m, nil) {
+			// The neighbors are dead ends, i.e., vertex states.
+			e := Edge(d.Vertex - 1)
+			expected := g.EdgeWeight32(e, Car, m)
+			if m == Time {
+				expected += float32(g.TurnCost(0, 0, e, Car) / SecondsPerTimeUnit)
+			}
+			if math.Abs(float64(d.Weight-expected)) > 1e-4 {
+				t.Errorf("%v: got weight %v for edge %v, expected %v", m, d.Weight, e, expected)
+			}
+		}
+	}
+
+	g.SetTurnCosts(nil)
+	if g.StateCount() != g.VertexCount() {
+		t.Errorf("got %v states without turn costs, expected %v", g.StateCount(), g.VertexCount())
+	}
+}
@@ -0,0 +1,304 @@
+/*
+ * Copyright 2014 Florian Benz, Steven Schäfer, Bernhard Schommer
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package graph
+
+import (
+	"alg"
+	"math"
+	"sort"
+)
+
+// Turn-aware search
+//
+// A restricted turn or a turn cost depends on the edge over which we arrive
+// at a vertex, so Dijkstra's algorithm on the vertices of the graph cannot
+// respect it. The search runs on a graph of states instead. Every vertex v has
+// a vertex state with the id v, which stands for arriving at v without any
+// restriction, e.g., at the start of a path. In addition, every edge e
+// incident to a turn-aware vertex v (see VertexTurnAware) has an arc state for
+// arriving at v over e. The arc states of v are numbered consecutively after
+// all vertex states, in the order of VertexRawEdges(v).
+//
+// Arriving at a turn-aware vertex always leads to an arc state. As long as
+// no vertex is turn-aware, the state graph is identical to the graph itself.
+
+// A StateGraph supports the turn-aware search.
+type StateGraph interface {
+	StateCount() int
+	StateNeighbors(Vertex, bool, Transport, Metric, []Dart) []Dart
+}
+
+// TurnGraph presents the states of a StateGraph as the vertices of a graph.
+// Only VertexCount and VertexNeighbors are implemented, which is all that is
+// needed by Dijkstra's algorithm. Every other method panics.
+type TurnGraph struct {
+	Graph
+	States StateGraph
+}
+
+func NewTurnGraph(g StateGraph) *TurnGraph {
+	return &TurnGraph{States: g}
+}
+
+func (g *TurnGraph) VertexCount() int {
+	return g.States.StateCount()
+}
+
+func (g *TurnGraph) VertexNeighbors(v Vertex, forward bool, t Transport, m Metric, buf []Dart) []Dart {
+	return g.States.StateNeighbors(v, forward, t, m, buf)
+}
+
+// A TimedStateGraph evaluates the conditions at a given moment, see
+// conditions.go.
+type TimedStateGraph interface {
+	StateGraph
+	StateNeighborsAt(Vertex, bool, Transport, Metric, Moment, []Dart) []Dart
+}
+
+// VertexNeighborsAt implements TimedGraph. If the states do not support the
+// conditions, this is the same as VertexNeighbors.
+func (g *TurnGraph) VertexNeighborsAt(v Vertex, forward bool, t Transport, m Metric, at Moment, buf []Dart) []Dart {
+	if timed, ok := g.States.(TimedStateGraph); ok {
+		return timed.StateNeighborsAt(v, forward, t, m, at, buf)
+	}
+	return g.States.StateNeighbors(v, forward, t, m, buf)
+}
+
+// States of a GraphFile
+
+func (g *GraphFile) StateCount() int {
+	states := g.turns.states
+	if len(states) == 0 {
+		return g.VertexCount()
+	}
+	return g.VertexCount() + states[len(states)-1]
+}
+
+// The index of the turn-aware vertex which owns the arc state s.
+func (g *GraphFile) arcStateIndex(s Vertex) int {
+	offset := int(s) - g.VertexCount()
+	states := g.turns.states
+	return sort.Search(len(states), func(i int) bool { return states[i] > offset }) - 1
+}
+
+// StateVertex returns the vertex of the state s.
+func (g *GraphFile) StateVertex(s Vertex) Vertex {
+	if int(s) < g.VertexCount() {
+		return s
+	}
+	return g.turns.vertices[g.arcStateIndex(s)]
+}
+
+// StateEdge returns the edge over which the arc state s is reached, or -1
+// for a vertex state.
+func (g *GraphFile) StateEdge(s Vertex) Edge {
+	if int(s) < g.VertexCount() {
+		return Edge(-1)
+	}
+	i := g.arcStateIndex(s)
+	position := int(s) - g.VertexCount() - g.turns.states[i]
+	v := g.turns.vertices[i]
+	degree := int(g.FirstOut[v+1] - g.FirstOut[v])
+	if position < degree {
+		return Edge(int(g.FirstOut[v]) + position)
+	}
+	e := g.FirstIn[v]
+	for position -= degree; position > 0; position-- {
+		e = g.NextIn[e]
+	}
+	return Edge(e)
+}
+
+// The position of the edge e in VertexRawEdges(v).
+func (g *GraphFile) arcPosition(e Edge, v Vertex) int {
+	if uint32(e) >= g.FirstOut[v] && uint32(e) < g.FirstOut[v+1] {
+		return int(uint32(e) - g.FirstOut[v])
+	}
+	position := int(g.FirstOut[v+1] - g.FirstOut[v])
+	for i := g.FirstIn[v]; i != Sentinel && Edge(i) != e; i = g.NextIn[i] {
+		position++
+	}
+	return position
+}
+
+// The state for arriving at v over the edge e.
+func (g *GraphFile) arcState(e Edge, v Vertex) Vertex {
+	i := g.awareIndex(v)
+	if i == -1 {
+		return v
+	}
+	return Vertex(g.VertexCount() + g.turns.states[i] + g.arcPosition(e, v))
+}
+
+// VertexStates returns all states of the vertex v.
+func (g *GraphFile) VertexStates(v Vertex, buf []Vertex) []Vertex {
+	result := append(buf[:0], v)
+	if i := g.awareIndex(v); i != -1 {
+		for s := g.turns.states[i]; s < g.turns.states[i+1]; s++ {
+			result = append(result, Vertex(g.VertexCount()+s))
+		}
+	}
+	return result
+}
+
+// WayStates returns the states for a path which starts (forward) or ends at
+// the vertex v with the edge e, e.g., a way returned by the k-d tree. The
+// edge may be -1 if the path starts or ends at the vertex itself.
+func (g *GraphFile) WayStates(v Vertex, e Edge, forward bool, t Transport, buf []Vertex) []Vertex {
+	result := append(buf[:0], v)
+	if !g.VertexTurnAware(v) || int(e) == -1 && forward {
+		return result
+	}
+	if forward {
+		result[0] = g.arcState(e, v)
+		return result
+	}
+	g.visitRawEdges(v, func(in Edge) {
+		if int(e) == -1 || g.TurnAllowed(in, v, e, t) {
+			result = append(result, g.arcState(in, v))
+		}
+	})
+	return result
+}
+
+// Calls f for every edge incident to v, in the order of VertexRawEdges.
+func (g *GraphFile) visitRawEdges(v Vertex, f func(Edge)) {
+	for i := g.FirstOut[v]; i < g.FirstOut[v+1]; i++ {
+		f(Edge(i))
+	}
+	for i := g.FirstIn[v]; i != Sentinel; i = g.NextIn[i] {
+		f(Edge(i))
+		if i == g.NextIn[i] {
+			break
+		}
+	}
+}
+
+// Returns true if the edge e can be used to leave (forward) or to reach the
+// vertex v.
+func (g *GraphFile) edgeUsable(e Edge, v Vertex, forward bool, t Transport, access []byte) bool {
+	return alg.GetBit(access, uint(e)) && g.edgeDirectionUsable(e, v, forward, t)
+}
+
+// Returns true if the oneway flags allow to leave (forward) or to reach the
+// vertex v over the edge e.
+func (g *GraphFile) edgeDirectionUsable(e Edge, v Vertex, forward bool, t Transport) bool {
+	if !alg.GetBit(g.Oneway[t], uint(e)) {
+		return true
+	}
+	out := uint32(e) >= g.FirstOut[v] && uint32(e) < g.FirstOut[v+1]
+	return out == forward
+}
+
+func (g *GraphFile) StateNeighbors(s Vertex, forward bool, t Transport, m Metric, buf []Dart) []Dart {
+	return g.StateNeighborsAppend(s, forward, t, m, buf[:0])
+}
+
+func (g *GraphFile) StateNeighborsAppend(s Vertex, forward bool, t Transport, m Metric, result []Dart) []Dart {
+	return g.StateNeighborsAppendAt(s, forward, t, m, Static, result)
+}
+
+// StateNeighborsAt returns the neighbors of the state s when the search
+// reaches it at the moment at, which may be Static.
+func (g *GraphFile) StateNeighborsAt(s Vertex, forward bool, t Transport, m Metric, at Moment, buf []Dart) []Dart {
+	return g.StateNeighborsAppendAt(s, forward, t, m, at, buf[:0])
+}
+
+func (g *GraphFile) StateNeighborsAppendAt(s Vertex, forward bool, t Transport, m Metric, at Moment, result []Dart) []Dart {
+	if g.turns.aware == nil && (at == Static || g.conditions.edges == nil) {
+		return g.VertexNeighborsAppend(s, forward, t, m, result)
+	}
+
+	access := g.edgeAccess(t, m)
+	v := g.StateVertex(s)
+	in := g.StateEdge(s)
+	if forward {
+		// Leave v over every edge which may follow the edge in.
+		g.visitRawEdges(v, func(e Edge) {
+			if !g.edgeUsableAt(e, v, true, t, m, access, at) {
+				return
+			}
+			if int(in) != -1 && !g.TurnAllowed(in, v, e, t) {
+				return
+			}
+			w := g.EdgeOpposite(e, v)
+			weight := g.edgeWeightAt(e, t, m, at) + g.turnWeight(in, v, e, t, m) + g.delayWeight(v, t, m)
+			result = append(result, Dart{g.arcState(e, w), weight})
+		})
+		return result
+	}
+
+	// The predecessors of a vertex state: the vertex state is only used at
+	// the start of a path if v is turn-aware.
+	if int(in) == -1 && g.VertexTurnAware(v) {
+		return result
+	}
+	predecessor := func(e Edge) {
+		if !g.edgeUsableAt(e, v, false, t, m, access, at) {
+			return
+		}
+		u := g.EdgeOpposite(e, v)
+		w := g.edgeWeightAt(e, t, m, at) + g.delayWeight(u, t, m)
+		result = append(result, Dart{u, w})
+		if !g.VertexTurnAware(u) {
+			return
+		}
+		g.visitRawEdges(u, func(f Edge) {
+			if g.edgeUsableAt(f, u, false, t, m, access, at) && g.TurnAllowed(f, u, e, t) {
+				result = append(result, Dart{g.arcState(f, u), w + g.turnWeight(f, u, e, t, m)})
+			}
+		})
+	}
+	if int(in) != -1 {
+		predecessor(in)
+	} else {
+		g.visitRawEdges(v, predecessor)
+	}
+	return result
+}
+
+// StateEdgeBetween returns an edge (of minimum weight) which leads from the
+// state s to the state n, or -1 if there is none.
+func (g *GraphFile) StateEdgeBetween(s, n Vertex, t Transport, m Metric) Edge {
+	return g.StateEdgeBetweenAt(s, n, t, m, Static)
+}
+
+// StateEdgeBetweenAt is StateEdgeBetween for a search which reaches the state
+// s at the moment at.
+func (g *GraphFile) StateEdgeBetweenAt(s, n Vertex, t Transport, m Metric, at Moment) Edge {
+	if e := g.StateEdge(n); int(e) != -1 {
+		return e
+	}
+	access := g.edgeAccess(t, m)
+	v := g.StateVertex(s)
+	in := g.StateEdge(s)
+	minEdge := Edge(-1)
+	minWeight := float32(math.Inf(1))
+	g.visitRawEdges(v, func(e Edge) {
+		if g.EdgeOpposite(e, v) != n || !g.edgeUsableAt(e, v, true, t, m, access, at) {
+			return
+		}
+		if int(in) != -1 && !g.TurnAllowed(in, v, e, t) {
+			return
+		}
+		w := g.edgeWeightAt(e, t, m, at) + g.turnWeight(in, v, e, t, m)
+		if int(minEdge) == -1 || w < minWeight {
+			minEdge, minWeight = e, w
+		}
+	})
+	return minEdge
+}
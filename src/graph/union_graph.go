@@ -45,6 +45,10 @@ type UnionGraph struct {
 	Indices []int
 	Offsets []int
 	Size    int
+	// The arc states of the clusters follow after all vertex states, see
+	// turn_graph.go. The overlay graph has no turn-aware vertices.
+	StateOffsets []int
+	States       int
 }
 
 func NewUnionGraph(overlay *OverlayGraphFile, cluster []*GraphFile, indices []int) *UnionGraph {
@@ -55,12 +59,20 @@ func NewUnionGraph(overlay *OverlayGraphFile, cluster []*GraphFile, indices []in
 		boundary := overlay.ClusterSize(indices[i])
 		size += g.VertexCount() - boundary
 	}
+	states := size
+	stateOffsets := make([]int, len(cluster))
+	for i, g := range cluster {
+		stateOffsets[i] = states
+		states += g.StateCount() - g.VertexCount()
+	}
 	return &UnionGraph{
-		Overlay: overlay,
-		Cluster: cluster,
-		Indices: indices,
-		Offsets: offsets,
-		Size:    size,
+		Overlay:      overlay,
+		Cluster:      cluster,
+		Indices:      indices,
+		Offsets:      offsets,
+		Size:         size,
+		StateOffsets: stateOffsets,
+		States:       states,
 	}
 }
 
@@ -103,7 +115,7 @@ func (g *UnionGraph) ToUnionVertex(v Vertex, index int) Vertex {
 	if index != -1 {
 		clusterId := g.Indices[index]
 		offset := g.Overlay.ClusterSize(clusterId)
-		if int(v) > offset {
+		if int(v) >= offset {
 			// internal vertex
 			return Vertex(int(v) - offset + g.Offsets[index])
 		} else {
@@ -169,6 +181,104 @@ func (g *UnionGraph) VertexNeighbors(v Vertex, forward bool, t Transport, m Metr
 	return buf
 }
 
+// States for the turn-aware search, see turn_graph.go. The vertex states
+// of the union graph are its vertices, followed by the arc states of the
+// clusters.
+
+func (g *UnionGraph) StateCount() int {
+	return g.States
+}
+
+// union state -> union cluster id, -1 for the vertex states of overlay vertices
+func (g *UnionGraph) StateToCluster(s Vertex) int {
+	if int(s) < g.Size {
+		return g.VertexToCluster(s)
+	}
+	i := 0
+	for i < len(g.StateOffsets)-1 && int(s) >= g.StateOffsets[i+1] {
+		i++
+	}
+	return i
+}
+
+// union state -> cluster state, cluster
+func (g *UnionGraph) ToClusterState(s Vertex, index int) (Vertex, *GraphFile) {
+	if int(s) < g.Size {
+		return g.ToClusterVertex(s, index)
+	}
+	cluster := g.Cluster[index]
+	return Vertex(int(s) - g.StateOffsets[index] + cluster.VertexCount()), cluster
+}
+
+// cluster state + union cluster id -> union state
+func (g *UnionGraph) ToUnionState(s Vertex, index int) Vertex {
+	if index != -1 && int(s) >= g.Cluster[index].VertexCount() {
+		return Vertex(int(s) - g.Cluster[index].VertexCount() + g.StateOffsets[index])
+	}
+	return g.ToUnionVertex(s, index)
+}
+
+// union state -> union vertex
+func (g *UnionGraph) StateVertex(s Vertex) Vertex {
+	if int(s) < g.Size {
+		return s
+	}
+	index := g.StateToCluster(s)
+	s, cluster := g.ToClusterState(s, index)
+	return g.ToUnionVertex(cluster.StateVertex(s), index)
+}
+
+// The union states of a way returned by the k-d tree for the cluster with
+// the given union index, see GraphFile.WayStates.
+func (g *UnionGraph) WayStates(way Way, index int, forward bool, t Transport, buf []Vertex) []Vertex {
+	if index == -1 {
+		return append(buf[:0], way.Vertex)
+	}
+	buf = g.Cluster[index].WayStates(way.Vertex, way.Edge, forward, t, buf)
+	for i, s := range buf {
+		buf[i] = g.ToUnionState(s, index)
+	}
+	return buf
+}
+
+func (g *UnionGraph) StateNeighbors(s Vertex, forward bool, t Transport, m Metric, buf []Dart) []Dart {
+	return g.StateNeighborsAt(s, forward, t, m, Static, buf)
+}
+
+// StateNeighborsAt evaluates the conditions of the cluster edges at the
+// moment at. The shortcuts of the overlay graph are static, so a path only
+// uses them in the clusters which are not part of the union graph.
+func (g *UnionGraph) StateNeighborsAt(s Vertex, forward bool, t Transport, m Metric, at Moment, buf []Dart) []Dart {
+	index := g.StateToCluster(s)
+	if index == -1 {
+		// Overlay vertices are never turn-aware, but the in cluster edges of a
+		// boundary vertex may lead to arc states of the cluster. The shortcuts
+		// of a cluster in the union graph are left out: they start at the
+		// vertex state of the boundary vertex, regardless of the edge over
+		// which the search arrived there, and they ignore the conditions.
+		clusterId, vertexId := g.Overlay.VertexCluster(s)
+		for i, id := range g.Indices {
+			if clusterId == id {
+				buf = g.Overlay.GraphFile.VertexNeighbors(s, forward, t, m, buf)
+				current := len(buf)
+				buf = g.Cluster[i].StateNeighborsAppendAt(vertexId, forward, t, m, at, buf)
+				for j := current; j < len(buf); j++ {
+					buf[j].Vertex = g.ToUnionState(buf[j].Vertex, i)
+				}
+				return buf
+			}
+		}
+		return g.Overlay.VertexNeighbors(s, forward, t, m, buf)
+	}
+
+	local, cluster := g.ToClusterState(s, index)
+	buf = cluster.StateNeighborsAt(local, forward, t, m, at, buf)
+	for i := range buf {
+		buf[i].Vertex = g.ToUnionState(buf[i].Vertex, index)
+	}
+	return buf
+}
+
 // Mockups which you should never use, but which ensure that the interface is complete...
 
 func (g *UnionGraph) EdgeCount() int {
@@ -212,6 +322,11 @@ func (g *UnionGraph) EdgeFerry(Edge) bool {
 	return false
 }
 
+func (g *UnionGraph) EdgeRoundabout(Edge) bool {
+	panic("not implemented")
+	return false
+}
+
 func (g *UnionGraph) EdgeMaxSpeed(Edge) int {
 	panic("not implemented")
 	return 0
@@ -221,3 +336,13 @@ func (g *UnionGraph) EdgeOneway(Edge, Transport) bool {
 	panic("not implemented")
 	return false
 }
+
+func (g *UnionGraph) EdgeName(Edge) string {
+	panic("not implemented")
+	return ""
+}
+
+func (g *UnionGraph) EdgeRef(Edge) string {
+	panic("not implemented")
+	return ""
+}
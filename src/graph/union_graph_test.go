@@ -0,0 +1,81 @@
+/*
+ * Copyright 2014 Florian Benz, Steven Schäfer, Bernhard Schommer
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package graph
+
+import (
+	"testing"
+)
+
+// An overlay graph with two clusters of two boundary vertices each, and the
+// first cluster with two more interior vertices. Only the first cluster is
+// part of the union graph.
+func unionGraph() *UnionGraph {
+	overlay := &OverlayGraphFile{
+		GraphFile: &GraphFile{
+			FirstOut: []uint32{0, 0, 0, 0, 0},
+			FirstIn:  []uint32{Sentinel, Sentinel, Sentinel, Sentinel},
+		},
+		Cluster: []uint32{0, 2, 4},
+	}
+	computeClusterIndex(overlay)
+	// A shortcut of weight 1 between the boundary vertices of each cluster.
+	overlay.Matrices = make([][][]float32, TransportMax)
+	for t := range overlay.Matrices {
+		overlay.Matrices[t] = make([][]float32, MetricMax)
+		for m := range overlay.Matrices[t] {
+			overlay.Matrices[t][m] = []float32{0, 1, 1, 0, 0, 1, 1, 0}
+		}
+	}
+	cluster := &GraphFile{
+		FirstOut: []uint32{0, 0, 0, 0, 0},
+		FirstIn:  []uint32{Sentinel, Sentinel, Sentinel, Sentinel},
+	}
+	return NewUnionGraph(overlay, []*GraphFile{cluster}, []int{0})
+}
+
+func TestUnionVertex(t *testing.T) {
+	g := unionGraph()
+	if g.VertexCount() != 6 {
+		t.Fatalf("got %d vertices, expected 6", g.VertexCount())
+	}
+	// The boundary vertices are the overlay vertices 0 and 1, the interior
+	// vertices 2 and 3 of the cluster follow the overlay vertices.
+	expected := []Vertex{0, 1, 4, 5}
+	for i, u := range expected {
+		v := Vertex(i)
+		if w := g.ToUnionVertex(v, 0); w != u {
+			t.Errorf("cluster vertex %d: got union vertex %d, expected %d", v, w, u)
+		}
+		index := g.VertexToCluster(u)
+		if w, _ := g.ToClusterVertex(u, index); w != v {
+			t.Errorf("union vertex %d: got cluster vertex %d, expected %d", u, w, v)
+		}
+	}
+}
+
+func TestUnionShortcuts(t *testing.T) {
+	g := unionGraph()
+	// The cluster in the union graph is searched on its states, the other
+	// one by its shortcuts.
+	if darts := g.StateNeighbors(0, true, Car, Distance, nil); len(darts) != 0 {
+		t.Errorf("got neighbors %v of a boundary vertex of the union cluster", darts)
+	}
+	darts := g.StateNeighbors(2, true, Car, Distance, nil)
+	if len(darts) != 1 || darts[0].Vertex != 3 || darts[0].Weight != 1 {
+		t.Errorf("got neighbors %v, expected the shortcut to 3", darts)
+	}
+}
@@ -105,7 +105,39 @@ func mapSteps(g *GraphFile, edgeIndices []int) int {
 	return size
 }
 
-func createGraphFile(base string, vertexCount, edgeCount, stepSize int) (*GraphFile, error) {
+// Map the strings used by the edges of the subgraph to a compact string table.
+// Returns the mapping, containing -1 if the string is not used, the number of
+// strings and the size of the new strings file.
+func mapStrings(g *GraphFile, edgeIndices []int) ([]int, int, int) {
+	stringMap := make([]int, g.StringCount())
+	for i := range stringMap {
+		stringMap[i] = -1
+	}
+
+	// The empty string is always present.
+	stringMap[0] = 0
+	count, size := 1, 1
+	if g.StringOffsets == nil {
+		return stringMap, count, size
+	}
+
+	for e := 0; e < g.EdgeCount(); e++ {
+		if edgeIndices[e] == -1 {
+			continue
+		}
+		for _, id := range []uint32{g.Names[e], g.Refs[e], g.Destinations[e]} {
+			if stringMap[id] != -1 {
+				continue
+			}
+			stringMap[id] = count
+			count++
+			size += int(g.StringOffsets[id+1] - g.StringOffsets[id])
+		}
+	}
+	return stringMap, count, size
+}
+
+func createGraphFile(base string, vertexCount, edgeCount, stepSize, stringCount, stringSize int) (*GraphFile, error) {
 	g := &GraphFile{}
 	vertexBits := (vertexCount + 7) / 8
 	edgeBits := (edgeCount + 7) / 8
@@ -117,20 +149,29 @@ func createGraphFile(base string, vertexCount, edgeCount, stepSize int) (*GraphF
 		{"vertices.ftf", vertexCount + 1, &g.FirstOut},
 		{"vertices-in.ftf", vertexCount, &g.FirstIn},
 		{"positions.ftf", 2 * vertexCount, &g.Coordinates},
+		{"delays.ftf", vertexCount, &g.Delays},
 		{"vaccess-car.ftf", vertexBits, &g.Access[Car]},
 		{"vaccess-bike.ftf", vertexBits, &g.Access[Bike]},
 		{"vaccess-foot.ftf", vertexBits, &g.Access[Foot]},
 		{"access-car.ftf", edgeBits, &g.AccessEdge[Car]},
 		{"access-bike.ftf", edgeBits, &g.AccessEdge[Bike]},
 		{"access-foot.ftf", edgeBits, &g.AccessEdge[Foot]},
-		{"oneway.ftf", edgeBits, &g.Oneway},
+		{"oneway.ftf", edgeBits, &g.Oneway[Car]},
+		{"oneway-bike.ftf", edgeBits, &g.Oneway[Bike]},
+		{"oneway-foot.ftf", edgeBits, &g.Oneway[Foot]},
 		{"edges-next.ftf", edgeCount, &g.NextIn},
 		{"edges.ftf", edgeCount, &g.Edges},
 		{"distances.ftf", edgeCount, &g.Distances},
 		{"steps.ftf", edgeCount + 1, &g.Steps},
 		{"step_positions.ftf", stepSize, &g.StepPositions},
 		{"ferries.ftf", edgeBits, &g.Ferries},
+		{"roundabouts.ftf", edgeBits, &g.Roundabouts},
 		{"maxspeeds.ftf", edgeCount, &g.MaxSpeeds},
+		{"names.ftf", edgeCount, &g.Names},
+		{"refs.ftf", edgeCount, &g.Refs},
+		{"destinations.ftf", edgeCount, &g.Destinations},
+		{"string_offsets.ftf", stringCount + 1, &g.StringOffsets},
+		{"strings.ftf", stringSize, &g.Strings},
 	}
 
 	for _, file := range files {
@@ -193,6 +234,9 @@ func writeVertexAttributes(input, output *GraphFile, vertexIndices, edgeIndices
 		// Finally, the coordinates and access flags are easy:
 		output.Coordinates[2*a] = input.Coordinates[2*u]
 		output.Coordinates[2*a+1] = input.Coordinates[2*u+1]
+		if input.Delays != nil {
+			output.Delays[a] = input.Delays[u]
+		}
 		for t := 0; t < int(TransportMax); t++ {
 			if alg.GetBit(input.Access[t], uint(u)) {
 				alg.SetBit(output.Access[t], uint(a))
@@ -230,17 +274,20 @@ func writeEdgeAttributes(input, output *GraphFile, edgeIndices []int) {
 		}
 
 		// Edge flags
-		if alg.GetBit(input.Oneway, uint(e)) {
-			alg.SetBit(output.Oneway, uint(f))
-		}
 		for t := 0; t < int(TransportMax); t++ {
 			if alg.GetBit(input.AccessEdge[t], uint(e)) {
 				alg.SetBit(output.AccessEdge[t], uint(f))
 			}
+			if alg.GetBit(input.Oneway[t], uint(e)) {
+				alg.SetBit(output.Oneway[t], uint(f))
+			}
 		}
 		if alg.GetBit(input.Ferries, uint(e)) {
 			alg.SetBit(output.Ferries, uint(f))
 		}
+		if input.EdgeRoundabout(Edge(e)) {
+			alg.SetBit(output.Roundabouts, uint(f))
+		}
 
 		// Distances
 		output.Distances[f] = input.Distances[e]
@@ -298,6 +345,99 @@ func writeEdgeSteps(input, output *GraphFile, edgeIndices []int) {
 	}
 }
 
+func writeEdgeStrings(input, output *GraphFile, edgeIndices, stringMap []int) {
+	// Compute the string sizes, including the terminating zero...
+	output.StringOffsets[0] = 1
+	for id, i := range stringMap {
+		if i > 0 {
+			output.StringOffsets[i] = input.StringOffsets[id+1] - input.StringOffsets[id]
+		}
+	}
+
+	// store the partial sums...
+	offset := uint32(0)
+	for i := 0; i < len(output.StringOffsets); i++ {
+		size := output.StringOffsets[i]
+		output.StringOffsets[i] = offset
+		offset += size
+	}
+
+	// and copy the strings. The new file is zero filled, so string 0 is
+	// already in place.
+	for id, i := range stringMap {
+		if i > 0 {
+			inString := input.Strings[input.StringOffsets[id]:input.StringOffsets[id+1]]
+			copy(output.Strings[output.StringOffsets[i]:], inString)
+		}
+	}
+
+	if input.StringOffsets == nil {
+		return
+	}
+	for e := 0; e < input.EdgeCount(); e++ {
+		f := edgeIndices[e]
+		if f == -1 {
+			continue
+		}
+		output.Names[f] = uint32(stringMap[input.Names[e]])
+		output.Refs[f] = uint32(stringMap[input.Refs[e]])
+		output.Destinations[f] = uint32(stringMap[input.Destinations[e]])
+	}
+}
+
+// Restrictions are only kept if the subgraph contains all of their edges.
+func writeRestrictions(input *GraphFile, base string, vertexIndices, edgeIndices []int) error {
+	restrictions := []Restriction(nil)
+	for _, r := range DecodeRestrictions(input.Restrictions) {
+		mapped := vertexIndices[r.Via] != -1
+		edges := make([]Edge, len(r.Edges))
+		for i, e := range r.Edges {
+			edges[i] = Edge(edgeIndices[e])
+			mapped = mapped && edgeIndices[e] != -1
+		}
+		if mapped {
+			r.Via = Vertex(vertexIndices[r.Via])
+			r.Edges = edges
+			restrictions = append(restrictions, r)
+		}
+	}
+	if len(restrictions) == 0 {
+		return nil
+	}
+
+	data := EncodeRestrictions(restrictions)
+	var output []uint32
+	err := mm.Create(path.Join(base, "restrictions.ftf"), len(data), &output)
+	if err != nil {
+		return err
+	}
+	copy(output, data)
+	return mm.Close(&output)
+}
+
+// Conditions are kept if the subgraph contains their edge.
+func writeConditions(input *GraphFile, base string, edgeIndices []int) error {
+	conditions := []Condition(nil)
+	for _, c := range input.conditions.conditions {
+		if f := edgeIndices[c.Edge]; f != -1 {
+			c.Edge = Edge(f)
+			conditions = append(conditions, c)
+		}
+	}
+	if len(conditions) == 0 {
+		return nil
+	}
+
+	data := EncodeConditions(conditions)
+	var output []uint32
+	err := mm.Create(path.Join(base, "conditions.ftf"), len(data), &output)
+	if err != nil {
+		return err
+	}
+	copy(output, data)
+	return mm.Close(&output)
+}
+
 // Output a subgraph of g to the directory path. A vertex v of g
 // becomes the vertex with index indices[v] in the subgraph if
 // indices[v] != -1. An edge {u, v} exists in the subgraph if
@@ -307,9 +447,10 @@ func (g *GraphFile) WriteSubgraph(base string, indices, partition []int) error {
 	vertexMap, vertexCount := validateNodeIndices(g, indices)
 	edgeIndices, edgeCount := mapEdges(g, indices, partition, vertexMap)
 	stepCount := mapSteps(g, edgeIndices)
+	stringMap, stringCount, stringSize := mapStrings(g, edgeIndices)
 
 	// Create the new graph file.
-	out, err := createGraphFile(base, vertexCount, edgeCount, stepCount)
+	out, err := createGraphFile(base, vertexCount, edgeCount, stepCount, stringCount, stringSize)
 	if err != nil {
 		return err
 	}
@@ -319,6 +460,13 @@ func (g *GraphFile) WriteSubgraph(base string, indices, partition []int) error {
 	writeEdgeAttributes(g, out, edgeIndices)
 	writeEdgeSteps(g, out, edgeIndices)
 	writeEdges(g, out, indices, edgeIndices)
+	writeEdgeStrings(g, out, edgeIndices, stringMap)
+	if err := writeRestrictions(g, base, indices, edgeIndices); err != nil {
+		return err
+	}
+	if err := writeConditions(g, base, edgeIndices); err != nil {
+		return err
+	}
 
 	return CloseGraphFile(out)
 }
@@ -155,7 +155,9 @@ func ValidateBitmaps(g *graph.GraphFile) {
 		{"edge access car",  esize, len(g.AccessEdge[graph.Car])},
 		{"edge access bike", esize, len(g.AccessEdge[graph.Bike])},
 		{"edge access foot", esize, len(g.AccessEdge[graph.Foot])},
-		{"oneway",  esize, len(g.Oneway)},
+		{"oneway car",  esize, len(g.Oneway[graph.Car])},
+		{"oneway bike", esize, len(g.Oneway[graph.Bike])},
+		{"oneway foot", esize, len(g.Oneway[graph.Foot])},
 		{"ferries", esize, len(g.Ferries)},
 	}
 	for _, ary := range arrays {
@@ -242,6 +244,44 @@ func ValidateSteps(g *graph.GraphFile) {
 	}
 }
 
+// Every restriction has to describe a path of adjacent edges and the via
+// vertex has to be the common vertex of the first two edges.
+func ValidateRestrictions(g *graph.GraphFile) {
+	edges := []graph.Edge(nil)
+	incident := func(e graph.Edge, v graph.Vertex) bool {
+		edges = g.VertexRawEdges(v, edges)
+		for _, f := range edges {
+			if f == e {
+				return true
+			}
+		}
+		return false
+	}
+	
+	for i, r := range graph.DecodeRestrictions(g.Restrictions) {
+		if len(r.Edges) < 2 || int(r.Via) >= g.VertexCount() {
+			log.Fatalf("Restriction %v is malformed: %v.", i, r)
+		}
+		for _, e := range r.Edges {
+			if int(e) >= g.EdgeCount() {
+				log.Fatalf("Restriction %v: edge %v out of range.", i, e)
+			}
+		}
+		if !incident(r.From(), r.Via) {
+			log.Fatalf("Restriction %v: the from edge does not end at the via vertex.", i)
+		}
+		
+		// Follow the remaining edges, starting at the via vertex.
+		v := r.Via
+		for _, e := range r.Edges[1:] {
+			if !incident(e, v) {
+				log.Fatalf("Restriction %v: edge %v does not start at vertex %v.", i, e, v)
+			}
+			v = g.EdgeOpposite(e, v)
+		}
+	}
+}
+
 func ValidateGraphFile(g *graph.GraphFile) {
 	fmt.Printf(" * Vertex Count: %v\n", g.VertexCount())
 	fmt.Printf(" * Edge Count:   %v\n", g.EdgeCount())
@@ -259,6 +299,8 @@ func ValidateGraphFile(g *graph.GraphFile) {
 	ValidateWeights(g)
 	println(" * Validate Steps")
 	ValidateSteps(g)
+	println(" * Validate Restrictions")
+	ValidateRestrictions(g)
 }
 
 
@@ -0,0 +1,168 @@
+/*
+ * Copyright 2014 Florian Benz, Steven Schäfer, Bernhard Schommer
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kdtree
+
+import (
+	"geo"
+	"graph"
+	"sort"
+)
+
+// Construction of the k-d trees, see kdtreebuilder. Every vertex and every
+// step of an edge is a point of the tree, identified by its encoded step.
+
+// NewKdTree creates the k-d tree of a cluster graph and returns it along
+// with the bounding box of the graph.
+func NewKdTree(g *graph.GraphFile) (*KdTree, geo.BBox) {
+	t := &KdTree{Graph: g, EncodedSteps: []uint64(nil), Coordinates: []geo.Coordinate(nil)}
+	bbox := geo.NewBBoxPoint(g.VertexCoordinate(graph.Vertex(0)))
+
+	// line up all coordinates and their encodings in the subgraph
+	steps := []geo.Coordinate(nil)
+	for i := 0; i < g.VertexCount(); i++ {
+		vertex := graph.Vertex(i)
+		t.Coordinates = append(t.Coordinates, g.VertexCoordinate(vertex))
+		t.AppendEncodedStep(EncodeStep(i, MaxEdgeOffset, MaxStepOffset))
+		bbox = bbox.Union(geo.NewBBoxPoint(g.VertexCoordinate(vertex)))
+		degree := g.FirstOut[i+1] - g.FirstOut[i]
+		for j := uint32(0); j < degree; j++ {
+			e := graph.Edge(g.FirstOut[i] + j)
+			if g.VertexAccessMask(vertex) == 0 || g.VertexAccessMask(g.EdgeOpposite(e, vertex)) == 0 {
+				// Vertices without access are copies of via ways (see refine)
+				// and must never be the result of a nearest neighbor query.
+				continue
+			}
+			steps = g.EdgeSteps(e, vertex, steps)
+
+			if len(steps) > 2000 {
+				panic("steps > 2000")
+			}
+
+			for k, s := range steps {
+				t.Coordinates = append(t.Coordinates, s)
+				t.AppendEncodedStep(EncodeStep(i, int(j), k))
+				bbox = bbox.Union(geo.NewBBoxPoint(s))
+			}
+		}
+	}
+
+	sortTree(t, true)
+	t.encodeCoordinates()
+	return t, bbox
+}
+
+// NewOverlayKdTree creates the k-d tree of the overlay graph, which contains
+// the boundary vertices and the steps of the cut edges.
+func NewOverlayKdTree(g *graph.OverlayGraphFile) *KdTree {
+	t := &KdTree{
+		Graph:        g.GraphFile,
+		EncodedSteps: []uint64(nil),
+		Coordinates:  []geo.Coordinate(nil),
+	}
+	cuts := g.GraphFile
+
+	// line up all coordinates and their encodings in the overlay graph
+	steps := []geo.Coordinate(nil)
+	for i := 0; i < cuts.VertexCount(); i++ {
+		vertex := graph.Vertex(i)
+		t.Coordinates = append(t.Coordinates, cuts.VertexCoordinate(vertex))
+		t.AppendEncodedStep(EncodeStep(i, MaxEdgeOffset, MaxStepOffset))
+		degree := cuts.FirstOut[i+1] - cuts.FirstOut[i]
+		for j := uint32(0); j < degree; j++ {
+			e := graph.Edge(cuts.FirstOut[i] + j)
+			steps = cuts.EdgeSteps(e, vertex, steps)
+
+			for k, s := range steps {
+				t.Coordinates = append(t.Coordinates, s)
+				t.AppendEncodedStep(EncodeStep(i, int(j), k))
+			}
+		}
+	}
+
+	sortTree(t, true)
+	t.encodeCoordinates()
+	return t
+}
+
+// EncodeStep returns the encoding of the k-th step of the j-th out edge of
+// a vertex, or of the vertex itself if both offsets are at their maximum.
+func EncodeStep(vertexIndex, edgeOffset, stepOffset int) uint64 {
+	if vertexIndex > MaxVertexIndex {
+		panic("vertex index too large")
+	}
+	// both offsets are at max if only a vertex is encoded
+	if edgeOffset != MaxEdgeOffset && stepOffset != MaxStepOffset {
+		if edgeOffset >= MaxEdgeOffset {
+			panic("edge offset too large")
+		}
+		if stepOffset >= MaxStepOffset {
+			panic("step offset too large")
+		}
+	}
+
+	ec := uint64(vertexIndex) << (EdgeOffsetBits + StepOffsetBits)
+	ec |= uint64(edgeOffset) << StepOffsetBits
+	ec |= uint64(stepOffset)
+	return ec
+}
+
+// The coordinates in the format of coordinates.ftf, which is what the
+// nearest neighbor search uses.
+func (t *KdTree) encodeCoordinates() {
+	t.EncodedCoordinates = make([]int32, 2*len(t.Coordinates))
+	for i, c := range t.Coordinates {
+		t.EncodedCoordinates[2*i], t.EncodedCoordinates[2*i+1] = c.Encode()
+	}
+}
+
+type byLat struct {
+	*KdTree
+}
+
+func (x byLat) Less(i, j int) bool {
+	return x.KdTree.Coordinates[i].Lat < x.KdTree.Coordinates[j].Lat
+}
+
+type byLng struct {
+	*KdTree
+}
+
+func (x byLng) Less(i, j int) bool {
+	return x.KdTree.Coordinates[i].Lng < x.KdTree.Coordinates[j].Lng
+}
+
+func subKdTree(t *KdTree, from, to int) *KdTree {
+	// The EncodedSteps slice is restricted by pointers and not with a new slice due to its encoding.
+	return &KdTree{Graph: t.Graph, EncodedSteps: t.EncodedSteps, Coordinates: t.Coordinates[from:to],
+		EncodedStepsStart: t.EncodedStepsStart + from, EncodedStepsEnd: t.EncodedStepsStart + to - 1}
+}
+
+// sortTree sorts the given tree by comparing either lat or long
+func sortTree(t *KdTree, compareLat bool) {
+	if t.Len() <= 1 {
+		return
+	}
+	if compareLat {
+		sort.Sort(byLat{t})
+	} else {
+		sort.Sort(byLng{t})
+	}
+	// sort recursively both halfs with the comparison alternating between lat and long
+	middle := t.Len() / 2
+	sortTree(subKdTree(t, 0, middle), !compareLat)
+	sortTree(subKdTree(t, middle+1, t.Len()), !compareLat)
+}
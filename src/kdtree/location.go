@@ -62,7 +62,7 @@ func (l Location) Decode(forward bool, transport graph.Transport, steps *[]geo.C
 	if int(edge) == -1 {
 		// The easy case, where we hit some vertex exactly.
 		target := g.VertexCoordinate(vertex)
-		way := graph.Way{Length: 0, Vertex: vertex, Steps: nil, Target: target}
+		way := graph.Way{Length: 0, Vertex: vertex, Edge: edge, Steps: nil, Target: target}
 		return []graph.Way{way}
 	}
 
@@ -104,14 +104,14 @@ func (l Location) Decode(forward bool, transport graph.Transport, steps *[]geo.C
 	var w []graph.Way
 	if !oneway {
 		w = make([]graph.Way, 2) // bidirectional
-		w[0] = graph.Way{Length: l1, Vertex: t1, Steps: b1, Forward: forward, Target: target}
-		w[1] = graph.Way{Length: l2, Vertex: t2, Steps: b2, Forward: forward, Target: target}
+		w[0] = graph.Way{Length: l1, Vertex: t1, Edge: edge, Steps: b1, Forward: forward, Target: target}
+		w[1] = graph.Way{Length: l2, Vertex: t2, Edge: edge, Steps: b2, Forward: forward, Target: target}
 	} else {
 		w = make([]graph.Way, 1) // one way
 		if forward {
-			w[0] = graph.Way{Length: l2, Vertex: t2, Steps: b2, Forward: forward, Target: target}
+			w[0] = graph.Way{Length: l2, Vertex: t2, Edge: edge, Steps: b2, Forward: forward, Target: target}
 		} else {
-			w[0] = graph.Way{Length: l1, Vertex: t1, Steps: b1, Forward: forward, Target: target}
+			w[0] = graph.Way{Length: l1, Vertex: t1, Edge: edge, Steps: b1, Forward: forward, Target: target}
 		}
 	}
 	return w
@@ -25,12 +25,12 @@ import (
 	"math"
 	"mm"
 	"path"
+	"sort"
 )
 
 var (
-	inf           float64
-	e             ellipsoid.Ellipsoid
-	clusterKdTree ClusterKdTree
+	inf float64
+	e   ellipsoid.Ellipsoid
 )
 
 type NN struct {
@@ -44,65 +44,91 @@ func init() {
 	e = ellipsoid.Init("WGS84", ellipsoid.Degrees, ellipsoid.Meter, ellipsoid.Longitude_is_symmetric, ellipsoid.Bearing_is_symmetric)
 }
 
-func LoadKdTree(clusterGraph *graph.ClusterGraph, base string) error {
+// LoadKdTree opens the k-d trees of all clusters and of the overlay graph as
+// well as the bounding boxes of the clusters.
+func LoadKdTree(clusterGraph *graph.ClusterGraph, base string) (*ClusterKdTree, error) {
+	t := &ClusterKdTree{Cluster: make([]*KdTree, 0, len(clusterGraph.Cluster))}
+
 	// Load the k-d tree of all clusters
-	clusterKdTrees := make([]*KdTree, len(clusterGraph.Cluster))
 	for i, g := range clusterGraph.Cluster {
 		clusterDir := path.Join(base, fmt.Sprintf("/cluster%d", i+1))
-		var encodedSteps []uint64
-		var encodedCoordinates []int32
-		err := mm.Open(path.Join(clusterDir, "kdtree.ftf"), &encodedSteps)
-		if err != nil {
-			return err
-		}
-		err = mm.Open(path.Join(clusterDir, "coordinates.ftf"), &encodedCoordinates)
+		kdTree, err := openKdTree(g, clusterDir)
 		if err != nil {
-			return err
-		}
-		clusterKdTrees[i] = &KdTree{
-			Graph:              g,
-			EncodedSteps:       encodedSteps,
-			EncodedCoordinates: encodedCoordinates,
+			CloseKdTree(t)
+			return nil, err
 		}
+		t.Cluster = append(t.Cluster, kdTree)
 	}
 
 	// Load the k-d tree of the overlay graph
-	var encodedSteps []uint64
-	var encodedCoordinates []int32
-	err := mm.Open(path.Join(base, "/overlay/kdtree.ftf"), &encodedSteps)
-	if err != nil {
-		return err
-	}
-	err = mm.Open(path.Join(base, "/overlay/coordinates.ftf"), &encodedCoordinates)
+	overlayKdTree, err := openKdTree(clusterGraph.Overlay.GraphFile, path.Join(base, "/overlay"))
 	if err != nil {
-		return err
-	}
-	overlayKdTree := &KdTree{
-		Graph:              clusterGraph.Overlay.GraphFile,
-		EncodedSteps:       encodedSteps,
-		EncodedCoordinates: encodedCoordinates,
+		CloseKdTree(t)
+		return nil, err
 	}
+	t.Overlay = overlayKdTree
 
 	// Load the bounding boxes of the clusters
 	var bboxesFile []int32
 	err = mm.Open(path.Join(base, "bboxes.ftf"), &bboxesFile)
 	if err != nil {
-		return err
+		CloseKdTree(t)
+		return nil, err
 	}
 	if len(bboxesFile)/4 != clusterGraph.Overlay.ClusterCount() {
-		return errors.New("size of bboxes file does not match cluster count")
+		mm.Close(&bboxesFile)
+		CloseKdTree(t)
+		return nil, errors.New("size of bboxes file does not match cluster count")
+	}
+	t.BBoxes = make([]geo.BBox, len(bboxesFile)/4)
+	for i, _ := range t.BBoxes {
+		t.BBoxes[i] = geo.DecodeBBox(bboxesFile[4*i : 4*i+4])
+	}
+	if err := mm.Close(&bboxesFile); err != nil {
+		CloseKdTree(t)
+		return nil, err
+	}
+	return t, nil
+}
+
+func openKdTree(g *graph.GraphFile, dir string) (*KdTree, error) {
+	t := &KdTree{Graph: g}
+	err := mm.Open(path.Join(dir, "kdtree.ftf"), &t.EncodedSteps)
+	if err != nil {
+		return nil, err
+	}
+	err = mm.Open(path.Join(dir, "coordinates.ftf"), &t.EncodedCoordinates)
+	if err != nil {
+		mm.Close(&t.EncodedSteps)
+		return nil, err
+	}
+	return t, nil
+}
+
+// CloseKdTree unmaps all k-d trees, which must not be used afterwards.
+func CloseKdTree(t *ClusterKdTree) error {
+	trees := t.Cluster
+	if t.Overlay != nil {
+		trees = append(trees, t.Overlay)
 	}
-	bboxes := make([]geo.BBox, len(bboxesFile)/4)
-	for i, _ := range bboxes {
-		bboxes[i] = geo.DecodeBBox(bboxesFile[4*i : 4*i+4])
+	var result error
+	for _, kdTree := range trees {
+		for _, p := range []interface{}{&kdTree.EncodedSteps, &kdTree.EncodedCoordinates} {
+			if err := mm.Close(p); err != nil && result == nil {
+				result = err
+			}
+		}
 	}
+	return result
+}
 
-	clusterKdTree = ClusterKdTree{
-		Overlay: overlayKdTree,
-		Cluster: clusterKdTrees,
-		BBoxes:  bboxes,
+// MappedSize returns the size in bytes of all memory mapped k-d trees.
+func (t *ClusterKdTree) MappedSize() int {
+	size := 0
+	for _, kdTree := range append([]*KdTree{t.Overlay}, t.Cluster...) {
+		size += 8*len(kdTree.EncodedSteps) + 4*len(kdTree.EncodedCoordinates)
 	}
-	return nil
+	return size
 }
 
 var linear = 0
@@ -110,7 +136,7 @@ var linear = 0
 // NearestNeighbor returns -1 if the location is on the overlay graph
 // No fail strategy: a nearest point on the overlay graph is always returned if no point
 // is found in the clusters.
-func NearestNeighbor(x geo.Coordinate, trans graph.Transport) Location {
+func (clusterKdTree *ClusterKdTree) NearestNeighbor(x geo.Coordinate, trans graph.Transport) Location {
 	// first search on the overlay graph
 	t := clusterKdTree.Overlay
 	nn := &NN{
@@ -293,3 +319,194 @@ func (nn *NN) decodeCoordinate(i int) (geo.Coordinate, bool) {
 func distance(x, y geo.Coordinate) float64 {
 	return (x.Lat-y.Lat)*(x.Lat-y.Lat) + (x.Lng-y.Lng)*(x.Lng-y.Lng)
 }
+
+// Neighbor is one result of a k-nearest neighbor query.
+type Neighbor struct {
+	Location   Location
+	Coordinate geo.Coordinate
+	Distance   float64 // in meter
+}
+
+// candidate of the k-nearest neighbor search within a single k-d tree
+type candidate struct {
+	index    int
+	coord    geo.Coordinate
+	distance float64 // squared euclidian distance
+	key      uint64  // vertex or edge which is represented by this candidate
+}
+
+// candidates is a list of at most k candidates sorted by distance, where
+// every vertex or edge occurs at most once.
+type candidates struct {
+	k     int
+	items []candidate
+}
+
+func (c *candidates) full() bool {
+	return len(c.items) >= c.k
+}
+
+func (c *candidates) worst() float64 {
+	return c.items[len(c.items)-1].distance
+}
+
+func (c *candidates) insert(x candidate) {
+	// Several steps of the same edge are all close to each other, but we
+	// are only interested in the closest one.
+	for i, item := range c.items {
+		if item.key == x.key {
+			if x.distance >= item.distance {
+				return
+			}
+			c.items = append(c.items[:i], c.items[i+1:]...)
+			break
+		}
+	}
+	if c.full() && x.distance >= c.worst() {
+		return
+	}
+	i := len(c.items)
+	for i > 0 && c.items[i-1].distance > x.distance {
+		i--
+	}
+	c.items = append(c.items, candidate{})
+	copy(c.items[i+1:], c.items[i:])
+	c.items[i] = x
+	if len(c.items) > c.k {
+		c.items = c.items[:c.k]
+	}
+}
+
+// KNearestNeighbors returns up to k accessible locations closest to x, sorted by
+// their distance. Every vertex and every edge is only returned once, even if
+// several of its steps are close to x. As for NearestNeighbor, only clusters
+// whose bounding box contains x are searched in addition to the overlay graph.
+func (clusterKdTree *ClusterKdTree) KNearestNeighbors(x geo.Coordinate, trans graph.Transport, k int) []Neighbor {
+	if k <= 0 {
+		return nil
+	}
+	trees := []*KdTree{clusterKdTree.Overlay}
+	clusters := []int{-1}
+	for i, b := range clusterKdTree.BBoxes {
+		if b.Contains(x) {
+			trees = append(trees, clusterKdTree.Cluster[i])
+			clusters = append(clusters, i)
+		}
+	}
+
+	neighbors := []Neighbor(nil)
+	for i, t := range trees {
+		nn := &NN{
+			kdTree: t,
+			x:      x,
+			trans:  trans,
+		}
+		best := &candidates{k: k}
+		nn.kSearch(0, t.EncodedStepLen()-1, true /* compareLat */, best)
+		for _, c := range best.items {
+			dist, _ := e.To(x.Lat, x.Lng, c.coord.Lat, c.coord.Lng)
+			neighbors = append(neighbors, Neighbor{
+				Location: Location{
+					Graph:   t.Graph,
+					EC:      t.EncodedStep(c.index),
+					Cluster: clusters[i],
+				},
+				Coordinate: c.coord,
+				Distance:   dist,
+			})
+		}
+	}
+
+	// Merge the results of all trees. The boundary vertices of a cluster are
+	// also vertices of the overlay graph, so they may be found twice. Only the
+	// overlay location is kept, as in NearestNeighbor.
+	sort.Stable(byDistance(neighbors))
+	result := neighbors[:0]
+	for _, n := range neighbors {
+		if len(result) == k {
+			break
+		}
+		if !n.Location.IsVertex() || !containsVertex(result, n.Coordinate) {
+			result = append(result, n)
+		}
+	}
+	return result
+}
+
+// Returns true if one of the neighbors is a vertex at the coordinate c.
+func containsVertex(neighbors []Neighbor, c geo.Coordinate) bool {
+	for _, n := range neighbors {
+		if n.Location.IsVertex() && n.Coordinate == c {
+			return true
+		}
+	}
+	return false
+}
+
+type byDistance []Neighbor
+
+func (n byDistance) Len() int           { return len(n) }
+func (n byDistance) Swap(i, j int)      { n[i], n[j] = n[j], n[i] }
+func (n byDistance) Less(i, j int) bool { return n[i].Distance < n[j].Distance }
+
+// kSearch is the k-nearest neighbor variant of binarySearch. All accessible
+// candidates are collected in best.
+func (nn *NN) kSearch(start, end int, compareLat bool, best *candidates) {
+	if end < start {
+		return
+	}
+
+	x := nn.x
+	middle := (end-start)/2 + start
+	middleCoord, middleAccessible := nn.decodeCoordinate(middle)
+	if middleAccessible {
+		best.insert(candidate{
+			index:    middle,
+			coord:    middleCoord,
+			distance: distance(x, middleCoord),
+			key:      nn.candidateKey(middle),
+		})
+	}
+	if end == start {
+		return
+	}
+
+	var left bool
+	distToPlane := 0.0
+	if compareLat {
+		left = x.Lat < middleCoord.Lat
+		distToPlane = (x.Lat - middleCoord.Lat) * (x.Lat - middleCoord.Lat)
+	} else {
+		left = x.Lng < middleCoord.Lng
+		distToPlane = (x.Lng - middleCoord.Lng) * (x.Lng - middleCoord.Lng)
+	}
+
+	if left {
+		nn.kSearch(start, middle-1, !compareLat, best)
+	} else {
+		nn.kSearch(middle+1, end, !compareLat, best)
+	}
+
+	// Only search on the other half if it may still contain a closer point.
+	if best.full() && best.worst() < distToPlane {
+		return
+	}
+	if left {
+		nn.kSearch(middle+1, end, !compareLat, best)
+	} else {
+		nn.kSearch(start, middle-1, !compareLat, best)
+	}
+}
+
+// candidateKey identifies the vertex or the edge of the i-th encoded step.
+func (nn *NN) candidateKey(i int) uint64 {
+	ec := nn.kdTree.EncodedStep(i)
+	vertex := ec >> (EdgeOffsetBits + StepOffsetBits)
+	edgeOffset := uint32((ec >> StepOffsetBits) & MaxEdgeOffset)
+	stepOffset := ec & MaxStepOffset
+	if edgeOffset == MaxEdgeOffset && stepOffset == MaxStepOffset {
+		return vertex << 1
+	}
+	edge := uint64(nn.kdTree.Graph.FirstOut[vertex] + edgeOffset)
+	return edge<<1 | 1
+}
@@ -0,0 +1,164 @@
+/*
+ * Copyright 2014 Florian Benz, Steven Schäfer, Bernhard Schommer
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kdtree
+
+import (
+	"geo"
+	"graph"
+	"testing"
+)
+
+// A graph without edges whose vertices are at the given coordinates.
+func pointGraph(points []geo.Coordinate) *graph.GraphFile {
+	g := &graph.GraphFile{
+		FirstOut: make([]uint32, len(points)+1),
+		FirstIn:  make([]uint32, len(points)),
+	}
+	for _, p := range points {
+		lat, lng := p.Encode()
+		g.Coordinates = append(g.Coordinates, lat, lng)
+	}
+	for t := range g.Access {
+		g.Access[t] = make([]byte, (len(points)+7)/8)
+		for i := range points {
+			g.Access[t][i/8] |= 1 << uint(i%8)
+		}
+	}
+	return g
+}
+
+// Points on a line of latitude, 0.001° apart.
+func linePoints(n int, lat, lng float64) []geo.Coordinate {
+	points := make([]geo.Coordinate, n)
+	for i := range points {
+		points[i] = geo.Coordinate{Lat: lat, Lng: lng + 0.001*float64(i)}
+	}
+	return points
+}
+
+// A cluster k-d tree with one cluster and an overlay graph without vertices.
+func singleClusterTree(g *graph.GraphFile) *ClusterKdTree {
+	cluster, bbox := NewKdTree(g)
+	overlay := NewOverlayKdTree(&graph.OverlayGraphFile{GraphFile: pointGraph(nil)})
+	return &ClusterKdTree{
+		Overlay: overlay,
+		Cluster: []*KdTree{cluster},
+		BBoxes:  []geo.BBox{bbox},
+	}
+}
+
+func TestCandidatesInsert(t *testing.T) {
+	c := &candidates{k: 3}
+	for _, x := range []candidate{
+		{index: 0, distance: 4, key: 1},
+		{index: 1, distance: 2, key: 2},
+		{index: 2, distance: 3, key: 1}, // closer step of the same edge
+		{index: 3, distance: 5, key: 3},
+		{index: 4, distance: 1, key: 4},
+		{index: 5, distance: 6, key: 2}, // farther step of the same edge
+	} {
+		c.insert(x)
+	}
+	expected := []int{4, 1, 2}
+	if len(c.items) != len(expected) {
+		t.Fatalf("got %v, expected the candidates %v", c.items, expected)
+	}
+	for i, index := range expected {
+		if c.items[i].index != index {
+			t.Errorf("got candidate %d at position %d, expected %d", c.items[i].index, i, index)
+		}
+	}
+}
+
+func TestKNearestNeighbors(t *testing.T) {
+	points := linePoints(20, 49.25, 7.0)
+	tree := singleClusterTree(pointGraph(points))
+	x := geo.Coordinate{Lat: 49.25, Lng: 7.0052}
+	neighbors := tree.KNearestNeighbors(x, graph.Car, 4)
+	expected := []graph.Vertex{5, 6, 4, 7}
+	if len(neighbors) != len(expected) {
+		t.Fatalf("got %d neighbors, expected %d", len(neighbors), len(expected))
+	}
+	for i, v := range expected {
+		n := neighbors[i]
+		if n.Location.Vertex() != v || !n.Location.IsVertex() || n.Location.Cluster != 0 {
+			t.Errorf("neighbor %d: got vertex %d in cluster %d, expected vertex %d",
+				i, n.Location.Vertex(), n.Location.Cluster, v)
+		}
+		if i > 0 && n.Distance < neighbors[i-1].Distance {
+			t.Errorf("neighbor %d is closer than neighbor %d", i, i-1)
+		}
+	}
+}
+
+func TestKNearestNeighborsAll(t *testing.T) {
+	// For k larger than the number of points, every point is returned once.
+	points := linePoints(7, 49.25, 7.0)
+	tree := singleClusterTree(pointGraph(points))
+	neighbors := tree.KNearestNeighbors(points[3], graph.Car, 100)
+	if len(neighbors) != len(points) {
+		t.Fatalf("got %d neighbors, expected %d", len(neighbors), len(points))
+	}
+	found := make(map[graph.Vertex]bool)
+	for _, n := range neighbors {
+		if found[n.Location.Vertex()] {
+			t.Errorf("vertex %d was returned twice", n.Location.Vertex())
+		}
+		found[n.Location.Vertex()] = true
+	}
+	if neighbors[0].Location.Vertex() != 3 || neighbors[0].Distance > 0.01 {
+		t.Errorf("got %v first, expected vertex 3", neighbors[0])
+	}
+}
+
+func TestKNearestNeighborsBoundary(t *testing.T) {
+	// The first two vertices of the cluster are boundary vertices, which are
+	// also in the k-d tree of the overlay graph.
+	points := linePoints(4, 49.25, 7.0)
+	tree := singleClusterTree(pointGraph(points))
+	tree.Overlay = NewOverlayKdTree(&graph.OverlayGraphFile{GraphFile: pointGraph(points[:2])})
+	neighbors := tree.KNearestNeighbors(points[0], graph.Car, 10)
+	if len(neighbors) != len(points) {
+		t.Fatalf("got %d neighbors, expected %d", len(neighbors), len(points))
+	}
+	for i, n := range neighbors {
+		expected := 0
+		if i < 2 {
+			expected = -1
+		}
+		if n.Location.Vertex() != graph.Vertex(i) || n.Location.Cluster != expected {
+			t.Errorf("neighbor %d: got vertex %d in cluster %d, expected vertex %d in cluster %d",
+				i, n.Location.Vertex(), n.Location.Cluster, i, expected)
+		}
+	}
+}
+
+func TestKNearestNeighborsAccess(t *testing.T) {
+	// Inaccessible vertices are never returned.
+	points := linePoints(5, 49.25, 7.0)
+	g := pointGraph(points)
+	g.Access[graph.Car] = []byte{0x1b} // not vertex 2
+	tree := singleClusterTree(g)
+	for _, n := range tree.KNearestNeighbors(points[2], graph.Car, 3) {
+		if n.Location.Vertex() == 2 {
+			t.Errorf("got the inaccessible vertex 2")
+		}
+	}
+	if n := tree.KNearestNeighbors(points[2], graph.Foot, 1); len(n) != 1 || n[0].Location.Vertex() != 2 {
+		t.Errorf("got %v, expected vertex 2 for pedestrians", n)
+	}
+}
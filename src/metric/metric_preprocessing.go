@@ -20,6 +20,7 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
 	"graph"
@@ -41,6 +42,7 @@ var (
 	FlagBaseDir    string
 	FlagCpuProfile string
 	FlagMetric     int
+	FlagTurnCosts  string
 )
 
 type Job struct {
@@ -55,6 +57,27 @@ func init() {
 	flag.StringVar(&FlagBaseDir, "dir", "", "directory of the graph")
 	flag.StringVar(&FlagCpuProfile, "cpuprofile", "", "write cpu profile to file")
 	flag.IntVar(&FlagMetric, "metric", -1, "restrict the preprocessing to one metric; -1 means all metrics")
+	flag.StringVar(&FlagTurnCosts, "turncosts", "default", "turn costs: default, none or a json file with the penalties in seconds")
+}
+
+// turnCosts returns the turn costs selected on the command line.
+func turnCosts() (*graph.TurnCosts, error) {
+	switch FlagTurnCosts {
+	case "default":
+		return &graph.DefaultTurnCosts, nil
+	case "none":
+		return nil, nil
+	}
+	file, err := os.Open(FlagTurnCosts)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	costs := graph.DefaultTurnCosts
+	if err := json.NewDecoder(file).Decode(&costs); err != nil {
+		return nil, err
+	}
+	return &costs, nil
 }
 
 func main() {
@@ -78,6 +101,17 @@ func main() {
 		log.Fatal("Open cluster graph: ", err)
 	}
 
+	// The turn costs are part of the Time matrices, the server reads them
+	// from the graph directory. All metrics have to use the same costs.
+	costs, err := turnCosts()
+	if err != nil {
+		log.Fatal("Read turn costs: ", err)
+	}
+	clusterGraph.SetTurnCosts(costs)
+	if err := graph.WriteTurnCosts(FlagBaseDir, costs); err != nil {
+		log.Fatal("Write turn costs: ", err)
+	}
+
 	if FlagMetric >= 0 {
 		if FlagMetric >= int(graph.MetricMax) {
 			log.Fatal("metric index is too large: ", FlagMetric)
@@ -88,7 +122,9 @@ func main() {
 	}
 }
 
-// preprocessAll computes the metric matrices for all metrics
+// preprocessAll computes the metric matrices for all metrics, including the
+// variants without ferries. For those, the in-cluster searches skip all
+// ferry edges (see GraphFile.VertexNeighbors).
 func preprocessAll(g *graph.ClusterGraph) {
 	for i := 0; i < int(graph.MetricMax); i++ {
 		preprocessOne(g, i)
@@ -165,7 +201,9 @@ func computeMatrixThreadRouter(ready chan<- int, job *Job) {
 	
 	for i := job.Start; i < len(g.Cluster); i += job.Stride {
 		boundaryVertexCount := g.Overlay.ClusterSize(i)
-		matrix, diff := computeMatrixRouter(router, g.Cluster[i], boundaryVertexCount)
+		// Search on the states of the cluster, so that the shortcuts respect
+		// the turn restrictions. The boundary vertices are never restricted.
+		matrix, diff := computeMatrixRouter(router, graph.NewTurnGraph(g.Cluster[i]), boundaryVertexCount)
 		job.Matrices[i] = matrix
 		duration += diff
 		queries  += boundaryVertexCount
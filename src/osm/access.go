@@ -101,13 +101,16 @@ func AccessMask(way Way) AccessType {
 		return 0
 	}
 
-	mask := DefaultAccessMask(way)
+	return applyAccessTags(DefaultAccessMask(way), way.Attributes)
+}
 
+// Apply the access tags to the default access mask.
+func applyAccessTags(mask AccessType, attributes map[string]string) AccessType {
 	// The designated access tags are hirachical.
 	// This means that more specific tags override the previous ones.
 	for _, data := range AccessTable {
-		if _, ok := way.Attributes[data.Key]; ok {
-			if ParseBool(way.Attributes[data.Key]) {
+		if _, ok := attributes[data.Key]; ok {
+			if ParseBool(attributes[data.Key]) {
 				mask |= data.Mask
 			} else {
 				mask &= ^data.Mask
@@ -0,0 +1,48 @@
+/*
+ * Copyright 2014 Florian Benz, Steven Schäfer, Bernhard Schommer
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package osm
+
+// Barriers on nodes, which block some or all transport modes.
+// See http://wiki.openstreetmap.org/wiki/Key:barrier
+
+// Compute the access mask for the passage through a node. Nodes without a
+// barrier can be passed by everyone. The access tags of a barrier override
+// its default, e.g., a gate with access=private blocks everyone.
+func BarrierAccessMask(node Node) AccessType {
+	barrier, ok := node.Attributes["barrier"]
+	if !ok {
+		return AccessMotorcar | AccessBicycle | AccessFoot
+	}
+	return applyAccessTags(DefaultBarrierMask(barrier), node.Attributes)
+}
+
+// The transport modes which may pass a barrier without access tags.
+func DefaultBarrierMask(barrier string) AccessType {
+	switch barrier {
+	// Gates are usually open, the access tags say otherwise.
+	case "no", "gate", "lift_gate", "swing_gate", "sliding_gate",
+		"entrance", "toll_booth", "border_control", "cattle_grid",
+		"height_restrictor", "sally_port":
+		return AccessMotorcar | AccessBicycle | AccessFoot
+	// These only let pedestrians through
+	case "stile", "turnstile", "full-height_turnstile", "kissing_gate":
+		return AccessFoot
+	}
+	// Bollards, blocks, chains and the like as well as unknown barriers
+	// keep the cars out.
+	return AccessBicycle | AccessFoot
+}
@@ -0,0 +1,51 @@
+/*
+ * Copyright 2014 Florian Benz, Steven Schäfer, Bernhard Schommer
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package osm
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+var barrierFixtures = [...]struct {
+	string
+	AccessType
+}{
+	{`{"Id":1,"Attributes":{"highway":"crossing"}}`, AccessMotorcar | AccessBicycle | AccessFoot},
+	{`{"Id":2,"Attributes":{"barrier":"bollard"}}`, AccessBicycle | AccessFoot},
+	{`{"Id":3,"Attributes":{"barrier":"gate"}}`, AccessMotorcar | AccessBicycle | AccessFoot},
+	{`{"Id":4,"Attributes":{"barrier":"gate","access":"private"}}`, 0},
+	{`{"Id":5,"Attributes":{"barrier":"lift_gate","access":"no","foot":"yes","bicycle":"yes"}}`, AccessBicycle | AccessFoot},
+	{`{"Id":6,"Attributes":{"barrier":"stile"}}`, AccessFoot},
+	{`{"Id":7,"Attributes":{"barrier":"bollard","motorcar":"yes"}}`, AccessMotorcar | AccessBicycle | AccessFoot},
+	{`{"Id":8,"Attributes":{"barrier":"cycle_barrier"}}`, AccessBicycle | AccessFoot},
+}
+
+func TestBarrierAccessMask(t *testing.T) {
+	for _, fixture := range barrierFixtures {
+		var node Node
+		err := json.Unmarshal([]byte(fixture.string), &node)
+		if err != nil {
+			t.Fatalf("Could not unmarshal fixture: %s", fixture.string)
+		}
+		mask := BarrierAccessMask(node)
+		if mask != fixture.AccessType {
+			t.Errorf("Wrong access mask %d (expected: %d) for node: %v\n",
+				mask, fixture.AccessType, node)
+		}
+	}
+}
@@ -0,0 +1,292 @@
+/*
+ * Copyright 2014 Florian Benz, Steven Schäfer, Bernhard Schommer
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package osm
+
+// Conditional restrictions, e.g., access:conditional=no @ (Mo-Fr 07:00-09:00)
+// See http://wiki.openstreetmap.org/wiki/Conditional_restrictions
+//
+// We only support conditions on the time of the week, given in a practical
+// subset of the opening_hours syntax: weekday ranges and lists (Mo-Fr, Sa,Su)
+// followed by time ranges (07:00-09:00,16:00-18:00), several rules separated
+// by semicolons, and 24/7. A time range which ends before it starts continues
+// over midnight. Conditions with anything else, e.g., public holidays or
+// weights, are ignored.
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const MinutesPerDay = 24 * 60
+
+var weekdays = [...]string{"Mo", "Tu", "We", "Th", "Fr", "Sa", "Su"}
+
+// A time range on some days of the week. Bit 0 of Days stands for Monday,
+// From and To are given in minutes after midnight.
+type TimeRange struct {
+	Days     uint8
+	From, To int
+}
+
+type OpeningHours []TimeRange
+
+// A value along with the opening hours during which it applies.
+type Conditional struct {
+	Value string
+	Hours OpeningHours
+}
+
+// A time dependent access restriction: during the opening hours the way is
+// open (Allowed) or closed for the transport modes in Mask.
+type AccessCondition struct {
+	Mask    AccessType
+	Allowed bool
+	Hours   OpeningHours
+}
+
+// A time dependent maximum speed in km/h.
+type SpeedCondition struct {
+	Speed float64
+	Hours OpeningHours
+}
+
+// The index of a weekday abbreviation, starting with 0 for Monday.
+func parseWeekday(s string) (int, error) {
+	for i, day := range weekdays {
+		if s == day {
+			return i, nil
+		}
+	}
+	return 0, errors.New("Unsupported weekday: " + s)
+}
+
+// Parse a list of weekdays and weekday ranges, e.g., Mo-Fr,Su.
+func parseWeekdays(s string) (uint8, error) {
+	days := uint8(0)
+	for _, part := range strings.Split(s, ",") {
+		bounds := strings.Split(part, "-")
+		if len(bounds) > 2 {
+			return 0, errors.New("Wrong weekday range: " + part)
+		}
+		first, err := parseWeekday(bounds[0])
+		if err != nil {
+			return 0, err
+		}
+		last, err := parseWeekday(bounds[len(bounds)-1])
+		if err != nil {
+			return 0, err
+		}
+		// Ranges may wrap around the end of the week, e.g., Fr-Mo.
+		for day := first; ; day = (day + 1) % 7 {
+			days |= 1 << uint(day)
+			if day == last {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+// Parse a time of the day given as HH:MM, the result is in minutes.
+func parseTimeOfDay(s string) (int, error) {
+	fields := strings.Split(s, ":")
+	if len(fields) != 2 || len(fields[1]) != 2 {
+		return 0, errors.New("Wrong time format: " + s)
+	}
+	hours, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return 0, err
+	}
+	minutes, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return 0, err
+	}
+	if hours < 0 || minutes < 0 || minutes >= 60 || hours*60+minutes > MinutesPerDay {
+		return 0, errors.New("Wrong time: " + s)
+	}
+	return hours*60 + minutes, nil
+}
+
+// Parse a single rule, e.g., "Mo-Fr 07:00-09:00,16:00-18:00".
+func parseRule(rule string) ([]TimeRange, error) {
+	// Remove all spaces, the weekdays end where the first time starts.
+	rule = strings.Join(strings.Fields(rule), "")
+	split := strings.IndexAny(rule, "0123456789")
+	if split == -1 {
+		split = len(rule)
+	}
+
+	days := uint8(0x7f)
+	if split > 0 {
+		var err error
+		days, err = parseWeekdays(rule[:split])
+		if err != nil {
+			return nil, err
+		}
+	}
+	if split == len(rule) {
+		return []TimeRange{{days, 0, MinutesPerDay}}, nil
+	}
+
+	result := []TimeRange(nil)
+	for _, span := range strings.Split(rule[split:], ",") {
+		bounds := strings.Split(span, "-")
+		if len(bounds) != 2 {
+			return nil, errors.New("Wrong time range: " + span)
+		}
+		from, err := parseTimeOfDay(bounds[0])
+		if err != nil {
+			return nil, err
+		}
+		to, err := parseTimeOfDay(bounds[1])
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, TimeRange{days, from, to})
+	}
+	return result, nil
+}
+
+// Parse opening hours in the supported subset of the syntax.
+func ParseOpeningHours(s string) (OpeningHours, error) {
+	s = strings.TrimSpace(s)
+	if s == "24/7" {
+		return OpeningHours{{0x7f, 0, MinutesPerDay}}, nil
+	}
+	result := OpeningHours(nil)
+	for _, rule := range strings.Split(s, ";") {
+		if strings.TrimSpace(rule) == "" {
+			continue
+		}
+		ranges, err := parseRule(rule)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, ranges...)
+	}
+	if len(result) == 0 {
+		return nil, errors.New("Empty opening hours")
+	}
+	return result, nil
+}
+
+// Returns true if the given minute of the day falls into the time range.
+func (r TimeRange) Contains(day time.Weekday, minute int) bool {
+	// Monday is bit 0, the previous day matters for ranges over midnight.
+	today := uint(day+6) % 7
+	yesterday := (today + 6) % 7
+	if r.From < r.To {
+		return r.Days&(1<<today) != 0 && minute >= r.From && minute < r.To
+	}
+	return r.Days&(1<<today) != 0 && minute >= r.From ||
+		r.Days&(1<<yesterday) != 0 && minute < r.To
+}
+
+// Returns true if some time range contains the given minute of the day.
+func (h OpeningHours) Contains(day time.Weekday, minute int) bool {
+	for _, r := range h {
+		if r.Contains(day, minute) {
+			return true
+		}
+	}
+	return false
+}
+
+// Parse the value of a conditional tag, i.e., a list of "value @ condition"
+// separated by semicolons. Conditions which are not supported are skipped.
+func ParseConditional(s string) []Conditional {
+	// The opening hours may contain semicolons, but only in parentheses.
+	parts := []string(nil)
+	depth, start := 0, 0
+	for i, c := range s {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ';':
+			if depth == 0 {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	parts = append(parts, s[start:])
+
+	result := []Conditional(nil)
+	for _, part := range parts {
+		at := strings.Index(part, "@")
+		if at == -1 {
+			continue
+		}
+		value := strings.TrimSpace(part[:at])
+		condition := strings.TrimSpace(part[at+1:])
+		condition = strings.TrimSuffix(strings.TrimPrefix(condition, "("), ")")
+		hours, err := ParseOpeningHours(condition)
+		if err != nil || value == "" {
+			continue
+		}
+		result = append(result, Conditional{value, hours})
+	}
+	return result
+}
+
+// Compute the time dependent access restrictions of a way, in the order of
+// the access hierarchy. As for the plain access tags, more specific tags
+// take precedence: a condition does not apply to the transport modes which
+// have their own access tag.
+func AccessConditions(way Way) []AccessCondition {
+	result := []AccessCondition(nil)
+	for i, data := range AccessTable {
+		value, ok := way.Attributes[data.Key+":conditional"]
+		if !ok {
+			continue
+		}
+		mask := data.Mask
+		for _, specific := range AccessTable[i+1:] {
+			if _, ok := way.Attributes[specific.Key]; ok {
+				mask &^= specific.Mask
+			}
+		}
+		if mask == 0 {
+			continue
+		}
+		for _, c := range ParseConditional(value) {
+			result = append(result, AccessCondition{mask, ParseBool(c.Value), c.Hours})
+		}
+	}
+	return result
+}
+
+// Compute the time dependent maximum speeds of a way.
+func MaxSpeedConditions(way Way) []SpeedCondition {
+	result := []SpeedCondition(nil)
+	for _, c := range ParseConditional(way.Attributes["maxspeed:conditional"]) {
+		speed := 130.0 // clamp "none" as in MaxSpeed
+		if c.Value != "none" {
+			var err error
+			speed, err = ParseSpeed(c.Value)
+			if err != nil || speed <= 0 {
+				continue
+			}
+		}
+		result = append(result, SpeedCondition{speed, c.Hours})
+	}
+	return result
+}
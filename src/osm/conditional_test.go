@@ -0,0 +1,136 @@
+/*
+ * Copyright 2014 Florian Benz, Steven Schäfer, Bernhard Schommer
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package osm
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var openingHoursFixtures = [...]struct {
+	string
+	OpeningHours
+}{
+	{"24/7", OpeningHours{{0x7f, 0, 1440}}},
+	{"Mo-Fr 07:00-09:00", OpeningHours{{0x1f, 420, 540}}},
+	{"Mo-Fr 07:00-09:00,16:00-18:00", OpeningHours{{0x1f, 420, 540}, {0x1f, 960, 1080}}},
+	{"Sa,Su", OpeningHours{{0x60, 0, 1440}}},
+	{"Fr-Mo 22:00-06:00", OpeningHours{{0x71, 1320, 360}}},
+	{"Mo 8:00 - 12:00; We 14:00-24:00", OpeningHours{{0x01, 480, 720}, {0x04, 840, 1440}}},
+	{"07:00-19:00", OpeningHours{{0x7f, 420, 1140}}},
+	{"Mo-Fr 07:00-09:00; PH off", nil},
+	{"sunset-sunrise", nil},
+	{"Mo-Fr 25:00-26:00", nil},
+}
+
+func TestParseOpeningHours(t *testing.T) {
+	for _, fixture := range openingHoursFixtures {
+		hours, err := ParseOpeningHours(fixture.string)
+		if fixture.OpeningHours == nil {
+			if err == nil {
+				t.Errorf("Expected an error for %q, got %v\n", fixture.string, hours)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(hours, fixture.OpeningHours) {
+			t.Errorf("Wrong opening hours %v, %v (expected: %v) for %q\n",
+				hours, err, fixture.OpeningHours, fixture.string)
+		}
+	}
+}
+
+func TestOpeningHoursContains(t *testing.T) {
+	hours, err := ParseOpeningHours("Mo-Fr 07:00-09:00; Sa 22:00-02:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	moments := [...]struct {
+		day      time.Weekday
+		minute   int
+		contains bool
+	}{
+		{time.Monday, 420, true},
+		{time.Monday, 540, false},
+		{time.Friday, 500, true},
+		{time.Saturday, 500, false},
+		{time.Saturday, 1380, true},
+		{time.Sunday, 60, true},
+		{time.Sunday, 120, false},
+		{time.Monday, 60, false},
+	}
+	for _, m := range moments {
+		if hours.Contains(m.day, m.minute) != m.contains {
+			t.Errorf("Contains(%v, %d) should be %t\n", m.day, m.minute, m.contains)
+		}
+	}
+}
+
+func TestParseConditional(t *testing.T) {
+	result := ParseConditional("no @ (Mo-Fr 07:00-09:00; Sa 10:00-12:00); delivery @ 06:00-07:00; no @ (weight > 7.5)")
+	expected := []Conditional{
+		{"no", OpeningHours{{0x1f, 420, 540}, {0x20, 600, 720}}},
+		{"delivery", OpeningHours{{0x7f, 360, 420}}},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Wrong conditional %v (expected: %v)\n", result, expected)
+	}
+}
+
+var accessConditionFixtures = [...]struct {
+	string
+	Conditions []AccessCondition
+}{
+	{`{"Id":1,"Attributes":{"highway":"residential"}}`, nil},
+	{`{"Id":2,"Attributes":{"highway":"residential","motor_vehicle:conditional":"no @ (Mo-Fr 07:00-09:00)"}}`,
+		[]AccessCondition{{AccessMotorcar, false, OpeningHours{{0x1f, 420, 540}}}}},
+	{`{"Id":3,"Attributes":{"highway":"pedestrian","access:conditional":"yes @ (06:00-10:00)","foot":"yes"}}`,
+		[]AccessCondition{{AccessMotorcar | AccessBicycle, true, OpeningHours{{0x7f, 360, 600}}}}},
+	{`{"Id":4,"Attributes":{"highway":"residential","vehicle:conditional":"no @ (Su)","bicycle":"yes","motorcar":"yes"}}`, nil},
+}
+
+func TestAccessConditions(t *testing.T) {
+	for _, fixture := range accessConditionFixtures {
+		var way Way
+		err := json.Unmarshal([]byte(fixture.string), &way)
+		if err != nil {
+			t.Fatalf("Could not unmarshal fixture: %s", fixture.string)
+		}
+		conditions := AccessConditions(way)
+		if !reflect.DeepEqual(conditions, fixture.Conditions) {
+			t.Errorf("Wrong access conditions %v (expected: %v) for way: %v\n",
+				conditions, fixture.Conditions, way)
+		}
+	}
+}
+
+func TestMaxSpeedConditions(t *testing.T) {
+	way := Way{Attributes: map[string]string{
+		"highway":              "primary",
+		"maxspeed":             "50",
+		"maxspeed:conditional": "30 @ (22:00-06:00); 20 mph @ (Sa,Su); fast @ (Mo)",
+	}}
+	conditions := MaxSpeedConditions(way)
+	expected := []SpeedCondition{
+		{30, OpeningHours{{0x7f, 1320, 360}}},
+		{20 * 1.609344, OpeningHours{{0x60, 0, 1440}}},
+	}
+	if !reflect.DeepEqual(conditions, expected) {
+		t.Errorf("Wrong maxspeed conditions %v (expected: %v)\n", conditions, expected)
+	}
+}
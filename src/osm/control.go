@@ -0,0 +1,49 @@
+/*
+ * Copyright 2014 Florian Benz, Steven Schäfer, Bernhard Schommer
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package osm
+
+// Traffic controls on nodes, which delay the traffic passing through them.
+// See http://wiki.openstreetmap.org/wiki/Key:highway
+
+type TrafficControl int
+
+const (
+	ControlNone TrafficControl = iota
+	ControlTrafficSignals
+	ControlStop
+	ControlGiveWay
+	ControlCrossing
+)
+
+// Compute the traffic control of a node. A crossing with traffic lights
+// counts as traffic signals.
+func NodeTrafficControl(node Node) TrafficControl {
+	switch node.Attributes["highway"] {
+	case "traffic_signals":
+		return ControlTrafficSignals
+	case "stop":
+		return ControlStop
+	case "give_way":
+		return ControlGiveWay
+	case "crossing":
+		if node.Attributes["crossing"] == "traffic_signals" {
+			return ControlTrafficSignals
+		}
+		return ControlCrossing
+	}
+	return ControlNone
+}
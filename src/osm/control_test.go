@@ -0,0 +1,50 @@
+/*
+ * Copyright 2014 Florian Benz, Steven Schäfer, Bernhard Schommer
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package osm
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+var controlFixtures = [...]struct {
+	string
+	TrafficControl
+}{
+	{`{"Id":1,"Attributes":{"highway":"traffic_signals"}}`, ControlTrafficSignals},
+	{`{"Id":2,"Attributes":{"highway":"stop","stop":"all"}}`, ControlStop},
+	{`{"Id":3,"Attributes":{"highway":"give_way"}}`, ControlGiveWay},
+	{`{"Id":4,"Attributes":{"highway":"crossing","crossing":"zebra"}}`, ControlCrossing},
+	{`{"Id":5,"Attributes":{"highway":"crossing","crossing":"traffic_signals"}}`, ControlTrafficSignals},
+	{`{"Id":6,"Attributes":{"highway":"turning_circle"}}`, ControlNone},
+	{`{"Id":7,"Attributes":{"traffic_signals":"signal"}}`, ControlNone},
+}
+
+func TestNodeTrafficControl(t *testing.T) {
+	for _, fixture := range controlFixtures {
+		var node Node
+		err := json.Unmarshal([]byte(fixture.string), &node)
+		if err != nil {
+			t.Fatalf("Could not unmarshal fixture: %s", fixture.string)
+		}
+		control := NodeTrafficControl(node)
+		if control != fixture.TrafficControl {
+			t.Errorf("Wrong traffic control %d (expected: %d) for node: %v\n",
+				control, fixture.TrafficControl, node)
+		}
+	}
+}
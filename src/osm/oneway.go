@@ -16,6 +16,10 @@
 
 package osm
 
+import (
+	"strings"
+)
+
 func reverse(nodes []int64) {
 	for i, j := 0, len(nodes)-1; i < j; i, j = i+1, j-1 {
 		nodes[i], nodes[j] = nodes[j], nodes[i]
@@ -23,43 +27,95 @@ func reverse(nodes []int64) {
 }
 
 // There are a number of exceptions when it comes to oneway tags.
-// After calling this function oneway is either true or false and
-// the nodes are stored in the correct order.
+// After calling this function oneway, oneway:bicycle and oneway:foot are
+// either true or false and the nodes are stored in the correct order.
 // It returns false if we could not parse the oneway tag. In this
 // case it is probably a good idea to ignore the street, since it
 // might or might not be a one-way road and the direction might be
 // wrong.
 func NormalizeOneway(way Way) bool {
+	safe, reversed := normalizeVehicleOneway(way)
+
+	// Bikes follow the vehicle oneway, unless there is a contraflow lane.
+	bicycle := way.Attributes["oneway"] == "true"
+	for _, key := range [...]string{"cycleway", "cycleway:left", "cycleway:right", "cycleway:both"} {
+		if strings.HasPrefix(way.Attributes[key], "opposite") {
+			bicycle = false
+		}
+	}
+	normalizeTransportOneway(way, "oneway:bicycle", bicycle, reversed)
+
+	// Pedestrians ignore the vehicle oneways.
+	normalizeTransportOneway(way, "oneway:foot", false, reversed)
+	return safe
+}
+
+// Normalize the oneway tag and report whether the nodes were reversed.
+func normalizeVehicleOneway(way Way) (bool, bool) {
 	// First normalize the allowed booleans and take care of the
 	// nasty -1 (reversed) case.
 	switch way.Attributes["oneway"] {
 	case "yes", "true", "1":
 		way.Attributes["oneway"] = "true"
-		return true
+		return true, false
 	case "-1":
 		reverse(way.Nodes)
 		way.Attributes["oneway"] = "true"
-		return true
+		return true, true
 	case "no", "false", "0":
 		way.Attributes["oneway"] = "false"
-		return true
+		return true, false
 	}
 
 	// Secondly, there are a few special cases which imply 'oneway'
 	if way.Attributes["junction"] == "roundabout" {
 		way.Attributes["oneway"] = "true"
-		return true
+		return true, false
 	}
 
 	switch way.Attributes["highway"] {
 	case "motorway", "motorway_link", "trunk":
 		way.Attributes["oneway"] = "true"
-		return true
+		return true, false
 	}
 
 	// Finally... there are some cases which are just wrong.
 	if _, ok := way.Attributes["oneway"]; ok {
-		return false
+		return false, false
+	}
+	return true, false
+}
+
+// Normalize the oneway tag of a single transport mode with the given default.
+// We cannot store a direction which disagrees with the order of the nodes,
+// such tags are ignored.
+func normalizeTransportOneway(way Way, key string, oneway, reversed bool) {
+	switch way.Attributes[key] {
+	case "yes", "true", "1":
+		oneway = !reversed
+	case "-1":
+		oneway = reversed
+	case "no", "false", "0":
+		oneway = false
+	}
+	if oneway {
+		way.Attributes[key] = "true"
+	} else {
+		way.Attributes[key] = "false"
+	}
+}
+
+// Compute the transport modes for which a normalized way is a oneway.
+func OnewayMask(way Way) AccessType {
+	mask := AccessType(0)
+	if way.Attributes["oneway"] == "true" {
+		mask |= AccessMotorcar
+	}
+	if way.Attributes["oneway:bicycle"] == "true" {
+		mask |= AccessBicycle
+	}
+	if way.Attributes["oneway:foot"] == "true" {
+		mask |= AccessFoot
 	}
-	return true
+	return mask
 }
@@ -0,0 +1,62 @@
+/*
+ * Copyright 2014 Florian Benz, Steven Schäfer, Bernhard Schommer
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package osm
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+var onewayFixtures = [...]struct {
+	string
+	AccessType
+	Nodes []int64
+}{
+	{`{"Id":1,"Nodes":[1,2],"Attributes":{"highway":"residential"}}`, 0, []int64{1, 2}},
+	{`{"Id":2,"Nodes":[1,2],"Attributes":{"highway":"residential","oneway":"yes"}}`, AccessMotorcar | AccessBicycle, []int64{1, 2}},
+	{`{"Id":3,"Nodes":[1,2],"Attributes":{"highway":"residential","oneway":"-1"}}`, AccessMotorcar | AccessBicycle, []int64{2, 1}},
+	{`{"Id":4,"Nodes":[1,2],"Attributes":{"highway":"residential","oneway":"yes","oneway:bicycle":"no"}}`, AccessMotorcar, []int64{1, 2}},
+	{`{"Id":5,"Nodes":[1,2],"Attributes":{"highway":"residential","oneway":"yes","cycleway":"opposite_lane"}}`, AccessMotorcar, []int64{1, 2}},
+	{`{"Id":6,"Nodes":[1,2],"Attributes":{"highway":"residential","oneway":"yes","cycleway:left":"opposite_track"}}`, AccessMotorcar, []int64{1, 2}},
+	{`{"Id":7,"Nodes":[1,2],"Attributes":{"highway":"cycleway","oneway:bicycle":"yes"}}`, AccessBicycle, []int64{1, 2}},
+	{`{"Id":8,"Nodes":[1,2],"Attributes":{"highway":"footway","oneway:foot":"yes"}}`, AccessFoot, []int64{1, 2}},
+	{`{"Id":9,"Nodes":[1,2],"Attributes":{"highway":"residential","oneway":"-1","oneway:bicycle":"yes"}}`, AccessMotorcar, []int64{2, 1}},
+	{`{"Id":10,"Nodes":[1,2],"Attributes":{"junction":"roundabout"}}`, AccessMotorcar | AccessBicycle, []int64{1, 2}},
+}
+
+func TestOnewayMask(t *testing.T) {
+	for _, fixture := range onewayFixtures {
+		var way Way
+		err := json.Unmarshal([]byte(fixture.string), &way)
+		if err != nil {
+			t.Fatalf("Could not unmarshal fixture: %s", fixture.string)
+		}
+		if !NormalizeOneway(way) {
+			t.Errorf("Could not normalize the oneway tags of way: %v\n", way)
+		}
+		mask := OnewayMask(way)
+		if mask != fixture.AccessType {
+			t.Errorf("Wrong oneway mask %d (expected: %d) for way: %v\n",
+				mask, fixture.AccessType, way)
+		}
+		if !reflect.DeepEqual(way.Nodes, fixture.Nodes) {
+			t.Errorf("Wrong node order %v (expected: %v) for way: %v\n",
+				way.Nodes, fixture.Nodes, way)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+/*
+ * Copyright 2014 Florian Benz, Steven Schäfer, Bernhard Schommer
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package osm
+
+// Turn restrictions, see http://wiki.openstreetmap.org/wiki/Relation:restriction
+//
+// A restriction relation consists of a "from" way, a "to" way and either a
+// single "via" node or a sequence of "via" ways. The kind of the restriction
+// is given by the restriction tag, e.g., restriction=no_left_turn. Some
+// restrictions only apply to one transport mode (restriction:motorcar=...)
+// and some exclude others (except=bicycle). Pedestrians are never affected.
+
+import (
+	"strings"
+)
+
+type Restriction struct {
+	Id int64
+	// Transport modes the restriction applies to.
+	Mask AccessType
+	// A "no_*" restriction forbids the turn from From to To, an "only_*"
+	// restriction forbids all other turns instead.
+	Only bool
+	From int64
+	// Either a single node or a sequence of ways.
+	Via []RelationMember
+	To  int64
+}
+
+// The restriction tags in the order of their precedence.
+var RestrictionTable = [...]AccessData{
+	{"restriction:motorcar", AccessMotorcar},
+	{"restriction:motor_vehicle", AccessMotorcar},
+	{"restriction:bicycle", AccessBicycle},
+	{"restriction:vehicle", AccessMotorcar | AccessBicycle},
+	{"restriction", AccessMotorcar | AccessBicycle},
+}
+
+// The keys of the except tag.
+var ExceptTable = [...]AccessData{
+	{"motorcar", AccessMotorcar},
+	{"motor_vehicle", AccessMotorcar},
+	{"bicycle", AccessBicycle},
+}
+
+// Returns the restriction described by the relation, or false if the relation
+// is not a turn restriction we understand.
+func ParseRestriction(relation Relation) (Restriction, bool) {
+	r := Restriction{Id: relation.Id}
+	if relation.Attributes["type"] != "restriction" {
+		return r, false
+	}
+
+	value := ""
+	for _, data := range RestrictionTable {
+		if v, ok := relation.Attributes[data.Key]; ok {
+			value = v
+			r.Mask = data.Mask
+			break
+		}
+	}
+	switch {
+	case strings.HasPrefix(value, "no_"):
+		r.Only = false
+	case strings.HasPrefix(value, "only_"):
+		r.Only = true
+	default:
+		return r, false
+	}
+
+	if except, ok := relation.Attributes["except"]; ok {
+		for _, key := range strings.Split(except, ";") {
+			key = strings.TrimSpace(key)
+			for _, data := range ExceptTable {
+				if data.Key == key {
+					r.Mask &= ^data.Mask
+				}
+			}
+		}
+	}
+	if r.Mask == 0 {
+		return r, false
+	}
+
+	// Exactly one from and one to way, the via members are either one node
+	// or a non-empty sequence of ways.
+	from, to := 0, 0
+	for _, m := range relation.Members {
+		switch m.Role {
+		case "from":
+			if m.Type != TypeEdge {
+				return r, false
+			}
+			r.From = m.Id
+			from++
+		case "to":
+			if m.Type != TypeEdge {
+				return r, false
+			}
+			r.To = m.Id
+			to++
+		case "via":
+			r.Via = append(r.Via, m)
+		}
+	}
+	if from != 1 || to != 1 || len(r.Via) == 0 {
+		return r, false
+	}
+	for _, m := range r.Via {
+		if m.Type == TypeNode && len(r.Via) == 1 {
+			continue
+		}
+		if m.Type != TypeEdge {
+			return r, false
+		}
+	}
+	return r, true
+}
+
+// Returns the ids of all ways which are part of the restriction.
+func (r Restriction) Ways() []int64 {
+	ways := []int64{r.From, r.To}
+	for _, m := range r.Via {
+		if m.Type == TypeEdge {
+			ways = append(ways, m.Id)
+		}
+	}
+	return ways
+}
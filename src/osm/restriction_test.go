@@ -0,0 +1,87 @@
+/*
+ * Copyright 2014 Florian Benz, Steven Schäfer, Bernhard Schommer
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package osm
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+var restrictionFixtures = [...]struct {
+	Relation string
+	Ok       bool
+	Expected Restriction
+}{
+	{`{"Id":1,"Members":[{"Type":1,"Id":10,"Role":"from"},{"Type":0,"Id":20,"Role":"via"},
+	{"Type":1,"Id":30,"Role":"to"}],"Attributes":{"type":"restriction","restriction":"no_left_turn"}}`,
+		true, Restriction{Id: 1, Mask: AccessMotorcar | AccessBicycle, From: 10, To: 30,
+			Via: []RelationMember{{TypeNode, 20, "via"}}}},
+	{`{"Id":2,"Members":[{"Type":1,"Id":10,"Role":"from"},{"Type":0,"Id":20,"Role":"via"},
+	{"Type":1,"Id":30,"Role":"to"}],"Attributes":{"type":"restriction","restriction":"only_straight_on",
+	"except":"bicycle;psv"}}`,
+		true, Restriction{Id: 2, Mask: AccessMotorcar, Only: true, From: 10, To: 30,
+			Via: []RelationMember{{TypeNode, 20, "via"}}}},
+	{`{"Id":3,"Members":[{"Type":1,"Id":10,"Role":"from"},{"Type":1,"Id":11,"Role":"via"},
+	{"Type":1,"Id":12,"Role":"via"},{"Type":1,"Id":30,"Role":"to"}],
+	"Attributes":{"type":"restriction","restriction:bicycle":"no_u_turn"}}`,
+		true, Restriction{Id: 3, Mask: AccessBicycle, From: 10, To: 30,
+			Via: []RelationMember{{TypeEdge, 11, "via"}, {TypeEdge, 12, "via"}}}},
+	// Not a turn restriction
+	{`{"Id":4,"Members":[{"Type":1,"Id":10,"Role":"from"},{"Type":0,"Id":20,"Role":"via"},
+	{"Type":1,"Id":30,"Role":"to"}],"Attributes":{"type":"route","restriction":"no_left_turn"}}`,
+		false, Restriction{}},
+	// Unknown restriction value
+	{`{"Id":5,"Members":[{"Type":1,"Id":10,"Role":"from"},{"Type":0,"Id":20,"Role":"via"},
+	{"Type":1,"Id":30,"Role":"to"}],"Attributes":{"type":"restriction","restriction":"fixme"}}`,
+		false, Restriction{}},
+	// Two from ways
+	{`{"Id":6,"Members":[{"Type":1,"Id":10,"Role":"from"},{"Type":1,"Id":11,"Role":"from"},
+	{"Type":0,"Id":20,"Role":"via"},{"Type":1,"Id":30,"Role":"to"}],
+	"Attributes":{"type":"restriction","restriction":"no_entry"}}`,
+		false, Restriction{}},
+	// Mixed via members
+	{`{"Id":7,"Members":[{"Type":1,"Id":10,"Role":"from"},{"Type":0,"Id":20,"Role":"via"},
+	{"Type":1,"Id":11,"Role":"via"},{"Type":1,"Id":30,"Role":"to"}],
+	"Attributes":{"type":"restriction","restriction":"no_u_turn"}}`,
+		false, Restriction{}},
+	// Applies to nobody we route for
+	{`{"Id":8,"Members":[{"Type":1,"Id":10,"Role":"from"},{"Type":0,"Id":20,"Role":"via"},
+	{"Type":1,"Id":30,"Role":"to"}],"Attributes":{"type":"restriction","restriction":"no_right_turn",
+	"except":"motorcar;bicycle"}}`,
+		false, Restriction{}},
+}
+
+func TestParseRestriction(t *testing.T) {
+	for _, fixture := range restrictionFixtures {
+		var relation Relation
+		err := json.Unmarshal([]byte(fixture.Relation), &relation)
+		if err != nil {
+			t.Fatalf("Could not unmarshal fixture: %s", fixture.Relation)
+		}
+		r, ok := ParseRestriction(relation)
+		if ok != fixture.Ok {
+			t.Errorf("ParseRestriction returned %v (expected: %v) for relation: %v\n",
+				ok, fixture.Ok, relation)
+			continue
+		}
+		if ok && !reflect.DeepEqual(r, fixture.Expected) {
+			t.Errorf("Wrong restriction %v (expected: %v) for relation: %v\n",
+				r, fixture.Expected, relation)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+/*
+ * Copyright 2014 Florian Benz, Steven Schäfer, Bernhard Schommer
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"graph"
+	"osm"
+)
+
+// Conditional restrictions
+// The access and maxspeed tags with a ":conditional" suffix become one
+// graph.Condition per edge and tag value, see graph/conditions.go. Ways
+// which are never accessible are not part of the street graph, so only the
+// restrictions which close an edge at times are of any use.
+
+// Convert the opening hours of a condition into time windows.
+func timeWindows(hours osm.OpeningHours) []graph.TimeWindow {
+	windows := make([]graph.TimeWindow, len(hours))
+	for i, r := range hours {
+		windows[i] = graph.TimeWindow{Days: r.Days, From: r.From, To: r.To}
+	}
+	return windows
+}
+
+// Record the conditional restrictions of the way for one of its edges.
+func (v *EdgeAttributes) SetConditions(way osm.Way, edge uint32) {
+	conditions := []graph.Condition(nil)
+	for _, c := range osm.AccessConditions(way) {
+		conditions = append(conditions, graph.Condition{
+			Transports: transportMask(c.Mask),
+			Edge:       graph.Edge(edge),
+			Open:       c.Allowed,
+			Windows:    timeWindows(c.Hours),
+		})
+	}
+	for _, c := range osm.MaxSpeedConditions(way) {
+		speed := int(c.Speed)
+		if speed < 1 {
+			speed = 1 // as in SetExtendedAttributes
+		}
+		conditions = append(conditions, graph.Condition{
+			Transports: 1<<uint(graph.Car) | 1<<uint(graph.Foot) | 1<<uint(graph.Bike),
+			Edge:       graph.Edge(edge),
+			MaxSpeed:   speed,
+			Windows:    timeWindows(c.Hours),
+		})
+	}
+	if len(conditions) == 0 {
+		return
+	}
+	v.ConditionCount += len(conditions)
+	v.Conditions = append(v.Conditions, graph.EncodeConditions(conditions)...)
+}
+
+func WriteConditions(attr *EdgeAttributes) {
+	fmt.Printf("Found %d conditional restrictions.\n", attr.ConditionCount)
+	// mm cannot create empty files, a missing file means no conditions.
+	if len(attr.Conditions) == 0 {
+		return
+	}
+	var conditions []uint32
+	Create("conditions.ftf", len(attr.Conditions), &conditions)
+	copy(conditions, attr.Conditions)
+	Close(&conditions)
+}
@@ -55,11 +55,35 @@ type EdgeAttributes struct {
 	Steps      [][]byte
 	
 	// access bitvectors
-	Oneway     []byte // TODO: treat oneway bike/car differently
+	OnewayCar  []byte
+	OnewayBike []byte
+	OnewayFoot []byte
 	AccessCar  []byte
 	AccessFoot []byte
 	AccessBike []byte
 	Ferries    []byte
+	Roundabouts []byte
+	
+	// edge -> string ids of the name, ref and destination tags
+	Names        []uint32
+	Refs         []uint32
+	Destinations []uint32
+	// string table, every string is zero terminated
+	StringIds     map[string]uint32
+	StringOffsets []uint32
+	Strings       []byte
+	
+	// edges of the ways which are part of a turn restriction
+	WayEdges map[int64][]WayEdge
+	// encoded restrictions, see graph/restriction.go
+	Restrictions        []uint32
+	RestrictionCount    int
+	SkippedRestrictions int
+	// vertex -> incident edges, for the barriers
+	BarrierEdges map[uint32][]uint32
+	// encoded conditional restrictions, see graph/conditions.go
+	Conditions     []uint32
+	ConditionCount int
 }
 
 func EdgeLength(steps []geo.Coordinate, e ellipsoid.Ellipsoid) uint16 {
@@ -92,9 +116,6 @@ func (v *EdgeAttributes) VisitNode(node osm.Node) {
 	v.Positions.Set(node.Id, node.Position)
 }
 
-func (v *EdgeAttributes) VisitRelation(relation osm.Relation) {
-}
-
 // Record a new edge from vertex i to j
 func (v *EdgeAttributes) NewEdge(i, j uint32) uint32 {
 	// Out edge i->
@@ -135,6 +156,22 @@ func SetBit(ary []byte, i uint32) {
 	ary[i / 8] |= 1 << (i % 8)
 }
 
+// Returns the id of s in the string table, the empty string has id 0.
+func (v *EdgeAttributes) StringId(s string) uint32 {
+	if s == "" {
+		return 0
+	}
+	if id, ok := v.StringIds[s]; ok {
+		return id
+	}
+	id := uint32(len(v.StringOffsets))
+	v.StringIds[s] = id
+	v.StringOffsets = append(v.StringOffsets, uint32(len(v.Strings)))
+	v.Strings = append(v.Strings, s...)
+	v.Strings = append(v.Strings, 0)
+	return id
+}
+
 func (v *EdgeAttributes) SetExtendedAttributes(way osm.Way, edge uint32) {
 	// Osm Attributes
 	// Store MaxSpeed in km/h.
@@ -145,8 +182,15 @@ func (v *EdgeAttributes) SetExtendedAttributes(way osm.Way, edge uint32) {
 	v.MaxSpeeds[edge] = uint16(speed)
 	
 	// Bitvectors
-	if way.Attributes["oneway"] == "true" {
-		SetBit(v.Oneway, edge)
+	oneway := osm.OnewayMask(way)
+	if oneway & osm.AccessMotorcar != 0 {
+		SetBit(v.OnewayCar, edge)
+	}
+	if oneway & osm.AccessBicycle != 0 {
+		SetBit(v.OnewayBike, edge)
+	}
+	if oneway & osm.AccessFoot != 0 {
+		SetBit(v.OnewayFoot, edge)
 	}
 	
 	mask := osm.AccessMask(way)
@@ -163,6 +207,16 @@ func (v *EdgeAttributes) SetExtendedAttributes(way osm.Way, edge uint32) {
 	if way.Attributes["route"] == "ferry" {
 		SetBit(v.Ferries, edge)
 	}
+	if way.Attributes["junction"] == "roundabout" {
+		SetBit(v.Roundabouts, edge)
+	}
+	
+	// Street names
+	v.Names[edge] = v.StringId(way.Attributes["name"])
+	v.Refs[edge] = v.StringId(way.Attributes["ref"])
+	v.Destinations[edge] = v.StringId(way.Attributes["destination"])
+	
+	v.SetConditions(way, edge)
 }
 
 func (v *EdgeAttributes) VisitWay(way osm.Way) {
@@ -181,6 +235,12 @@ func (v *EdgeAttributes) VisitWay(way osm.Way) {
 			edge := v.NewEdge(segmentIndex, nodeIndex)
 			v.NewStep(way.Nodes[segmentStart:i+1], edge)
 			v.SetExtendedAttributes(way, edge)
+			if v.RestrictionWays[way.Id] {
+				v.WayEdges[way.Id] = append(v.WayEdges[way.Id],
+					WayEdge{edge, segmentIndex, nodeIndex})
+			}
+			v.BarrierEdge(way.Nodes[segmentStart], segmentIndex, edge)
+			v.BarrierEdge(nodeId, nodeIndex, edge)
 			segmentStart = i
 			segmentIndex = nodeIndex
 		}
@@ -195,6 +255,12 @@ func NewEdgeAttributes(graph *StreetGraph, vertices []uint32) *EdgeAttributes {
 		Positions:   NewPositions(64),
 		CurrentOut:  vertices,
 		Region:      mm.NewRegion(0),
+		// string 0 is the empty string
+		StringIds:     make(map[string]uint32),
+		StringOffsets: []uint32{0},
+		Strings:       []byte{0},
+		WayEdges:      make(map[int64][]WayEdge),
+		BarrierEdges:  make(map[uint32][]uint32),
 	}
 	
 	Create("vertices-in.ftf", numVertices, &attr.FirstIn)
@@ -202,14 +268,20 @@ func NewEdgeAttributes(graph *StreetGraph, vertices []uint32) *EdgeAttributes {
 	Create("edges.ftf", numEdges, &attr.Edges)
 	Create("distances.ftf", numEdges, &attr.Distances)
 	Create("maxspeeds.ftf", numEdges, &attr.MaxSpeeds)
+	Create("names.ftf", numEdges, &attr.Names)
+	Create("refs.ftf", numEdges, &attr.Refs)
+	Create("destinations.ftf", numEdges, &attr.Destinations)
 	Allocate(numEdges+1, &attr.Steps)
 	
 	bvSize := (numEdges + 7) / 8
-	Create("oneway.ftf",      bvSize, &attr.Oneway)
+	Create("oneway.ftf",      bvSize, &attr.OnewayCar)
+	Create("oneway-bike.ftf", bvSize, &attr.OnewayBike)
+	Create("oneway-foot.ftf", bvSize, &attr.OnewayFoot)
 	Create("access-car.ftf",  bvSize, &attr.AccessCar)
 	Create("access-bike.ftf", bvSize, &attr.AccessBike)
 	Create("access-foot.ftf", bvSize, &attr.AccessFoot)
 	Create("ferries.ftf",     bvSize, &attr.Ferries)
+	Create("roundabouts.ftf", bvSize, &attr.Roundabouts)
 	
 	for i, _ := range attr.FirstIn {
 		attr.FirstIn[i] = 0xffffffff
@@ -228,11 +300,30 @@ func WriteEdgeAttributes(attr *EdgeAttributes) {
 	Close(&attr.Distances)
 	Close(&attr.MaxSpeeds)
 	
-	Close(&attr.Oneway)
+	Close(&attr.OnewayCar)
+	Close(&attr.OnewayBike)
+	Close(&attr.OnewayFoot)
 	Close(&attr.AccessCar)
 	Close(&attr.AccessBike)
 	Close(&attr.AccessFoot)
 	Close(&attr.Ferries)
+	Close(&attr.Roundabouts)
+	
+	Close(&attr.Names)
+	Close(&attr.Refs)
+	Close(&attr.Destinations)
+	
+	// Output the string table, plus sentinel
+	var offsets []uint32
+	Create("string_offsets.ftf", len(attr.StringOffsets)+1, &offsets)
+	copy(offsets, attr.StringOffsets)
+	offsets[len(attr.StringOffsets)] = uint32(len(attr.Strings))
+	Close(&offsets)
+	
+	var strings []byte
+	Create("strings.ftf", len(attr.Strings), &strings)
+	copy(strings, attr.Strings)
+	Close(&strings)
 	
 	// Compute the step indices
 	var steps []uint32
@@ -253,6 +344,9 @@ func WriteEdgeAttributes(attr *EdgeAttributes) {
 	Close(&steps)
 	Close(&step_positions)
 	attr.Region.Free()
+	
+	WriteRestrictions(attr)
+	WriteConditions(attr)
 }
 
 func ComputeEdgeAttributes(graph *StreetGraph, vertices []uint32) {
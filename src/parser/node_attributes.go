@@ -20,11 +20,12 @@ package main
 import (
 	"alg"
 	"fmt"
+	"graph"
 	"osm"
 )
 
 // Pass 2
-// Gather the relevant node attributes: out-degrees and positions.
+// Gather the relevant node attributes: out-degrees, positions and delays.
 // At this point we could allow a small interlude which sorts the node
 // indices, but we do not do this currently.
 
@@ -32,6 +33,15 @@ type NodeAttributes struct {
 	*StreetGraph
 	Degrees   []uint32
 	Positions []int32
+	Delays    []byte
+}
+
+// Traffic controls and the corresponding delays, see graph/delays.go.
+var NodeDelays = map[osm.TrafficControl] graph.NodeDelay {
+	osm.ControlTrafficSignals: graph.DelayTrafficSignals,
+	osm.ControlStop:           graph.DelayStop,
+	osm.ControlGiveWay:        graph.DelayGiveWay,
+	osm.ControlCrossing:       graph.DelayCrossing,
 }
 
 func (v *NodeAttributes) VisitNode(node osm.Node) {
@@ -39,6 +49,7 @@ func (v *NodeAttributes) VisitNode(node osm.Node) {
 		lat, lng := node.Position.Encode()
 		v.Positions[2*i]   = lat
 		v.Positions[2*i+1] = lng
+		v.Delays[i] = byte(NodeDelays[osm.NodeTrafficControl(node)])
 	}
 }
 
@@ -61,6 +72,7 @@ func NewNodeAttributes(graph *StreetGraph) *NodeAttributes {
 	attr := &NodeAttributes{StreetGraph: graph}
 	Create("vertices.ftf",  int(graph.Size+1), &attr.Degrees)
 	Create("positions.ftf", int(2*graph.Size), &attr.Positions)
+	Create("delays.ftf",    int(graph.Size),   &attr.Delays)
 	return attr
 }
 
@@ -93,6 +105,7 @@ func PrintStatistics(attr *NodeAttributes) {
 
 func WriteNodeAttributes(attr *NodeAttributes) []uint32 {
 	Close(&attr.Positions)
+	Close(&attr.Delays)
 
 	// Write node -> first edge table (that's the degree sum)
 	c := uint32(0)
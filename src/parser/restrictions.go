@@ -0,0 +1,211 @@
+/*
+ * Copyright 2014 Florian Benz, Steven Schäfer, Bernhard Schommer
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"graph"
+	"osm"
+	"sort"
+)
+
+// Turn restrictions
+// The street graph pass collects the ways which are part of a restriction,
+// the edge attribute pass records the edges of these ways and resolves the
+// restrictions once it reaches the relations (which come after all ways in
+// a pbf file).
+//
+// Barriers are restrictions, too: the street graph pass turns the barrier
+// nodes into vertices and the edge attribute pass records their edges. In
+// the end, every barrier which blocks a transport mode becomes one "only"
+// restriction per edge, see graph.BarrierRestrictions.
+
+// An edge of a way in the direction of the way.
+type WayEdge struct {
+	Edge     uint32
+	From, To uint32
+}
+
+// Returns the edges of a way starting at the given vertex, along with the
+// vertex at the other end. The way may be traversed in both directions.
+func wayPath(edges []WayEdge, start uint32) ([]uint32, uint32, bool) {
+	if len(edges) == 0 {
+		return nil, 0, false
+	}
+	path := make([]uint32, len(edges))
+	if edges[0].From == start {
+		for i, e := range edges {
+			path[i] = e.Edge
+		}
+		return path, edges[len(edges)-1].To, true
+	}
+	if edges[len(edges)-1].To == start {
+		for i, e := range edges {
+			path[len(edges)-1-i] = e.Edge
+		}
+		return path, edges[0].From, true
+	}
+	return nil, 0, false
+}
+
+// Returns the unique edge of a way which is incident to vertex v.
+func incidentEdge(edges []WayEdge, v uint32) (uint32, bool) {
+	found, count := uint32(0), 0
+	for _, e := range edges {
+		if e.From == v || e.To == v {
+			found = e.Edge
+			count++
+		}
+	}
+	return found, count == 1
+}
+
+// Convert an access mask into the transport bits of a graph.Restriction.
+func transportMask(mask osm.AccessType) uint8 {
+	transports := uint8(0)
+	if mask & osm.AccessMotorcar != 0 {
+		transports |= 1 << uint(graph.Car)
+	}
+	if mask & osm.AccessBicycle != 0 {
+		transports |= 1 << uint(graph.Bike)
+	}
+	if mask & osm.AccessFoot != 0 {
+		transports |= 1 << uint(graph.Foot)
+	}
+	return transports
+}
+
+// Resolve a restriction in terms of edges. The from and to ways have to end
+// at the via node or the ends of the via ways, respectively.
+func (v *EdgeAttributes) ResolveRestriction(r osm.Restriction) (graph.Restriction, bool) {
+	result := graph.Restriction{Only: r.Only, Transports: transportMask(r.Mask)}
+	from, to := v.WayEdges[r.From], v.WayEdges[r.To]
+
+	if len(r.Via) == 1 && r.Via[0].Type == osm.TypeNode {
+		via, ok := v.Indices[r.Via[0].Id]
+		if !ok {
+			return result, false
+		}
+		e, ok1 := incidentEdge(from, via)
+		f, ok2 := incidentEdge(to, via)
+		if !ok1 || !ok2 {
+			return result, false
+		}
+		result.Via = graph.Vertex(via)
+		result.Edges = []graph.Edge{graph.Edge(e), graph.Edge(f)}
+		return result, true
+	}
+
+	// The via ways form a path which may start at either end of the first way.
+	first := v.WayEdges[r.Via[0].Id]
+	if len(first) == 0 {
+		return result, false
+	}
+	for _, start := range []uint32{first[0].From, first[len(first)-1].To} {
+		e, ok := incidentEdge(from, start)
+		if !ok {
+			continue
+		}
+		edges := []graph.Edge{graph.Edge(e)}
+		current := start
+		for _, m := range r.Via {
+			path, end, found := wayPath(v.WayEdges[m.Id], current)
+			if !found {
+				ok = false
+				break
+			}
+			for _, e := range path {
+				edges = append(edges, graph.Edge(e))
+			}
+			current = end
+		}
+		if !ok || current == start {
+			continue
+		}
+		f, ok := incidentEdge(to, current)
+		if !ok {
+			continue
+		}
+		result.Via = graph.Vertex(start)
+		result.Edges = append(edges, graph.Edge(f))
+		return result, true
+	}
+	return result, false
+}
+
+func (v *EdgeAttributes) VisitRelation(relation osm.Relation) {
+	r, ok := osm.ParseRestriction(relation)
+	if !ok || r.Mask & v.Access == 0 {
+		return
+	}
+	restriction, ok := v.ResolveRestriction(r)
+	if !ok {
+		v.SkippedRestrictions++
+		return
+	}
+	v.Restrictions = append(v.Restrictions,
+		graph.EncodeRestrictions([]graph.Restriction{restriction})...)
+	v.RestrictionCount++
+}
+
+// Record the edge of the given vertex if it is a barrier.
+func (v *EdgeAttributes) BarrierEdge(nodeId int64, vertex, edge uint32) {
+	if _, ok := v.Barriers[nodeId]; ok {
+		v.BarrierEdges[vertex] = append(v.BarrierEdges[vertex], edge)
+	}
+}
+
+// Add the restrictions for all barriers, ordered by their vertex. A barrier
+// at a dead end does not block anything.
+func (v *EdgeAttributes) ResolveBarriers() int {
+	blocked := make(map[uint32]osm.AccessType)
+	vertices := []int(nil)
+	for id, mask := range v.Barriers {
+		if vertex, ok := v.Indices[id]; ok && len(v.BarrierEdges[vertex]) > 1 {
+			blocked[vertex] = mask
+			vertices = append(vertices, int(vertex))
+		}
+	}
+	sort.Ints(vertices)
+
+	for _, i := range vertices {
+		vertex := uint32(i)
+		edges := make([]graph.Edge, len(v.BarrierEdges[vertex]))
+		for j, e := range v.BarrierEdges[vertex] {
+			edges[j] = graph.Edge(e)
+		}
+		restrictions := graph.BarrierRestrictions(graph.Vertex(vertex), edges,
+			transportMask(blocked[vertex]))
+		v.Restrictions = append(v.Restrictions,
+			graph.EncodeRestrictions(restrictions)...)
+	}
+	return len(vertices)
+}
+
+func WriteRestrictions(attr *EdgeAttributes) {
+	fmt.Printf("Found %d turn restrictions, skipped %d.\n",
+		attr.RestrictionCount, attr.SkippedRestrictions)
+	fmt.Printf("Found %d barriers.\n", attr.ResolveBarriers())
+	// mm cannot create empty files, a missing file means no restrictions.
+	if len(attr.Restrictions) == 0 {
+		return
+	}
+	var restrictions []uint32
+	Create("restrictions.ftf", len(attr.Restrictions), &restrictions)
+	copy(restrictions, attr.Restrictions)
+	Close(&restrictions)
+}
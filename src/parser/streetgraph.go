@@ -35,12 +35,27 @@ type StreetGraph struct {
 	Size     uint32
 	Indices  NodeIndices
 	Visited  alg.BitVector
+	// ways which are part of a turn restriction
+	RestrictionWays map[int64]bool
+	// node -> blocked transport modes, for the barriers
+	Barriers map[int64]osm.AccessType
 }
 
 func (s *StreetGraph) VisitNode(node osm.Node) {
+	// Barriers become vertices, so that we can restrict the passage.
+	if blocked := s.Access &^ osm.BarrierAccessMask(node); blocked != 0 {
+		s.Barriers[node.Id] = blocked
+	}
 }
 
 func (s *StreetGraph) VisitRelation(relation osm.Relation) {
+	r, ok := osm.ParseRestriction(relation)
+	if !ok || r.Mask & s.Access == 0 {
+		return
+	}
+	for _, id := range r.Ways() {
+		s.RestrictionWays[id] = true
+	}
 }
 
 func (s *StreetGraph) VisitWay(way osm.Way) {
@@ -65,7 +80,8 @@ func (s *StreetGraph) VisitWay(way osm.Way) {
 			// node is already in the graph
 			continue
 		}
-		if i == 0 || i == len(way.Nodes) - 1 || s.Visited.Get(nodeId) {
+		_, barrier := s.Barriers[nodeId]
+		if i == 0 || i == len(way.Nodes) - 1 || s.Visited.Get(nodeId) || barrier {
 			s.Indices[nodeId] = s.Size
 			s.Size++
 		}
@@ -84,6 +100,8 @@ func NewStreetGraph(file *os.File, access osm.AccessType) *StreetGraph {
 		Indices: NodeIndices {},
 		Visited: alg.NewBitVector(64),
 		Size:    0,
+		RestrictionWays: make(map[int64]bool),
+		Barriers:        make(map[int64]osm.AccessType),
 	}
 	err := osm.ParseFile(file, graph)
 	if err != nil {
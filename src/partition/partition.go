@@ -71,6 +71,8 @@ func main() {
 	pi := &PartitionInfo{Count: partitionCount}
 
 	pi.metisPartitioning(g)
+	g = pi.splitCutEdges(g)
+	pi.collectBorderVertices(g)
 	pi.createSubgraphs(g, FlagBaseDir)
 	pi.createOverlayGraph(g, FlagBaseDir)
 }
@@ -144,10 +146,15 @@ func (pi *PartitionInfo) metisPartitioning(g *graph.GraphFile) {
 	// remove both files
 	os.Remove(MetisGraphFile)
 	os.Remove(metisOutputName)
+}
+
+func (pi *PartitionInfo) collectBorderVertices(g *graph.GraphFile) {
+	time4 := time.Now()
 
 	// determine border vertices
 	// here, initially pi.BorderTable maps border vertices to their partition
 	crossEdges := 0
+	edges := []graph.Edge(nil)
 	pi.BorderTable = make([]int, g.VertexCount())
 	for i, _ := range pi.BorderTable {
 		pi.BorderTable[i] = -1
@@ -0,0 +1,126 @@
+/*
+ * Copyright 2014 Florian Benz, Steven Schäfer, Bernhard Schommer
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Splits the cut edges of the partition
+
+package main
+
+import (
+	"alg"
+	"fmt"
+	"geo"
+	"graph"
+	"time"
+)
+
+// The overlay graph only knows the boundary vertices and not the edge over
+// which a path arrives at them, so it cannot respect a turn restriction at
+// a boundary vertex. We therefore split every cut edge {u, v} into three
+// edges: u - u' in the cluster of u, a very short cut edge u' - v' and
+// v' - v in the cluster of v. Only the new vertices u' and v' are boundary
+// vertices. They have degree 2 and no restrictions, and every vertex of the
+// original graph is an interior vertex of its cluster.
+func (pi *PartitionInfo) splitCutEdges(g *graph.GraphFile) *graph.GraphFile {
+	time1 := time.Now()
+
+	x := graph.NewGraphExtension(g)
+	// cut edge -> the new edges at its tail and its head
+	replacement := make(map[graph.Edge][2]graph.Edge)
+	for i := 0; i < g.VertexCount(); i++ {
+		u := graph.Vertex(i)
+		for j := g.FirstOut[u]; j < g.FirstOut[u+1]; j++ {
+			e := graph.Edge(j)
+			v := g.EdgeOpposite(e, u)
+			if pi.Table[u] == pi.Table[v] {
+				continue
+			}
+			tail, head := splitEdge(g, x, e, u, v)
+			replacement[e] = [2]graph.Edge{tail, head}
+			pi.Table = append(pi.Table, pi.Table[u], pi.Table[v])
+		}
+	}
+
+	// Restrictions at u and v now refer to the new edges. Restrictions with
+	// via ways have already been replaced in refine, we drop them if they
+	// contain a cut edge.
+	for i, r := range x.Restrictions {
+		if len(r.Edges) != 2 {
+			continue
+		}
+		edges := make([]graph.Edge, 2)
+		for j, e := range r.Edges {
+			edges[j] = e
+			if split, ok := replacement[e]; ok {
+				if g.EdgeTail(e) == r.Via {
+					edges[j] = split[0]
+				} else {
+					edges[j] = split[1]
+				}
+			}
+		}
+		x.Restrictions[i].Edges = edges
+	}
+
+	result := x.Build()
+	time2 := time.Now()
+	fmt.Printf("Splitting %d cut edges: %v s\n", len(replacement), time2.Sub(time1).Seconds())
+	return result
+}
+
+// Split the edge e from u to v at its middle point, returns the new edges
+// at u and v. The attributes of all three parts are copied from e.
+func splitEdge(g *graph.GraphFile, x *graph.GraphExtension, e graph.Edge, u, v graph.Vertex) (graph.Edge, graph.Edge) {
+	cu, cv := g.VertexCoordinate(u), g.VertexCoordinate(v)
+	steps := g.EdgeGeometry(e, u)
+	var middle geo.Coordinate
+	var first, second []geo.Coordinate
+	if len(steps) > 0 {
+		k := len(steps) / 2
+		middle, first, second = steps[k], steps[:k], steps[k+1:]
+	} else {
+		middle = geo.Coordinate{Lat: (cu.Lat + cv.Lat) / 2, Lng: (cu.Lng + cv.Lng) / 2}
+	}
+
+	// Divide the distance of the edge in proportion to the lengths of both parts.
+	l1 := geo.StepLength(append(append([]geo.Coordinate{cu}, first...), middle))
+	l2 := geo.StepLength(append(append([]geo.Coordinate{middle}, second...), cv))
+	distance := alg.HalfToFloat64(g.Distances[e])
+	d1 := distance / 2
+	if l1+l2 > 0 {
+		d1 = distance * l1 / (l1 + l2)
+	}
+
+	access := g.EdgeAccessMask(e)
+	oneway := g.EdgeOnewayMask(e)
+	// The new vertices are hidden if the edge is part of a copied via way.
+	vaccess := access & g.VertexAccessMask(u) & g.VertexAccessMask(v)
+	u1 := x.AddVertex(middle, vaccess)
+	v1 := x.AddVertex(middle, vaccess)
+	x.RemoveEdge(e)
+	tail := x.AddEdge(graph.ExtensionEdge{
+		From: u, To: u1, Original: e, Steps: first,
+		Distance: d1, Access: access, Oneway: oneway,
+	})
+	x.AddEdge(graph.ExtensionEdge{
+		From: u1, To: v1, Original: e,
+		Distance: 0, Access: access, Oneway: oneway,
+	})
+	head := x.AddEdge(graph.ExtensionEdge{
+		From: v1, To: v, Original: e, Steps: second,
+		Distance: distance - d1, Access: access, Oneway: oneway,
+	})
+	return tail, head
+}
@@ -81,23 +81,29 @@ func SanityCheck(g graph.Graph, mode graph.Transport) {
 	inHistogram.Print()
 }
 
-func Reach(g graph.Graph, v graph.Vertex, forward bool, mode graph.Transport) []byte {
+// Reach returns the vertices which are reachable from v (forward) or from
+// which v is reachable. The search runs on the states of g, so that it sees
+// the turn restrictions and the barriers. For the backward search, v must
+// not be turn-aware, as the vertex state of such a vertex has no predecessors.
+func Reach(g *graph.GraphFile, v graph.Vertex, forward bool, mode graph.Transport) []byte {
 	result := make([]byte, (g.VertexCount()+7)/8)
+	visited := make([]byte, (g.StateCount()+7)/8)
 	queue := make([]graph.Vertex, 1, 128)
 	alg.SetBit(result, uint(v))
+	alg.SetBit(visited, uint(v))
 	queue[0] = v
 
-	edges := []graph.Edge(nil)
+	darts := []graph.Dart(nil)
 
 	for len(queue) > 0 {
 		s := queue[len(queue)-1]
 		queue = queue[:len(queue)-1]
-		edges = g.VertexEdges(s, forward, mode, edges)
-		for _, e := range edges {
-			t := g.EdgeOpposite(e, s)
-			if !alg.GetBit(result, uint(t)) {
-				alg.SetBit(result, uint(t))
-				queue = append(queue, t)
+		darts = g.StateNeighbors(s, forward, mode, graph.Distance, darts)
+		for _, d := range darts {
+			if !alg.GetBit(visited, uint(d.Vertex)) {
+				alg.SetBit(visited, uint(d.Vertex))
+				alg.SetBit(result, uint(g.StateVertex(d.Vertex)))
+				queue = append(queue, d.Vertex)
 			}
 		}
 	}
@@ -105,33 +111,54 @@ func Reach(g graph.Graph, v graph.Vertex, forward bool, mode graph.Transport) []
 	return result
 }
 
-func SCC(g graph.Graph, v graph.Vertex, t graph.Transport) ([]byte, int) {
+func SCC(g *graph.GraphFile, v graph.Vertex, t graph.Transport) ([]byte, int) {
 	r0 := Reach(g, v, true, t)
 	r1 := Reach(g, v, false, t)
 	scc := alg.Intersection(r0, r1)
 	return scc, alg.Popcount(scc)
 }
 
-// RandomVertex returns a random vertex that is not in the final graph yet
-func RandomVertex(g graph.Graph, in []byte) graph.Vertex {
-	for {
-		r := rand.Intn(g.VertexCount())
-		if !alg.GetBit(in, uint(r)) {
-			return graph.Vertex(r)
+// RandomVertex returns a random vertex that is not in the final graph yet,
+// or -1 if there is none. Turn-aware vertices are skipped, see Reach.
+func RandomVertex(g *graph.GraphFile, in []byte) graph.Vertex {
+	candidate := func(v graph.Vertex) bool {
+		return !alg.GetBit(in, uint(v)) && !g.VertexTurnAware(v)
+	}
+	// Sample from the candidates, so that we stop if all vertices are taken.
+	count := 0
+	for i := 0; i < g.VertexCount(); i++ {
+		if candidate(graph.Vertex(i)) {
+			count++
+		}
+	}
+	if count == 0 {
+		return -1
+	}
+	r := rand.Intn(count)
+	for i := 0; i < g.VertexCount(); i++ {
+		if candidate(graph.Vertex(i)) {
+			if r == 0 {
+				return graph.Vertex(i)
+			}
+			r--
 		}
 	}
 	return -1
 }
 
 // LargeSCC returns the union of all large SCCs found
-func LargeSCC(g graph.Graph, t graph.Transport) ([]byte, int) {
+func LargeSCC(g *graph.GraphFile, t graph.Transport) ([]byte, int) {
 	in := make([]byte, g.VertexCount())
 	totalSize := 0
 	sccCount := 0
 	fmt.Printf("Computing SCCs for t = %v\n", t)
 	// Stops after MaxTrials unsuccessful trials or if it is not possible to find a SCC of sufficent size anymore
 	for i := 0; i < MaxTrials && totalSize+MinSize <= g.VertexCount(); i++ {
-		scc, size := SCC(g, RandomVertex(g, in), t)
+		v := RandomVertex(g, in)
+		if v == -1 {
+			break
+		}
+		scc, size := SCC(g, v, t)
 		if size >= MinSize {
 			i--
 			in = alg.Union(in, scc)
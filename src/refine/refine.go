@@ -79,9 +79,13 @@ func main() {
 
 	println("Open input file. " + InputFile)
 	g, _ := graph.OpenGraphFile(InputFile, true)
-	println("Pass 1/2: Find the accessible subgraph.")
+	println("Pass 1/3: Expand the restrictions with via ways.")
+	vertexCount := g.VertexCount()
+	g = ExpandRestrictions(g)
+	println("Pass 2/3: Find the accessible subgraph.")
 	subgraph := AccessibleRegion(g)
-	println("Pass 2/2: Output the subgraph.")
+	HideCopies(g, vertexCount)
+	println("Pass 3/3: Output the subgraph.")
 	if OutputFile != "" {
 		g.WriteInducedSubgraph(OutputFile, subgraph)
 	}
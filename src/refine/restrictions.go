@@ -0,0 +1,280 @@
+/*
+ * Copyright 2014 Florian Benz, Steven Schäfer, Bernhard Schommer
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"alg"
+	"fmt"
+	"graph"
+)
+
+// Restrictions with via ways
+//
+// The searches only handle restrictions at a single via vertex. A restriction
+// from the edge a over the via edges w1, ..., wk to the edge b is replaced by
+// a copy of the via path, which has to be used after a: the turn from a into
+// w1 is forbidden, as is every other turn into the copy of w1. The copy of a
+// via vertex has copies of the edges of the original vertex, except for the
+// edges which a restriction forbids at this point. Restrictions with the same
+// from edge share the copies of their common prefix, i.e., the copies form a
+// trie. The copies are oneway and only accessible for a single transport mode,
+// since the restrictions differ between the modes.
+
+// A vertex on the via path of some restrictions.
+type viaNode struct {
+	vertex    graph.Vertex // the original vertex
+	original  graph.Edge   // the original edge leading to vertex
+	copy      graph.Vertex // the copy of vertex
+	in        graph.Edge   // the copy of original, or -1
+	children  map[graph.Edge]*viaNode
+	forbidden map[graph.Edge]bool // targets of "no" restrictions
+	only      map[graph.Edge]bool // allowed edges of "only" restrictions
+}
+
+func newViaNode(v graph.Vertex, e graph.Edge) *viaNode {
+	return &viaNode{
+		vertex:    v,
+		original:  e,
+		copy:      v,
+		in:        graph.Edge(-1),
+		children:  make(map[graph.Edge]*viaNode),
+		forbidden: make(map[graph.Edge]bool),
+		only:      make(map[graph.Edge]bool),
+	}
+}
+
+func (n *viaNode) allowed(e graph.Edge) bool {
+	return !n.forbidden[e] && (len(n.only) == 0 || n.only[e])
+}
+
+// The restrictions with via ways for one from edge and transport mode.
+type viaTrie struct {
+	root      *viaNode
+	transport graph.Transport
+}
+
+type viaExpansion struct {
+	g *graph.GraphFile
+	x *graph.GraphExtension
+	// (from edge, via vertex) -> indices of the restrictions at a single vertex
+	turns map[[2]int][]int
+	tries []*viaTrie
+	edges []graph.Edge
+}
+
+func ExpandRestrictions(g *graph.GraphFile) *graph.GraphFile {
+	x := graph.NewGraphExtension(g)
+	p := &viaExpansion{
+		g:     g,
+		x:     x,
+		turns: make(map[[2]int][]int),
+	}
+
+	// Keep the restrictions at a single vertex and collect the others in tries.
+	restrictions := x.Restrictions
+	x.Restrictions = nil
+	roots := make(map[[3]int]*viaTrie)
+	expanded := 0
+	for _, r := range restrictions {
+		if len(r.Edges) == 2 {
+			key := [2]int{int(r.From()), int(r.Via)}
+			p.turns[key] = append(p.turns[key], len(x.Restrictions))
+			x.Restrictions = append(x.Restrictions, r)
+			continue
+		}
+		expanded++
+		for t := graph.Transport(0); t < graph.TransportMax; t++ {
+			if !r.Applies(t) || t == graph.Foot {
+				continue
+			}
+			key := [3]int{int(r.From()), int(r.Via), int(t)}
+			trie, ok := roots[key]
+			if !ok {
+				trie = &viaTrie{newViaNode(r.Via, r.From()), t}
+				roots[key] = trie
+				p.tries = append(p.tries, trie)
+			}
+			p.insert(trie, r)
+		}
+	}
+
+	for _, trie := range p.tries {
+		p.expandChildren(trie.root, trie.transport)
+	}
+	p.restrictRoots()
+
+	fmt.Printf("Expanded %d restrictions with via ways, %d new vertices\n",
+		expanded, len(x.Vertices))
+	return x.Build()
+}
+
+// Returns true if e can be used to leave v with transport t.
+func (p *viaExpansion) usable(e graph.Edge, v graph.Vertex, t graph.Transport) bool {
+	p.edges = p.g.VertexEdges(v, true, t, p.edges)
+	for _, f := range p.edges {
+		if f == e {
+			return true
+		}
+	}
+	return false
+}
+
+// Add a restriction to the trie, restrictions whose edges do not form a
+// path are ignored.
+func (p *viaExpansion) insert(trie *viaTrie, r graph.Restriction) {
+	v := r.Via
+	for _, e := range r.Edges[1:] {
+		if !p.usable(e, v, trie.transport) {
+			return
+		}
+		v = p.g.EdgeOpposite(e, v)
+	}
+
+	node := trie.root
+	for _, e := range r.Edges[1 : len(r.Edges)-1] {
+		child, ok := node.children[e]
+		if !ok {
+			child = newViaNode(p.g.EdgeOpposite(e, node.vertex), e)
+			node.children[e] = child
+		}
+		if r.Only {
+			node.only[e] = true
+		}
+		node = child
+	}
+	if r.Only {
+		node.only[r.To()] = true
+	} else {
+		node.forbidden[r.To()] = true
+	}
+}
+
+// Add a copy of the original edge e from the vertex u, which starts at the vertex from.
+func (p *viaExpansion) copyEdge(e graph.Edge, u, from, to graph.Vertex, t graph.Transport) graph.Edge {
+	return p.x.AddEdge(graph.ExtensionEdge{
+		From:     from,
+		To:       to,
+		Original: e,
+		Steps:    p.g.EdgeGeometry(e, u),
+		Distance: alg.HalfToFloat64(p.g.Distances[e]),
+		Access:   1 << uint(t),
+		Oneway:   1 << uint(t),
+	})
+}
+
+// Create the copies of the children of node, in the order of the edges.
+func (p *viaExpansion) expandChildren(node *viaNode, t graph.Transport) {
+	for _, e := range p.g.VertexEdges(node.vertex, true, t, nil) {
+		child, ok := node.children[e]
+		if ok && node.allowed(e) && p.g.TurnAllowed(node.original, node.vertex, e, t) {
+			p.expand(child, node, t)
+		}
+	}
+}
+
+// Create the copy of node, which is reached from its parent.
+func (p *viaExpansion) expand(node, parent *viaNode, t graph.Transport) {
+	g := p.g
+	node.copy = p.x.AddVertex(g.VertexCoordinate(node.vertex), 0)
+	if g.Delays != nil {
+		p.x.Vertices[len(p.x.Vertices)-1].Delay = graph.NodeDelay(g.Delays[node.vertex])
+	}
+	node.in = p.copyEdge(node.original, parent.vertex, parent.copy, node.copy, t)
+	p.expandChildren(node, t)
+
+	for _, e := range g.VertexEdges(node.vertex, true, t, nil) {
+		if _, ok := node.children[e]; ok {
+			continue
+		}
+		if !node.allowed(e) || !g.TurnAllowed(node.original, node.vertex, e, t) {
+			continue
+		}
+
+		// Leave the via path, the restrictions at the next vertex also apply
+		// to the copy of e. Restrictions with via ways which start with e
+		// are not copied, though.
+		u := g.EdgeOpposite(e, node.vertex)
+		f := p.copyEdge(e, node.vertex, node.copy, u, t)
+		for _, i := range p.turns[[2]int{int(e), int(u)}] {
+			r := p.x.Restrictions[i]
+			if r.Applies(t) {
+				p.x.Restrictions = append(p.x.Restrictions, graph.Restriction{
+					Transports: 1 << uint(t),
+					Only:       r.Only,
+					Via:        u,
+					Edges:      []graph.Edge{f, r.To()},
+				})
+			}
+		}
+	}
+}
+
+// Forbid the turns from the from edges into the original via paths, and
+// from every other edge into the copies.
+func (p *viaExpansion) restrictRoots() {
+	g, x := p.g, p.x
+	incident := make(map[graph.Vertex][]graph.Edge)
+	for _, trie := range p.tries {
+		incident[trie.root.vertex] = nil
+	}
+	for i, e := range x.Edges {
+		for _, v := range []graph.Vertex{e.From, e.To} {
+			if edges, ok := incident[v]; ok {
+				incident[v] = append(edges, graph.Edge(g.EdgeCount()+i))
+			}
+		}
+	}
+
+	forbid := func(t graph.Transport, via graph.Vertex, from, to graph.Edge) {
+		x.Restrictions = append(x.Restrictions, graph.Restriction{
+			Transports: 1 << uint(t),
+			Via:        via,
+			Edges:      []graph.Edge{from, to},
+		})
+	}
+	for _, trie := range p.tries {
+		root, t := trie.root, trie.transport
+		edges := append(g.VertexRawEdges(root.vertex, nil), incident[root.vertex]...)
+		for _, e := range g.VertexRawEdges(root.vertex, nil) {
+			if _, ok := root.children[e]; ok || !root.allowed(e) {
+				forbid(t, root.vertex, root.original, e)
+			}
+		}
+		for _, e := range g.VertexRawEdges(root.vertex, nil) {
+			child, ok := root.children[e]
+			if !ok || int(child.in) == -1 {
+				continue
+			}
+			for _, e := range edges {
+				if e != root.original {
+					forbid(t, root.vertex, e, child.in)
+				}
+			}
+		}
+	}
+}
+
+// The copies of the via paths are part of the accessible region, but they
+// should never be the nearest neighbor of a waypoint. All vertices from the
+// given index onwards are copies.
+func HideCopies(g *graph.GraphFile, first int) {
+	for t := range g.Access {
+		for v := first; v < g.VertexCount(); v++ {
+			alg.ClearBit(g.Access[t], uint(v))
+		}
+	}
+}
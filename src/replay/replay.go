@@ -0,0 +1,225 @@
+/*
+ * Copyright 2014 Florian Benz, Steven Schäfer, Bernhard Schommer
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Replays the access log of the server against a running server and
+// reports the latencies.
+//
+// Usage: replay [flags] access-2014-07-01.jsonl ...
+//
+// Only GET requests are replayed, as the body of POST requests is not
+// contained in the log. The latencies are measured on the client side, from
+// sending the request until the whole response has been read.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// command line flags
+	FlagServer      string
+	FlagConcurrency int
+	FlagLimit       int
+	FlagTimeout     time.Duration
+
+	Percentiles = []float64{50, 90, 95, 99, 99.9}
+)
+
+// The part of an access log entry which is needed for the replay.
+type Entry struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+}
+
+type Result struct {
+	Status   int
+	Duration time.Duration
+	Err      error
+}
+
+func init() {
+	flag.StringVar(&FlagServer, "server", "http://localhost:23401", "base URL of the server")
+	flag.IntVar(&FlagConcurrency, "concurrency", 1, "number of concurrent requests")
+	flag.IntVar(&FlagLimit, "n", 0, "maximum number of requests, 0 for all")
+	flag.DurationVar(&FlagTimeout, "timeout", time.Minute, "timeout of a single request")
+}
+
+// readLog returns the URLs of all GET requests in the log file.
+func readLog(filename string, urls []string) ([]string, int, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer file.Close()
+
+	skipped := 0
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var entry Entry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			return nil, 0, fmt.Errorf("%s: %v", filename, err)
+		}
+		if entry.Method != "" && entry.Method != "GET" {
+			skipped++
+			continue
+		}
+		urls = append(urls, entry.URL)
+	}
+	return urls, skipped, scanner.Err()
+}
+
+func replay(client *http.Client, url string) Result {
+	startTime := time.Now()
+	resp, err := client.Get(url)
+	if err != nil {
+		return Result{Err: err}
+	}
+	_, err = io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	return Result{Status: resp.StatusCode, Duration: time.Now().Sub(startTime), Err: err}
+}
+
+// percentile returns the p-th percentile of the sorted durations with the
+// nearest-rank method.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	} else if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return sorted[rank]
+}
+
+func report(results []Result, elapsed time.Duration) {
+	durations := []time.Duration(nil)
+	statuses := make(map[int]int)
+	failed := 0
+	total := time.Duration(0)
+	for _, r := range results {
+		if r.Err != nil {
+			failed++
+			continue
+		}
+		statuses[r.Status]++
+		durations = append(durations, r.Duration)
+		total += r.Duration
+	}
+	sort.Sort(byDuration(durations))
+
+	fmt.Printf("Requests:   %d in %v (%.1f/s)\n", len(results), elapsed, float64(len(results))/elapsed.Seconds())
+	fmt.Printf("Failed:     %d\n", failed)
+	codes := []int(nil)
+	for code := range statuses {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	for _, code := range codes {
+		fmt.Printf("%-12s%d\n", fmt.Sprintf("Status %d:", code), statuses[code])
+	}
+	if len(durations) == 0 {
+		return
+	}
+	fmt.Printf("Mean:       %v\n", total/time.Duration(len(durations)))
+	for _, p := range Percentiles {
+		fmt.Printf("%-12s%v\n", fmt.Sprintf("p%v:", p), percentile(durations, p))
+	}
+	fmt.Printf("Max:        %v\n", durations[len(durations)-1])
+}
+
+type byDuration []time.Duration
+
+func (d byDuration) Len() int           { return len(d) }
+func (d byDuration) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
+func (d byDuration) Less(i, j int) bool { return d[i] < d[j] }
+
+func main() {
+	flag.Parse()
+	if flag.NArg() == 0 || FlagConcurrency < 1 {
+		fmt.Fprintln(os.Stderr, "Usage: replay [flags] logfile ...")
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+
+	urls := []string(nil)
+	skipped := 0
+	for _, filename := range flag.Args() {
+		var n int
+		var err error
+		urls, n, err = readLog(filename, urls)
+		if err != nil {
+			log.Fatal("Reading the log failed: ", err)
+		}
+		skipped += n
+	}
+	if FlagLimit > 0 && len(urls) > FlagLimit {
+		urls = urls[:FlagLimit]
+	}
+	if skipped > 0 {
+		fmt.Printf("Skipped %d requests which are not GET requests\n", skipped)
+	}
+
+	client := &http.Client{
+		Timeout:   FlagTimeout,
+		Transport: &http.Transport{MaxIdleConnsPerHost: FlagConcurrency},
+	}
+	base := strings.TrimRight(FlagServer, "/")
+	results := make([]Result, len(urls))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	startTime := time.Now()
+	for i := 0; i < FlagConcurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				results[j] = replay(client, base+urls[j])
+				if err := results[j].Err; err != nil {
+					log.Println(err)
+				}
+			}
+		}()
+	}
+	for i := range urls {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	report(results, time.Now().Sub(startTime))
+}
@@ -0,0 +1,248 @@
+/*
+ * Copyright 2014 Florian Benz, Steven Schäfer, Bernhard Schommer
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Alternative routes with the via vertex approach
+//
+// See Abraham et al. "Alternative Routes in Road Networks" (2010). After the
+// bidirectional search we continue both searches up to the maximum length of
+// an alternative. Every vertex v which is processed in both search spaces
+// defines a path P_v from the source to v and on to the target. Such a path
+// is admissible if
+//  * it shares at most SharingFactor * l(Opt) with the routes found so far,
+//  * its length is at most (1 + StretchFactor) * l(Opt),
+//  * its detour, the part between the last state before v and the first
+//    state after v on the shortest path, is at most (1 + StretchFactor)
+//    times the part of the shortest path which it replaces, and
+//  * it is locally optimal: every subpath of length LocalOptimality * l(Opt)
+//    around v and around both ends of the detour is a shortest path
+//    (checked with the T-test).
+// The bounded stretch is not checked for the other subpaths. All of this
+// happens on the states of the union graph, i.e., shortcut edges of the
+// overlay graph are treated as single edges.
+
+package route
+
+import (
+	"graph"
+	"sort"
+)
+
+const (
+	SharingFactor   = 0.8
+	StretchFactor   = 0.25
+	LocalOptimality = 0.25
+
+	// Maximum number of via vertices for which we run the T-test
+	MaxLocalOptimalityTests = 32
+)
+
+// A candidate via vertex and the length of the corresponding path.
+type viaVertex struct {
+	vertex graph.Vertex
+	length float32
+}
+
+type byLength []viaVertex
+
+func (v byLength) Len() int           { return len(v) }
+func (v byLength) Swap(i, j int)      { v[i], v[j] = v[j], v[i] }
+func (v byLength) Less(i, j int) bool { return v[i].length < v[j].length }
+
+// An edge of a path on the union graph.
+type unionEdge struct {
+	u, v graph.Vertex
+}
+
+// ComputeAlternativeLegs returns the shortest path between location[waypointIndex]
+// and location[waypointIndex+1], followed by up to k alternatives ranked by
+// their length.
+func (r *RoutePlanner) ComputeAlternativeLegs(waypointIndex, k int) []Leg {
+	s := r.searchLeg(waypointIndex)
+	router := s.router
+	if !router.PathFound() {
+		return []Leg{r.noRouteLeg(s)}
+	}
+
+	optimal := router.Distance()
+	limit := (1 + StretchFactor) * optimal
+	settled := router.Settled
+	router.Continue(limit)
+	r.Stats.settled(router.Settled - settled)
+
+	// Collect all states which may lead to a short enough path.
+	candidates := []viaVertex(nil)
+	for i := 0; i < s.g.StateCount(); i++ {
+		v := graph.Vertex(i)
+		if !router.SHeap.Processed(v) || !router.THeap.Processed(v) {
+			continue
+		}
+		length := router.SDist[v] + router.TDist[v]
+		if length <= limit && v != router.MeetVertex {
+			candidates = append(candidates, viaVertex{v, length})
+		}
+	}
+	sort.Sort(byLength(candidates))
+
+	// The edges of all routes found so far, along with their weights.
+	paths := [][]graph.Vertex{router.VPath()}
+	used := make(map[unionEdge]bool)
+	for _, e := range pathEdges(s.g, paths[0]) {
+		used[e] = true
+	}
+	// The distance of every state on the shortest path from its start.
+	position := make(map[graph.Vertex]float32)
+	for i, w := range prefixSums(r.viaWeights(router, paths[0], router.MeetVertex)) {
+		position[paths[0][i]] = w
+	}
+	turnGraph := graph.NewTurnGraph(s.g)
+
+	tests := 0
+	for _, c := range candidates {
+		if len(paths) > k || tests >= MaxLocalOptimalityTests || r.Err() != nil {
+			break
+		}
+		vpath := router.VPathVia(c.vertex)
+		edges := pathEdges(s.g, vpath)
+		weights := r.viaWeights(router, vpath, c.vertex)
+
+		// Limited sharing
+		shared := float32(0)
+		for i, e := range edges {
+			if used[e] {
+				shared += weights[i]
+			}
+		}
+		if shared > SharingFactor*optimal {
+			continue
+		}
+
+		// Bounded stretch of the detour
+		index := 0
+		for vpath[index] != c.vertex {
+			index++
+		}
+		first, last := index, index
+		for first > 0 && !hasPosition(position, vpath[first]) {
+			first--
+		}
+		for last < len(vpath)-1 && !hasPosition(position, vpath[last]) {
+			last++
+		}
+		lengths := prefixSums(weights)
+		start, end := position[vpath[first]], optimal
+		if p, ok := position[vpath[last]]; ok {
+			end = p
+		}
+		if detour := lengths[last] - lengths[first]; detour > (1+StretchFactor)*(end-start) {
+			continue
+		}
+
+		// Local optimality
+		optimalAround := func(i int) bool {
+			tests++
+			return r.locallyOptimal(turnGraph, vpath, weights, i, optimal)
+		}
+		if !optimalAround(index) || !optimalAround(first) || !optimalAround(last) {
+			continue
+		}
+
+		paths = append(paths, vpath)
+		for _, e := range edges {
+			used[e] = true
+		}
+	}
+
+	legs := make([]Leg, len(paths))
+	for i, vpath := range paths {
+		legs[i] = r.elaborateLeg(s, vpath)
+	}
+	return legs
+}
+
+// The edges of a path of states.
+func pathEdges(g *graph.UnionGraph, vpath []graph.Vertex) []unionEdge {
+	edges := make([]unionEdge, len(vpath)-1)
+	for i := range edges {
+		edges[i] = unionEdge{g.StateVertex(vpath[i]), g.StateVertex(vpath[i+1])}
+	}
+	return edges
+}
+
+func hasPosition(position map[graph.Vertex]float32, v graph.Vertex) bool {
+	_, ok := position[v]
+	return ok
+}
+
+// The lengths of all prefixes of a path with the given edge weights.
+func prefixSums(weights []float32) []float32 {
+	sums := make([]float32, len(weights)+1)
+	for i, w := range weights {
+		sums[i+1] = sums[i] + w
+	}
+	return sums
+}
+
+// The weights of the edges on the path via v, derived from the distances
+// in the search spaces.
+func (r *RoutePlanner) viaWeights(router *BidiRouter, vpath []graph.Vertex, via graph.Vertex) []float32 {
+	weights := make([]float32, len(vpath)-1)
+	forward := true
+	for i := range weights {
+		u, v := vpath[i], vpath[i+1]
+		if u == via {
+			forward = false
+		}
+		if forward {
+			weights[i] = router.SDist[v] - router.SDist[u]
+		} else {
+			weights[i] = router.TDist[u] - router.TDist[v]
+		}
+	}
+	return weights
+}
+
+// The T-test: the subpath from the last vertex at least LocalOptimality * optimal
+// before vpath[index] to the first vertex at least as far after it has to be
+// a shortest path.
+func (r *RoutePlanner) locallyOptimal(g graph.Graph, vpath []graph.Vertex, weights []float32, index int, optimal float32) bool {
+	radius := LocalOptimality * optimal
+	first, before := index, float32(0)
+	for first > 0 && before < radius {
+		first--
+		before += weights[first]
+	}
+	last, after := index, float32(0)
+	for last < len(vpath)-1 && after < radius {
+		after += weights[last]
+		last++
+	}
+	if first == last {
+		return true
+	}
+
+	router := &BidiRouter{
+		Transport: r.Transport,
+		Metric:    r.metric(),
+		Context:   r.Context,
+	}
+	router.Reset(g)
+	router.AddSource(vpath[first], 0)
+	router.AddTarget(vpath[last], 0)
+	router.Run()
+	r.Stats.settled(router.Settled)
+	length := before + after
+	return router.PathFound() && length <= router.Distance()*(1+1e-4)+1e-3
+}
@@ -0,0 +1,76 @@
+/*
+ * Copyright 2014 Florian Benz, Steven Schäfer, Bernhard Schommer
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package route
+
+import (
+	"geo"
+	"graph"
+	"testing"
+)
+
+// Two parallel roads of 24 columns, which are connected in the first and the
+// last column and by two rungs. The detour over the second road between the
+// rungs is 2 * 111 m longer than the part of the first road it replaces.
+func ladderNetwork(from, to int) *testNetwork {
+	n := gridNetwork(2, 24, 12)
+	edges := []testEdge(nil)
+	for _, e := range n.Edges {
+		c := int(e.From) % 24
+		if e.To-e.From == 24 && c != 0 && c != 23 && c != from && c != to {
+			continue
+		}
+		edges = append(edges, e)
+	}
+	n.Edges = edges
+	return n
+}
+
+func TestAlternatives(t *testing.T) {
+	for _, test := range []struct {
+		from, to int
+		routes   int
+	}{
+		// The detour has a stretch of 1.28.
+		{8, 19, 1},
+		// The detour has a stretch of 1.23.
+		{8, 21, 2},
+	} {
+		n := ladderNetwork(test.from, test.to)
+		g, trees := n.ClusterGraph()
+		planner := &RoutePlanner{
+			Graph:        g,
+			KdTree:       trees,
+			Waypoints:    []geo.Coordinate{n.Points[n.vertex(0, 0)], n.Points[n.vertex(0, 23)]},
+			Transport:    graph.Car,
+			Metric:       graph.Distance,
+			Alternatives: 2,
+		}
+		result := planner.Run()
+		if len(result.Routes) != test.routes {
+			t.Errorf("rungs at %d and %d: got %d routes, expected %d",
+				test.from, test.to, len(result.Routes), test.routes)
+			continue
+		}
+		optimal := result.Routes[0].Distance.Value
+		for _, route := range result.Routes[1:] {
+			if d := route.Distance.Value - optimal; d < 200 || d > 250 {
+				t.Errorf("rungs at %d and %d: got an alternative of %d m, the shortest route has %d m",
+					test.from, test.to, route.Distance.Value, optimal)
+			}
+		}
+	}
+}
@@ -17,11 +17,17 @@
 package route
 
 import (
+	"context"
 	"graph"
 	"log"
 	"math"
 )
 
+const (
+	// Number of settled vertices between two checks of the context
+	CancelCheckInterval = 1024
+)
+
 type BidiRouter struct {
 	// Data Structures
 	SParent []graph.Vertex
@@ -34,9 +40,15 @@ type BidiRouter struct {
 	Graph     graph.Graph
 	Transport graph.Transport
 	Metric    graph.Metric
+	// Optional, the search stops as soon as the context is done.
+	Context context.Context
 	// Results
 	MeetVertex graph.Vertex
 	MDistance  float32
+	// Number of vertices settled by both searches
+	Settled int
+	// The error of the context if the search was stopped
+	Err error
 }
 
 // Problem Setup
@@ -75,6 +87,8 @@ func (r *BidiRouter) Reset(g graph.Graph) {
 	(&r.THeap).Reset(vertexCount)
 	r.MeetVertex = graph.Vertex(-1)
 	r.MDistance = float32(math.Inf(1))
+	r.Settled = 0
+	r.Err = nil
 }
 
 func (r *BidiRouter) update_meet(v graph.Vertex) {
@@ -99,8 +113,20 @@ func (r *BidiRouter) AddTarget(v graph.Vertex, distance float32) {
 	r.update_meet(v)
 }
 
+// Returns true if the search has to stop. The context is only checked every
+// CancelCheckInterval settled vertices.
+func (r *BidiRouter) cancelled() bool {
+	if r.Context == nil || r.Settled%CancelCheckInterval != 0 {
+		return false
+	}
+	r.Err = r.Context.Err()
+	return r.Err != nil
+}
+
 // Dijkstra
 
+// Run computes a shortest path. If the context is done before, no path is
+// found and Err is set.
 func (r *BidiRouter) Run() {
 	g := r.Graph
 	sh, th := &r.SHeap, &r.THeap
@@ -118,10 +144,16 @@ func (r *BidiRouter) Run() {
 	// bound is less than the sum of the weights of the top elements
 	// in the heap, the current meetVertex lies on the shortest path.
 	for !sh.Empty() && !th.Empty() && upperBound > sh.Top()+th.Top() {
+		if r.cancelled() {
+			r.MeetVertex = graph.Vertex(-1)
+			r.MDistance = float32(math.Inf(1))
+			return
+		}
 		if sh.Top() <= th.Top() {
 			// Source step
 			curr, dist := sh.Pop()
 			r.SDist[curr] = dist
+			r.Settled++
 			darts = g.VertexNeighbors(curr, true /* forward */, t, m, darts)
 			for _, d := range darts {
 				n := d.Vertex
@@ -152,6 +184,7 @@ func (r *BidiRouter) Run() {
 			// Target step
 			curr, dist := th.Pop()
 			r.TDist[curr] = dist
+			r.Settled++
 			darts = g.VertexNeighbors(curr, false /* forward */, t, m, darts)
 			for _, d := range darts {
 				n := d.Vertex
@@ -186,6 +219,45 @@ func (r *BidiRouter) Run() {
 	r.MDistance = upperBound
 }
 
+// Continue both searches after Run until all vertices with a distance of
+// at most limit from a source respectively to a target are processed. This
+// does not change the shortest path, but provides exact distances for the
+// search of alternative paths. The searches stop early if the context is
+// done.
+func (r *BidiRouter) Continue(limit float32) {
+	g := r.Graph
+	t, m := r.Transport, r.Metric
+	darts := []graph.Dart(nil)
+
+	sh := &r.SHeap
+	for !sh.Empty() && sh.Top() <= limit && !r.cancelled() {
+		curr, dist := sh.Pop()
+		r.SDist[curr] = dist
+		r.Settled++
+		darts = g.VertexNeighbors(curr, true /* forward */, t, m, darts)
+		for _, d := range darts {
+			n := d.Vertex
+			if !sh.Processed(n) && sh.Update(n, dist+d.Weight) {
+				r.SParent[n] = curr
+			}
+		}
+	}
+
+	th := &r.THeap
+	for !th.Empty() && th.Top() <= limit && !r.cancelled() {
+		curr, dist := th.Pop()
+		r.TDist[curr] = dist
+		r.Settled++
+		darts = g.VertexNeighbors(curr, false /* forward */, t, m, darts)
+		for _, d := range darts {
+			n := d.Vertex
+			if !th.Processed(n) && th.Update(n, dist+d.Weight) {
+				r.TParent[n] = curr
+			}
+		}
+	}
+}
+
 // Result Queries
 
 func (r *BidiRouter) PathFound() bool {
@@ -204,7 +276,7 @@ func (r *BidiRouter) parent_edge(u, v graph.Vertex, forward bool, buf []graph.Ed
 	minEdge := graph.Edge(-1)
 	minWeight := math.Inf(1)
 	found := false
-	buf = g.VertexEdges(u, forward, r.Transport, buf)
+	buf = searchEdges(g, u, forward, r.Transport, r.Metric, buf)
 	for _, e := range buf {
 		n := g.EdgeOpposite(e, u)
 		if n != v {
@@ -290,7 +362,7 @@ func (r *BidiRouter) EdgeBetween(u, v graph.Vertex) graph.Edge {
 	g := r.Graph
 	minEdge := graph.Edge(-1)
 	minWeight := math.Inf(1)
-	for _, e := range g.VertexEdges(u, true, r.Transport, nil) {
+	for _, e := range searchEdges(g, u, true, r.Transport, r.Metric, nil) {
 		n := g.EdgeOpposite(e, u)
 		if n != v {
 			continue
@@ -312,10 +384,18 @@ func (r *BidiRouter) EdgeBetween(u, v graph.Vertex) graph.Edge {
 // Returns the vertices on a shortest path from a source vertex to a target vertex.
 // Has the great advantage that it actually works for OverlayGraphs.
 func (r *BidiRouter) VPath() []graph.Vertex {
+	return r.VPathVia(r.MeetVertex)
+}
+
+// Returns the vertices on the path from a source vertex to a target vertex
+// via the vertex v, where v has to be reachable in both search spaces. The
+// path consists of the shortest path from a source to v and the shortest
+// path from v to a target.
+func (r *BidiRouter) VPathVia(v graph.Vertex) []graph.Vertex {
 	// Determine the length of the path along with the source vertex s
 	// and target vertex t.
 	sourceSteps, targetSteps := 0, 0
-	s, t := r.MeetVertex, r.MeetVertex
+	s, t := v, v
 	for r.SParent[s] != s {
 		sourceSteps++
 		s = r.SParent[s]
@@ -327,33 +407,33 @@ func (r *BidiRouter) VPath() []graph.Vertex {
 
 	stepCount := sourceSteps + targetSteps
 	if stepCount == 0 {
-		// The meet vertex is both a source and a target vertex.
+		// The via vertex is both a source and a target vertex.
 		return []graph.Vertex{t}
 	}
 	vpath := make([]graph.Vertex, stepCount+1)
 
-	// Path from a source vertex to the meet vertex
+	// Path from a source vertex to the via vertex
 	if sourceSteps != 0 {
-		v := r.MeetVertex
+		u := v
 		i := sourceSteps
-		for r.SParent[v] != v {
-			vpath[i] = v
-			v = r.SParent[v]
+		for r.SParent[u] != u {
+			vpath[i] = u
+			u = r.SParent[u]
 			i--
 		}
-		vpath[0] = v
+		vpath[0] = u
 	}
 
-	// Path from the meet vertex to a target vertex.
+	// Path from the via vertex to a target vertex.
 	if targetSteps != 0 {
-		v := r.MeetVertex
+		u := v
 		i := sourceSteps
-		for r.TParent[v] != v {
-			vpath[i] = v
-			v = r.TParent[v]
+		for r.TParent[u] != u {
+			vpath[i] = u
+			u = r.TParent[u]
 			i++
 		}
-		vpath[i] = v
+		vpath[i] = u
 	}
 
 	return vpath
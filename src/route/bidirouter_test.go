@@ -0,0 +1,72 @@
+/*
+ * Copyright 2014 Florian Benz, Steven Schäfer, Bernhard Schommer
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package route
+
+import (
+	"context"
+	"graph"
+	"testing"
+)
+
+// A path 0 - 1 - ... - n-1 with edges of weight 1 in both directions. Only
+// the methods used by the search are implemented.
+type lineGraph struct {
+	graph.Graph
+	n int
+}
+
+func (g *lineGraph) VertexCount() int {
+	return g.n
+}
+
+func (g *lineGraph) VertexNeighbors(v graph.Vertex, forward bool, t graph.Transport, m graph.Metric, buf []graph.Dart) []graph.Dart {
+	buf = buf[:0]
+	if v > 0 {
+		buf = append(buf, graph.Dart{Vertex: v - 1, Weight: 1})
+	}
+	if int(v) < g.n-1 {
+		buf = append(buf, graph.Dart{Vertex: v + 1, Weight: 1})
+	}
+	return buf
+}
+
+func TestBidiRouterCancel(t *testing.T) {
+	g := &lineGraph{n: 10 * CancelCheckInterval}
+	run := func(ctx context.Context) *BidiRouter {
+		router := &BidiRouter{Context: ctx}
+		router.Reset(g)
+		router.AddSource(0, 0)
+		router.AddTarget(graph.Vertex(g.n-1), 0)
+		router.Run()
+		return router
+	}
+
+	router := run(context.Background())
+	if !router.PathFound() || router.Distance() != float32(g.n-1) || router.Err != nil {
+		t.Errorf("Got distance %v and error %v", router.Distance(), router.Err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	router = run(ctx)
+	if router.PathFound() || router.Err != context.Canceled {
+		t.Errorf("Search was not stopped, error %v", router.Err)
+	}
+	if router.Settled > CancelCheckInterval {
+		t.Errorf("Settled %d vertices after the cancellation", router.Settled)
+	}
+}
@@ -0,0 +1,255 @@
+/*
+ * Copyright 2014 Florian Benz, Steven Schäfer, Bernhard Schommer
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package route
+
+import (
+	"geo"
+	"graph"
+	"kdtree"
+)
+
+// A grid of roads for the tests of the planners. The vertex (r, c) lies at
+// 49.2 + 0.001 r, 7.0 + 0.001 c and every edge has one step in its middle.
+// The columns are divided into clusters of clusterCols columns each.
+type testNetwork struct {
+	Points  []geo.Coordinate
+	Edges   []testEdge
+	Cluster []int // vertex -> cluster
+	cols    int
+}
+
+type testEdge struct {
+	From, To graph.Vertex
+	Oneway   bool             // for all transport modes
+	Steps    []geo.Coordinate // nil for a single step in the middle
+}
+
+const (
+	testLat      = 49.2
+	testLng      = 7.0
+	testSpacing  = 0.001
+	testMaxSpeed = 50
+)
+
+func gridNetwork(rows, cols, clusterCols int) *testNetwork {
+	n := &testNetwork{cols: cols}
+	for r := 0; r < rows; r++ {
+		for c := 0; c < cols; c++ {
+			n.Points = append(n.Points, geo.Coordinate{
+				Lat: testLat + testSpacing*float64(r),
+				Lng: testLng + testSpacing*float64(c),
+			})
+			n.Cluster = append(n.Cluster, c/clusterCols)
+			if c > 0 {
+				n.Edges = append(n.Edges, testEdge{From: n.vertex(r, c-1), To: n.vertex(r, c)})
+			}
+			if r > 0 {
+				n.Edges = append(n.Edges, testEdge{From: n.vertex(r-1, c), To: n.vertex(r, c)})
+			}
+		}
+	}
+	return n
+}
+
+func (n *testNetwork) vertex(r, c int) graph.Vertex {
+	return graph.Vertex(r*n.cols + c)
+}
+
+// The index of the edge between u and v, or -1.
+func (n *testNetwork) edge(u, v graph.Vertex) int {
+	for i, e := range n.Edges {
+		if e.From == u && e.To == v || e.From == v && e.To == u {
+			return i
+		}
+	}
+	return -1
+}
+
+// Builds a graph with the given vertices and edges, all edges are accessible
+// for all transport modes and have the same maxspeed. The attributes of the
+// edges come from a template edge at vertex 0, which is removed again.
+func newTestGraph(points []geo.Coordinate, edges []testEdge) *graph.GraphFile {
+	all := []byte{1}
+	lat, lng := points[0].Encode()
+	base := &graph.GraphFile{
+		FirstOut:    []uint32{0, 1},
+		FirstIn:     []uint32{0},
+		NextIn:      []uint32{0},
+		Edges:       []uint32{0},
+		Coordinates: []int32{lat, lng},
+		Distances:   []uint16{0},
+		MaxSpeeds:   []uint16{testMaxSpeed},
+		Steps:       []uint32{0, 0},
+		Ferries:     []byte{0},
+	}
+	for t := range base.Access {
+		base.Access[t] = all
+		base.AccessEdge[t] = all
+		base.Oneway[t] = []byte{0}
+	}
+
+	x := graph.NewGraphExtension(base)
+	x.RemoveEdge(0)
+	for _, p := range points[1:] {
+		x.AddVertex(p, 1<<graph.TransportMax-1)
+	}
+	for _, e := range edges {
+		a, b := points[e.From], points[e.To]
+		steps := e.Steps
+		if steps == nil {
+			steps = []geo.Coordinate{{Lat: (a.Lat + b.Lat) / 2, Lng: (a.Lng + b.Lng) / 2}}
+		}
+		line := append(append([]geo.Coordinate{a}, steps...), b)
+		distance := 0.0
+		for i := 1; i < len(line); i++ {
+			distance += line[i-1].Distance(line[i])
+		}
+		edge := graph.ExtensionEdge{
+			From:     e.From,
+			To:       e.To,
+			Steps:    steps,
+			Distance: distance,
+			Access:   1<<graph.TransportMax - 1,
+		}
+		if e.Oneway {
+			edge.Oneway = 1<<graph.TransportMax - 1
+		}
+		x.AddEdge(edge)
+	}
+	return x.Build()
+}
+
+// The whole network as a single graph.
+func (n *testNetwork) Graph() *graph.GraphFile {
+	return newTestGraph(n.Points, n.Edges)
+}
+
+// The network as a cluster graph with its k-d trees, as created by the
+// preprocessing. The boundary vertices are the endpoints of the cut edges.
+func (n *testNetwork) ClusterGraph() (*graph.ClusterGraph, *kdtree.ClusterKdTree) {
+	clusterCount := 0
+	for _, c := range n.Cluster {
+		if c >= clusterCount {
+			clusterCount = c + 1
+		}
+	}
+	boundary := make([]bool, len(n.Points))
+	for _, e := range n.Edges {
+		if n.Cluster[e.From] != n.Cluster[e.To] {
+			boundary[e.From], boundary[e.To] = true, true
+		}
+	}
+
+	// Number the vertices of every cluster, the boundary vertices first.
+	local := make([]graph.Vertex, len(n.Points))
+	points := make([][]geo.Coordinate, clusterCount)
+	for _, first := range []bool{true, false} {
+		for v, c := range n.Cluster {
+			if boundary[v] == first {
+				local[v] = graph.Vertex(len(points[c]))
+				points[c] = append(points[c], n.Points[v])
+			}
+		}
+	}
+	partition := make([]uint32, clusterCount+1)
+	for v, c := range n.Cluster {
+		if boundary[v] {
+			partition[c+1]++
+		}
+	}
+	for c := 0; c < clusterCount; c++ {
+		partition[c+1] += partition[c]
+	}
+	overlayVertex := func(v graph.Vertex) graph.Vertex {
+		return graph.Vertex(partition[n.Cluster[v]]) + local[v]
+	}
+
+	edges := make([][]testEdge, clusterCount)
+	cuts := []testEdge(nil)
+	for _, e := range n.Edges {
+		c := n.Cluster[e.From]
+		if c == n.Cluster[e.To] {
+			edges[c] = append(edges[c], testEdge{From: local[e.From], To: local[e.To], Oneway: e.Oneway, Steps: e.Steps})
+		} else {
+			cuts = append(cuts, testEdge{From: overlayVertex(e.From), To: overlayVertex(e.To), Oneway: e.Oneway, Steps: e.Steps})
+		}
+	}
+	overlayPoints := make([]geo.Coordinate, partition[clusterCount])
+	for v := range n.Points {
+		if boundary[v] {
+			overlayPoints[overlayVertex(graph.Vertex(v))] = n.Points[v]
+		}
+	}
+
+	g := &graph.ClusterGraph{
+		Overlay: graph.NewOverlayGraph(newTestGraph(overlayPoints, cuts), partition),
+		Cluster: make([]*graph.GraphFile, clusterCount),
+	}
+	for c := range g.Cluster {
+		g.Cluster[c] = newTestGraph(points[c], edges[c])
+	}
+	computeTestMatrices(g)
+
+	trees := &kdtree.ClusterKdTree{
+		Overlay: kdtree.NewOverlayKdTree(g.Overlay),
+		Cluster: make([]*kdtree.KdTree, clusterCount),
+		BBoxes:  make([]geo.BBox, clusterCount),
+	}
+	for c, cluster := range g.Cluster {
+		tree, bbox := kdtree.NewKdTree(cluster)
+		bbox.Min.Lat -= testSpacing / 2
+		bbox.Min.Lng -= testSpacing / 2
+		bbox.Max.Lat += testSpacing / 2
+		bbox.Max.Lng += testSpacing / 2
+		trees.Cluster[c], trees.BBoxes[c] = tree, bbox
+	}
+	return g, trees
+}
+
+// The matrices of the overlay graph, as computed by the metric preprocessing.
+func computeTestMatrices(g *graph.ClusterGraph) {
+	overlay := g.Overlay
+	overlay.Matrices = make([][][]float32, graph.TransportMax)
+	for t := range overlay.Matrices {
+		overlay.Matrices[t] = make([][]float32, graph.MetricMax)
+		for m := range overlay.Matrices[t] {
+			matrix := []float32(nil)
+			router := &Router{Forward: true, Transport: graph.Transport(t), Metric: graph.Metric(m)}
+			for c, cluster := range g.Cluster {
+				size := overlay.ClusterSize(c)
+				for i := 0; i < size; i++ {
+					router.Reset(graph.NewTurnGraph(cluster))
+					router.AddSource(graph.Vertex(i), 0)
+					router.Run()
+					for j := 0; j < size; j++ {
+						matrix = append(matrix, router.Distance(graph.Vertex(j)))
+					}
+				}
+			}
+			overlay.Matrices[t][m] = matrix
+		}
+	}
+}
+
+// The distance between two vertices of the whole network.
+func (n *testNetwork) distance(u, v graph.Vertex, t graph.Transport, m graph.Metric) float32 {
+	router := &Router{Forward: true, Transport: t, Metric: m}
+	router.Reset(n.Graph())
+	router.AddSource(u, 0)
+	router.RunUntil([]graph.Vertex{v})
+	return router.Distance(v)
+}
@@ -0,0 +1,78 @@
+/*
+ * Copyright 2014 Florian Benz, Steven Schäfer, Bernhard Schommer
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Conversion of a Result into other output formats
+
+package route
+
+import (
+	"geo"
+	"geojson"
+)
+
+// Convert a Point back to a geo.Coordinate.
+func PointToStep(p Point) geo.Coordinate {
+	return geo.Coordinate{Lat: p[0], Lng: p[1]}
+}
+
+// The geometry of a whole leg, i.e., the concatenation of the polylines of
+// all steps without repeating the shared end points.
+func LegCoordinates(leg Leg) []geo.Coordinate {
+	coordinates := []geo.Coordinate(nil)
+	for _, step := range leg.Steps {
+		for _, p := range step.Polyline {
+			c := PointToStep(p)
+			if len(coordinates) > 0 && coordinates[len(coordinates)-1] == c {
+				continue
+			}
+			coordinates = append(coordinates, c)
+		}
+	}
+	if len(coordinates) == 0 {
+		coordinates = []geo.Coordinate{PointToStep(leg.StartLocation), PointToStep(leg.EndLocation)}
+	}
+	return coordinates
+}
+
+// GeoJSON returns a FeatureCollection with one LineString per leg. The steps
+// of the leg are included in the properties.
+func (r *Result) GeoJSON() *geojson.FeatureCollection {
+	collection := geojson.NewFeatureCollection()
+	for i, route := range r.Routes {
+		for j, leg := range route.Legs {
+			steps := make([]map[string]interface{}, len(leg.Steps))
+			for k, step := range leg.Steps {
+				steps[k] = map[string]interface{}{
+					"distance":       step.Distance.Value,
+					"duration":       step.Duration.Value,
+					"start_location": geojson.NewPosition(PointToStep(step.StartLocation)),
+					"end_location":   geojson.NewPosition(PointToStep(step.EndLocation)),
+					"instruction":    step.Instruction,
+				}
+			}
+
+			feature := geojson.NewFeature(geojson.NewLineString(LegCoordinates(leg)))
+			feature.Properties["route"] = i
+			feature.Properties["leg"] = j
+			feature.Properties["status"] = leg.Status
+			feature.Properties["distance"] = leg.Distance.Value
+			feature.Properties["duration"] = leg.Duration.Value
+			feature.Properties["steps"] = steps
+			collection.AddFeature(feature)
+		}
+	}
+	return collection
+}
@@ -0,0 +1,79 @@
+/*
+ * Copyright 2014 Florian Benz, Steven Schäfer, Bernhard Schommer
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package route
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestResultGeoJSON(t *testing.T) {
+	encoded, err := json.Marshal(testResult().GeoJSON())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var collection struct {
+		Type     string `json:"type"`
+		Features []struct {
+			Type     string `json:"type"`
+			Geometry struct {
+				Type        string      `json:"type"`
+				Coordinates [][]float64 `json:"coordinates"`
+			} `json:"geometry"`
+			Properties struct {
+				Route    int    `json:"route"`
+				Leg      int    `json:"leg"`
+				Status   string `json:"status"`
+				Distance int    `json:"distance"`
+				Steps    []struct {
+					Instruction   string    `json:"instruction"`
+					StartLocation []float64 `json:"start_location"`
+				} `json:"steps"`
+			} `json:"properties"`
+		} `json:"features"`
+	}
+	if err := json.Unmarshal(encoded, &collection); err != nil {
+		t.Fatal(err)
+	}
+	if collection.Type != "FeatureCollection" || len(collection.Features) != 2 {
+		t.Fatalf("got a %s with %d features, expected 2 legs", collection.Type, len(collection.Features))
+	}
+
+	distances := []int{146, 112}
+	for i, f := range collection.Features {
+		if f.Type != "Feature" || f.Geometry.Type != "LineString" {
+			t.Errorf("feature %d: got a %s with a %s", i, f.Type, f.Geometry.Type)
+		}
+		p := f.Properties
+		if p.Route != 0 || p.Leg != i || p.Status != StatusOk || p.Distance != distances[i] {
+			t.Errorf("feature %d: got properties %+v", i, p)
+		}
+		if len(f.Geometry.Coordinates) != 3 || len(p.Steps) != 2 {
+			t.Errorf("feature %d: got %d coordinates and %d steps, expected 3 and 2",
+				i, len(f.Geometry.Coordinates), len(p.Steps))
+		}
+	}
+
+	// Positions are longitude first.
+	second := collection.Features[1]
+	if c := second.Geometry.Coordinates[0]; c[0] != 7.002 || c[1] != 49.2 {
+		t.Errorf("second leg starts at %v, expected [7.002 49.2]", c)
+	}
+	if s := second.Properties.Steps[0]; s.Instruction != "Turn left" || s.StartLocation[0] != 7.002 {
+		t.Errorf("got first step %+v of the second leg", s)
+	}
+}
@@ -0,0 +1,118 @@
+/*
+ * Copyright 2014 Florian Benz, Steven Schäfer, Bernhard Schommer
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Representation of the route geometry in the JSON response
+
+package route
+
+import "geo"
+
+const (
+	// Geometry formats
+	GeometryCoordinates = "coordinates" // nested arrays, the default
+	GeometryPolyline    = "polyline"    // encoded polyline, 5 digits
+	GeometryPolyline6   = "polyline6"   // encoded polyline, 6 digits
+
+	// Route level geometry
+	OverviewFalse      = "false"
+	OverviewFull       = "full"
+	OverviewSimplified = "simplified"
+
+	// The simplified overview deviates at most the route length times this
+	// factor from the full geometry, but at least MinOverviewTolerance meter.
+	OverviewToleranceFactor = 1.0 / 2000.0
+	MinOverviewTolerance    = 1.0
+)
+
+type GeometryOptions struct {
+	Format   string
+	Overview string
+	// If false, the geometry of the individual steps is dropped.
+	Steps bool
+}
+
+func polylinePrecision(format string) int {
+	if format == GeometryPolyline6 {
+		return 6
+	}
+	return 5
+}
+
+func PolylineToSteps(polyline Polyline) []geo.Coordinate {
+	steps := make([]geo.Coordinate, len(polyline))
+	for i, p := range polyline {
+		steps[i] = PointToStep(p)
+	}
+	return steps
+}
+
+func CoordinatesToPolyline(cs []geo.Coordinate) Polyline {
+	polyline := make(Polyline, len(cs))
+	for i, c := range cs {
+		polyline[i] = StepToPoint(c)
+	}
+	return polyline
+}
+
+// ApplyGeometryOptions rewrites the geometry of all routes in the result
+// according to the given options.
+func (r *Result) ApplyGeometryOptions(options GeometryOptions) {
+	encoded := options.Format == GeometryPolyline || options.Format == GeometryPolyline6
+	precision := polylinePrecision(options.Format)
+
+	for i := range r.Routes {
+		route := &r.Routes[i]
+
+		if options.Overview == OverviewFull || options.Overview == OverviewSimplified {
+			overview := []geo.Coordinate(nil)
+			for _, leg := range route.Legs {
+				coordinates := LegCoordinates(leg)
+				if len(overview) > 0 && overview[len(overview)-1] == coordinates[0] {
+					coordinates = coordinates[1:]
+				}
+				overview = append(overview, coordinates...)
+			}
+			if options.Overview == OverviewSimplified {
+				tolerance := float64(route.Distance.Value) * OverviewToleranceFactor
+				if tolerance < MinOverviewTolerance {
+					tolerance = MinOverviewTolerance
+				}
+				overview = geo.SimplifyPolyline(overview, tolerance)
+			}
+			if encoded {
+				route.OverviewGeometry = geo.EncodePolyline(overview, precision)
+			} else {
+				route.OverviewPolyline = CoordinatesToPolyline(overview)
+			}
+		}
+
+		for j := range route.Legs {
+			leg := &route.Legs[j]
+			if encoded {
+				leg.Geometry = geo.EncodePolyline(LegCoordinates(*leg), precision)
+			}
+			for k := range leg.Steps {
+				step := &leg.Steps[k]
+				if options.Steps && encoded {
+					step.Geometry = geo.EncodePolyline(PolylineToSteps(step.Polyline), precision)
+				}
+				if !options.Steps || encoded {
+					step.Polyline = nil
+				}
+			}
+		}
+	}
+}
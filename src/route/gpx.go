@@ -0,0 +1,99 @@
+/*
+ * Copyright 2014 Florian Benz, Steven Schäfer, Bernhard Schommer
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// The structure of a GPX 1.1 document (http://www.topografix.com/GPX/1/1/)
+// for XML encoding. Every route is exported as a track with one segment per
+// leg, and as a GPX route whose points are the start points of the steps.
+
+package route
+
+import (
+	"encoding/xml"
+	"fmt"
+)
+
+const (
+	GPXNamespace = "http://www.topografix.com/GPX/1/1"
+	GPXCreator   = "osmrouting"
+)
+
+type GPX struct {
+	XMLName xml.Name   `xml:"gpx"`
+	Xmlns   string     `xml:"xmlns,attr"`
+	Version string     `xml:"version,attr"`
+	Creator string     `xml:"creator,attr"`
+	Routes  []GPXRoute `xml:"rte"`
+	Tracks  []GPXTrack `xml:"trk"`
+}
+
+type GPXRoute struct {
+	Name   string     `xml:"name"`
+	Points []GPXPoint `xml:"rtept"`
+}
+
+type GPXTrack struct {
+	Name     string            `xml:"name"`
+	Segments []GPXTrackSegment `xml:"trkseg"`
+}
+
+type GPXTrackSegment struct {
+	Points []GPXPoint `xml:"trkpt"`
+}
+
+type GPXPoint struct {
+	Lat         float64 `xml:"lat,attr"`
+	Lon         float64 `xml:"lon,attr"`
+	Name        string  `xml:"name,omitempty"`
+	Description string  `xml:"desc,omitempty"`
+}
+
+func (r *Result) GPX() *GPX {
+	gpx := &GPX{
+		Xmlns:   GPXNamespace,
+		Version: "1.1",
+		Creator: GPXCreator,
+	}
+	for i, route := range r.Routes {
+		name := fmt.Sprintf("Route %d", i+1)
+		rte := GPXRoute{Name: name}
+		trk := GPXTrack{Name: name}
+		for _, leg := range route.Legs {
+			for _, step := range leg.Steps {
+				rte.Points = append(rte.Points, GPXPoint{
+					Lat:         step.StartLocation[0],
+					Lon:         step.StartLocation[1],
+					Name:        step.Instruction,
+					Description: step.Distance.Text,
+				})
+			}
+			segment := GPXTrackSegment{}
+			for _, c := range LegCoordinates(leg) {
+				segment.Points = append(segment.Points, GPXPoint{Lat: c.Lat, Lon: c.Lng})
+			}
+			trk.Segments = append(trk.Segments, segment)
+		}
+		if len(route.Legs) > 0 {
+			rte.Points = append(rte.Points, GPXPoint{
+				Lat:  route.EndLocation[0],
+				Lon:  route.EndLocation[1],
+				Name: "Destination",
+			})
+		}
+		gpx.Routes = append(gpx.Routes, rte)
+		gpx.Tracks = append(gpx.Tracks, trk)
+	}
+	return gpx
+}
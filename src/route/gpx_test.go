@@ -0,0 +1,128 @@
+/*
+ * Copyright 2014 Florian Benz, Steven Schäfer, Bernhard Schommer
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package route
+
+import (
+	"encoding/xml"
+	"testing"
+)
+
+// A route with two legs of two steps each, from 49.2, 7.0 over 49.2, 7.002
+// to 49.201, 7.002.
+func testResult() *Result {
+	step := func(from, to Point, instruction string, distance int) Step {
+		return Step{
+			Distance:      FormatDistance(float64(distance)),
+			Duration:      FormatDuration(float64(distance)),
+			StartLocation: from,
+			EndLocation:   to,
+			Polyline:      Polyline{from, to},
+			Instruction:   instruction,
+		}
+	}
+	a, b, c := Point{49.2, 7.0}, Point{49.2, 7.001}, Point{49.2, 7.002}
+	d, e := Point{49.2005, 7.002}, Point{49.201, 7.002}
+	legs := []Leg{{
+		Status:        StatusOk,
+		Distance:      Distance{Value: 146},
+		Duration:      Duration{Value: 146},
+		StartLocation: a,
+		EndLocation:   c,
+		Steps:         []Step{step(a, b, "Head east", 73), step(b, c, "Continue", 73)},
+	}, {
+		Status:        StatusOk,
+		Distance:      Distance{Value: 112},
+		Duration:      Duration{Value: 112},
+		StartLocation: c,
+		EndLocation:   e,
+		Steps:         []Step{step(c, d, "Turn left", 56), step(d, e, "Continue", 56)},
+	}}
+	return &Result{
+		Routes: []Route{{
+			Distance:      Distance{Value: 258},
+			Duration:      Duration{Value: 258},
+			StartLocation: a,
+			EndLocation:   e,
+			Legs:          legs,
+		}},
+	}
+}
+
+func TestResultGPX(t *testing.T) {
+	encoded, err := xml.Marshal(testResult().GPX())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var gpx struct {
+		XMLName xml.Name
+		Version string `xml:"version,attr"`
+		Routes  []struct {
+			Points []struct {
+				Lat  float64 `xml:"lat,attr"`
+				Lon  float64 `xml:"lon,attr"`
+				Name string  `xml:"name"`
+			} `xml:"rtept"`
+		} `xml:"rte"`
+		Tracks []struct {
+			Segments []struct {
+				Points []struct {
+					Lat float64 `xml:"lat,attr"`
+					Lon float64 `xml:"lon,attr"`
+				} `xml:"trkpt"`
+			} `xml:"trkseg"`
+		} `xml:"trk"`
+	}
+	if err := xml.Unmarshal(encoded, &gpx); err != nil {
+		t.Fatal(err)
+	}
+	if gpx.XMLName.Space != GPXNamespace || gpx.XMLName.Local != "gpx" || gpx.Version != "1.1" {
+		t.Errorf("got root element %v, version %q", gpx.XMLName, gpx.Version)
+	}
+	if len(gpx.Routes) != 1 || len(gpx.Tracks) != 1 {
+		t.Fatalf("got %d routes and %d tracks, expected 1 each", len(gpx.Routes), len(gpx.Tracks))
+	}
+
+	// The start points of the steps and the destination
+	names := []string{"Head east", "Continue", "Turn left", "Continue", "Destination"}
+	points := gpx.Routes[0].Points
+	if len(points) != len(names) {
+		t.Fatalf("got %d route points, expected %d", len(points), len(names))
+	}
+	for i, p := range points {
+		if p.Name != names[i] {
+			t.Errorf("route point %d is %q, expected %q", i, p.Name, names[i])
+		}
+	}
+	if last := points[len(points)-1]; last.Lat != 49.201 || last.Lon != 7.002 {
+		t.Errorf("got destination %v, %v", last.Lat, last.Lon)
+	}
+
+	// One segment per leg, without repeating the shared end points of the
+	// steps.
+	segments := gpx.Tracks[0].Segments
+	if len(segments) != 2 {
+		t.Fatalf("got %d track segments, expected 2", len(segments))
+	}
+	for i, segment := range segments {
+		if len(segment.Points) != 3 {
+			t.Errorf("segment %d has %d points, expected 3", i, len(segment.Points))
+		}
+	}
+	if p := segments[1].Points[0]; p.Lat != 49.2 || p.Lon != 7.002 {
+		t.Errorf("second segment starts at %v, %v", p.Lat, p.Lon)
+	}
+}
@@ -0,0 +1,391 @@
+/*
+ * Copyright 2014 Florian Benz, Steven Schäfer, Bernhard Schommer
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Isochrones: everything reachable within a time or distance budget
+//
+// The search runs in two phases. First, a bounded Dijkstra on the overlay
+// graph plus the cluster containing the center computes the distances of
+// all boundary vertices within the largest budget. Every shortest path to
+// an interior vertex of another cluster enters this cluster for the last
+// time through one of its boundary vertices, so in the second phase we can
+// run a bounded Dijkstra on every cluster with a reached boundary vertex on
+// its own, seeded with the boundary distances from the first phase. Both
+// phases search on the states of the graphs, so that they respect the turn
+// restrictions, and only the settled vertices are visited afterwards.
+
+package route
+
+import (
+	"context"
+	"geo"
+	"graph"
+	"kdtree"
+	"math"
+)
+
+type Isochrone struct {
+	// Budget in meter or seconds, depending on the metric.
+	Budget int `json:"budget"`
+	// Closed outline of the reachable area, see geo.Outline.
+	Polygon Polyline `json:"polygon,omitempty"`
+	// Geometry of all (partially) reachable edges.
+	Edges []Polyline `json:"edges,omitempty"`
+}
+
+type IsochroneResult struct {
+	Center     Point       `json:"center"`
+	Isochrones []Isochrone `json:"isochrones"`
+}
+
+type IsochronePlanner struct {
+	// Underlying graph structure
+	Graph  *graph.ClusterGraph
+	KdTree *kdtree.ClusterKdTree
+	// User input
+	Center  geo.Coordinate
+	Budgets []int
+	// Graph setting
+	Transport graph.Transport
+	Metric    graph.Metric
+	// If Forward == false we compute the area from which the center can be
+	// reached within the budgets instead.
+	Forward bool
+	// Planner options
+	Polygons bool
+	Edges    bool
+	// Optional, the computation stops as soon as the context is done, see Err.
+	Context context.Context
+	// KdTree Output
+	Location kdtree.Location
+}
+
+// The outline of an isochrone uses cells of extent / outlineResolution, but
+// at least minOutlineCell meter.
+const (
+	outlineResolution = 64
+	minOutlineCell    = 25.0
+)
+
+// A vertex with its distance, in the order in which a search settled them.
+type settledVertex struct {
+	vertex   graph.Vertex
+	distance float32
+}
+
+// Reachable portion of a single edge. The fractions are measured from
+// both endpoints, so fromFraction + toFraction >= 1 means that the whole
+// edge is reachable.
+type edgeReach struct {
+	from         graph.Vertex
+	fromFraction float64
+	toFraction   float64
+}
+
+// Convert a budget in meter or seconds to a weight in the given metric.
+func MetricWeight(m graph.Metric, value int) float32 {
+	if m.Base() == graph.Time {
+		return float32(float64(value) / SecondsPerTimeUnit)
+	}
+	return float32(value)
+}
+
+// Err returns the error of the context if the computation was stopped, the
+// isochrones of Run are incomplete in this case.
+func (p *IsochronePlanner) Err() error {
+	return contextErr(p.Context)
+}
+
+func (p *IsochronePlanner) Run() *IsochroneResult {
+	p.Location = p.KdTree.NearestNeighbor(p.Center, p.Transport)
+	buf := []geo.Coordinate(nil)
+	ways := p.Location.Decode(p.Forward, p.Transport, &buf)
+
+	limits := make([]float32, len(p.Budgets))
+	maxLimit := float32(0)
+	for i, budget := range p.Budgets {
+		limits[i] = MetricWeight(p.Metric, budget)
+		if limits[i] > maxLimit {
+			maxLimit = limits[i]
+		}
+	}
+
+	// Collect the reachable parts of the network for every budget.
+	pieces := make([][][]geo.Coordinate, len(limits))
+	for i, limit := range limits {
+		pieces[i] = p.wayPieces(ways, limit)
+	}
+
+	// Phase 1: overlay graph and the cluster of the center.
+	g, indices := LocationUnionGraph(p.Graph, []kdtree.Location{p.Location})
+	overlay := p.Graph.Overlay
+	router := &Router{
+		Forward:   p.Forward,
+		Transport: p.Transport,
+		Metric:    p.Metric,
+		Record:    true,
+		Context:   p.Context,
+	}
+	router.Reset(graph.NewTurnGraph(g))
+	states := []graph.Vertex(nil)
+	for _, way := range ways {
+		states = g.WayStates(way, indices[0], p.Forward, p.Transport, states)
+		for _, v := range states {
+			(&router.Heap).Update(v, wayWeight(p.Location, way, p.Transport, p.Metric))
+		}
+	}
+	router.RunBounded(maxLimit)
+
+	// The overlay vertices have a single state, the union states of the
+	// cluster of the center are handled in the second phase.
+	settled := []settledVertex(nil)
+	clusters := []int(nil)
+	visited := make(map[int]bool)
+	if p.Location.Cluster != -1 {
+		clusters = append(clusters, p.Location.Cluster)
+		visited[p.Location.Cluster] = true
+	}
+	for _, s := range router.Order {
+		if int(s) >= overlay.VertexCount() {
+			continue
+		}
+		settled = append(settled, settledVertex{s, router.Dist[s]})
+		if c, _ := overlay.VertexCluster(s); !visited[c] {
+			clusters = append(clusters, c)
+			visited[c] = true
+		}
+	}
+	for i, limit := range limits {
+		reach := p.collectReach(overlay.GraphFile, settled, limit)
+		pieces[i] = appendReachPieces(pieces[i], overlay.GraphFile, reach)
+	}
+
+	// Phase 2: every cluster with a settled boundary vertex.
+	clusterRouter := &Router{
+		Forward:   p.Forward,
+		Transport: p.Transport,
+		Metric:    p.Metric,
+		Record:    true,
+		Context:   p.Context,
+	}
+	for _, c := range clusters {
+		cluster := p.Graph.Cluster[c]
+		isCenter := c == p.Location.Cluster
+		clusterRouter.Reset(graph.NewTurnGraph(cluster))
+		for i := 0; i < overlay.ClusterSize(c); i++ {
+			v := overlay.ClusterVertex(c, graph.Vertex(i))
+			if router.Processed(v) {
+				(&clusterRouter.Heap).Update(graph.Vertex(i), router.Distance(v))
+			}
+		}
+		if isCenter {
+			for _, way := range ways {
+				w := wayWeight(p.Location, way, p.Transport, p.Metric)
+				states = cluster.WayStates(way.Vertex, way.Edge, p.Forward, p.Transport, states)
+				for _, s := range states {
+					(&clusterRouter.Heap).Update(s, w)
+				}
+			}
+		}
+		clusterRouter.RunBounded(maxLimit)
+
+		// The distance of a vertex is the one of its first settled state.
+		settled = settled[:0]
+		seen := make(map[graph.Vertex]bool)
+		for _, s := range clusterRouter.Order {
+			v := cluster.StateVertex(s)
+			if !seen[v] {
+				settled = append(settled, settledVertex{v, clusterRouter.Dist[s]})
+				seen[v] = true
+			}
+		}
+		for i, limit := range limits {
+			reach := p.collectReach(cluster, settled, limit)
+			pieces[i] = appendReachPieces(pieces[i], cluster, reach)
+		}
+	}
+
+	// Format the results.
+	start := p.Center
+	if len(ways) > 0 {
+		start = ways[0].Target
+	}
+	result := &IsochroneResult{
+		Center:     StepToPoint(start),
+		Isochrones: make([]Isochrone, len(p.Budgets)),
+	}
+	for i, budget := range p.Budgets {
+		isochrone := Isochrone{Budget: budget}
+		if p.Polygons {
+			isochrone.Polygon = piecesToPolygon(pieces[i], start)
+		}
+		if p.Edges {
+			isochrone.Edges = make([]Polyline, len(pieces[i]))
+			for j, piece := range pieces[i] {
+				isochrone.Edges[j] = StepsToPolyline(piece[1:len(piece)-1], piece[0], piece[len(piece)-1])
+			}
+		}
+		result.Isochrones[i] = isochrone
+	}
+	return result
+}
+
+// The parts of the edge containing the center which are within the limit.
+func (p *IsochronePlanner) wayPieces(ways []graph.Way, limit float32) [][]geo.Coordinate {
+	pieces := [][]geo.Coordinate(nil)
+	for _, way := range ways {
+		weight := wayWeight(p.Location, way, p.Transport, p.Metric)
+		if weight == 0 {
+			continue
+		}
+		// Orient the way such that it starts at the center.
+		vertex := p.Location.Graph.VertexCoordinate(way.Vertex)
+		line := make([]geo.Coordinate, 0, len(way.Steps)+2)
+		if p.Forward {
+			line = append(line, way.Target)
+			line = append(line, way.Steps...)
+			line = append(line, vertex)
+		} else {
+			line = append(line, vertex)
+			line = append(line, way.Steps...)
+			line = append(line, way.Target)
+			reverseSteps(line)
+		}
+		fraction := float64(limit / weight)
+		if fraction >= 1 {
+			pieces = append(pieces, line)
+		} else {
+			pieces = append(pieces, cutSteps(line, fraction))
+		}
+	}
+	return pieces
+}
+
+// Compute the reachable fraction of every edge in g which is adjacent to a
+// settled vertex within the limit.
+func (p *IsochronePlanner) collectReach(g *graph.GraphFile, settled []settledVertex, limit float32) map[graph.Edge]*edgeReach {
+	reach := make(map[graph.Edge]*edgeReach)
+	edges := []graph.Edge(nil)
+	for _, s := range settled {
+		u, dist := s.vertex, s.distance
+		if dist > limit {
+			break
+		}
+		edges = searchEdges(g, u, p.Forward, p.Transport, p.Metric, edges)
+		for _, e := range edges {
+			weight := g.EdgeWeight32(e, p.Transport, p.Metric)
+			fraction := 1.0
+			if weight > 0 && limit-dist < weight {
+				fraction = float64((limit - dist) / weight)
+			}
+			r, ok := reach[e]
+			if !ok {
+				reach[e] = &edgeReach{from: u, fromFraction: fraction}
+			} else if r.from == u {
+				// Self loop or parallel entries, keep the larger fraction.
+				if fraction > r.fromFraction {
+					r.fromFraction = fraction
+				}
+			} else if fraction > r.toFraction {
+				r.toFraction = fraction
+			}
+		}
+	}
+	return reach
+}
+
+// Turn the reachable fractions into geometries.
+func appendReachPieces(pieces [][]geo.Coordinate, g *graph.GraphFile, reach map[graph.Edge]*edgeReach) [][]geo.Coordinate {
+	buf := []geo.Coordinate(nil)
+	for e, r := range reach {
+		to := g.EdgeOpposite(e, r.from)
+		buf = g.EdgeSteps(e, r.from, buf)
+		line := make([]geo.Coordinate, 0, len(buf)+2)
+		line = append(line, g.VertexCoordinate(r.from))
+		line = append(line, buf...)
+		line = append(line, g.VertexCoordinate(to))
+
+		if r.fromFraction+r.toFraction >= 1 {
+			pieces = append(pieces, line)
+			continue
+		}
+		if r.fromFraction > 0 {
+			pieces = append(pieces, cutSteps(line, r.fromFraction))
+		}
+		if r.toFraction > 0 {
+			reverseSteps(line)
+			pieces = append(pieces, cutSteps(line, r.toFraction))
+		}
+	}
+	return pieces
+}
+
+// Returns the initial part of line with the given fraction of its length.
+func cutSteps(line []geo.Coordinate, fraction float64) []geo.Coordinate {
+	total := 0.0
+	for i := 1; i < len(line); i++ {
+		total += line[i-1].Distance(line[i])
+	}
+	remaining := fraction * total
+	result := []geo.Coordinate{line[0]}
+	for i := 1; i < len(line); i++ {
+		d := line[i-1].Distance(line[i])
+		if d >= remaining {
+			if d > 0 {
+				t := remaining / d
+				a, b := line[i-1], line[i]
+				result = append(result, geo.Coordinate{
+					Lat: a.Lat + t*(b.Lat-a.Lat),
+					Lng: a.Lng + t*(b.Lng-a.Lng),
+				})
+			}
+			return result
+		}
+		remaining -= d
+		result = append(result, line[i])
+	}
+	return result
+}
+
+func reverseSteps(steps []geo.Coordinate) {
+	for i, j := 0, len(steps)-1; i < j; i, j = i+1, j-1 {
+		steps[i], steps[j] = steps[j], steps[i]
+	}
+}
+
+// The concave outline of all pieces as a closed polyline, start has to be
+// on the network.
+func piecesToPolygon(pieces [][]geo.Coordinate, start geo.Coordinate) Polyline {
+	box := geo.BBox{Min: start, Max: start}
+	for _, piece := range pieces {
+		for _, c := range piece {
+			box.Min.Lat, box.Min.Lng = math.Min(box.Min.Lat, c.Lat), math.Min(box.Min.Lng, c.Lng)
+			box.Max.Lat, box.Max.Lng = math.Max(box.Max.Lat, c.Lat), math.Max(box.Max.Lng, c.Lng)
+		}
+	}
+	width := box.Min.Distance(geo.Coordinate{Lat: box.Min.Lat, Lng: box.Max.Lng})
+	height := box.Min.Distance(geo.Coordinate{Lat: box.Max.Lat, Lng: box.Min.Lng})
+	cell := math.Max(math.Max(width, height)/outlineResolution, minOutlineCell)
+
+	outline := geo.Outline(pieces, start, cell)
+	polygon := make(Polyline, 0, len(outline)+1)
+	for _, c := range outline {
+		polygon = append(polygon, StepToPoint(c))
+	}
+	if len(outline) > 0 {
+		polygon = append(polygon, StepToPoint(outline[0]))
+	}
+	return polygon
+}
@@ -0,0 +1,80 @@
+/*
+ * Copyright 2014 Florian Benz, Steven Schäfer, Bernhard Schommer
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package route
+
+import (
+	"graph"
+	"testing"
+)
+
+// Even-odd rule with longitude as the x-axis.
+func polygonContains(polygon Polyline, lat, lng float64) bool {
+	inside := false
+	for i := 0; i+1 < len(polygon); i++ {
+		a, b := polygon[i], polygon[i+1]
+		if (a[0] > lat) != (b[0] > lat) && lng < a[1]+(lat-a[0])*(b[1]-a[1])/(b[0]-a[0]) {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+func TestIsochronePlanner(t *testing.T) {
+	// A U-shaped network: the first two rows are only connected to the
+	// others in the first and the last column, so the middle of the lower
+	// rows is close to the center, but far away in the network.
+	n := gridNetwork(5, 9, 3)
+	for c := 1; c < 8; c++ {
+		i := n.edge(n.vertex(1, c), n.vertex(2, c))
+		n.Edges = append(n.Edges[:i], n.Edges[i+1:]...)
+	}
+	g, trees := n.ClusterGraph()
+	center := n.vertex(1, 4)
+	planner := &IsochronePlanner{
+		Graph:     g,
+		KdTree:    trees,
+		Center:    n.Points[center],
+		Budgets:   []int{300, 560},
+		Transport: graph.Car,
+		Metric:    graph.Distance,
+		Forward:   true,
+		Polygons:  true,
+		Edges:     true,
+	}
+	result := planner.Run()
+
+	for i, budget := range planner.Budgets {
+		isochrone := result.Isochrones[i]
+		if len(isochrone.Edges) == 0 {
+			t.Errorf("budget %d: no edges", budget)
+		}
+		polygon := isochrone.Polygon
+		if len(polygon) < 4 || polygon[0][0] != polygon[len(polygon)-1][0] || polygon[0][1] != polygon[len(polygon)-1][1] {
+			t.Fatalf("budget %d: polygon %v is not closed", budget, polygon)
+		}
+		// The outline lies within a few cells of the reachable network.
+		for v, p := range n.Points {
+			d := n.distance(center, graph.Vertex(v), graph.Car, graph.Distance)
+			inside := polygonContains(polygon, p.Lat, p.Lng)
+			if d <= float32(budget) && !inside {
+				t.Errorf("budget %d: vertex %d at distance %v is outside", budget, v, d)
+			} else if d > float32(budget)+60 && inside {
+				t.Errorf("budget %d: vertex %d at distance %v is inside", budget, v, d)
+			}
+		}
+	}
+}
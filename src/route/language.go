@@ -0,0 +1,252 @@
+/*
+ * Copyright 2014 Florian Benz, Steven Schäfer, Bernhard Schommer
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Localised text output
+//
+// All human readable text (distances, durations and instructions) is
+// produced from a catalogue, which maps message ids to templates. A
+// template may contain placeholders of the form {name}, which are replaced
+// by the following values:
+//   {value}    a formatted number, using the decimal separator of the
+//              catalogue (distances and durations)
+//   {n}        an integer (ordinal numbers)
+//   {modifier} the translated direction of a turn, e.g. "slight left"
+//   {street}   the street name and reference, e.g. "Hauptstraße (B 51)"
+//   {exit}     the ordinal number of a roundabout exit, e.g. "2nd"
+// Placeholders which are not listed above are left unchanged. Messages
+// which are missing from a catalogue are taken from the English one, so a
+// new language can be added step by step.
+//
+// Messages ending in ".street" are used instead of the message without the
+// suffix if the street name is known. The ordinal messages are looked up
+// as "ordinal.<n>" first, then as "ordinal.<n mod 10>" (except for 11, 12
+// and 13) and finally as "ordinal".
+
+package route
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+type Catalogue map[string]string
+
+type Units int
+
+const (
+	UnitsMetric Units = iota
+	UnitsImperial
+)
+
+const (
+	DefaultLanguage = "en"
+
+	metersPerFoot = 0.3048
+	metersPerMile = 1609.344
+)
+
+// All available catalogues, by ISO 639-1 language code.
+var Catalogues = map[string]Catalogue{
+	"en": English,
+	"de": German,
+}
+
+type Locale struct {
+	// ISO 639-1 code of the catalogue
+	Language  string
+	Catalogue Catalogue
+	Units     Units
+}
+
+// The locale which is used if nothing else is requested.
+var DefaultLocale = &Locale{Language: DefaultLanguage, Catalogue: English, Units: UnitsMetric}
+
+// NewLocale returns the locale for a language code, which may contain a
+// region as in "de-AT".
+func NewLocale(language string, units Units) (*Locale, error) {
+	language = strings.ToLower(language)
+	if i := strings.IndexAny(language, "-_"); i != -1 {
+		language = language[:i]
+	}
+	catalogue, ok := Catalogues[language]
+	if !ok {
+		return nil, errors.New("unsupported language: " + language)
+	}
+	return &Locale{Language: language, Catalogue: catalogue, Units: units}, nil
+}
+
+// Returns the template for the message id.
+func (l *Locale) message(id string) string {
+	if message, ok := l.Catalogue[id]; ok {
+		return message
+	}
+	if message, ok := English[id]; ok {
+		return message
+	}
+	return id
+}
+
+// Returns the message with the placeholders replaced by the given
+// name/value pairs.
+func (l *Locale) format(id string, args ...string) string {
+	return strings.NewReplacer(args...).Replace(l.message(id))
+}
+
+func (l *Locale) number(format string, value float64) string {
+	text := fmt.Sprintf(format, value)
+	return strings.Replace(text, ".", l.message("decimal_separator"), 1)
+}
+
+func (l *Locale) quantity(id, format string, value float64) string {
+	return l.format(id, "{value}", l.number(format, value))
+}
+
+// Returns a human readable string for the given distance in meter.
+func (l *Locale) FormatDistance(distance float64) Distance {
+	text := ""
+	if l.Units == UnitsImperial {
+		switch {
+		case distance < 0.1*metersPerMile:
+			text = l.quantity("distance.feet", "%.0f", distance/metersPerFoot)
+		default:
+			text = l.quantity("distance.miles", "%.2f", distance/metersPerMile)
+		}
+	} else {
+		switch {
+		case distance < 0.5:
+			// Yes, this is a gag. Why do you even have to ask?
+			text = l.quantity("distance.millimeters", "%.2f", distance*1000.0)
+		case distance < 500.0:
+			text = l.quantity("distance.meters", "%.2f", distance)
+		default:
+			text = l.quantity("distance.kilometers", "%.2f", distance/1000.0)
+		}
+	}
+	return Distance{text, int(distance)}
+}
+
+// Returns a human readable formatting for the given time-span.
+func (l *Locale) FormatDuration(seconds float64) Duration {
+	text := ""
+	switch {
+	case seconds < 30.0:
+		text = l.quantity("duration.seconds", "%.2f", seconds)
+	case seconds < 1800.0:
+		text = l.quantity("duration.minutes", "%.2f", seconds/60.0)
+	default:
+		text = l.quantity("duration.hours", "%.2f", seconds/3600.0)
+	}
+	return Duration{text, int(seconds)}
+}
+
+// Returns the ordinal number n, e.g., "2nd" or "2.".
+func (l *Locale) Ordinal(n int) string {
+	ids := []string{fmt.Sprintf("ordinal.%d", n)}
+	if n%100 < 11 || n%100 > 13 {
+		ids = append(ids, fmt.Sprintf("ordinal.%d", n%10))
+	}
+	ids = append(ids, "ordinal")
+	number := fmt.Sprintf("%d", n)
+	for _, catalogue := range []Catalogue{l.Catalogue, English} {
+		for _, id := range ids {
+			if message, ok := catalogue[id]; ok {
+				return strings.Replace(message, "{n}", number, -1)
+			}
+		}
+	}
+	return number
+}
+
+// A human readable description of the maneuver, e.g.,
+// "Turn left onto Hauptstraße (B 51)".
+func (l *Locale) Instruction(m Maneuver, name, ref string) string {
+	id := ""
+	switch m.Type {
+	case ManeuverDepart:
+		id = "depart"
+	case ManeuverRoundabout:
+		id = "roundabout"
+		if m.Exit > 0 {
+			id = "roundabout.exit"
+		}
+	case ManeuverNewName, ManeuverContinue:
+		switch m.Modifier {
+		case ModifierStraight:
+			id = "continue"
+		case ModifierSlightLeft, ModifierSlightRight:
+			id = "keep"
+		default:
+			id = turnMessage(m.Modifier)
+		}
+	default:
+		id = turnMessage(m.Modifier)
+	}
+
+	// Keep left or right, there is no slight version of this.
+	modifier := m.Modifier
+	if id == "keep" && modifier == ModifierSlightLeft {
+		modifier = ModifierLeft
+	} else if id == "keep" {
+		modifier = ModifierRight
+	}
+
+	street := StreetName(name, ref)
+	if street != "" {
+		id += ".street"
+	}
+	return l.format(id,
+		"{modifier}", l.message("modifier."+modifier),
+		"{street}", street,
+		"{exit}", l.Ordinal(m.Exit))
+}
+
+func turnMessage(modifier string) string {
+	switch modifier {
+	case ModifierUturn:
+		return "uturn"
+	case ModifierStraight:
+		return "straight"
+	}
+	return "turn"
+}
+
+func (l *Locale) localizeStep(step *Step) {
+	length, seconds := step.length, step.seconds
+	if length == 0 && seconds == 0 {
+		length, seconds = float64(step.Distance.Value), float64(step.Duration.Value)
+	}
+	step.Distance = l.FormatDistance(length)
+	step.Duration = l.FormatDuration(seconds)
+	step.Instruction = l.Instruction(step.Maneuver, step.Name, step.Ref)
+}
+
+// Localize rewrites all texts of the result for the given locale.
+func (r *Result) Localize(l *Locale) {
+	for i := range r.Routes {
+		route := &r.Routes[i]
+		route.Distance = l.FormatDistance(float64(route.Distance.Value))
+		route.Duration = l.FormatDuration(float64(route.Duration.Value))
+		for j := range route.Legs {
+			leg := &route.Legs[j]
+			leg.Distance = l.FormatDistance(float64(leg.Distance.Value))
+			leg.Duration = l.FormatDuration(float64(leg.Duration.Value))
+			for k := range leg.Steps {
+				l.localizeStep(&leg.Steps[k])
+			}
+		}
+	}
+}
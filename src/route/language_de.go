@@ -0,0 +1,61 @@
+/*
+ * Copyright 2014 Florian Benz, Steven Schäfer, Bernhard Schommer
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// German messages, see language.go for the placeholder format.
+
+package route
+
+var German = Catalogue{
+	"decimal_separator": ",",
+
+	"distance.millimeters": "{value} mm",
+	"distance.meters":      "{value} m",
+	"distance.kilometers":  "{value} km",
+	"distance.feet":        "{value} ft",
+	"distance.miles":       "{value} mi",
+
+	"duration.seconds": "{value} Sek.",
+	"duration.minutes": "{value} Min.",
+	"duration.hours":   "{value} Std.",
+
+	"ordinal": "{n}.",
+
+	"modifier.uturn":        "wenden",
+	"modifier.sharp right":  "scharf rechts",
+	"modifier.right":        "rechts",
+	"modifier.slight right": "leicht rechts",
+	"modifier.straight":     "geradeaus",
+	"modifier.slight left":  "leicht links",
+	"modifier.left":         "links",
+	"modifier.sharp left":   "scharf links",
+
+	"depart":                 "Starten Sie Ihre Route",
+	"depart.street":          "Starten Sie Ihre Route auf {street}",
+	"turn":                   "Biegen Sie {modifier} ab",
+	"turn.street":            "Biegen Sie {modifier} ab auf {street}",
+	"uturn":                  "Wenden Sie",
+	"uturn.street":           "Wenden Sie auf {street}",
+	"straight":               "Fahren Sie geradeaus",
+	"straight.street":        "Fahren Sie geradeaus auf {street}",
+	"continue":               "Fahren Sie weiter",
+	"continue.street":        "Fahren Sie weiter auf {street}",
+	"keep":                   "Halten Sie sich {modifier}",
+	"keep.street":            "Halten Sie sich {modifier} auf {street}",
+	"roundabout":             "Fahren Sie in den Kreisverkehr",
+	"roundabout.street":      "Fahren Sie in den Kreisverkehr auf {street}",
+	"roundabout.exit":        "Nehmen Sie im Kreisverkehr die {exit} Ausfahrt",
+	"roundabout.exit.street": "Nehmen Sie im Kreisverkehr die {exit} Ausfahrt auf {street}",
+}
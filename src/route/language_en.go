@@ -0,0 +1,65 @@
+/*
+ * Copyright 2014 Florian Benz, Steven Schäfer, Bernhard Schommer
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// English messages, see language.go for the placeholder format. This
+// catalogue has to be complete, since it is the fallback for all others.
+
+package route
+
+var English = Catalogue{
+	"decimal_separator": ".",
+
+	"distance.millimeters": "{value} mm",
+	"distance.meters":      "{value} m",
+	"distance.kilometers":  "{value} km",
+	"distance.feet":        "{value} ft",
+	"distance.miles":       "{value} mi",
+
+	"duration.seconds": "{value} secs",
+	"duration.minutes": "{value} mins",
+	"duration.hours":   "{value} hours",
+
+	"ordinal.1": "{n}st",
+	"ordinal.2": "{n}nd",
+	"ordinal.3": "{n}rd",
+	"ordinal":   "{n}th",
+
+	"modifier.uturn":        "U-turn",
+	"modifier.sharp right":  "sharp right",
+	"modifier.right":        "right",
+	"modifier.slight right": "slight right",
+	"modifier.straight":     "straight",
+	"modifier.slight left":  "slight left",
+	"modifier.left":         "left",
+	"modifier.sharp left":   "sharp left",
+
+	"depart":                 "Start your journey",
+	"depart.street":          "Start your journey on {street}",
+	"turn":                   "Turn {modifier}",
+	"turn.street":            "Turn {modifier} onto {street}",
+	"uturn":                  "Make a U-turn",
+	"uturn.street":           "Make a U-turn onto {street}",
+	"straight":               "Go straight",
+	"straight.street":        "Go straight onto {street}",
+	"continue":               "Continue",
+	"continue.street":        "Continue onto {street}",
+	"keep":                   "Keep {modifier}",
+	"keep.street":            "Keep {modifier} onto {street}",
+	"roundabout":             "Enter the roundabout",
+	"roundabout.street":      "Enter the roundabout onto {street}",
+	"roundabout.exit":        "Enter the roundabout and take the {exit} exit",
+	"roundabout.exit.street": "Enter the roundabout and take the {exit} exit onto {street}",
+}
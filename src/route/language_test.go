@@ -0,0 +1,91 @@
+/*
+ * Copyright 2014 Florian Benz, Steven Schäfer, Bernhard Schommer
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package route
+
+import (
+	"testing"
+)
+
+func TestCatalogues(t *testing.T) {
+	// English is the fallback, so it has to contain every message.
+	for language, catalogue := range Catalogues {
+		for id := range catalogue {
+			if _, ok := English[id]; !ok {
+				t.Errorf("Message %q of language %q is missing in English", id, language)
+			}
+		}
+	}
+}
+
+func TestNewLocale(t *testing.T) {
+	l, err := NewLocale("de-AT", UnitsMetric)
+	if err != nil || l.Catalogue["depart"] != German["depart"] {
+		t.Errorf("Expected the German catalogue for de-AT")
+	}
+	if _, err := NewLocale("xx", UnitsMetric); err == nil {
+		t.Errorf("Expected an error for an unknown language")
+	}
+}
+
+func TestFormat(t *testing.T) {
+	german := &Locale{Catalogue: German, Units: UnitsMetric}
+	imperial := &Locale{Catalogue: English, Units: UnitsImperial}
+	cases := []struct {
+		text, expected string
+	}{
+		{german.FormatDistance(1234.5).Text, "1,23 km"},
+		{german.FormatDuration(600).Text, "10,00 Min."},
+		{imperial.FormatDistance(100).Text, "328 ft"},
+		{imperial.FormatDistance(3218.688).Text, "2.00 mi"},
+		{DefaultLocale.Ordinal(1), "1st"},
+		{DefaultLocale.Ordinal(12), "12th"},
+		{DefaultLocale.Ordinal(23), "23rd"},
+		{german.Ordinal(2), "2."},
+	}
+	for _, c := range cases {
+		if c.text != c.expected {
+			t.Errorf("Got %q, expected %q", c.text, c.expected)
+		}
+	}
+}
+
+func TestInstruction(t *testing.T) {
+	german := &Locale{Catalogue: German, Units: UnitsMetric}
+	cases := []struct {
+		l           *Locale
+		m           Maneuver
+		name, ref   string
+		instruction string
+	}{
+		{DefaultLocale, Maneuver{Type: ManeuverTurn, Modifier: ModifierLeft}, "Hauptstraße", "B 51",
+			"Turn left onto Hauptstraße (B 51)"},
+		{german, Maneuver{Type: ManeuverTurn, Modifier: ModifierLeft}, "Hauptstraße", "B 51",
+			"Biegen Sie links ab auf Hauptstraße (B 51)"},
+		{DefaultLocale, Maneuver{Type: ManeuverNewName, Modifier: ModifierSlightRight}, "", "",
+			"Keep right"},
+		{german, Maneuver{Type: ManeuverRoundabout, Modifier: ModifierRight, Exit: 2}, "", "A 1",
+			"Nehmen Sie im Kreisverkehr die 2. Ausfahrt auf A 1"},
+		{DefaultLocale, Maneuver{Type: ManeuverTurn, Modifier: ModifierUturn}, "", "",
+			"Make a U-turn"},
+	}
+	for _, c := range cases {
+		instruction := c.l.Instruction(c.m, c.name, c.ref)
+		if instruction != c.instruction {
+			t.Errorf("Got %q, expected %q", instruction, c.instruction)
+		}
+	}
+}
@@ -0,0 +1,271 @@
+/*
+ * Copyright 2014 Florian Benz, Steven Schäfer, Bernhard Schommer
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Maneuvers
+//
+// The path consists of one step per graph edge. We merge consecutive edges
+// into a single step as long as we stay on the same street and there is no
+// turn at a real junction. Every resulting step starts with a maneuver,
+// which is classified by the difference of the bearings before and after
+// the junction. Roundabouts (junction=roundabout) are merged into a single
+// step, together with the edge leaving the roundabout, and we count the
+// exits which are passed on the way.
+
+package route
+
+import (
+	"ellipsoid"
+	"graph"
+	"math"
+)
+
+const (
+	ManeuverDepart     = "depart"
+	ManeuverTurn       = "turn"
+	ManeuverContinue   = "continue"
+	ManeuverNewName    = "new name"
+	ManeuverRoundabout = "roundabout"
+)
+
+const (
+	ModifierUturn       = "uturn"
+	ModifierSharpRight  = "sharp right"
+	ModifierRight       = "right"
+	ModifierSlightRight = "slight right"
+	ModifierStraight    = "straight"
+	ModifierSlightLeft  = "slight left"
+	ModifierLeft        = "left"
+	ModifierSharpLeft   = "sharp left"
+)
+
+// Upper bounds (in degrees) of the absolute turn angle for each class of turns.
+const (
+	StraightAngle = 20
+	SlightAngle   = 60
+	TurnAngle     = 120
+	SharpAngle    = 170
+)
+
+type Maneuver struct {
+	Type     string `json:"type"`
+	Modifier string `json:"modifier,omitempty"`
+	// Bearings in degrees clockwise from north, in [0, 360).
+	BearingBefore int `json:"bearing_before"`
+	BearingAfter  int `json:"bearing_after"`
+	// Number of the roundabout exit to take.
+	Exit int `json:"exit,omitempty"`
+}
+
+var bearingEllipsoid = ellipsoid.Init("WGS84", ellipsoid.Degrees, ellipsoid.Meter,
+	ellipsoid.Longitude_is_symmetric, ellipsoid.Bearing_not_symmetric)
+
+// Returns the bearing from p to q in degrees, in [0, 360).
+func Bearing(p, q Point) float64 {
+	_, bearing := bearingEllipsoid.To(p[0], p[1], q[0], q[1])
+	bearing = math.Mod(bearing, 360)
+	if bearing < 0 {
+		bearing += 360
+	}
+	return bearing
+}
+
+// The bearing at the start of the polyline.
+func startBearing(polyline Polyline) float64 {
+	for i := 1; i < len(polyline); i++ {
+		if !samePoint(polyline[0], polyline[i]) {
+			return Bearing(polyline[0], polyline[i])
+		}
+	}
+	return 0
+}
+
+// The bearing at the end of the polyline.
+func endBearing(polyline Polyline) float64 {
+	last := len(polyline) - 1
+	for i := last - 1; i >= 0; i-- {
+		if !samePoint(polyline[i], polyline[last]) {
+			return Bearing(polyline[i], polyline[last])
+		}
+	}
+	return 0
+}
+
+func samePoint(p, q Point) bool {
+	return p[0] == q[0] && p[1] == q[1]
+}
+
+// The turn angle in degrees between two bearings, in (-180, 180].
+// Positive angles are right turns.
+func TurnAngleBetween(before, after float64) float64 {
+	angle := math.Mod(after-before+540, 360) - 180
+	if angle == -180 {
+		angle = 180
+	}
+	return angle
+}
+
+func TurnModifier(angle float64) string {
+	abs := math.Abs(angle)
+	switch {
+	case abs < StraightAngle:
+		return ModifierStraight
+	case abs >= SharpAngle:
+		return ModifierUturn
+	case angle > 0 && abs < SlightAngle:
+		return ModifierSlightRight
+	case angle > 0 && abs < TurnAngle:
+		return ModifierRight
+	case angle > 0:
+		return ModifierSharpRight
+	case abs < SlightAngle:
+		return ModifierSlightLeft
+	case abs < TurnAngle:
+		return ModifierLeft
+	}
+	return ModifierSharpLeft
+}
+
+func newManeuver(kind string, before, after float64) Maneuver {
+	return Maneuver{
+		Type:          kind,
+		Modifier:      TurnModifier(TurnAngleBetween(before, after)),
+		BearingBefore: int(before+0.5) % 360,
+		BearingAfter:  int(after+0.5) % 360,
+	}
+}
+
+// Count the edges at vertex u in the given cluster (-1 for the overlay
+// graph). Boundary vertices are part of both the overlay graph and a
+// cluster, so we have to look at both graphs. Returns the number of
+// accessible edges and the number of edges which can be used to leave
+// a roundabout at u.
+func (r *RoutePlanner) junction(cluster int, u graph.Vertex) (degree, exits int) {
+	overlay := r.Graph.Overlay
+	graphs := []*graph.GraphFile(nil)
+	vertices := []graph.Vertex(nil)
+	if cluster == -1 {
+		c, v := overlay.VertexCluster(u)
+		graphs = append(graphs, overlay.GraphFile, r.Graph.Cluster[c])
+		vertices = append(vertices, u, v)
+	} else {
+		graphs = append(graphs, r.Graph.Cluster[cluster])
+		vertices = append(vertices, u)
+		if int(u) < overlay.ClusterSize(cluster) {
+			graphs = append(graphs, overlay.GraphFile)
+			vertices = append(vertices, overlay.ClusterVertex(cluster, u))
+		}
+	}
+
+	buf := []graph.Edge(nil)
+	for i, g := range graphs {
+		edges := make(map[graph.Edge]bool)
+		buf = g.VertexEdges(vertices[i], true /* forward */, r.Transport, buf)
+		for _, e := range buf {
+			edges[e] = true
+			if !g.EdgeRoundabout(e) {
+				exits++
+			}
+		}
+		buf = g.VertexEdges(vertices[i], false /* forward */, r.Transport, buf)
+		for _, e := range buf {
+			edges[e] = true
+		}
+		degree += len(edges)
+	}
+	return degree, exits
+}
+
+// The maneuver at a junction where we do not just follow the street.
+func turnManeuver(sameStreet bool, before, after float64) Maneuver {
+	m := newManeuver(ManeuverTurn, before, after)
+	if sameStreet {
+		m.Type = ManeuverContinue
+	} else if m.Modifier == ModifierStraight {
+		m.Type = ManeuverNewName
+	}
+	return m
+}
+
+// Append step to last, which has to end where step starts.
+func mergeStep(last *Step, step Step) {
+	polyline := make(Polyline, 0, len(last.Polyline)+len(step.Polyline))
+	polyline = append(polyline, last.Polyline...)
+	if len(step.Polyline) > 0 {
+		polyline = append(polyline, step.Polyline[1:]...)
+	}
+	last.Polyline = polyline
+	last.EndLocation = step.EndLocation
+	last.length += step.length
+	last.seconds += step.seconds
+	last.Distance = FormatDistance(last.length)
+	last.Duration = FormatDuration(last.seconds)
+}
+
+// Merge the per edge steps into maneuvers and compute the instructions.
+func MergeSteps(steps []Step) []Step {
+	result := make([]Step, 0, len(steps))
+	inRoundabout := false
+	entry := 0.0 // bearing when entering the roundabout
+	for i, step := range steps {
+		after := startBearing(step.Polyline)
+		if i == 0 {
+			step.Maneuver = newManeuver(ManeuverDepart, after, after)
+			step.Maneuver.Modifier = ""
+			step.Maneuver.BearingBefore = 0
+			result = append(result, step)
+			continue
+		}
+
+		last := &result[len(result)-1]
+		before := endBearing(steps[i-1].Polyline)
+		modifier := TurnModifier(TurnAngleBetween(before, after))
+		sameStreet := step.Name == last.Name && step.Ref == last.Ref
+
+		switch {
+		case inRoundabout && step.roundabout:
+			// We pass an exit of the roundabout.
+			if step.exits > 0 {
+				last.Maneuver.Exit++
+			}
+			mergeStep(last, step)
+		case inRoundabout:
+			// Leave the roundabout, the direction is relative to the entry.
+			inRoundabout = false
+			last.Maneuver.Exit++
+			last.Maneuver.Modifier = TurnModifier(TurnAngleBetween(entry, after))
+			last.Name, last.Ref = step.Name, step.Ref
+			last.roundabout = false
+			mergeStep(last, step)
+		case step.roundabout && !last.roundabout:
+			inRoundabout = true
+			entry = before
+			step.Maneuver = newManeuver(ManeuverRoundabout, before, after)
+			result = append(result, step)
+		case sameStreet && (step.degree <= 2 || modifier == ModifierStraight ||
+			modifier == ModifierSlightLeft || modifier == ModifierSlightRight):
+			// Follow the street, there is no real choice here.
+			mergeStep(last, step)
+		default:
+			step.Maneuver = turnManeuver(sameStreet, before, after)
+			result = append(result, step)
+		}
+	}
+
+	for i := range result {
+		result[i].Instruction = DefaultLocale.Instruction(result[i].Maneuver, result[i].Name, result[i].Ref)
+	}
+	return result
+}
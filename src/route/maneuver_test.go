@@ -0,0 +1,124 @@
+/*
+ * Copyright 2014 Florian Benz, Steven Schäfer, Bernhard Schommer
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package route
+
+import (
+	"testing"
+)
+
+func TestTurnModifier(t *testing.T) {
+	cases := []struct {
+		before, after float64
+		modifier      string
+	}{
+		{0, 5, ModifierStraight},
+		{355, 10, ModifierStraight},
+		{0, 45, ModifierSlightRight},
+		{0, 90, ModifierRight},
+		{0, 150, ModifierSharpRight},
+		{0, 180, ModifierUturn},
+		{90, 60, ModifierSlightLeft},
+		{90, 0, ModifierLeft},
+		{10, 220, ModifierSharpLeft},
+	}
+	for _, c := range cases {
+		m := TurnModifier(TurnAngleBetween(c.before, c.after))
+		if m != c.modifier {
+			t.Errorf("%v -> %v: got %q, expected %q", c.before, c.after, m, c.modifier)
+		}
+	}
+}
+
+func TestBearing(t *testing.T) {
+	north := Bearing(Point{49.0, 7.0}, Point{49.1, 7.0})
+	east := Bearing(Point{49.0, 7.0}, Point{49.0, 7.1})
+	west := Bearing(Point{49.0, 7.0}, Point{49.0, 6.9})
+	if north > 1 && north < 359 {
+		t.Errorf("Bearing north is %v", north)
+	}
+	if east < 89 || east > 91 {
+		t.Errorf("Bearing east is %v", east)
+	}
+	if west < 269 || west > 271 {
+		t.Errorf("Bearing west is %v", west)
+	}
+}
+
+func testStep(name string, points ...Point) Step {
+	return Step{
+		Name:          name,
+		StartLocation: points[0],
+		EndLocation:   points[len(points)-1],
+		Polyline:      Polyline(points),
+		length:        100,
+		seconds:       10,
+		degree:        3,
+	}
+}
+
+func TestMergeSteps(t *testing.T) {
+	// North on A, straight on along A, then a right turn onto B.
+	steps := []Step{
+		testStep("A", Point{49.0, 7.0}, Point{49.001, 7.0}),
+		testStep("A", Point{49.001, 7.0}, Point{49.002, 7.0}),
+		testStep("B", Point{49.002, 7.0}, Point{49.002, 7.001}),
+	}
+	merged := MergeSteps(steps)
+	if len(merged) != 2 {
+		t.Fatalf("Expected 2 steps, got %v", len(merged))
+	}
+	if merged[0].Maneuver.Type != ManeuverDepart || len(merged[0].Polyline) != 3 {
+		t.Errorf("Unexpected first step: %v", merged[0])
+	}
+	if merged[0].Distance.Value != 200 || merged[0].Duration.Value != 20 {
+		t.Errorf("Wrong merged distance or duration: %v", merged[0])
+	}
+	m := merged[1].Maneuver
+	if m.Type != ManeuverTurn || m.Modifier != ModifierRight || m.BearingBefore != 0 || m.BearingAfter != 90 {
+		t.Errorf("Unexpected maneuver: %v", m)
+	}
+	if merged[1].Instruction != "Turn right onto B" {
+		t.Errorf("Unexpected instruction: %q", merged[1].Instruction)
+	}
+}
+
+func TestMergeRoundabout(t *testing.T) {
+	// Enter a roundabout heading north, pass two exits and leave it towards
+	// the east at the third exit.
+	steps := []Step{
+		testStep("A", Point{49.0, 7.0}, Point{49.001, 7.0}),
+		testStep("", Point{49.001, 7.0}, Point{49.0015, 6.9995}),
+		testStep("", Point{49.0015, 6.9995}, Point{49.002, 7.0}),
+		testStep("", Point{49.002, 7.0}, Point{49.0015, 7.0005}),
+		testStep("B", Point{49.0015, 7.0005}, Point{49.0015, 7.002}),
+	}
+	for i := 1; i <= 3; i++ {
+		steps[i].roundabout = true
+		steps[i].exits = 1
+	}
+	merged := MergeSteps(steps)
+	if len(merged) != 2 {
+		t.Fatalf("Expected 2 steps, got %v", len(merged))
+	}
+	m := merged[1].Maneuver
+	if m.Type != ManeuverRoundabout || m.Exit != 3 || m.Modifier != ModifierRight {
+		t.Errorf("Unexpected maneuver: %v", m)
+	}
+	if merged[1].Name != "B" || merged[1].Instruction != "Enter the roundabout and take the 3rd exit onto B" {
+		t.Errorf("Unexpected step: %v, %q", merged[1].Name, merged[1].Instruction)
+	}
+}
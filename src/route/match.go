@@ -0,0 +1,455 @@
+/*
+ * Copyright 2014 Florian Benz, Steven Schäfer, Bernhard Schommer
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Map matching of GPS traces
+//
+// We use the hidden Markov model of Newson and Krumm ("Hidden Markov Map
+// Matching Through Noise and Sparseness", 2009). The hidden states are the
+// candidate positions of a GPS point in the graph, which we take from the
+// k-d trees. The emission probability of a candidate decreases with its
+// distance to the GPS point (Gaussian), the transition probability between
+// two candidates decreases with the difference between their route distance
+// and the great circle distance of the GPS points (exponential). The most
+// likely sequence is found with the Viterbi algorithm and the confidence of
+// each matched point is its posterior probability (forward-backward).
+
+package route
+
+import (
+	"context"
+	"geo"
+	"graph"
+	"kdtree"
+	"math"
+)
+
+const (
+	// Number of candidates per GPS point
+	MatchCandidates = 5
+	// Candidates further away than this (in meter) are ignored, unless there
+	// is no other candidate.
+	MatchMaxDistance = 200.0
+	// Standard deviation of the GPS noise in meter
+	MatchSigma = 10.0
+	// Scale of the exponential distribution of the transition probabilities
+	MatchBeta = 10.0
+	// Transitions which need a higher speed (in m/s) than this are impossible.
+	MatchMaxSpeed = 70.0
+	// Transitions whose route is longer than the great circle distance plus
+	// this (in meter) are impossible, which bounds the searches.
+	MatchMaxDetour = 2000.0
+	// Number of concurrent workers computing transition probabilities
+	MatchWorkers = 8
+)
+
+type Tracepoint struct {
+	// Matched position in the graph, nil if the point could not be matched.
+	Location Point `json:"location"`
+	// Distance in meter between the GPS point and the matched position
+	Distance float64 `json:"distance"`
+	// Posterior probability of the matched position
+	Confidence float64 `json:"confidence"`
+}
+
+type MatchResult struct {
+	*Result
+	Tracepoints []Tracepoint `json:"tracepoints"`
+}
+
+type MatchPlanner struct {
+	// Underlying graph structure
+	Graph  *graph.ClusterGraph
+	KdTree *kdtree.ClusterKdTree
+	// User input
+	Points []geo.Coordinate
+	// Optional time stamps in seconds, one per point
+	Timestamps []int64
+	// Graph setting
+	Transport graph.Transport
+	// Planner options
+	ConcurrentKd          bool
+	ConcurrentTransitions bool
+	// Optional, the computation stops as soon as the context is done, see Err.
+	Context context.Context
+	// KdTree Output
+	Candidates [][]kdtree.Neighbor
+}
+
+// Err returns the error of the context if the computation was stopped, the
+// result of Run is incomplete in this case.
+func (p *MatchPlanner) Err() error {
+	return contextErr(p.Context)
+}
+
+func (p *MatchPlanner) Run() *MatchResult {
+	// Compute the candidates for every point.
+	candidates := make([][]kdtree.Neighbor, len(p.Points))
+	Multiplex(len(p.Points), p.ConcurrentKd, func(i int) {
+		candidates[i] = p.candidates(p.Points[i])
+	})
+
+	// Points without any candidate are not part of the model.
+	steps := []int(nil)
+	for i, c := range candidates {
+		if len(c) > 0 {
+			p.Candidates = append(p.Candidates, c)
+			steps = append(steps, i)
+		}
+	}
+
+	result := &MatchResult{
+		Result:      &Result{Routes: []Route(nil)},
+		Tracepoints: make([]Tracepoint, len(p.Points)),
+	}
+	if len(steps) == 0 {
+		return result
+	}
+
+	emissions := make([][]float64, len(steps))
+	for t, c := range p.Candidates {
+		emissions[t] = make([]float64, len(c))
+		for i, n := range c {
+			emissions[t][i] = -0.5 * (n.Distance / MatchSigma) * (n.Distance / MatchSigma)
+		}
+	}
+	transitions := p.transitions(steps)
+	if p.Err() != nil {
+		return result
+	}
+
+	states := viterbi(emissions, transitions)
+	confidence := posterior(emissions, transitions)
+
+	// Route along the matched positions.
+	locations := []kdtree.Location(nil)
+	waypoints := []geo.Coordinate(nil)
+	for t, i := range states {
+		n := p.Candidates[t][i]
+		result.Tracepoints[steps[t]] = Tracepoint{
+			Location:   StepToPoint(n.Coordinate),
+			Distance:   n.Distance,
+			Confidence: confidence[t][i],
+		}
+		if len(locations) > 0 {
+			last := locations[len(locations)-1]
+			if last.Graph == n.Location.Graph && last.EC == n.Location.EC {
+				continue
+			}
+		}
+		locations = append(locations, n.Location)
+		waypoints = append(waypoints, n.Coordinate)
+	}
+
+	if len(locations) > 1 {
+		planner := &RoutePlanner{
+			Graph:          p.Graph,
+			KdTree:         p.KdTree,
+			Waypoints:      waypoints,
+			Transport:      p.Transport,
+			Metric:         graph.Distance,
+			ConcurrentLegs: true,
+			Context:        p.Context,
+			Locations:      locations,
+		}
+		result.Result = planner.Run()
+	}
+	return result
+}
+
+// The candidates for one GPS point.
+func (p *MatchPlanner) candidates(x geo.Coordinate) []kdtree.Neighbor {
+	neighbors := p.KdTree.KNearestNeighbors(x, p.Transport, MatchCandidates)
+	result := []kdtree.Neighbor(nil)
+	for _, n := range neighbors {
+		if n.Distance <= MatchMaxDistance {
+			result = append(result, n)
+		}
+	}
+	if len(result) == 0 && len(neighbors) > 0 {
+		result = neighbors[:1]
+	}
+	return result
+}
+
+// Compute the log transition probabilities between the candidates of all
+// consecutive steps, indexed by [step][from][to].
+func (p *MatchPlanner) transitions(steps []int) [][][]float64 {
+	transitions := make([][][]float64, len(steps)-1)
+	workers := MatchWorkers
+	if len(transitions) < workers {
+		workers = len(transitions)
+	}
+	Multiplex(workers, p.ConcurrentTransitions, func(worker int) {
+		router := &Router{
+			Forward:   true,
+			Transport: p.Transport,
+			Metric:    graph.Distance,
+			Context:   p.Context,
+		}
+		for t := worker; t < len(transitions); t += workers {
+			transitions[t] = p.stepTransitions(router, steps[t], steps[t+1], t)
+		}
+	})
+	return transitions
+}
+
+func (p *MatchPlanner) stepTransitions(router *Router, a, b, t int) [][]float64 {
+	from, to := p.Candidates[t], p.Candidates[t+1]
+	greatCircle := greatCircleDistance(p.Points[a], p.Points[b])
+	maxDistance := greatCircle + MatchMaxDetour
+	if len(p.Timestamps) == len(p.Points) && p.Timestamps[b] > p.Timestamps[a] {
+		maxDistance = math.Min(maxDistance, MatchMaxSpeed*float64(p.Timestamps[b]-p.Timestamps[a]))
+	}
+
+	// A single union graph for all candidates of both steps.
+	locations := make([]kdtree.Location, 0, len(from)+len(to))
+	for _, n := range from {
+		locations = append(locations, n.Location)
+	}
+	for _, n := range to {
+		locations = append(locations, n.Location)
+	}
+	g, indices := LocationUnionGraph(p.Graph, locations)
+
+	result := make([][]float64, len(from))
+	feasible := false
+	for i, src := range from {
+		distances := p.routeDistances(router, g, src, indices[i], to, indices[len(from):], float32(maxDistance))
+		result[i] = make([]float64, len(to))
+		for j, dist := range distances {
+			if math.IsInf(dist, 1) || dist > maxDistance {
+				result[i][j] = math.Inf(-1)
+				continue
+			}
+			result[i][j] = -math.Abs(dist-greatCircle) / MatchBeta
+			feasible = true
+		}
+	}
+
+	if !feasible {
+		// The trace is broken at this point, e.g., due to a missing road in
+		// the data. Start over with uniform transitions.
+		for i := range result {
+			for j := range result[i] {
+				result[i][j] = 0
+			}
+		}
+	}
+	return result
+}
+
+// The lengths of the shortest paths in meter from the candidate src to all
+// candidates in dst, or +Inf if they are further away than the limit. We
+// run a single search from src, which stops once all candidates are
+// reached.
+// The indices are the union graph indices of the candidates.
+func (p *MatchPlanner) routeDistances(router *Router, g *graph.UnionGraph, src kdtree.Neighbor, srcIndex int, dst []kdtree.Neighbor, dstIndices []int, limit float32) []float64 {
+	buf := []geo.Coordinate(nil)
+	router.Reset(graph.NewTurnGraph(g))
+	states := []graph.Vertex(nil)
+	for _, way := range src.Location.Decode(true /* forward */, p.Transport, &buf) {
+		states = g.WayStates(way, srcIndex, true /* forward */, p.Transport, states)
+		for _, v := range states {
+			(&router.Heap).Update(v, float32(way.Length))
+		}
+	}
+
+	dstWays := make([][]graph.Way, len(dst))
+	targets := []graph.Vertex(nil)
+	for j, n := range dst {
+		dstWays[j] = n.Location.Decode(false /* forward */, p.Transport, &buf)
+		for _, way := range dstWays[j] {
+			states = g.WayStates(way, dstIndices[j], false /* forward */, p.Transport, states)
+			targets = append(targets, states...)
+		}
+	}
+	router.RunUntilBounded(targets, limit)
+
+	result := make([]float64, len(dst))
+	for j, n := range dst {
+		result[j] = p.edgeDistance(src, n)
+		for _, way := range dstWays[j] {
+			states = g.WayStates(way, dstIndices[j], false /* forward */, p.Transport, states)
+			for _, v := range states {
+				if router.Processed(v) {
+					result[j] = math.Min(result[j], float64(router.Distance(v))+way.Length)
+				}
+			}
+		}
+	}
+	return result
+}
+
+// The distance in meter from src to dst along their edge, if both are on
+// the same edge and dst can be reached without leaving it, or +Inf.
+func (p *MatchPlanner) edgeDistance(src, dst kdtree.Neighbor) float64 {
+	a, b := src.Location, dst.Location
+	if a.Graph != b.Graph || a.Edge() == -1 || a.Edge() != b.Edge() {
+		return math.Inf(1)
+	}
+	da, db := edgePosition(a, p.Transport), edgePosition(b, p.Transport)
+	if db >= da {
+		// In the direction of the edge, which is always open.
+		return db - da
+	}
+	if !a.Graph.EdgeOneway(a.Edge(), p.Transport) {
+		return da - db
+	}
+	return math.Inf(1)
+}
+
+// The distance in meter from the start vertex of the edge of l to l.
+func edgePosition(l kdtree.Location, t graph.Transport) float64 {
+	buf := []geo.Coordinate(nil)
+	for _, way := range l.Decode(false /* forward */, t, &buf) {
+		if way.Vertex == l.Vertex() {
+			return way.Length
+		}
+	}
+	return 0
+}
+
+func greatCircleDistance(a, b geo.Coordinate) float64 {
+	return geo.StepLength([]geo.Coordinate{a, b})
+}
+
+// Returns the most likely state for every step.
+func viterbi(emissions [][]float64, transitions [][][]float64) []int {
+	score := emissions[0]
+	parents := make([][]int, len(emissions))
+	for t := 1; t < len(emissions); t++ {
+		next := make([]float64, len(emissions[t]))
+		parents[t] = make([]int, len(emissions[t]))
+		for j := range next {
+			next[j] = math.Inf(-1)
+			for i, s := range score {
+				if v := s + transitions[t-1][i][j]; v > next[j] {
+					next[j] = v
+					parents[t][j] = i
+				}
+			}
+			next[j] += emissions[t][j]
+		}
+		if allInf(next) {
+			// No feasible chain reaches this step, although every step has
+			// some feasible transition. Start over as in stepTransitions and
+			// continue from the best state of the previous step.
+			best := argmax(score)
+			for j := range next {
+				next[j] = emissions[t][j]
+				parents[t][j] = best
+			}
+		}
+		score = next
+	}
+
+	states := make([]int, len(emissions))
+	states[len(states)-1] = argmax(score)
+	for t := len(emissions) - 1; t > 0; t-- {
+		states[t-1] = parents[t][states[t]]
+	}
+	return states
+}
+
+// Returns the posterior probability of every state.
+func posterior(emissions [][]float64, transitions [][][]float64) [][]float64 {
+	n := len(emissions)
+	alpha := make([][]float64, n)
+	beta := make([][]float64, n)
+	// The forward pass starts over where no feasible chain reaches a step,
+	// as in viterbi. The trace then consists of independent segments.
+	restart := make([]bool, n)
+	alpha[0] = emissions[0]
+	for t := 1; t < n; t++ {
+		alpha[t] = make([]float64, len(emissions[t]))
+		terms := make([]float64, len(alpha[t-1]))
+		for j := range alpha[t] {
+			for i, a := range alpha[t-1] {
+				terms[i] = a + transitions[t-1][i][j]
+			}
+			alpha[t][j] = logSumExp(terms) + emissions[t][j]
+		}
+		if allInf(alpha[t]) {
+			restart[t] = true
+			copy(alpha[t], emissions[t])
+		}
+	}
+	beta[n-1] = make([]float64, len(emissions[n-1]))
+	for t := n - 2; t >= 0; t-- {
+		beta[t] = make([]float64, len(emissions[t]))
+		if restart[t+1] {
+			// Last step of a segment
+			continue
+		}
+		terms := make([]float64, len(emissions[t+1]))
+		for i := range beta[t] {
+			for j, b := range beta[t+1] {
+				terms[j] = transitions[t][i][j] + emissions[t+1][j] + b
+			}
+			beta[t][i] = logSumExp(terms)
+		}
+	}
+
+	// The total probability of the segment of step t.
+	total := logSumExp(alpha[n-1])
+	result := make([][]float64, n)
+	for t := n - 1; t >= 0; t-- {
+		result[t] = make([]float64, len(emissions[t]))
+		for i := range result[t] {
+			result[t][i] = math.Exp(alpha[t][i] + beta[t][i] - total)
+		}
+		if restart[t] {
+			total = logSumExp(alpha[t-1])
+		}
+	}
+	return result
+}
+
+func allInf(xs []float64) bool {
+	for _, x := range xs {
+		if !math.IsInf(x, -1) {
+			return false
+		}
+	}
+	return true
+}
+
+func argmax(xs []float64) int {
+	max := 0
+	for i, x := range xs {
+		if x > xs[max] {
+			max = i
+		}
+	}
+	return max
+}
+
+func logSumExp(xs []float64) float64 {
+	max := math.Inf(-1)
+	for _, x := range xs {
+		if x > max {
+			max = x
+		}
+	}
+	if math.IsInf(max, -1) {
+		return max
+	}
+	sum := 0.0
+	for _, x := range xs {
+		sum += math.Exp(x - max)
+	}
+	return max + math.Log(sum)
+}
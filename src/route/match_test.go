@@ -0,0 +1,180 @@
+/*
+ * Copyright 2014 Florian Benz, Steven Schäfer, Bernhard Schommer
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package route
+
+import (
+	"geo"
+	"graph"
+	"kdtree"
+	"math"
+	"testing"
+)
+
+// Two candidates per step. The emissions prefer candidate 0 in the middle
+// step, but the transitions make candidate 1 the only consistent choice.
+func TestViterbiPosterior(t *testing.T) {
+	inf := math.Inf(-1)
+	emissions := [][]float64{
+		{-1, -1},
+		{-0.5, -2},
+		{-1, -1},
+	}
+	transitions := [][][]float64{
+		{{inf, 0}, {inf, 0}},
+		{{inf, inf}, {0, inf}},
+	}
+
+	states := viterbi(emissions, transitions)
+	expected := []int{0, 1, 0}
+	for i := range states {
+		if states[i] != expected[i] {
+			t.Fatalf("Expected states %v, got %v.", expected, states)
+		}
+	}
+
+	confidence := posterior(emissions, transitions)
+	for i, s := range states {
+		if math.Abs(confidence[i][s]-1) > 1e-9 && i != 0 {
+			t.Errorf("Expected confidence 1 at step %v, got %v.", i, confidence[i][s])
+		}
+		sum := 0.0
+		for _, c := range confidence[i] {
+			sum += c
+		}
+		if math.Abs(sum-1) > 1e-9 {
+			t.Errorf("Posterior at step %v does not sum to 1: %v.", i, sum)
+		}
+	}
+	if math.Abs(confidence[0][0]-0.5) > 1e-9 {
+		t.Errorf("Expected confidence 0.5 at step 0, got %v.", confidence[0][0])
+	}
+}
+
+// Every step has a feasible transition, but no chain runs through all
+// steps. The model starts over at the last step instead of failing.
+func TestViterbiPosteriorRestart(t *testing.T) {
+	inf := math.Inf(-1)
+	emissions := [][]float64{
+		{-1, -2},
+		{-1, -1},
+		{-2, -1},
+	}
+	transitions := [][][]float64{
+		{{0, inf}, {inf, inf}},
+		{{inf, inf}, {inf, 0}},
+	}
+
+	states := viterbi(emissions, transitions)
+	expected := []int{0, 0, 1}
+	for i := range states {
+		if states[i] != expected[i] {
+			t.Fatalf("Expected states %v, got %v.", expected, states)
+		}
+	}
+
+	confidence := posterior(emissions, transitions)
+	for i := range confidence {
+		sum := 0.0
+		for _, c := range confidence[i] {
+			if math.IsNaN(c) {
+				t.Fatalf("Posterior at step %v is NaN.", i)
+			}
+			sum += c
+		}
+		if math.Abs(sum-1) > 1e-9 {
+			t.Errorf("Posterior at step %v does not sum to 1: %v.", i, sum)
+		}
+	}
+	if math.Abs(confidence[1][0]-1) > 1e-9 {
+		t.Errorf("Expected confidence 1 at step 1, got %v.", confidence[1][0])
+	}
+	last := math.Exp(-1) / (math.Exp(-1) + math.Exp(-2))
+	if math.Abs(confidence[2][1]-last) > 1e-9 {
+		t.Errorf("Expected confidence %v at step 2, got %v.", last, confidence[2][1])
+	}
+}
+
+// Two candidates on an edge with several steps.
+func TestMatchEdgeDistance(t *testing.T) {
+	for _, oneway := range []bool{false, true} {
+		n := gridNetwork(1, 4, 2)
+		a, b := n.Points[n.vertex(0, 0)], n.Points[n.vertex(0, 1)]
+		steps := []geo.Coordinate(nil)
+		for _, f := range []float64{0.25, 0.5, 0.75} {
+			steps = append(steps, geo.Coordinate{Lat: a.Lat, Lng: a.Lng + f*(b.Lng-a.Lng)})
+		}
+		n.Edges[n.edge(n.vertex(0, 0), n.vertex(0, 1))] = testEdge{
+			From: n.vertex(0, 0), To: n.vertex(0, 1), Oneway: oneway, Steps: steps,
+		}
+		g, trees := n.ClusterGraph()
+		p := &MatchPlanner{Graph: g, KdTree: trees, Transport: graph.Car}
+
+		first := trees.KNearestNeighbors(steps[0], graph.Car, 1)[0]
+		last := trees.KNearestNeighbors(steps[2], graph.Car, 1)[0]
+		if first.Location.Edge() == -1 || first.Location.Edge() != last.Location.Edge() {
+			t.Fatalf("oneway %v: expected two locations on the same edge", oneway)
+		}
+		expected := greatCircleDistance(steps[0], steps[2])
+		if d := p.edgeDistance(first, last); math.Abs(d-expected) > 1e-3 {
+			t.Errorf("oneway %v: got forward distance %v, expected %v", oneway, d, expected)
+		}
+		if d := p.edgeDistance(last, first); oneway && !math.IsInf(d, 1) {
+			t.Errorf("got distance %v against the oneway", d)
+		} else if !oneway && math.Abs(d-expected) > 1e-3 {
+			t.Errorf("got backward distance %v, expected %v", d, expected)
+		}
+		if d := p.edgeDistance(first, kdtree.Neighbor{Location: kdtree.Location{Graph: g.Overlay.GraphFile}}); !math.IsInf(d, 1) {
+			t.Errorf("got distance %v to another graph", d)
+		}
+	}
+}
+
+// A noisy trace along the middle row of a grid.
+func TestMatchPlanner(t *testing.T) {
+	n := gridNetwork(3, 9, 3)
+	g, trees := n.ClusterGraph()
+	points := []geo.Coordinate(nil)
+	for c := 0.0; c <= 8; c += 0.5 {
+		points = append(points, geo.Coordinate{
+			Lat: testLat + testSpacing + 0.00005*math.Cos(3*c),
+			Lng: testLng + testSpacing*c,
+		})
+	}
+	planner := &MatchPlanner{
+		Graph:     g,
+		KdTree:    trees,
+		Points:    points,
+		Transport: graph.Car,
+	}
+	result := planner.Run()
+
+	for i, p := range result.Tracepoints {
+		if p.Location == nil || math.Abs(p.Location[0]-(testLat+testSpacing)) > 1e-9 || p.Distance > 6 {
+			t.Errorf("point %d matched to %v at a distance of %v", i, p.Location, p.Distance)
+		}
+	}
+	if len(result.Routes) != 1 {
+		t.Fatalf("expected a single route, got %v", result.Routes)
+	}
+	// The lengths of the steps of a route are great circle distances, and
+	// the distance of every leg is rounded down.
+	expected := greatCircleDistance(n.Points[n.vertex(1, 0)], n.Points[n.vertex(1, 8)])
+	legs := float64(len(result.Routes[0].Legs))
+	if d := float64(result.Routes[0].Distance.Value) - expected; d < -legs || d > 1 {
+		t.Errorf("got a route of %v m, expected %v m", result.Routes[0].Distance.Value, expected)
+	}
+}
@@ -17,67 +17,203 @@
 package route
 
 import (
+	"context"
 	"geo"
 	"graph"
 	"kdtree"
 	"log"
 	"math"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// Maximum number of goroutines started by all calls of Multiplex together
+var MaxParallelism = runtime.NumCPU()
+
+// A leg with a departure time has a route only if it is at most
+// TimedMaxStretch times as long as the leg without the conditions.
+const TimedMaxStretch = 3
+
 type RoutePlanner struct {
 	// Underlying graph structure
-	Graph *graph.ClusterGraph
+	Graph  *graph.ClusterGraph
+	KdTree *kdtree.ClusterKdTree
 	// User input
 	Waypoints []geo.Coordinate
+	// Optional constraints, one per waypoint
+	Options []WaypointOptions
 	// Graph setting
 	Transport    graph.Transport
 	Metric       graph.Metric
 	AvoidFerries bool
+	// Number of alternative routes in addition to the shortest one. Only
+	// used for routes between two waypoints without a departure time, the
+	// server rejects other requests for alternatives.
+	Alternatives int
+	// Optional, the route respects the conditional restrictions (see
+	// graph/conditions.go) at the time at which it reaches an edge if it
+	// starts at the departure. The legs are computed one after another.
+	Departure time.Time
 	// Planner options
 	ConcurrentKd    bool
 	ConcurrentLegs  bool
 	ConcurrentPaths bool
+	// Optional, the computation stops as soon as the context is done, e.g.,
+	// because of a deadline or because the client is gone. See Err.
+	Context context.Context
 	// KdTree Output
 	Locations []kdtree.Location
+	// Statistics Output
+	Stats PlannerStats
+}
+
+// Time spent in the phases of a planner run and the number of vertices
+// settled by all searches. Legs may be computed concurrently, so the times
+// of the leg search and the path elaboration are summed up over all legs.
+type PlannerStats struct {
+	Snapping    time.Duration
+	LegSearch   time.Duration
+	Elaboration time.Duration
+	Settled     int64
+}
+
+// Add the time since start to the given phase, concurrent calls are fine.
+func (s *PlannerStats) since(phase *time.Duration, start time.Time) {
+	atomic.AddInt64((*int64)(phase), int64(time.Now().Sub(start)))
+}
+
+func (s *PlannerStats) settled(n int) {
+	atomic.AddInt64(&s.Settled, int64(n))
 }
 
 // Execute f(0), f(1), ..., f(n-1) and do so in parallel, based on the
-// corresponding flag.
+// corresponding flag. The calling goroutine takes part in the work and all
+// calls together, including nested ones (e.g., the paths of concurrent
+// legs), start at most MaxParallelism additional goroutines. A call which
+// finds no free worker runs f on the calling goroutine only.
 func Multiplex(n int, inParallel bool, f func(int)) {
-	if inParallel && n > 1 {
-		barrier := make(chan int, n)
-		for i := 0; i < n; i++ {
-			go func(i int) {
-				f(i)
-				barrier <- 1
-			}(i)
+	next := int64(-1)
+	work := func() {
+		for i := int(atomic.AddInt64(&next, 1)); i < n; i = int(atomic.AddInt64(&next, 1)) {
+			f(i)
 		}
-		for i := 0; i < n; i++ {
-			<-barrier
+	}
+	if inParallel && n > 1 {
+		var wg sync.WaitGroup
+		for w := 1; w < n && w < MaxParallelism && acquireWorker(); w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer releaseWorker()
+				work()
+			}()
 		}
+		work()
+		wg.Wait()
 	} else {
-		for i := 0; i < n; i++ {
-			f(i)
-		}
+		work()
 	}
 }
 
+// Number of goroutines started by Multiplex which are still running.
+var workers int64
+
+func acquireWorker() bool {
+	if atomic.AddInt64(&workers, 1) > int64(MaxParallelism) {
+		atomic.AddInt64(&workers, -1)
+		return false
+	}
+	return true
+}
+
+func releaseWorker() {
+	atomic.AddInt64(&workers, -1)
+}
+
+// The metric of all searches, which excludes ferries if requested.
+func (r *RoutePlanner) metric() graph.Metric {
+	if r.AvoidFerries {
+		return r.Metric.WithoutFerries()
+	}
+	return r.Metric
+}
+
+// Err returns the error of the context if the computation was stopped, the
+// result of Run is incomplete in this case.
+func (r *RoutePlanner) Err() error {
+	return contextErr(r.Context)
+}
+
+// contextErr returns the error of an optional context.
+func contextErr(ctx context.Context) error {
+	if ctx == nil {
+		return nil
+	}
+	return ctx.Err()
+}
+
 func (r *RoutePlanner) Run() *Result {
 	// Compute the closest point in the graph for each user specified waypoint.
+	// The locations may already be given, e.g., by the map matching.
 	count := len(r.Waypoints)
-	r.Locations = make([]kdtree.Location, count)
-	Multiplex(count, r.ConcurrentKd, func(i int) {
-		r.Locations[i] = kdtree.NearestNeighbor(r.Waypoints[i], r.Transport)
-	})
+	if len(r.Locations) != count {
+		if err := r.Snap(); err != nil {
+			log.Printf("%v, using the closest road instead.\n", err)
+		}
+	}
+
+	// Alternative routes are only supported between two waypoints, and the
+	// search for them ignores the time.
+	if r.Alternatives > 0 && count == 2 && r.Departure.IsZero() {
+		legs := r.ComputeAlternativeLegs(0, r.Alternatives)
+		if r.Err() != nil {
+			return &Result{}
+		}
+		routes := []Route(nil)
+		for _, leg := range legs {
+			routes = append(routes, r.LegsToRoute([]Leg{leg}))
+		}
+		bounds := ComputeBounds(routes[0])
+		for _, route := range routes[1:] {
+			bounds = BoxUnion(bounds, ComputeBounds(route))
+		}
+		return &Result{
+			BoundingBox: bounds,
+			Routes:      routes,
+		}
+	}
 
 	// Now compute a shortest path for each leg.
 	// If ConcurrentLegs is set compute the legs concurrently.
 	legs := make([]Leg, count-1)
-	Multiplex(count-1, r.ConcurrentLegs, func(i int) {
-		legs[i] = r.ComputeLeg(i)
-	})
+	if !r.Departure.IsZero() {
+		// Every leg starts when the previous one arrives.
+		departure := r.Departure
+		for i := range legs {
+			legs[i] = r.ComputeLegAt(i, departure)
+			departure = departure.Add(time.Duration(legs[i].Duration.Value) * time.Second)
+		}
+	} else {
+		Multiplex(count-1, r.ConcurrentLegs, func(i int) {
+			legs[i] = r.ComputeLeg(i)
+		})
+	}
+	if r.Err() != nil {
+		return &Result{}
+	}
+
+	route := r.LegsToRoute(legs)
+	route.Legs = r.mergeViaLegs(route.Legs)
+	return &Result{
+		BoundingBox: ComputeBounds(route),
+		Routes:      []Route{route},
+	}
+}
 
-	// Format the results.
+// Format the results.
+func (r *RoutePlanner) LegsToRoute(legs []Leg) Route {
 	distance := 0
 	duration := 0
 	for i, leg := range legs {
@@ -91,18 +227,13 @@ func (r *RoutePlanner) Run() *Result {
 		}
 	}
 
-	route := Route{
+	return Route{
 		Distance:      FormatDistance(float64(distance)),
 		Duration:      FormatDuration(float64(duration)),
 		StartLocation: legs[0].StartLocation,
 		EndLocation:   legs[len(legs)-1].EndLocation,
 		Legs:          legs,
 	}
-
-	return &Result{
-		BoundingBox: ComputeBounds(route),
-		Routes:      []Route{route},
-	}
 }
 
 func (r *RoutePlanner) UnionGraph(src, dst kdtree.Location) (*graph.UnionGraph, int, int) {
@@ -135,12 +266,12 @@ func (r *RoutePlanner) UnionGraph(src, dst kdtree.Location) (*graph.UnionGraph,
 func (r *RoutePlanner) EdgeBetween(g graph.Graph, u, v graph.Vertex) graph.Edge {
 	minEdge := graph.Edge(-1)
 	minWeight := math.Inf(1)
-	for _, e := range g.VertexEdges(u, true, r.Transport, nil) {
+	for _, e := range searchEdges(g, u, true, r.Transport, r.metric(), nil) {
 		n := g.EdgeOpposite(e, u)
 		if n != v {
 			continue
 		}
-		weight := g.EdgeWeight(e, r.Transport, r.Metric)
+		weight := g.EdgeWeight(e, r.Transport, r.metric())
 		if weight < minWeight {
 			minEdge = e
 			minWeight = weight
@@ -149,52 +280,273 @@ func (r *RoutePlanner) EdgeBetween(g graph.Graph, u, v graph.Vertex) graph.Edge
 	return minEdge
 }
 
+// The state of the search for one leg, which is needed to turn a path on the
+// union graph into a Leg.
+type legSearch struct {
+	g          *graph.UnionGraph
+	src, dst   kdtree.Location
+	srcWays    []graph.Way
+	dstWays    []graph.Way
+	srcCluster int
+	dstCluster int
+	router     *BidiRouter
+	// The forward search of a leg with a departure time, see searchLegAt.
+	timed     *Router
+	departure graph.Moment
+}
+
 // Compute one path segment between location[waypointIndex] and location[waypointIndex+1]
 func (r *RoutePlanner) ComputeLeg(waypointIndex int) Leg {
+	s := r.searchLeg(waypointIndex)
+	if !s.router.PathFound() {
+		return r.noRouteLeg(s)
+	}
+	return r.elaborateLeg(s, s.router.VPath())
+}
+
+// Same as ComputeLeg, for a leg which starts at the given time.
+func (r *RoutePlanner) ComputeLegAt(waypointIndex int, departure time.Time) Leg {
+	s := r.searchLegAt(waypointIndex, graph.MomentOf(departure))
+	path := s.timedPath(r)
+	if path == nil {
+		return r.noRouteLeg(s)
+	}
+	return r.elaborateLeg(s, path)
+}
+
+// The ways and the union graph of the leg between location[waypointIndex]
+// and location[waypointIndex+1], without a search. The union graph also
+// contains the clusters extra, if any.
+func (r *RoutePlanner) newLegSearch(waypointIndex int, extra []int) *legSearch {
 	src := r.Locations[waypointIndex]
 	dst := r.Locations[waypointIndex+1]
 	buf := []geo.Coordinate(nil)
 	srcWays := src.Decode(true /* forward */, r.Transport, &buf)
 	dstWays := dst.Decode(false /* forward */, r.Transport, &buf)
 
+	// Restrict the direction of travel, unless this leaves nothing.
+	if ways := filterWays(src, srcWays, r.options(waypointIndex), true); len(ways) > 0 {
+		srcWays = ways
+	}
+	if ways := filterWays(dst, dstWays, r.options(waypointIndex+1), false); len(ways) > 0 {
+		dstWays = ways
+	}
+
 	// Compute the union of the source and target clusters.
 	g, srcCluster, dstCluster := r.UnionGraph(src, dst)
+	if len(extra) > 0 {
+		cluster := g.Cluster
+		for _, id := range extra {
+			cluster = append(cluster, r.Graph.Cluster[id])
+		}
+		g = graph.NewUnionGraph(g.Overlay, cluster, append(g.Indices, extra...))
+	}
+
+	return &legSearch{
+		g:          g,
+		src:        src,
+		dst:        dst,
+		srcWays:    srcWays,
+		dstWays:    dstWays,
+		srcCluster: srcCluster,
+		dstCluster: dstCluster,
+		departure:  graph.Static,
+	}
+}
 
-	// Run Dijkstra on the union graph
+// Run Dijkstra between location[waypointIndex] and location[waypointIndex+1]
+// on the union of the overlay graph and the source and target clusters.
+func (r *RoutePlanner) searchLeg(waypointIndex int) *legSearch {
+	defer r.Stats.since(&r.Stats.LegSearch, time.Now())
+	s := r.newLegSearch(waypointIndex, nil)
+	g := s.g
+
+	// Run Dijkstra on the states of the union graph, which respects the
+	// turn restrictions.
 	router := &BidiRouter{
 		Transport: r.Transport,
-		Metric:    r.Metric,
+		Metric:    r.metric(),
+		Context:   r.Context,
 	}
-	router.Reset(g)
-	for _, srcWay := range srcWays {
-		v := g.ToUnionVertex(srcWay.Vertex, srcCluster)
-		router.AddSource(v, float32(srcWay.Length))
+	router.Reset(graph.NewTurnGraph(g))
+	states := []graph.Vertex(nil)
+	for _, srcWay := range s.srcWays {
+		states = g.WayStates(srcWay, s.srcCluster, true /* forward */, r.Transport, states)
+		for _, v := range states {
+			router.AddSource(v, wayWeight(s.src, srcWay, r.Transport, r.metric()))
+		}
 	}
-	for _, dstWay := range dstWays {
-		v := g.ToUnionVertex(dstWay.Vertex, dstCluster)
-		router.AddTarget(v, float32(dstWay.Length))
+	for _, dstWay := range s.dstWays {
+		states = g.WayStates(dstWay, s.dstCluster, false /* forward */, r.Transport, states)
+		for _, v := range states {
+			router.AddTarget(v, wayWeight(s.dst, dstWay, r.Transport, r.metric()))
+		}
 	}
 	router.Run()
+	r.Stats.settled(router.Settled)
+
+	s.router = router
+	return s
+}
 
-	// Return the empty route from start to end point in case no path was found.
-	if !router.PathFound() {
-		srcWays[0].Length = 0
-		srcWays[0].Steps = []geo.Coordinate(nil)
-		dstWays[0].Length = 0
-		dstWays[0].Steps = []geo.Coordinate(nil)
-		return r.StepsToLeg(StatusNoRoute, []Step(nil), srcWays[0], dstWays[0], srcWays[0].Target, dstWays[0].Target)
+// Run Dijkstra from location[waypointIndex] to location[waypointIndex+1]
+// for a leg which starts at the given moment. Only a forward search knows
+// the moment at which it reaches a vertex, so unlike searchLeg this is not
+// a bidirectional search. The conditions are evaluated on the cluster edges
+// of the union graph, the shortcuts of the overlay graph are static. If the
+// path uses a shortcut of a cluster with time dependent conditions, that
+// cluster is added to the union graph and the search starts over.
+func (r *RoutePlanner) searchLegAt(waypointIndex int, departure graph.Moment) *legSearch {
+	// The leg without the conditions bounds the search, which would settle
+	// the whole union graph if the conditions close the targets.
+	limit := float32(math.Inf(1))
+	if static := r.searchLeg(waypointIndex); static.router.PathFound() {
+		limit = TimedMaxStretch * static.router.Distance()
 	}
 
+	// Every round adds at least one cluster, which has no shortcuts in the
+	// union graph from then on.
+	extra := []int(nil)
+	for {
+		s := r.timedLegSearch(waypointIndex, departure, limit, extra)
+		clusters := r.timedShortcutClusters(s)
+		if len(clusters) == 0 {
+			return s
+		}
+		extra = append(extra, clusters...)
+	}
+}
+
+// A single forward search of searchLegAt on the union graph with the
+// additional clusters extra.
+func (r *RoutePlanner) timedLegSearch(waypointIndex int, departure graph.Moment, limit float32, extra []int) *legSearch {
+	defer r.Stats.since(&r.Stats.LegSearch, time.Now())
+	s := r.newLegSearch(waypointIndex, extra)
+	g := s.g
+
+	router := &Router{
+		Forward:   true,
+		Transport: r.Transport,
+		Metric:    r.metric(),
+		Context:   r.Context,
+	}
+	router.Reset(graph.NewTurnGraph(g))
+	states := []graph.Vertex(nil)
+	for _, srcWay := range s.srcWays {
+		states = g.WayStates(srcWay, s.srcCluster, true /* forward */, r.Transport, states)
+		for _, v := range states {
+			router.AddSource(v, wayWeight(s.src, srcWay, r.Transport, r.metric()))
+		}
+	}
+	targets := []graph.Vertex(nil)
+	for _, dstWay := range s.dstWays {
+		states = g.WayStates(dstWay, s.dstCluster, false /* forward */, r.Transport, states)
+		targets = append(targets, states...)
+	}
+	router.RunUntilBoundedAt(targets, limit, departure)
+	r.Stats.settled(router.Settled)
+
+	s.timed = router
+	s.departure = departure
+	return s
+}
+
+// The clusters which are not part of the union graph of s, which have
+// time dependent conditions and whose shortcuts are on the path of s.
+func (r *RoutePlanner) timedShortcutClusters(s *legSearch) []int {
+	g := s.g
+	path := s.timedPath(r)
+	clusters := []int(nil)
+	for i := 0; i+1 < len(path); i++ {
+		u, v := path[i], path[i+1]
+		if g.StateToCluster(u) != -1 || g.StateToCluster(v) != -1 {
+			continue
+		}
+		if int(r.EdgeBetween(g.Overlay, u, v)) != -1 {
+			// Cut edge
+			continue
+		}
+		clusterId, _ := g.Overlay.VertexCluster(u)
+		if containsInt(g.Indices, clusterId) || containsInt(clusters, clusterId) {
+			continue
+		}
+		if r.Graph.Cluster[clusterId].TimeDependent(r.Transport, r.metric()) {
+			clusters = append(clusters, clusterId)
+		}
+	}
+	return clusters
+}
+
+func containsInt(xs []int, x int) bool {
+	for _, y := range xs {
+		if x == y {
+			return true
+		}
+	}
+	return false
+}
+
+// The shortest path of states found by searchLegAt, including the weight of
+// the target way, or nil if there is none.
+func (s *legSearch) timedPath(r *RoutePlanner) []graph.Vertex {
+	router := s.timed
+	if router.Err != nil {
+		return nil
+	}
+	best, target := float32(math.Inf(1)), graph.Vertex(-1)
+	states := []graph.Vertex(nil)
+	for _, dstWay := range s.dstWays {
+		weight := wayWeight(s.dst, dstWay, r.Transport, r.metric())
+		states = s.g.WayStates(dstWay, s.dstCluster, false /* forward */, r.Transport, states)
+		for _, v := range states {
+			if router.Processed(v) && router.Distance(v)+weight < best {
+				best, target = router.Distance(v)+weight, v
+			}
+		}
+	}
+	if int(target) == -1 {
+		return nil
+	}
+	return router.VPath(target)
+}
+
+// The moment at which the leg reaches the union state u, or Static for a
+// leg without a departure time.
+func (s *legSearch) moment(u graph.Vertex) graph.Moment {
+	if s.timed == nil {
+		return graph.Static
+	}
+	return s.departure.Arrival(s.timed.Distance(u), s.timed.Transport, s.timed.Metric)
+}
+
+// Return the empty route from start to end point in case no path was found.
+func (r *RoutePlanner) noRouteLeg(s *legSearch) Leg {
+	srcWay, dstWay := s.srcWays[0], s.dstWays[0]
+	srcWay.Length = 0
+	srcWay.Steps = []geo.Coordinate(nil)
+	dstWay.Length = 0
+	dstWay.Steps = []geo.Coordinate(nil)
+	return r.StepsToLeg(StatusNoRoute, []Step(nil), s.src, s.dst, srcWay, dstWay, srcWay.Target, dstWay.Target)
+}
+
+// Turn a path of states on the union graph into a Leg. Shortcut edges are
+// unpacked with an additional search in the corresponding cluster.
+func (r *RoutePlanner) elaborateLeg(s *legSearch, path []graph.Vertex) Leg {
+	defer r.Stats.since(&r.Stats.Elaboration, time.Now())
+	g := s.g
+	src, dst := s.src, s.dst
+	srcWays, dstWays := s.srcWays, s.dstWays
+	srcCluster, dstCluster := s.srcCluster, s.dstCluster
+
 	// Gather the result path.
-	vpath := router.VPath()
 	segments := [][]Step(nil)
 	sketches := []int(nil)
 	indices := []int(nil)
 	i := 0
-	for i < len(vpath)-1 {
-		u, v := vpath[i], vpath[i+1]
-		uindex := g.VertexToCluster(u)
-		vindex := g.VertexToCluster(v)
+	for i < len(path)-1 {
+		u, v := path[i], path[i+1]
+		uindex := g.StateToCluster(u)
+		vindex := g.StateToCluster(v)
 		steps := []Step(nil)
 
 		if uindex == -1 && vindex == -1 {
@@ -209,31 +561,45 @@ func (r *RoutePlanner) ComputeLeg(waypointIndex int) Leg {
 				indices = append(indices, i)
 			} else {
 				// Cut edge
-				steps = append(steps, r.EdgeToStep(overlay, e, u, v))
+				steps = append(steps, r.EdgeToStep(overlay, -1, e, u, v))
 			}
 			i++
 		} else {
 			// A path within a cluster. We collect all edges until we hit the
 			// next boundary vertex.
-			u, cluster := g.ToClusterVertex(u, uindex)
+			clusterId := -1
+			if uindex != -1 {
+				clusterId = g.Indices[uindex]
+			} else {
+				clusterId, _ = g.Overlay.VertexCluster(u)
+			}
+			u, cluster := g.ToClusterState(u, uindex)
 			j, done := i+1, false
-			for !done && j < len(vpath) {
-				v := vpath[j]
+			// The moment at which the search reaches u.
+			at := s.moment(path[i])
+			for !done && j < len(path) {
+				v := path[j]
 
-				// Project the vertex v onto the current cluster.
-				vindex := g.VertexToCluster(v)
+				// Project the state v onto the current cluster.
+				vindex := g.StateToCluster(v)
 				if vindex == -1 {
 					done = true
 					_, v = g.Overlay.VertexCluster(v)
 				} else {
-					v, _ = g.ToClusterVertex(v, vindex)
+					v, _ = g.ToClusterState(v, vindex)
 					j++
 				}
 
-				// Find the matching u - v edge in the current cluster
-				e := r.EdgeBetween(cluster, u, v)
-				steps = append(steps, r.EdgeToStep(cluster, e, u, v))
+				// Find the matching u - v edge in the current cluster.
+				e := cluster.StateEdgeBetweenAt(u, v, r.Transport, r.metric(), at)
+				step := r.EdgeToStep(cluster, clusterId, e, cluster.StateVertex(u), cluster.StateVertex(v))
+				r.addConditionalSpeed(&step, cluster, e, at)
+				r.addTurnCost(&step, cluster, u, e)
+				steps = append(steps, step)
 				u = v
+				if !done {
+					at = s.moment(path[j-1])
+				}
 			}
 			i = j
 		}
@@ -245,27 +611,47 @@ func (r *RoutePlanner) ComputeLeg(waypointIndex int) Leg {
 	Multiplex(len(sketches), r.ConcurrentPaths, func(i int) {
 		// Find the boundary vertices and cluster corresponding to this shortcut.
 		index := indices[i]
-		clusterIndex, u := g.Overlay.VertexCluster(vpath[index])
+		clusterIndex, u := g.Overlay.VertexCluster(path[index])
 		cluster := r.Graph.Cluster[clusterIndex]
-		_, v := g.Overlay.VertexCluster(vpath[index+1])
+		_, v := g.Overlay.VertexCluster(path[index+1])
 
-		// Run Dijkstra to find a u -> v path.
+		// Run Dijkstra to find a u -> v path. It starts in the state for the
+		// edge over which the path arrives at u, which is a cut edge unless
+		// the previous state lies in the same cluster of the union graph.
 		router := &BidiRouter{
 			Transport: r.Transport,
-			Metric:    r.Metric,
+			Metric:    r.metric(),
+			Context:   r.Context,
+		}
+		router.Reset(graph.NewTurnGraph(cluster))
+		in := graph.Edge(-1)
+		if index > 0 {
+			if pindex := g.StateToCluster(path[index-1]); pindex != -1 && g.Indices[pindex] == clusterIndex {
+				p, _ := g.ToClusterState(path[index-1], pindex)
+				in = cluster.StateEdgeBetween(p, u, r.Transport, r.metric())
+			}
+		}
+		for _, s := range cluster.WayStates(u, in, true /* forward */, r.Transport, nil) {
+			router.AddSource(s, 0)
+		}
+		for _, s := range cluster.WayStates(v, -1, false /* forward */, r.Transport, nil) {
+			router.AddTarget(s, 0)
 		}
-		router.Reset(cluster)
-		router.AddSource(u, 0)
-		router.AddTarget(v, 0)
 		router.Run()
+		r.Stats.settled(router.Settled)
+		if !router.PathFound() {
+			// only if the computation was stopped
+			return
+		}
 
 		// Convert this path into a step array.
-		vertices, edges := router.Path()
-		steps := make([]Step, len(edges))
-		for j, edge := range edges {
-			s := vertices[j]
-			t := vertices[j+1]
-			steps[j] = r.EdgeToStep(cluster, edge, s, t)
+		states := router.VPath()
+		steps := make([]Step, len(states)-1)
+		for j := range steps {
+			s, t := states[j], states[j+1]
+			edge := cluster.StateEdgeBetween(s, t, r.Transport, r.metric())
+			steps[j] = r.EdgeToStep(cluster, clusterIndex, edge, cluster.StateVertex(s), cluster.StateVertex(t))
+			r.addTurnCost(&steps[j], cluster, s, edge)
 		}
 		segments[sketches[i]] = steps
 	})
@@ -275,7 +661,7 @@ func (r *RoutePlanner) ComputeLeg(waypointIndex int) Leg {
 	var startc, stopc geo.Coordinate
 	for i, srcWay := range srcWays {
 		vertex := g.ToUnionVertex(srcWay.Vertex, srcCluster)
-		if vpath[0] == vertex {
+		if g.StateVertex(path[0]) == vertex {
 			indexstart = i
 			startc = src.Graph.VertexCoordinate(srcWay.Vertex)
 			break
@@ -283,7 +669,7 @@ func (r *RoutePlanner) ComputeLeg(waypointIndex int) Leg {
 	}
 	for i, dstWay := range dstWays {
 		vertex := g.ToUnionVertex(dstWay.Vertex, dstCluster)
-		if vpath[len(vpath)-1] == vertex {
+		if g.StateVertex(path[len(path)-1]) == vertex {
 			indexend = i
 			stopc = dst.Graph.VertexCoordinate(dstWay.Vertex)
 			break
@@ -293,5 +679,5 @@ func (r *RoutePlanner) ComputeLeg(waypointIndex int) Leg {
 	for _, segment := range segments {
 		steps = append(steps, segment...)
 	}
-	return r.StepsToLeg(StatusOk, steps, srcWays[indexstart], dstWays[indexend], startc, stopc)
+	return r.StepsToLeg(StatusOk, steps, src, dst, srcWays[indexstart], dstWays[indexend], startc, stopc)
 }
@@ -0,0 +1,183 @@
+/*
+ * Copyright 2014 Florian Benz, Steven Schäfer, Bernhard Schommer
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package route
+
+import (
+	"geo"
+	"graph"
+	"math"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMultiplex(t *testing.T) {
+	defer func(old int) { MaxParallelism = old }(MaxParallelism)
+	MaxParallelism = 4
+
+	const n = 100
+	done := make([]int32, n)
+	active, maxActive := int32(0), int32(0)
+	Multiplex(n, true, func(i int) {
+		a := atomic.AddInt32(&active, 1)
+		for {
+			m := atomic.LoadInt32(&maxActive)
+			if a <= m || atomic.CompareAndSwapInt32(&maxActive, m, a) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		atomic.AddInt32(&done[i], 1)
+		atomic.AddInt32(&active, -1)
+	})
+
+	for i, d := range done {
+		if d != 1 {
+			t.Errorf("f(%d) was called %d times", i, d)
+		}
+	}
+	if maxActive > int32(MaxParallelism) {
+		t.Errorf("%d concurrent calls, expected at most %d", maxActive, MaxParallelism)
+	}
+}
+
+// The inner calls share the workers with the outer one.
+func TestMultiplexNested(t *testing.T) {
+	defer func(old int) { MaxParallelism = old }(MaxParallelism)
+	MaxParallelism = 4
+
+	const n = 10
+	done := int32(0)
+	active, maxActive := int32(0), int32(0)
+	Multiplex(n, true, func(int) {
+		Multiplex(n, true, func(int) {
+			a := atomic.AddInt32(&active, 1)
+			for {
+				m := atomic.LoadInt32(&maxActive)
+				if a <= m || atomic.CompareAndSwapInt32(&maxActive, m, a) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond)
+			atomic.AddInt32(&done, 1)
+			atomic.AddInt32(&active, -1)
+		})
+	})
+
+	if done != n*n {
+		t.Errorf("f was called %d times, expected %d", done, n*n)
+	}
+	// The calling goroutine and the workers
+	if maxActive > int32(MaxParallelism)+1 {
+		t.Errorf("%d concurrent calls, expected at most %d", maxActive, MaxParallelism+1)
+	}
+}
+
+func TestRoutePlannerDelays(t *testing.T) {
+	n := gridNetwork(1, 6, 3)
+	g, trees := n.ClusterGraph()
+	// The middle of the edge from (0, 1) to (0, 2).
+	middle := geo.Coordinate{Lat: testLat, Lng: testLng + 1.5*testSpacing}
+	duration := func(to geo.Coordinate) int {
+		planner := &RoutePlanner{
+			Graph:     g,
+			KdTree:    trees,
+			Waypoints: []geo.Coordinate{n.Points[n.vertex(0, 0)], to},
+			Transport: graph.Car,
+			Metric:    graph.Time,
+		}
+		return planner.Run().Routes[0].Duration.Value
+	}
+	toSignals := duration(n.Points[n.vertex(0, 1)])
+	toMiddle := duration(middle)
+
+	// Traffic signals at (0, 1) in the first cluster.
+	cluster := g.Cluster[0]
+	cluster.Delays = make([]byte, cluster.VertexCount())
+	for v := range cluster.Delays {
+		if cluster.VertexCoordinate(graph.Vertex(v)) == n.Points[n.vertex(0, 1)] {
+			cluster.Delays[v] = byte(graph.DelayTrafficSignals)
+		}
+	}
+	signals := int(graph.NodeDelaySeconds[graph.Car][graph.DelayTrafficSignals])
+	if d := duration(n.Points[n.vertex(0, 1)]); d != toSignals {
+		t.Errorf("got duration %d to the signals, expected %d without delay", d, toSignals)
+	}
+	if d := duration(middle); d != toMiddle+signals {
+		t.Errorf("got duration %d through the signals, expected %d", d, toMiddle+signals)
+	}
+}
+
+func TestRoutePlannerConditions(t *testing.T) {
+	// The shortest route along the first row passes the middle cluster on a
+	// shortcut. Its edge from (0, 3) to (0, 4) is closed for cars on Monday
+	// from 07:00 to 09:00.
+	n := gridNetwork(2, 9, 3)
+	g, trees := n.ClusterGraph()
+	cluster := g.Cluster[1]
+	closed := graph.Edge(-1)
+	for v := 0; v < cluster.VertexCount(); v++ {
+		if cluster.VertexCoordinate(graph.Vertex(v)) != n.Points[n.vertex(0, 3)] {
+			continue
+		}
+		for _, e := range cluster.VertexEdges(graph.Vertex(v), true, graph.Car, nil) {
+			if cluster.VertexCoordinate(cluster.EdgeOpposite(e, graph.Vertex(v))) == n.Points[n.vertex(0, 4)] {
+				closed = e
+			}
+		}
+	}
+	cluster.SetConditions([]graph.Condition{{
+		Transports: 1 << uint(graph.Car),
+		Edge:       closed,
+		Windows:    []graph.TimeWindow{{Days: 0x01, From: 420, To: 540}},
+	}})
+
+	// The same network without the closed edge.
+	detour := *n
+	detour.Edges = nil
+	for i, e := range n.Edges {
+		if i != n.edge(n.vertex(0, 3), n.vertex(0, 4)) {
+			detour.Edges = append(detour.Edges, e)
+		}
+	}
+	src, dst := n.vertex(0, 0), n.vertex(0, 8)
+	open := n.distance(src, dst, graph.Car, graph.Distance)
+	closedDistance := detour.distance(src, dst, graph.Car, graph.Distance)
+
+	distance := func(departure string) int {
+		planner := &RoutePlanner{
+			Graph:     g,
+			KdTree:    trees,
+			Waypoints: []geo.Coordinate{n.Points[src], n.Points[dst]},
+			Transport: graph.Car,
+			Metric:    graph.Distance,
+		}
+		if departure != "" {
+			planner.Departure, _ = time.Parse(time.RFC3339, departure)
+		}
+		return planner.Run().Routes[0].Distance.Value
+	}
+	static := distance("")
+	for departure, expected := range map[string]float32{
+		"2014-06-02T07:30:00+00:00": float32(static) + closedDistance - open,
+		"2014-06-02T10:00:00+00:00": float32(static),
+	} {
+		if d := distance(departure); math.Abs(float64(d)-float64(expected)) > 1 {
+			t.Errorf("departure %s: got distance %d, expected %v", departure, d, expected)
+		}
+	}
+}
@@ -39,6 +39,9 @@ type Route struct {
 	StartLocation Point    `json:"start_location"`
 	EndLocation   Point    `json:"end_location"`
 	Legs          []Leg    `json:"legs"`
+	// Geometry of the whole route, only present if requested.
+	OverviewPolyline Polyline `json:"overview_polyline,omitempty"`
+	OverviewGeometry string   `json:"overview_geometry,omitempty"`
 }
 
 type Leg struct {
@@ -48,6 +51,8 @@ type Leg struct {
 	StartLocation Point    `json:"start_location"`
 	EndLocation   Point    `json:"end_location"`
 	Steps         []Step   `json:"steps"`
+	// Encoded polyline of the leg, only present if requested.
+	Geometry string `json:"geometry,omitempty"`
 }
 
 type Step struct {
@@ -55,8 +60,21 @@ type Step struct {
 	Duration      Duration `json:"duration"`
 	StartLocation Point    `json:"start_location"`
 	EndLocation   Point    `json:"end_location"`
-	Polyline      Polyline `json:"polyline"`
+	Polyline      Polyline `json:"polyline,omitempty"`
+	Geometry      string   `json:"geometry,omitempty"` // encoded polyline
 	Instruction   string   `json:"instruction"`
+	Maneuver      Maneuver `json:"maneuver"`
+	// Street name and reference number, e.g., "Hauptstraße" and "B 51".
+	Name string `json:"name,omitempty"`
+	Ref  string `json:"ref,omitempty"`
+
+	// Exact length in meter and duration in seconds
+	length  float64
+	seconds float64
+	// The junction at the start of the step, see RoutePlanner.junction.
+	roundabout bool
+	degree     int
+	exits      int
 }
 
 type Distance struct {
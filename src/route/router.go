@@ -17,6 +17,7 @@
 package route
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"graph"
@@ -32,6 +33,16 @@ type Router struct {
 	Forward   bool
 	Transport graph.Transport
 	Metric    graph.Metric
+	// Optional, the search stops as soon as the context is done.
+	Context context.Context
+	// Number of vertices settled since the last Reset
+	Settled int
+	// If Record is set, the settled vertices are appended to Order in the
+	// order of their distances. Reset clears Order.
+	Record bool
+	Order  []graph.Vertex
+	// The error of the context if the search was stopped
+	Err error
 }
 
 // Problem Setup
@@ -62,6 +73,9 @@ func (r *Router) Reset(g graph.Graph) {
 	}
 
 	(&r.Heap).Reset(vertexCount)
+	r.Settled = 0
+	r.Order = r.Order[:0]
+	r.Err = nil
 }
 
 // Add a new Source if Forward == true, or a sink if Forward == false.
@@ -73,15 +87,84 @@ func (r *Router) AddSource(v graph.Vertex, distance float32) {
 // Dijkstra
 
 func (r *Router) Run() {
+	r.run(nil, float32(math.Inf(1)), graph.Static)
+}
+
+// Dijkstra with early termination: the search stops as soon as all of the
+// given vertices are processed. Unreachable vertices simply lead to a full
+// search, as in Run.
+func (r *Router) RunUntil(targets []graph.Vertex) {
+	r.run(r.pending(targets), float32(math.Inf(1)), graph.Static)
+}
+
+// RunUntil on a graph.TimedGraph, which respects the conditional restrictions
+// at the moment at which the search reaches a vertex if it started at the
+// departure. Only a forward search knows this moment. Other graphs ignore the
+// conditions as in RunUntil.
+func (r *Router) RunUntilAt(targets []graph.Vertex, departure graph.Moment) {
+	r.run(r.pending(targets), float32(math.Inf(1)), departure)
+}
+
+// RunUntilAt which also stops at the limit, as RunBounded.
+func (r *Router) RunUntilBoundedAt(targets []graph.Vertex, limit float32, departure graph.Moment) {
+	r.run(r.pending(targets), limit, departure)
+}
+
+// Dijkstra which only settles vertices with a distance of at most limit.
+// Vertices beyond the limit may still be Reachable, but are never Processed.
+func (r *Router) RunBounded(limit float32) {
+	r.run(nil, limit, graph.Static)
+}
+
+// RunUntil which also stops at the limit, as RunBounded.
+func (r *Router) RunUntilBounded(targets []graph.Vertex, limit float32) {
+	r.run(r.pending(targets), limit, graph.Static)
+}
+
+// The targets which are not processed yet.
+func (r *Router) pending(targets []graph.Vertex) map[graph.Vertex]bool {
+	pending := make(map[graph.Vertex]bool, len(targets))
+	for _, v := range targets {
+		if !(&r.Heap).Processed(v) {
+			pending[v] = true
+		}
+	}
+	return pending
+}
+
+// Returns true if the search has to stop, see BidiRouter.cancelled.
+func (r *Router) cancelled() bool {
+	if r.Context == nil || r.Settled%CancelCheckInterval != 0 {
+		return false
+	}
+	r.Err = r.Context.Err()
+	return r.Err != nil
+}
+
+// The loop of all searches. It stops when no vertex within the limit is
+// left, when all pending vertices (unless nil) are processed, or when the
+// context is done. The conditions are evaluated unless departure is Static.
+func (r *Router) run(pending map[graph.Vertex]bool, limit float32, departure graph.Moment) {
 	g, h := r.Graph, &r.Heap
 	t, m := r.Transport, r.Metric
 	forward := r.Forward
 	darts := []graph.Dart(nil)
+	timed, ok := g.(graph.TimedGraph)
+	ok = ok && departure != graph.Static
 
-	for !h.Empty() {
+	for !h.Empty() && h.Top() <= limit && (pending == nil || len(pending) > 0) && !r.cancelled() {
 		curr, dist := h.Pop()
 		r.Dist[curr] = dist
-		darts = g.VertexNeighbors(curr, forward, t, m, darts)
+		r.Settled++
+		if r.Record {
+			r.Order = append(r.Order, curr)
+		}
+		delete(pending, curr)
+		if ok {
+			darts = timed.VertexNeighborsAt(curr, forward, t, m, departure.Arrival(dist, t, m), darts)
+		} else {
+			darts = g.VertexNeighbors(curr, forward, t, m, darts)
+		}
 		for _, d := range darts {
 			n := d.Vertex
 			if h.Processed(n) {
@@ -115,6 +198,22 @@ func (r *Router) Processed(v graph.Vertex) bool {
 	return (&r.Heap).Color(v) == Black
 }
 
+// The edges at u which a search in the metric m relaxes, the same as the
+// neighbors in GraphFile.VertexNeighbors.
+func searchEdges(g graph.Graph, u graph.Vertex, forward bool, t graph.Transport, m graph.Metric, buf []graph.Edge) []graph.Edge {
+	buf = g.VertexEdges(u, forward, t, buf)
+	if !m.AvoidsFerries() {
+		return buf
+	}
+	result := buf[:0]
+	for _, e := range buf {
+		if !g.EdgeFerry(e) {
+			result = append(result, e)
+		}
+	}
+	return result
+}
+
 func (r *Router) parent_edge(v graph.Vertex, buf []graph.Edge) (graph.Edge, []graph.Edge) {
 	g := r.Graph
 	u := r.Parent[v]
@@ -124,7 +223,7 @@ func (r *Router) parent_edge(v graph.Vertex, buf []graph.Edge) (graph.Edge, []gr
 	minEdge := graph.Edge(-1)
 	minWeight := math.Inf(1)
 	found := false
-	buf = g.VertexEdges(u, r.Forward, r.Transport, buf)
+	buf = searchEdges(g, u, r.Forward, r.Transport, r.Metric, buf)
 	for _, e := range buf {
 		n := g.EdgeOpposite(e, u)
 		if n != v {
@@ -188,6 +287,22 @@ func (r *Router) Path(t graph.Vertex) ([]graph.Vertex, []graph.Edge) {
 	return vertices, path
 }
 
+// Returns the vertices on a shortest path between a source vertex and t, in
+// the same order as Path. Unlike Path, this does not need the edges of the
+// graph, so it also works for the states of a TurnGraph.
+func (r *Router) VPath(t graph.Vertex) []graph.Vertex {
+	vertices := []graph.Vertex{t}
+	for v := t; r.Parent[v] != v; v = r.Parent[v] {
+		vertices = append(vertices, r.Parent[v])
+	}
+	if r.Forward {
+		for i, j := 0, len(vertices)-1; i < j; i, j = i+1, j-1 {
+			vertices[i], vertices[j] = vertices[j], vertices[i]
+		}
+	}
+	return vertices
+}
+
 // Check that the distance function is dual feasible for all Reachable
 // vertices and that the parent pointers define a primal solution which
 // obeys the complementary slackness conditions. This implies that the
@@ -211,7 +326,7 @@ func (r *Router) CertifySolution() (bool, error) {
 			continue
 		}
 
-		buf = g.VertexEdges(u, r.Forward, r.Transport, buf)
+		buf = searchEdges(g, u, r.Forward, r.Transport, r.Metric, buf)
 		for _, e := range buf {
 			v := g.EdgeOpposite(e, u)
 			if !r.Reachable(v) {
@@ -247,7 +362,7 @@ func (r *Router) CertifySolution() (bool, error) {
 		// Find the weight of the tree edge from Parent[v] to v.
 		minEdge := graph.Edge(-1)
 		minWeight := float32(math.Inf(1))
-		buf = g.VertexEdges(v, !r.Forward, r.Transport, buf)
+		buf = searchEdges(g, v, !r.Forward, r.Transport, r.Metric, buf)
 		for _, e := range buf {
 			u := g.EdgeOpposite(e, v)
 			if u != r.Parent[v] {
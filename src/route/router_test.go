@@ -0,0 +1,165 @@
+/*
+ * Copyright 2014 Florian Benz, Steven Schäfer, Bernhard Schommer
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package route
+
+import (
+	"context"
+	"graph"
+	"testing"
+)
+
+func TestRouterRun(t *testing.T) {
+	g := &lineGraph{n: 20}
+	router := &Router{Forward: true}
+	router.Reset(g)
+	router.AddSource(5, 0)
+	router.Run()
+	for v := 0; v < g.n; v++ {
+		expected := float32(v - 5)
+		if v < 5 {
+			expected = -expected
+		}
+		if !router.Processed(graph.Vertex(v)) || router.Distance(graph.Vertex(v)) != expected {
+			t.Errorf("vertex %d: got distance %v, expected %v", v, router.Distance(graph.Vertex(v)), expected)
+		}
+	}
+	if router.Settled != g.n {
+		t.Errorf("settled %d vertices, expected %d", router.Settled, g.n)
+	}
+}
+
+func TestRouterRunUntil(t *testing.T) {
+	g := &lineGraph{n: 20}
+	router := &Router{Forward: true}
+	router.Reset(g)
+	router.AddSource(0, 0)
+	router.RunUntil([]graph.Vertex{3, 6})
+	if !router.Processed(6) || router.Distance(6) != 6 || !router.Processed(3) {
+		t.Errorf("targets are not processed, distance %v", router.Distance(6))
+	}
+	if router.Processed(7) || router.Settled != 7 {
+		t.Errorf("settled %d vertices, expected the search to stop at the last target", router.Settled)
+	}
+	path := router.VPath(6)
+	if len(path) != 7 || path[0] != 0 || path[6] != 6 {
+		t.Errorf("got path %v", path)
+	}
+
+	// Processed targets do not continue the search.
+	router.RunUntil([]graph.Vertex{2})
+	if router.Settled != 7 {
+		t.Errorf("settled %d vertices for a processed target", router.Settled)
+	}
+	// The search continues for new targets.
+	router.RunUntil([]graph.Vertex{10})
+	if router.Distance(10) != 10 || router.Processed(11) {
+		t.Errorf("got distance %v to the new target", router.Distance(10))
+	}
+}
+
+func TestRouterRunBounded(t *testing.T) {
+	g := &lineGraph{n: 20}
+	router := &Router{Forward: true}
+	router.Reset(g)
+	router.AddSource(10, 0)
+	router.RunBounded(3.5)
+	for v := 0; v < g.n; v++ {
+		processed := v >= 7 && v <= 13
+		if router.Processed(graph.Vertex(v)) != processed {
+			t.Errorf("vertex %d: processed is %v, expected %v", v, !processed, processed)
+		}
+	}
+	// The next vertices are reachable, but beyond the limit.
+	if !router.Reachable(6) || router.Distance(6) != 4 {
+		t.Errorf("vertex 6 is not reachable with distance 4, got %v", router.Distance(6))
+	}
+}
+
+func TestRouterCancel(t *testing.T) {
+	g := &lineGraph{n: 10 * CancelCheckInterval}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	router := &Router{Forward: true, Context: ctx}
+	for _, run := range []func(){
+		func() { router.RunUntil([]graph.Vertex{graph.Vertex(g.n - 1)}) },
+		func() { router.RunBounded(float32(g.n)) },
+	} {
+		router.Reset(g)
+		router.AddSource(0, 0)
+		run()
+		if router.Processed(graph.Vertex(g.n-1)) || router.Err != context.Canceled {
+			t.Errorf("Search was not stopped, error %v", router.Err)
+		}
+		if router.Settled > CancelCheckInterval {
+			t.Errorf("Settled %d vertices after the cancellation", router.Settled)
+		}
+	}
+}
+
+// A path 0 - 1 - 2 - 3 - 4 with edges of 100 m and a shortcut of 100 m
+// from 1 to 4, which is closed on Monday from 07:00 to 09:00.
+type closureGraph struct {
+	graph.Graph
+}
+
+func (g *closureGraph) VertexCount() int {
+	return 5
+}
+
+func (g *closureGraph) VertexNeighbors(v graph.Vertex, forward bool, t graph.Transport, m graph.Metric, buf []graph.Dart) []graph.Dart {
+	return g.VertexNeighborsAt(v, forward, t, m, graph.Static, buf)
+}
+
+func (g *closureGraph) VertexNeighborsAt(v graph.Vertex, forward bool, t graph.Transport, m graph.Metric, at graph.Moment, buf []graph.Dart) []graph.Dart {
+	buf = buf[:0]
+	if v < 4 {
+		buf = append(buf, graph.Dart{Vertex: v + 1, Weight: 100})
+	}
+	closed := graph.TimeWindow{Days: 0x01, From: 420, To: 540}
+	if v == 1 && (at == graph.Static || !closed.Contains(at)) {
+		buf = append(buf, graph.Dart{Vertex: 4, Weight: 100})
+	}
+	return buf
+}
+
+func TestRouterRunUntilAt(t *testing.T) {
+	g := &closureGraph{}
+	router := &Router{Forward: true, Transport: graph.Foot, Metric: graph.Distance}
+	// On foot, the search reaches vertex 1 after 72 seconds.
+	for departure, expected := range map[graph.Moment]float32{
+		graph.Static: 200,
+		418:          200,
+		419:          400,
+		480:          400,
+		600:          200,
+	} {
+		router.Reset(g)
+		router.AddSource(0, 0)
+		router.RunUntilAt([]graph.Vertex{4}, departure)
+		if d := router.Distance(4); d != expected {
+			t.Errorf("departure %v: got distance %v, expected %v", departure, d, expected)
+		}
+	}
+
+	// The detour is beyond the limit.
+	router.Reset(g)
+	router.AddSource(0, 0)
+	router.RunUntilBoundedAt([]graph.Vertex{4}, 300, 480)
+	if router.Processed(4) {
+		t.Errorf("got distance %v beyond the limit", router.Distance(4))
+	}
+}
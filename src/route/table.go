@@ -0,0 +1,247 @@
+/*
+ * Copyright 2014 Florian Benz, Steven Schäfer, Bernhard Schommer
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Many-to-many distance and duration tables
+//
+// A table only needs the cost of the shortest paths and not the paths
+// themselves. We can therefore stay on the overlay graph (plus the clusters
+// containing the sources and destinations) and never have to unpack a
+// shortcut edge.
+
+package route
+
+import (
+	"context"
+	"geo"
+	"graph"
+	"kdtree"
+	"math"
+)
+
+const (
+	// Number of concurrent searches for the rows of a table. Every search
+	// needs its own Router, i.e., memory linear in the size of the union graph.
+	TableWorkers = 8
+
+	// Conversion factor from weights in the Time metric to seconds.
+	SecondsPerTimeUnit = graph.SecondsPerTimeUnit
+
+	// Table entry for destinations which cannot be reached.
+	NoRoute = -1
+)
+
+type Table struct {
+	Sources      []Point `json:"sources"`
+	Destinations []Point `json:"destinations"`
+	// Distances in meter and durations in seconds, indexed by [source][destination].
+	// Every matrix is optimal for its own metric and contains NoRoute if there
+	// is no path at all.
+	Distances [][]int `json:"distances,omitempty"`
+	Durations [][]int `json:"durations,omitempty"`
+}
+
+type TablePlanner struct {
+	// Underlying graph structure
+	Graph  *graph.ClusterGraph
+	KdTree *kdtree.ClusterKdTree
+	// User input
+	Sources      []geo.Coordinate
+	Destinations []geo.Coordinate
+	// Graph setting
+	Transport graph.Transport
+	Metrics   []graph.Metric
+	// Planner options
+	ConcurrentKd   bool
+	ConcurrentRows bool
+	// Optional, the computation stops as soon as the context is done, see Err.
+	Context context.Context
+	// KdTree Output
+	SourceLocations      []kdtree.Location
+	DestinationLocations []kdtree.Location
+}
+
+// Convert a weight in the given metric into meter or seconds respectively.
+func MetricValue(m graph.Metric, weight float32) int {
+	if m.Base() == graph.Time {
+		return int(float64(weight)*SecondsPerTimeUnit + 0.5)
+	}
+	return int(float64(weight) + 0.5)
+}
+
+// The weight of a partial edge returned by the k-d tree. Way.Length is always
+// given in meter, so for other metrics we scale it by the weight of the whole
+// edge. The edge of the location itself is never avoided.
+func wayWeight(l kdtree.Location, way graph.Way, t graph.Transport, m graph.Metric) float32 {
+	e := l.Edge()
+	m = m.Base()
+	if m == graph.Distance || int(e) == -1 || way.Length == 0 {
+		return float32(way.Length)
+	}
+	// A path to the location passes through the vertex of the way, but the
+	// search does not add its delay, see graph.NodeDelay.
+	delay := float32(0)
+	if !way.Forward {
+		delay = float32(l.Graph.VertexDelay(way.Vertex, t) / graph.SecondsPerTimeUnit)
+	}
+	length := l.Graph.EdgeWeight(e, t, graph.Distance)
+	if length == 0 {
+		return float32(way.Length) + delay
+	}
+	return float32(way.Length*l.Graph.EdgeWeight(e, t, m)/length) + delay
+}
+
+// Compute the union of the overlay graph and all clusters containing one of
+// the given locations. Returns the graph along with the union cluster index
+// of every location.
+func LocationUnionGraph(g *graph.ClusterGraph, locations []kdtree.Location) (*graph.UnionGraph, []int) {
+	cluster := []*graph.GraphFile(nil)
+	indices := []int(nil)
+	unionIndex := make(map[int]int)
+	locationIndex := make([]int, len(locations))
+	for i, l := range locations {
+		if l.Cluster == -1 {
+			locationIndex[i] = -1
+			continue
+		}
+		index, ok := unionIndex[l.Cluster]
+		if !ok {
+			index = len(cluster)
+			unionIndex[l.Cluster] = index
+			cluster = append(cluster, g.Cluster[l.Cluster])
+			indices = append(indices, l.Cluster)
+		}
+		locationIndex[i] = index
+	}
+	return graph.NewUnionGraph(g.Overlay, cluster, indices), locationIndex
+}
+
+// Err returns the error of the context if the computation was stopped, the
+// table of Run is incomplete in this case.
+func (p *TablePlanner) Err() error {
+	return contextErr(p.Context)
+}
+
+func (p *TablePlanner) Run() *Table {
+	// Compute the closest point in the graph for all sources and destinations.
+	locations := make([]kdtree.Location, len(p.Sources)+len(p.Destinations))
+	Multiplex(len(locations), p.ConcurrentKd, func(i int) {
+		if i < len(p.Sources) {
+			locations[i] = p.KdTree.NearestNeighbor(p.Sources[i], p.Transport)
+		} else {
+			locations[i] = p.KdTree.NearestNeighbor(p.Destinations[i-len(p.Sources)], p.Transport)
+		}
+	})
+	p.SourceLocations = locations[:len(p.Sources)]
+	p.DestinationLocations = locations[len(p.Sources):]
+
+	g, unionIndices := LocationUnionGraph(p.Graph, locations)
+	srcIndices := unionIndices[:len(p.Sources)]
+	dstIndices := unionIndices[len(p.Sources):]
+
+	table := &Table{
+		Sources:      make([]Point, len(p.Sources)),
+		Destinations: make([]Point, len(p.Destinations)),
+	}
+	buf := []geo.Coordinate(nil)
+	srcWays := make([][]graph.Way, len(p.Sources))
+	for i, l := range p.SourceLocations {
+		srcWays[i] = l.Decode(true /* forward */, p.Transport, &buf)
+		table.Sources[i] = StepToPoint(srcWays[i][0].Target)
+	}
+	dstWays := make([][]graph.Way, len(p.Destinations))
+	for i, l := range p.DestinationLocations {
+		dstWays[i] = l.Decode(false /* forward */, p.Transport, &buf)
+		table.Destinations[i] = StepToPoint(dstWays[i][0].Target)
+	}
+
+	for _, m := range p.Metrics {
+		matrix := p.computeMatrix(g, m, srcIndices, dstIndices, srcWays, dstWays)
+		switch m {
+		case graph.Distance:
+			table.Distances = matrix
+		case graph.Time:
+			table.Durations = matrix
+		}
+	}
+	return table
+}
+
+// Compute one row of the table per source with a forward search on the
+// states of the union graph, which stops once all destinations are settled.
+func (p *TablePlanner) computeMatrix(g *graph.UnionGraph, m graph.Metric, srcIndices, dstIndices []int, srcWays, dstWays [][]graph.Way) [][]int {
+	// The states of every destination way.
+	targets := []graph.Vertex(nil)
+	dstStates := make([][][]graph.Vertex, len(dstWays))
+	for j, ways := range dstWays {
+		dstStates[j] = make([][]graph.Vertex, len(ways))
+		for k, way := range ways {
+			dstStates[j][k] = g.WayStates(way, dstIndices[j], false /* forward */, p.Transport, nil)
+			targets = append(targets, dstStates[j][k]...)
+		}
+	}
+
+	matrix := make([][]int, len(srcWays))
+	workers := TableWorkers
+	if len(srcWays) < workers {
+		workers = len(srcWays)
+	}
+	Multiplex(workers, p.ConcurrentRows, func(worker int) {
+		router := &Router{
+			Forward:   true,
+			Transport: p.Transport,
+			Metric:    m,
+			Context:   p.Context,
+		}
+		states := []graph.Vertex(nil)
+		for i := worker; i < len(srcWays); i += workers {
+			src := p.SourceLocations[i]
+			router.Reset(graph.NewTurnGraph(g))
+			for _, way := range srcWays[i] {
+				states = g.WayStates(way, srcIndices[i], true /* forward */, p.Transport, states)
+				for _, v := range states {
+					router.AddSource(v, wayWeight(src, way, p.Transport, m))
+				}
+			}
+			router.RunUntil(targets)
+
+			row := make([]int, len(dstWays))
+			for j, ways := range dstWays {
+				dst := p.DestinationLocations[j]
+				if src.Graph == dst.Graph && src.EC == dst.EC {
+					// Both points snap to the same position.
+					row[j] = 0
+					continue
+				}
+				best := float32(math.Inf(1))
+				for k, way := range ways {
+					for _, v := range dstStates[j][k] {
+						dist := router.Distance(v) + wayWeight(dst, way, p.Transport, m)
+						if dist < best {
+							best = dist
+						}
+					}
+				}
+				if math.IsInf(float64(best), 1) {
+					row[j] = NoRoute
+				} else {
+					row[j] = MetricValue(m, best)
+				}
+			}
+			matrix[i] = row
+		}
+	})
+	return matrix
+}
@@ -0,0 +1,143 @@
+/*
+ * Copyright 2014 Florian Benz, Steven Schäfer, Bernhard Schommer
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package route
+
+import (
+	"alg"
+	"context"
+	"geo"
+	"graph"
+	"kdtree"
+	"testing"
+)
+
+// A location on the only edge of a graph with two vertices. The edge is
+// 100 m long with a maxspeed of 50 km/h.
+func edgeLocation() kdtree.Location {
+	g := &graph.GraphFile{
+		FirstOut:  []uint32{0, 1, 1},
+		FirstIn:   []uint32{graph.Sentinel, 0},
+		NextIn:    []uint32{graph.Sentinel},
+		Edges:     []uint32{0 ^ 1},
+		Distances: []uint16{alg.Float32ToHalf(100)},
+		MaxSpeeds: []uint16{50},
+	}
+	// Vertex 0, edge offset 0, step offset 0
+	return kdtree.Location{Graph: g, EC: 0, Cluster: -1}
+}
+
+func TestWayWeight(t *testing.T) {
+	l := edgeLocation()
+	way := graph.Way{Length: 40}
+	if w := wayWeight(l, way, graph.Car, graph.Distance); w != 40 {
+		t.Errorf("distance: got %v, expected 40", w)
+	}
+	// The partial edge has the same unit as the edge weights, so 40% of
+	// the edge weight in the Time metric.
+	expected := 0.4 * l.Graph.EdgeWeight32(0, graph.Car, graph.Time)
+	if w := wayWeight(l, way, graph.Car, graph.Time); w != expected {
+		t.Errorf("time: got %v, expected %v", w, expected)
+	}
+}
+
+func TestTablePlanner(t *testing.T) {
+	n := gridNetwork(4, 9, 3)
+	// A oneway in the middle cluster, against the direction of the search.
+	n.Edges[n.edge(n.vertex(2, 4), n.vertex(2, 5))] = testEdge{From: n.vertex(2, 5), To: n.vertex(2, 4), Oneway: true}
+	g, trees := n.ClusterGraph()
+
+	// Interior and boundary vertices of all clusters.
+	sources := []graph.Vertex{n.vertex(0, 0), n.vertex(1, 2), n.vertex(2, 4)}
+	destinations := []graph.Vertex{n.vertex(3, 8), n.vertex(2, 5), n.vertex(2, 3), n.vertex(1, 4)}
+	coordinates := func(vertices []graph.Vertex) []geo.Coordinate {
+		result := []geo.Coordinate(nil)
+		for _, v := range vertices {
+			result = append(result, n.Points[v])
+		}
+		return result
+	}
+	planner := &TablePlanner{
+		Graph:        g,
+		KdTree:       trees,
+		Sources:      coordinates(sources),
+		Destinations: coordinates(destinations),
+		Transport:    graph.Car,
+		Metrics:      []graph.Metric{graph.Distance, graph.Time},
+	}
+	table := planner.Run()
+
+	for _, m := range planner.Metrics {
+		matrix := table.Distances
+		if m == graph.Time {
+			matrix = table.Durations
+		}
+		for i, u := range sources {
+			for j, v := range destinations {
+				expected := MetricValue(m, n.distance(u, v, graph.Car, m))
+				if d := matrix[i][j] - expected; d < -1 || d > 1 {
+					t.Errorf("%v from %d to %d: got %d, expected %d", m, u, v, matrix[i][j], expected)
+				}
+			}
+		}
+	}
+	// The oneway leads to a detour.
+	if table.Distances[2][1] < 200 {
+		t.Errorf("got distance %d along the oneway", table.Distances[2][1])
+	}
+}
+
+func TestTablePlannerNoRoute(t *testing.T) {
+	// The last column is only reachable over a oneway.
+	n := gridNetwork(1, 6, 3)
+	n.Edges[n.edge(n.vertex(0, 4), n.vertex(0, 5))].Oneway = true
+	g, trees := n.ClusterGraph()
+	planner := &TablePlanner{
+		Graph:        g,
+		KdTree:       trees,
+		Sources:      []geo.Coordinate{n.Points[n.vertex(0, 5)]},
+		Destinations: []geo.Coordinate{n.Points[n.vertex(0, 0)], n.Points[n.vertex(0, 5)]},
+		Transport:    graph.Car,
+		Metrics:      []graph.Metric{graph.Distance},
+	}
+	table := planner.Run()
+	if table.Distances[0][0] != NoRoute || table.Distances[0][1] != 0 {
+		t.Errorf("got %v, expected no route and 0", table.Distances[0])
+	}
+}
+
+func TestTablePlannerCancel(t *testing.T) {
+	n := gridNetwork(3, 6, 3)
+	g, trees := n.ClusterGraph()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	planner := &TablePlanner{
+		Graph:        g,
+		KdTree:       trees,
+		Sources:      []geo.Coordinate{n.Points[n.vertex(0, 0)]},
+		Destinations: []geo.Coordinate{n.Points[n.vertex(2, 5)]},
+		Transport:    graph.Car,
+		Metrics:      []graph.Metric{graph.Distance},
+		Context:      ctx,
+	}
+	table := planner.Run()
+	if planner.Err() != context.Canceled {
+		t.Errorf("got error %v, expected the cancellation", planner.Err())
+	}
+	if table.Distances[0][0] != NoRoute {
+		t.Errorf("got distance %d after the cancellation", table.Distances[0][0])
+	}
+}
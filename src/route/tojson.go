@@ -17,38 +17,19 @@
 package route
 
 import (
-	"fmt"
 	"geo"
 	"graph"
+	"kdtree"
 )
 
 // Returns a human readable string for the given distance value.
 func FormatDistance(distance float64) Distance {
-	switch {
-	case distance < 0.5:
-		// Yes, this is a gag. Why do you even have to ask?
-		t := fmt.Sprintf("%.2f mm", distance*1000.0)
-		return Distance{t, int(distance)}
-	case distance < 500.0:
-		t := fmt.Sprintf("%.2f m", distance)
-		return Distance{t, int(distance)}
-	}
-	t := fmt.Sprintf("%.2f km", distance/1000.0)
-	return Distance{t, int(distance)}
+	return DefaultLocale.FormatDistance(distance)
 }
 
 // Returns a human readable formatting for the given time-span.
 func FormatDuration(seconds float64) Duration {
-	switch {
-	case seconds < 30.0:
-		t := fmt.Sprintf("%.2f secs", seconds)
-		return Duration{t, int(seconds)}
-	case seconds < 1800.0:
-		t := fmt.Sprintf("%.2f mins", seconds/60.0)
-		return Duration{t, int(seconds)}
-	}
-	t := fmt.Sprintf("%.2f hours", seconds/3600.0)
-	return Duration{t, int(seconds)}
+	return DefaultLocale.FormatDuration(seconds)
 }
 
 // Convert from geo.Coordinate to a Point.
@@ -91,98 +72,116 @@ func (r *RoutePlanner) PartwayToStep(steps []geo.Coordinate, start, stop geo.Coo
 		StartLocation: StepToPoint(start),
 		EndLocation:   StepToPoint(stop),
 		Polyline:      StepsToPolyline(steps, start, stop),
+		length:        length,
+		seconds:       duration,
 	}
 }
 
 // Convert a Path (start - steps - stop) into a json Step structure.
 // This contains some additional information, which might or might
-// not be accurate.
-func (r *RoutePlanner) WayToStep(steps graph.Way, start, stop geo.Coordinate) Step {
-	return r.PartwayToStep(steps.Steps, start, stop, 0)
+// not be accurate. The way is part of the edge at location l.
+func (r *RoutePlanner) WayToStep(l kdtree.Location, steps graph.Way, start, stop geo.Coordinate) Step {
+	step := r.PartwayToStep(steps.Steps, start, stop, 0)
+	if edge := l.Edge(); int(edge) != -1 {
+		step.Name = l.Graph.EdgeName(edge)
+		step.Ref = l.Graph.EdgeRef(edge)
+		step.roundabout = l.Graph.EdgeRoundabout(edge)
+	}
+	return step
 }
 
-// Convert an Edge (u,v) into a json Step
-func (r *RoutePlanner) EdgeToStep(g graph.Graph, edge graph.Edge, u, v graph.Vertex) Step {
+// Convert an Edge (u,v) into a json Step. The graph g is the given
+// cluster, or the overlay graph if cluster == -1.
+func (r *RoutePlanner) EdgeToStep(g graph.Graph, cluster int, edge graph.Edge, u, v graph.Vertex) Step {
 	step := g.EdgeSteps(edge, u, nil)
 	upos := g.VertexCoordinate(u)
 	vpos := g.VertexCoordinate(v)
 	speed := g.EdgeMaxSpeed(edge)
-	return r.PartwayToStep(step, upos, vpos, speed)
+	result := r.PartwayToStep(step, upos, vpos, speed)
+	result.Name = g.EdgeName(edge)
+	result.Ref = g.EdgeRef(edge)
+	result.roundabout = g.EdgeRoundabout(edge)
+	result.degree, result.exits = r.junction(cluster, u)
+	return result
 }
 
-func Orientation(p, q, r Point) string {
-	s := (q[0]-p[0])*(r[1]-p[1]) - (q[1]-p[1])*(r[0]-p[0])
-	if s < 1e-9 && s > -1e-9 {
-		return "Continue straightforward"
-	}
-	if s > 0 {
-		return "Turn right"
+// Add the cost of the turn from the state s onto the edge e and the delay
+// at the start of e to the duration of the step, see graph.TurnCost and
+// graph.VertexDelay.
+func (r *RoutePlanner) addTurnCost(step *Step, g *graph.GraphFile, s graph.Vertex, e graph.Edge) {
+	u := g.StateVertex(s)
+	seconds := g.TurnCost(g.StateEdge(s), u, e, r.Transport)
+	r.addSeconds(step, seconds+g.VertexDelay(u, r.Transport))
+}
+
+func (r *RoutePlanner) addSeconds(step *Step, seconds float64) {
+	if seconds > 0 {
+		step.seconds += seconds
+		step.Duration = FormatDuration(step.seconds)
 	}
-	return "Turn left"
 }
 
-// Assemble a sequence of Steps into a Leg.
-func (r *RoutePlanner) StepsToLeg(status string, steps []Step, start, stop graph.Way, startc, stopc geo.Coordinate) Leg {
-	// Determine the number of steps on this path.
-	var startPoint, endPoint Point
-	totalSteps := len(steps)
-	if start.Length > 1e-7 {
-		totalSteps++
+// Adjusts the duration of a step on an edge with a conditional maxspeed which
+// applies at the given moment. Like PartwayToStep, this only matters for cars.
+func (r *RoutePlanner) addConditionalSpeed(step *Step, g *graph.GraphFile, e graph.Edge, at graph.Moment) {
+	if r.Transport != graph.Car || at == graph.Static {
+		return
 	}
-	if stop.Length > 1e-7 {
-		totalSteps++
+	speed := g.EdgeMaxSpeedAt(e, r.Transport, at)
+	static := g.EdgeMaxSpeed(e)
+	if speed == static || speed <= 0 || static <= 0 {
+		return
 	}
-	fullsteps := make([]Step, totalSteps)
+	step.seconds *= float64(static) / float64(speed)
+	step.Duration = FormatDuration(step.seconds)
+}
 
-	distance := 0
-	duration := 0
+// Returns "name (ref)", or just the name or ref if the other one is missing.
+func StreetName(name, ref string) string {
+	switch {
+	case name == "":
+		return ref
+	case ref == "":
+		return name
+	}
+	return name + " (" + ref + ")"
+}
+
+// Assemble a sequence of Steps into a Leg.
+func (r *RoutePlanner) StepsToLeg(status string, steps []Step, src, dst kdtree.Location, start, stop graph.Way, startc, stopc geo.Coordinate) Leg {
+	fullsteps := make([]Step, 0, len(steps)+2)
 
 	// Add the initial step, if present
-	i := 0
 	if start.Length > 1e-7 {
 		// Our implementation of Dijkstra's algorithm ensures len(vertices) > 0
-		step := r.WayToStep(start, start.Target, startc)
-		distance += step.Distance.Value
-		duration += step.Duration.Value
-		fullsteps[i] = step
-		i++
+		fullsteps = append(fullsteps, r.WayToStep(src, start, start.Target, startc))
 	}
 
 	// Add the intermediate steps
-	for _, step := range steps {
-		if i > 0 {
-			step.Instruction = Orientation(fullsteps[i-1].StartLocation, fullsteps[i-1].EndLocation, step.EndLocation)
-		}
-		distance += step.Distance.Value
-		duration += step.Duration.Value
-		fullsteps[i] = step
-		i++
-	}
+	fullsteps = append(fullsteps, steps...)
 
 	// Add the final step, if present
 	if stop.Length > 1e-7 {
-		step := r.WayToStep(stop, stopc, stop.Target)
-		if i > 0 {
-			step.Instruction = Orientation(fullsteps[i-1].StartLocation, fullsteps[i-1].EndLocation, step.EndLocation)
-		}
-		distance += step.Distance.Value
-		duration += step.Duration.Value
-		fullsteps[i] = step
-		i++
+		step := r.WayToStep(dst, stop, stopc, stop.Target)
+		step.degree, step.exits = r.junction(dst.Cluster, stop.Vertex)
+		// The route passes through the last vertex, see wayWeight.
+		r.addSeconds(&step, dst.Graph.VertexDelay(stop.Vertex, r.Transport))
+		fullsteps = append(fullsteps, step)
 	}
 
-	if totalSteps > 0 {
-		fullsteps[0].Instruction = "Start your journey"
+	distance := 0
+	duration := 0
+	for _, step := range fullsteps {
+		distance += step.Distance.Value
+		duration += step.Duration.Value
 	}
-	startPoint = StepToPoint(start.Target)
-	endPoint = StepToPoint(stop.Target)
 
 	return Leg{
 		Status:        status,
 		Distance:      FormatDistance(float64(distance)),
 		Duration:      FormatDuration(float64(duration)),
-		StartLocation: startPoint,
-		EndLocation:   endPoint,
-		Steps:         fullsteps,
+		StartLocation: StepToPoint(start.Target),
+		EndLocation:   StepToPoint(stop.Target),
+		Steps:         MergeSteps(fullsteps),
 	}
 }
@@ -0,0 +1,345 @@
+/*
+ * Copyright 2014 Florian Benz, Steven Schäfer, Bernhard Schommer
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Trips: visit all waypoints in the cheapest order
+//
+// We compute the table between all waypoints and solve the resulting
+// (asymmetric) travelling salesman problem. Open trips are reduced to
+// round trips by adding a dummy vertex between the end and the start of the
+// trip. Small instances are solved exactly with the Held-Karp dynamic
+// program, larger ones with a nearest neighbor tour improved by 2-opt and
+// Or-opt moves.
+
+package route
+
+import (
+	"context"
+	"geo"
+	"graph"
+	"kdtree"
+	"math"
+)
+
+const (
+	// Instances with at most this many vertices (including the dummy vertex)
+	// are solved exactly.
+	MaxExactTrip = 12
+
+	// Cost of a forbidden or impossible transition
+	tripInfinity = 1e12
+)
+
+type TripResult struct {
+	*Result
+	// Index of the input waypoint for every waypoint of the route.
+	WaypointOrder []int `json:"waypoint_order"`
+}
+
+type TripPlanner struct {
+	// Underlying graph structure
+	Graph  *graph.ClusterGraph
+	KdTree *kdtree.ClusterKdTree
+	// User input
+	Waypoints []geo.Coordinate
+	// Graph setting
+	Transport graph.Transport
+	Metric    graph.Metric
+	// Trip options. A round trip starts and ends at the first waypoint.
+	// Otherwise, FixedStart and FixedEnd keep the first respectively last
+	// waypoint in place.
+	RoundTrip  bool
+	FixedStart bool
+	FixedEnd   bool
+	// Planner options
+	ConcurrentKd   bool
+	ConcurrentRows bool
+	ConcurrentLegs bool
+	// Optional, the computation stops as soon as the context is done, see Err.
+	Context context.Context
+}
+
+// Err returns the error of the context if the computation was stopped, the
+// result of Run is incomplete in this case.
+func (p *TripPlanner) Err() error {
+	return contextErr(p.Context)
+}
+
+func (p *TripPlanner) Run() *TripResult {
+	table := &TablePlanner{
+		Graph:          p.Graph,
+		KdTree:         p.KdTree,
+		Sources:        p.Waypoints,
+		Destinations:   p.Waypoints,
+		Transport:      p.Transport,
+		Metrics:        []graph.Metric{p.Metric},
+		ConcurrentKd:   p.ConcurrentKd,
+		ConcurrentRows: p.ConcurrentRows,
+		Context:        p.Context,
+	}
+	result := table.Run()
+	matrix := result.Durations
+	if p.Metric == graph.Distance {
+		matrix = result.Distances
+	}
+
+	order := SolveTrip(tripCosts(matrix), p.RoundTrip, p.FixedStart, p.FixedEnd)
+	if p.RoundTrip {
+		order = append(order, order[0])
+	}
+
+	waypoints := make([]geo.Coordinate, len(order))
+	locations := make([]kdtree.Location, len(order))
+	for i, j := range order {
+		waypoints[i] = p.Waypoints[j]
+		locations[i] = table.SourceLocations[j]
+	}
+	planner := &RoutePlanner{
+		Graph:          p.Graph,
+		KdTree:         p.KdTree,
+		Waypoints:      waypoints,
+		Transport:      p.Transport,
+		Metric:         p.Metric,
+		ConcurrentLegs: p.ConcurrentLegs,
+		Context:        p.Context,
+		Locations:      locations,
+	}
+	return &TripResult{
+		Result:        planner.Run(),
+		WaypointOrder: order,
+	}
+}
+
+func tripCosts(matrix [][]int) [][]float64 {
+	costs := make([][]float64, len(matrix))
+	for i, row := range matrix {
+		costs[i] = make([]float64, len(row))
+		for j, value := range row {
+			if value == NoRoute {
+				costs[i][j] = tripInfinity
+			} else {
+				costs[i][j] = float64(value)
+			}
+		}
+	}
+	return costs
+}
+
+// SolveTrip returns the order in which to visit the vertices 0..n-1 given
+// the cost matrix. For round trips the returned order starts at vertex 0
+// and the return to it is implicit.
+func SolveTrip(costs [][]float64, roundTrip, fixedStart, fixedEnd bool) []int {
+	n := len(costs)
+	if n <= 2 {
+		order := make([]int, n)
+		for i := range order {
+			order[i] = i
+		}
+		return order
+	}
+
+	// Add a dummy vertex (with index n) between the end and the start.
+	m := n
+	if !roundTrip {
+		m = n + 1
+	}
+	cost := make([][]float64, m)
+	for i := range cost {
+		cost[i] = make([]float64, m)
+		for j := range cost[i] {
+			switch {
+			case i < n && j < n:
+				cost[i][j] = costs[i][j]
+			case i == j:
+				cost[i][j] = 0
+			case j == n:
+				// from i to the dummy vertex: i is the end of the trip
+				if fixedEnd && i != n-1 {
+					cost[i][j] = tripInfinity
+				}
+			default:
+				// from the dummy vertex to j: j is the start of the trip
+				if fixedStart && j != 0 {
+					cost[i][j] = tripInfinity
+				}
+			}
+		}
+	}
+
+	var tour []int
+	if m <= MaxExactTrip {
+		tour = heldKarp(cost)
+	} else {
+		tour = nearestNeighborTour(cost)
+		for improveTwoOpt(cost, tour) || improveOrOpt(cost, tour) {
+		}
+	}
+
+	// Rotate the tour such that it starts at vertex 0 (round trip) or after
+	// the dummy vertex (open trip).
+	first := 0
+	for i, v := range tour {
+		if (roundTrip && v == 0) || (!roundTrip && v == n) {
+			first = i
+		}
+	}
+	if !roundTrip {
+		first++
+	}
+	order := make([]int, 0, n)
+	for i := 0; i < m; i++ {
+		v := tour[(first+i)%m]
+		if v != n {
+			order = append(order, v)
+		}
+	}
+	return order
+}
+
+func tourCost(cost [][]float64, tour []int) float64 {
+	total := 0.0
+	for i := range tour {
+		total += cost[tour[i]][tour[(i+1)%len(tour)]]
+	}
+	return total
+}
+
+// Exact solution of the travelling salesman problem in O(2^n n^2).
+func heldKarp(cost [][]float64) []int {
+	n := len(cost)
+	subsets := 1 << uint(n-1)
+	// dist[S][j]: shortest path from 0 visiting the vertices in S (shifted
+	// by one, vertex 0 is not part of S) and ending in j.
+	dist := make([][]float64, subsets)
+	parent := make([][]int, subsets)
+	for s := range dist {
+		dist[s] = make([]float64, n)
+		parent[s] = make([]int, n)
+		for j := range dist[s] {
+			dist[s][j] = math.Inf(1)
+		}
+	}
+	for j := 1; j < n; j++ {
+		dist[1<<uint(j-1)][j] = cost[0][j]
+	}
+	for s := 1; s < subsets; s++ {
+		for j := 1; j < n; j++ {
+			bit := 1 << uint(j-1)
+			if s&bit == 0 || math.IsInf(dist[s][j], 1) {
+				continue
+			}
+			for k := 1; k < n; k++ {
+				kbit := 1 << uint(k-1)
+				if s&kbit != 0 {
+					continue
+				}
+				if d := dist[s][j] + cost[j][k]; d < dist[s|kbit][k] {
+					dist[s|kbit][k] = d
+					parent[s|kbit][k] = j
+				}
+			}
+		}
+	}
+
+	all := subsets - 1
+	last, best := 1, math.Inf(1)
+	for j := 1; j < n; j++ {
+		if d := dist[all][j] + cost[j][0]; d < best {
+			best = d
+			last = j
+		}
+	}
+	tour := make([]int, n)
+	s := all
+	for i := n - 1; i > 0; i-- {
+		tour[i] = last
+		prev := parent[s][last]
+		s &^= 1 << uint(last-1)
+		last = prev
+	}
+	tour[0] = 0
+	return tour
+}
+
+func nearestNeighborTour(cost [][]float64) []int {
+	n := len(cost)
+	visited := make([]bool, n)
+	tour := []int{0}
+	visited[0] = true
+	for len(tour) < n {
+		curr := tour[len(tour)-1]
+		next, best := -1, math.Inf(1)
+		for j := 0; j < n; j++ {
+			if !visited[j] && cost[curr][j] < best {
+				next, best = j, cost[curr][j]
+			}
+		}
+		visited[next] = true
+		tour = append(tour, next)
+	}
+	return tour
+}
+
+// Reverse a segment of the tour if this makes the tour cheaper. Since the
+// costs are asymmetric we have to recompute the cost of the whole segment.
+func improveTwoOpt(cost [][]float64, tour []int) bool {
+	n := len(tour)
+	improved := false
+	for i := 1; i < n-1; i++ {
+		for j := i + 1; j < n; j++ {
+			before := tourCost(cost, tour)
+			reverseTour(tour[i : j+1])
+			if tourCost(cost, tour) < before-1e-9 {
+				improved = true
+			} else {
+				reverseTour(tour[i : j+1])
+			}
+		}
+	}
+	return improved
+}
+
+// Move a segment of up to three vertices to a different position if this
+// makes the tour cheaper.
+func improveOrOpt(cost [][]float64, tour []int) bool {
+	n := len(tour)
+	for length := 1; length <= 3; length++ {
+		for i := 1; i+length <= n; i++ {
+			before := tourCost(cost, tour)
+			segment := append([]int(nil), tour[i:i+length]...)
+			rest := append(append([]int(nil), tour[:i]...), tour[i+length:]...)
+			for j := 1; j <= len(rest); j++ {
+				if j == i {
+					continue
+				}
+				candidate := make([]int, 0, n)
+				candidate = append(candidate, rest[:j]...)
+				candidate = append(candidate, segment...)
+				candidate = append(candidate, rest[j:]...)
+				if tourCost(cost, candidate) < before-1e-9 {
+					copy(tour, candidate)
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func reverseTour(tour []int) {
+	for i, j := 0, len(tour)-1; i < j; i, j = i+1, j-1 {
+		tour[i], tour[j] = tour[j], tour[i]
+	}
+}
@@ -0,0 +1,127 @@
+/*
+ * Copyright 2014 Florian Benz, Steven Schäfer, Bernhard Schommer
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package route
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func randomCosts(n int) [][]float64 {
+	costs := make([][]float64, n)
+	for i := range costs {
+		costs[i] = make([]float64, n)
+		for j := range costs[i] {
+			if i != j {
+				costs[i][j] = float64(rand.Intn(1000) + 1)
+			}
+		}
+	}
+	return costs
+}
+
+func orderCost(costs [][]float64, order []int, roundTrip bool) float64 {
+	total := 0.0
+	for i := 0; i+1 < len(order); i++ {
+		total += costs[order[i]][order[i+1]]
+	}
+	if roundTrip {
+		total += costs[order[len(order)-1]][order[0]]
+	}
+	return total
+}
+
+// Enumerate all orders satisfying the constraints.
+func bruteForceTrip(costs [][]float64, roundTrip, fixedStart, fixedEnd bool) float64 {
+	n := len(costs)
+	best := math.Inf(1)
+	order := make([]int, n)
+	used := make([]bool, n)
+	var rec func(k int)
+	rec = func(k int) {
+		if k == n {
+			if !roundTrip && fixedEnd && order[n-1] != n-1 {
+				return
+			}
+			if c := orderCost(costs, order, roundTrip); c < best {
+				best = c
+			}
+			return
+		}
+		for v := 0; v < n; v++ {
+			if used[v] || (k == 0 && (roundTrip || fixedStart) && v != 0) {
+				continue
+			}
+			used[v] = true
+			order[k] = v
+			rec(k + 1)
+			used[v] = false
+		}
+	}
+	rec(0)
+	return best
+}
+
+func checkOrder(t *testing.T, order []int, n int, roundTrip, fixedStart, fixedEnd bool) {
+	if len(order) != n {
+		t.Fatalf("Expected %v waypoints, got %v.", n, order)
+	}
+	seen := make([]bool, n)
+	for _, v := range order {
+		if seen[v] {
+			t.Fatalf("Waypoint %v visited twice in %v.", v, order)
+		}
+		seen[v] = true
+	}
+	if (roundTrip || fixedStart) && order[0] != 0 {
+		t.Errorf("Order %v does not start at the first waypoint.", order)
+	}
+	if !roundTrip && fixedEnd && order[n-1] != n-1 {
+		t.Errorf("Order %v does not end at the last waypoint.", order)
+	}
+}
+
+func TestSolveTripExact(t *testing.T) {
+	for i := 0; i < NumTests; i++ {
+		n := rand.Intn(6) + 3
+		costs := randomCosts(n)
+		roundTrip := rand.Intn(2) == 0
+		fixedStart := rand.Intn(2) == 0
+		fixedEnd := rand.Intn(2) == 0
+
+		order := SolveTrip(costs, roundTrip, fixedStart, fixedEnd)
+		checkOrder(t, order, n, roundTrip, fixedStart, fixedEnd)
+		expected := bruteForceTrip(costs, roundTrip, fixedStart, fixedEnd)
+		if c := orderCost(costs, order, roundTrip); c != expected {
+			t.Errorf("Order %v has cost %v, optimum is %v.", order, c, expected)
+		}
+	}
+}
+
+func TestSolveTripHeuristic(t *testing.T) {
+	for i := 0; i < 10; i++ {
+		n := rand.Intn(40) + MaxExactTrip
+		costs := randomCosts(n)
+		roundTrip := rand.Intn(2) == 0
+		fixedStart := rand.Intn(2) == 0
+		fixedEnd := rand.Intn(2) == 0
+
+		order := SolveTrip(costs, roundTrip, fixedStart, fixedEnd)
+		checkOrder(t, order, n, roundTrip, fixedStart, fixedEnd)
+	}
+}
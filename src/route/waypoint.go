@@ -0,0 +1,175 @@
+/*
+ * Copyright 2014 Florian Benz, Steven Schäfer, Bernhard Schommer
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Waypoint options
+//
+// A waypoint may restrict the roads it is snapped to by a maximum distance
+// (radius) and by the direction of travel (bearing). With a bearing we only
+// leave a waypoint and only arrive at it in the given direction. Via
+// waypoints are visited like all others, but they do not start a new leg.
+
+package route
+
+import (
+	"fmt"
+	"geo"
+	"graph"
+	"kdtree"
+	"math"
+	"time"
+)
+
+const (
+	// Number of candidates considered when snapping a waypoint with options
+	SnapCandidates = 10
+)
+
+type WaypointOptions struct {
+	// Direction of travel in degrees clockwise from north and the allowed
+	// deviation. There is no constraint if BearingRange <= 0.
+	Bearing      int
+	BearingRange int
+	// Maximum distance in meter to the road, there is no limit if Radius <= 0.
+	Radius float64
+	// Pass through the waypoint without starting a new leg.
+	Via bool
+}
+
+// The waypoint with the given index could not be snapped to a road which
+// satisfies its options.
+type SnapError struct {
+	Waypoint int
+}
+
+func (e *SnapError) Error() string {
+	return fmt.Sprintf("no matching road found for waypoint %d", e.Waypoint)
+}
+
+func (r *RoutePlanner) options(i int) WaypointOptions {
+	if i < len(r.Options) {
+		return r.Options[i]
+	}
+	return WaypointOptions{}
+}
+
+// Snap computes the locations of all waypoints. If a waypoint cannot be
+// snapped within its options, we return a SnapError and fall back to the
+// closest location.
+func (r *RoutePlanner) Snap() error {
+	defer r.Stats.since(&r.Stats.Snapping, time.Now())
+	count := len(r.Waypoints)
+	r.Locations = make([]kdtree.Location, count)
+	errors := make([]error, count)
+	Multiplex(count, r.ConcurrentKd, func(i int) {
+		r.Locations[i], errors[i] = r.snap(i)
+	})
+	for _, err := range errors {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *RoutePlanner) snap(i int) (kdtree.Location, error) {
+	x := r.Waypoints[i]
+	options := r.options(i)
+	if options.Radius <= 0 && options.BearingRange <= 0 {
+		return r.KdTree.NearestNeighbor(x, r.Transport), nil
+	}
+
+	// The last waypoint is only used as a destination.
+	forward := i < len(r.Waypoints)-1
+	buf := []geo.Coordinate(nil)
+	for _, n := range r.KdTree.KNearestNeighbors(x, r.Transport, SnapCandidates) {
+		if options.Radius > 0 && n.Distance > options.Radius {
+			break
+		}
+		ways := n.Location.Decode(forward, r.Transport, &buf)
+		if len(filterWays(n.Location, ways, options, forward)) > 0 {
+			return n.Location, nil
+		}
+	}
+	return r.KdTree.NearestNeighbor(x, r.Transport), &SnapError{i}
+}
+
+// The direction of travel on the way at the position of the location.
+// Forward ways lead from the location to way.Vertex, backward ways the
+// other way around.
+func wayBearing(l kdtree.Location, way graph.Way, forward bool) float64 {
+	vertex := l.Graph.VertexCoordinate(way.Vertex)
+	if forward {
+		next := vertex
+		if len(way.Steps) > 0 {
+			next = way.Steps[0]
+		}
+		return Bearing(StepToPoint(way.Target), StepToPoint(next))
+	}
+	prev := vertex
+	if len(way.Steps) > 0 {
+		prev = way.Steps[len(way.Steps)-1]
+	}
+	return Bearing(StepToPoint(prev), StepToPoint(way.Target))
+}
+
+// Returns the ways which satisfy the bearing constraint.
+func filterWays(l kdtree.Location, ways []graph.Way, options WaypointOptions, forward bool) []graph.Way {
+	if options.BearingRange <= 0 || l.IsVertex() {
+		return ways
+	}
+	result := []graph.Way(nil)
+	for _, way := range ways {
+		bearing := wayBearing(l, way, forward)
+		deviation := math.Abs(TurnAngleBetween(float64(options.Bearing), bearing))
+		if way.Length == 0 || deviation <= float64(options.BearingRange) {
+			result = append(result, way)
+		}
+	}
+	return result
+}
+
+// Merge every leg which ends at a via waypoint with the following leg.
+func (r *RoutePlanner) mergeViaLegs(legs []Leg) []Leg {
+	result := []Leg{legs[0]}
+	for i := 1; i < len(legs); i++ {
+		if !r.options(i).Via {
+			result = append(result, legs[i])
+			continue
+		}
+		leg := &result[len(result)-1]
+		next := legs[i]
+		if next.Status != StatusOk {
+			leg.Status = next.Status
+		}
+
+		// The depart maneuver of the next leg becomes a normal turn.
+		if len(leg.Steps) > 0 && len(next.Steps) > 0 {
+			last := leg.Steps[len(leg.Steps)-1]
+			first := &next.Steps[0]
+			sameStreet := first.Name == last.Name && first.Ref == last.Ref
+			before := endBearing(last.Polyline)
+			after := startBearing(first.Polyline)
+			first.Maneuver = turnManeuver(sameStreet, before, after)
+			first.Instruction = DefaultLocale.Instruction(first.Maneuver, first.Name, first.Ref)
+		}
+
+		leg.Steps = append(leg.Steps, next.Steps...)
+		leg.Distance = FormatDistance(float64(leg.Distance.Value + next.Distance.Value))
+		leg.Duration = FormatDuration(float64(leg.Duration.Value + next.Duration.Value))
+		leg.EndLocation = next.EndLocation
+	}
+	return result
+}
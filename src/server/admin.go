@@ -0,0 +1,277 @@
+/*
+ * Copyright 2014 Florian Benz, Steven Schäfer, Bernhard Schommer
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Graceful shutdown and the admin API
+//
+// The admin API is served on a separate listener, either a TCP address
+// (-admin localhost:23402) or a unix socket (-admin unix:/path/to/socket),
+// so that it is never reachable through the public port. Every request has
+// to carry the token from the file given by -admintoken in the header
+//   Authorization: Bearer <token>
+// The following commands are available:
+//   POST /shutdown     graceful shutdown, same as SIGTERM
+//   POST /reload       reload the graph, same as SIGHUP, an optional
+//                      parameter dir loads another graph directory
+//   POST /cache/flush  remove all cached responses
+//   GET  /stats        server statistics as JSON object
+
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+const (
+	// Time in-flight requests have to finish during a shutdown
+	ShutdownTimeout = 60 * time.Second
+
+	AdminUnixPrefix = "unix:"
+)
+
+var (
+	// Closed as soon as the server should shut down
+	shutdownChan = make(chan struct{})
+	shutdownOnce sync.Once
+
+	requestsActive int64
+	requestsTotal  int64
+)
+
+type Stats struct {
+	StartupTime    time.Time `json:"startup_time"`
+	GraphDir       string    `json:"graph_dir"`
+	GraphLoaded    time.Time `json:"graph_loaded"`
+	UptimeSeconds  int64     `json:"uptime_seconds"`
+	RequestsActive int64     `json:"requests_active"`
+	RequestsTotal  int64     `json:"requests_total"`
+	CacheEnabled   bool      `json:"cache_enabled"`
+	CacheEntries   int       `json:"cache_entries"`
+	CacheSize      int       `json:"cache_size"`
+	CacheMaxSize   int       `json:"cache_max_size"`
+	Goroutines     int       `json:"goroutines"`
+	HeapAlloc      uint64    `json:"heap_alloc"`
+	HeapSys        uint64    `json:"heap_sys"`
+}
+
+// Shutdown initiates a graceful shutdown. It may be called more than once.
+func Shutdown() {
+	shutdownOnce.Do(func() {
+		close(shutdownChan)
+	})
+}
+
+// serve runs the public server and, if configured, the admin server until
+// SIGTERM, SIGINT or an admin shutdown command. In-flight requests are
+// drained before serve returns. SIGHUP reloads the graph.
+func serve(addr string) error {
+	server := &http.Server{Addr: addr, Handler: instrument(http.DefaultServeMux)}
+
+	var admin *http.Server
+	if FlagAdmin != "" {
+		listener, err := adminListener(FlagAdmin)
+		if err != nil {
+			return err
+		}
+		token, err := readAdminToken(FlagAdminToken)
+		if err != nil {
+			listener.Close()
+			return err
+		}
+		admin = &http.Server{Handler: adminHandler(token)}
+		go func() {
+			if err := admin.Serve(listener); err != http.ErrServerClosed {
+				log.Println("Admin server: ", err)
+			}
+		}()
+		log.Println("Admin API on", FlagAdmin)
+	}
+
+	go reloadOnSignal()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	stopped := make(chan struct{})
+	go func() {
+		select {
+		case s := <-signals:
+			log.Println("Received", s)
+		case <-shutdownChan:
+			log.Println("Shutdown requested")
+		}
+		log.Println("Draining in-flight requests...")
+		ctx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+		if err := server.Shutdown(ctx); err != nil {
+			log.Println("Shutdown: ", err)
+		}
+		if admin != nil {
+			admin.Shutdown(ctx)
+		}
+		cancel()
+		close(stopped)
+	}()
+
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	<-stopped
+	signal.Stop(signals)
+
+	// Handlers which are still running after the shutdown timeout drop
+	// their log entries.
+	CloseLogger()
+	return nil
+}
+
+// adminListener listens on a TCP address or, with the prefix "unix:", on a
+// unix socket which is only accessible by the owner.
+func adminListener(addr string) (net.Listener, error) {
+	if !strings.HasPrefix(addr, AdminUnixPrefix) {
+		return net.Listen("tcp", addr)
+	}
+	path := strings.TrimPrefix(addr, AdminUnixPrefix)
+	// remove a stale socket of a previous run
+	if fi, err := os.Stat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		os.Remove(path)
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+// readAdminToken reads the token from the given file, leading and trailing
+// white space is ignored.
+func readAdminToken(filename string) (string, error) {
+	if filename == "" {
+		return "", errors.New("the admin API requires a token file (-admintoken)")
+	}
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return "", err
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", errors.New("empty admin token in " + filename)
+	}
+	return token, nil
+}
+
+func adminHandler(token string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/shutdown", adminShutdown)
+	mux.HandleFunc("/reload", adminReload)
+	mux.HandleFunc("/cache/flush", adminFlushCache)
+	mux.HandleFunc("/stats", adminStats)
+
+	expected := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		actual := []byte(r.Header.Get("Authorization"))
+		if subtle.ConstantTimeCompare(actual, expected) != 1 {
+			http.Error(w, "invalid token", http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+func adminShutdown(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "only POST is supported", http.StatusMethodNotAllowed)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+	w.Write([]byte("shutting down\n"))
+	Shutdown()
+}
+
+func adminReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "only POST is supported", http.StatusMethodNotAllowed)
+		return
+	}
+	dir := r.URL.Query().Get("dir")
+	if dir == "" {
+		dir = FlagDir
+	}
+	if err := Reload(dir); err != nil {
+		http.Error(w, "reload failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Write([]byte("reloaded " + dir + "\n"))
+}
+
+func adminFlushCache(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "only POST is supported", http.StatusMethodNotAllowed)
+		return
+	}
+	if !FlagCaching {
+		http.Error(w, "caching is disabled", http.StatusConflict)
+		return
+	}
+	cache.Flush()
+	w.Write([]byte("cache flushed\n"))
+}
+
+func adminStats(w http.ResponseWriter, r *http.Request) {
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+	data := AcquireDataset()
+	data.Release()
+	stats := Stats{
+		StartupTime:    startupTime,
+		GraphDir:       data.Dir,
+		GraphLoaded:    data.Loaded,
+		UptimeSeconds:  int64(time.Now().Sub(startupTime).Seconds()),
+		RequestsActive: atomic.LoadInt64(&requestsActive),
+		RequestsTotal:  atomic.LoadInt64(&requestsTotal),
+		CacheEnabled:   FlagCaching,
+		CacheMaxSize:   FlagCacheSize * 1024 * 1024,
+		Goroutines:     runtime.NumGoroutine(),
+		HeapAlloc:      memStats.HeapAlloc,
+		HeapSys:        memStats.HeapSys,
+	}
+	if FlagCaching {
+		stats.CacheEntries, stats.CacheSize = cache.Stats()
+	}
+	jsonResult, err := json.Marshal(stats)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", ContentTypeJSON)
+	w.Write(jsonResult)
+}
@@ -0,0 +1,208 @@
+/*
+ * Copyright 2014 Florian Benz, Steven Schäfer, Bernhard Schommer
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// An HTTP client which connects to the unix socket at path.
+func unixClient(path string) *http.Client {
+	return &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", path)
+		},
+	}}
+}
+
+func adminRequest(handler http.Handler, method, url, authorization string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(method, url, nil)
+	if authorization != "" {
+		request.Header.Set("Authorization", authorization)
+	}
+	handler.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestAdminToken(t *testing.T) {
+	defer func(old bool) { FlagCaching = old }(FlagCaching)
+	FlagCaching = false
+
+	handler := adminHandler("secret")
+	for authorization, status := range map[string]int{
+		"":              http.StatusUnauthorized,
+		"secret":        http.StatusUnauthorized,
+		"Bearer":        http.StatusUnauthorized,
+		"Bearer wrong":  http.StatusUnauthorized,
+		"Bearer secret": http.StatusConflict, // caching is disabled
+	} {
+		recorder := adminRequest(handler, "POST", "http://x.de/cache/flush", authorization)
+		if recorder.Code != status {
+			t.Errorf("Authorization %q: got status %d, expected %d", authorization, recorder.Code, status)
+		}
+	}
+}
+
+func TestAdminFlushCache(t *testing.T) {
+	defer func(caching bool, c *Cache) { FlagCaching, cache = caching, c }(FlagCaching, cache)
+	FlagCaching = true
+	InitCache()
+	CachePut("a", []byte("response"))
+
+	handler := adminHandler("secret")
+	if recorder := adminRequest(handler, "GET", "http://x.de/cache/flush", "Bearer secret"); recorder.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET: got status %d", recorder.Code)
+	}
+	if _, ok := CacheGet("a"); !ok {
+		t.Fatalf("cache was flushed by a GET request")
+	}
+	if recorder := adminRequest(handler, "POST", "http://x.de/cache/flush", "Bearer secret"); recorder.Code != http.StatusOK {
+		t.Errorf("POST: got status %d", recorder.Code)
+	}
+	if _, ok := CacheGet("a"); ok {
+		t.Errorf("cache was not flushed")
+	}
+}
+
+func TestAdminListenerStaleSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "admin.sock")
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	listener, err := adminListener(AdminUnixPrefix + path)
+	if err != nil {
+		t.Fatalf("stale socket was not removed: %v", err)
+	}
+	defer listener.Close()
+	if fi, err := os.Stat(path); err != nil || fi.Mode().Perm() != 0600 {
+		t.Errorf("got socket mode %v (%v), expected 0600", fi.Mode().Perm(), err)
+	}
+}
+
+// The handler of the draining test, registered only once.
+var (
+	slowOnce    sync.Once
+	slowStarted chan struct{}
+	slowRelease chan struct{}
+)
+
+// A shutdown through the admin API on a unix socket waits for the request
+// in flight on the public server.
+func TestAdminShutdown(t *testing.T) {
+	dir := t.TempDir()
+	tokenFile := filepath.Join(dir, "token")
+	if err := ioutil.WriteFile(tokenFile, []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	socket := filepath.Join(dir, "admin.sock")
+	defer func(admin, token string) { FlagAdmin, FlagAdminToken = admin, token }(FlagAdmin, FlagAdminToken)
+	FlagAdmin, FlagAdminToken = AdminUnixPrefix+socket, tokenFile
+	shutdownChan, shutdownOnce = make(chan struct{}), sync.Once{}
+
+	slowStarted, slowRelease = make(chan struct{}), make(chan struct{})
+	slowOnce.Do(func() {
+		http.HandleFunc("/test/slow", func(w http.ResponseWriter, r *http.Request) {
+			close(slowStarted)
+			<-slowRelease
+			w.Write([]byte("done"))
+		})
+	})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+	served := make(chan error, 1)
+	go func() {
+		served <- serve(addr)
+	}()
+	for i := 0; ; i++ {
+		if resp, err := http.Get("http://" + addr + "/test/unknown"); err == nil {
+			resp.Body.Close()
+			break
+		} else if i == 1000 {
+			t.Fatalf("server did not start: %v", err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	responses := make(chan string, 1)
+	go func() {
+		resp, err := http.Get("http://" + addr + "/test/slow")
+		if err != nil {
+			responses <- err.Error()
+			return
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		responses <- string(body)
+	}()
+	<-slowStarted
+
+	client := unixClient(socket)
+	shutdown := func(token string) int {
+		request, _ := http.NewRequest("POST", "http://admin/shutdown", nil)
+		request.Header.Set("Authorization", "Bearer "+token)
+		resp, err := client.Do(request)
+		if err != nil {
+			t.Fatalf("admin request failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if status := shutdown("wrong"); status != http.StatusUnauthorized {
+		t.Errorf("shutdown with a wrong token: got status %d", status)
+	}
+	if status := shutdown("secret"); status != http.StatusAccepted {
+		t.Fatalf("shutdown: got status %d", status)
+	}
+
+	select {
+	case err := <-served:
+		t.Fatalf("server stopped before the request was done: %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(slowRelease)
+	if body := <-responses; body != "done" {
+		t.Errorf("request in flight got %q", body)
+	}
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Errorf("serve: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("server did not stop")
+	}
+}
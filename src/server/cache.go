@@ -15,119 +15,219 @@
  */
 
 // The idea is quite natural, but has been presented by other groups first: cache route requests
+//
+// The cache is split into shards by the hash of the key, so that concurrent
+// requests rarely wait for the same lock. Each shard is a LRU list with its
+// part of the byte budget. Inserting a response evicts the least recently
+// used responses of the shard until it fits. With a TTL, older responses are
+// treated as missing and removed on access.
+//
+// The key of a route request is the canonical form of all parameters which
+// influence the response (see RouteKey), so that equivalent requests share
+// one entry and different requests never do.
 
 package main
 
 import (
+	"bytes"
+	"container/list"
+	"fmt"
+	"geo"
+	"graph"
+	"hash/fnv"
+	"route"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 const (
-	MaxCacheSize        = 100 * 1024 * 1024 // in bytes
-	CacheQueueSize      = 100
-	CacheEvictionBorder = 0.75    // % of cache size
-	CacheEvictionPeriod = 15 * 60 // in seconds; min. distance in time between eviction passes
+	CacheShards = 16
+	// Estimated memory of an entry in addition to the key and the response
+	CacheEntryOverhead = 128 // in bytes
+	// Decimal places of the coordinates in a key, about 0.1 m
+	CacheKeyPrecision = 6
 )
 
 var (
-	cache Cache
+	cache *Cache
+
+	// statistics for monitoring
+	cacheHits      int64
+	cacheMisses    int64
+	cacheEvictions int64
 )
 
 type Cache struct {
-	Size             int
-	Queue            chan *CacheQueueElement
-	mutex            sync.Mutex
-	elements         map[string]*CacheElement
-	lastEvictionPass time.Time
+	shards []*cacheShard
+	// maximum age of an entry, no limit if 0
+	ttl time.Duration
+	// current time, replaced by tests
+	now func() time.Time
 }
 
-type CacheElement struct {
-	Response     []byte
-	HitCounter   int
-	LastAccessed time.Time
+type cacheShard struct {
+	mutex   sync.Mutex
+	maxSize int
+	size    int
+	// front: most recently used
+	lru      *list.List
+	elements map[string]*list.Element
 }
 
-type CacheQueueElement struct {
+type CacheElement struct {
 	Key      string
 	Response []byte
+	Created  time.Time
 }
 
-// Thread-safe access to the map of the cache
-func (c Cache) Get(key string) (*CacheElement, bool) {
-	c.mutex.Lock()
-	element, ok := c.elements[key]
-	c.mutex.Unlock()
-	return element, ok
+// The parameters which determine the response of a route request.
+type RouteKey struct {
+	Waypoints    []geo.Coordinate
+	Travelmode   string
+	Metric       graph.Metric
+	AvoidFerries bool
+	Alternatives int
+	Departure    time.Time
+	Format       string
+	Geometry     route.GeometryOptions
+	Locale       *route.Locale
 }
 
-// Thread-safe access to the map of the cache
-func (c Cache) Put(key string, element *CacheElement) {
-	c.mutex.Lock()
-	c.elements[key] = element
-	c.mutex.Unlock()
+// String returns the canonical form of the key. Coordinates are rounded to
+// CacheKeyPrecision decimal places.
+func (k *RouteKey) String() string {
+	var buf bytes.Buffer
+	for i, w := range k.Waypoints {
+		if i > 0 {
+			buf.WriteString(SeparatorWaypoints)
+		}
+		buf.WriteString(strconv.FormatFloat(w.Lat, 'f', CacheKeyPrecision, 64))
+		buf.WriteString(SeparatorLatLng)
+		buf.WriteString(strconv.FormatFloat(w.Lng, 'f', CacheKeyPrecision, 64))
+	}
+	// The conditions repeat every week, so the moment of the departure
+	// determines the response.
+	departure := graph.Static
+	if !k.Departure.IsZero() {
+		departure = graph.MomentOf(k.Departure)
+	}
+	fmt.Fprintf(&buf, ";%s;%d;%t;%d;%d;%s;%s,%s,%t;%s,%d",
+		k.Travelmode, k.Metric, k.AvoidFerries, k.Alternatives, departure, k.Format,
+		k.Geometry.Format, k.Geometry.Overview, k.Geometry.Steps,
+		k.Locale.Language, k.Locale.Units)
+	return buf.String()
 }
 
-// Thread-safe access to the map of the cache
-func (c Cache) Update(key string) (*CacheElement, bool) {
-	c.mutex.Lock()
-	element, ok := c.elements[key]
-	if ok {
-		// adjust element in case of a hit
-		element.HitCounter++
-		element.LastAccessed = time.Now()
+// NewCache creates a cache holding at most maxSize bytes in the given
+// number of shards. Entries expire after ttl, never if ttl is 0.
+func NewCache(maxSize, shards int, ttl time.Duration) *Cache {
+	c := &Cache{shards: make([]*cacheShard, shards), ttl: ttl, now: time.Now}
+	for i := range c.shards {
+		c.shards[i] = &cacheShard{
+			maxSize:  maxSize / shards,
+			lru:      list.New(),
+			elements: make(map[string]*list.Element),
+		}
 	}
-	c.mutex.Unlock()
-	return element, ok
+	return c
 }
 
-// Thread-safe access to the map of the cache
-func (c Cache) Delete(key string) {
-	c.mutex.Lock()
-	delete(c.elements, key)
-	c.mutex.Unlock()
+func (c *Cache) shard(key string) *cacheShard {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return c.shards[h.Sum32()%uint32(len(c.shards))]
 }
 
-func InitCache() {
-	cacheMap := make(map[string]*CacheElement)
-	cacheQueue := make(chan *CacheQueueElement, CacheQueueSize)
-	cache = Cache{Size: 0, elements: cacheMap, Queue: cacheQueue, lastEvictionPass: time.Now()}
-	go CacheHandler()
+func elementSize(key string, response []byte) int {
+	return len(key) + len(response) + CacheEntryOverhead
 }
 
-func CacheGet(key string) ([]byte, bool) {
-	if elem, ok := cache.Get(key); ok {
-		return elem.Response, true
+// Thread-safe lookup, which marks the entry as recently used
+func (c *Cache) Get(key string) ([]byte, bool) {
+	s := c.shard(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	e, ok := s.elements[key]
+	if !ok {
+		return nil, false
 	}
-	return nil, false
+	element := e.Value.(*CacheElement)
+	if c.ttl > 0 && c.now().Sub(element.Created) >= c.ttl {
+		s.remove(e)
+		atomic.AddInt64(&cacheEvictions, 1)
+		return nil, false
+	}
+	s.lru.MoveToFront(e)
+	return element.Response, true
 }
 
-func CachePut(key string, response []byte) {
-	if len(cache.Queue) < CacheQueueSize {
-		cache.Queue <- &CacheQueueElement{Key: key, Response: response}
+// Thread-safe insertion, which evicts the least recently used entries of
+// the shard if necessary. Responses larger than a shard are not cached.
+func (c *Cache) Put(key string, response []byte) {
+	size := elementSize(key, response)
+	s := c.shard(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if size > s.maxSize {
+		return
 	}
+	if e, ok := s.elements[key]; ok {
+		s.remove(e)
+	}
+	for s.size+size > s.maxSize {
+		s.remove(s.lru.Back())
+		atomic.AddInt64(&cacheEvictions, 1)
+	}
+	element := &CacheElement{Key: key, Response: response, Created: c.now()}
+	s.elements[key] = s.lru.PushFront(element)
+	s.size += size
 }
 
-func CacheHandler() {
-	for elem := range cache.Queue {
-		if _, ok := cache.Update(elem.Key); !ok && cache.Size+len(elem.Response) <= MaxCacheSize {
-			cache.Put(elem.Key, &CacheElement{Response: elem.Response, HitCounter: 0, LastAccessed: time.Now()})
-			cache.Size += len(elem.Response)
-		}
-		if cache.Size >= CacheEvictionBorder*MaxCacheSize {
-			timeSinceLastEviction := time.Now().Sub(cache.lastEvictionPass)
-			// respect the period
-			if timeSinceLastEviction.Seconds() < CacheEvictionPeriod {
-				return
-			}
-			for k, elem := range cache.elements {
-				// TODO sort by some criteria and then delete the tail
-				timeSinceLastAccess := time.Now().Sub(elem.LastAccessed)
-				if elem.HitCounter <= 2 && timeSinceLastAccess.Hours() >= 2 {
-					cache.Delete(k)
-				}
-			}
-			cache.lastEvictionPass = time.Now()
-		}
+// Removes the entry, the caller has to hold the lock of the shard.
+func (s *cacheShard) remove(e *list.Element) {
+	element := s.lru.Remove(e).(*CacheElement)
+	delete(s.elements, element.Key)
+	s.size -= elementSize(element.Key, element.Response)
+}
+
+// Thread-safe removal of all elements
+func (c *Cache) Flush() {
+	for _, s := range c.shards {
+		s.mutex.Lock()
+		s.lru.Init()
+		s.elements = make(map[string]*list.Element)
+		s.size = 0
+		s.mutex.Unlock()
+	}
+}
+
+// Thread-safe access to the number of elements and their total size
+func (c *Cache) Stats() (int, int) {
+	entries, size := 0, 0
+	for _, s := range c.shards {
+		s.mutex.Lock()
+		entries += len(s.elements)
+		size += s.size
+		s.mutex.Unlock()
+	}
+	return entries, size
+}
+
+func InitCache() {
+	cache = NewCache(FlagCacheSize*1024*1024, CacheShards, FlagCacheTTL)
+}
+
+func CacheGet(key string) ([]byte, bool) {
+	if response, ok := cache.Get(key); ok {
+		atomic.AddInt64(&cacheHits, 1)
+		return response, true
 	}
+	atomic.AddInt64(&cacheMisses, 1)
+	return nil, false
+}
+
+func CachePut(key string, response []byte) {
+	cache.Put(key, response)
 }
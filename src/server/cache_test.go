@@ -0,0 +1,162 @@
+/*
+ * Copyright 2014 Florian Benz, Steven Schäfer, Bernhard Schommer
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"geo"
+	"graph"
+	"route"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCacheLRU(t *testing.T) {
+	// a single shard with room for exactly three responses of 100 bytes
+	c := NewCache(3*elementSize("a", make([]byte, 100)), 1, 0)
+	for _, key := range []string{"a", "b", "c"} {
+		c.Put(key, make([]byte, 100))
+	}
+	// "a" becomes the most recently used entry, so "b" is evicted next
+	if _, ok := c.Get("a"); !ok {
+		t.Fatalf("a is missing")
+	}
+	c.Put("d", make([]byte, 100))
+	for key, expected := range map[string]bool{"a": true, "b": false, "c": true, "d": true} {
+		if _, ok := c.Get(key); ok != expected {
+			t.Errorf("Get(%s) = %v, expected %v", key, ok, expected)
+		}
+	}
+	if entries, size := c.Stats(); entries != 3 || size != 3*elementSize("a", make([]byte, 100)) {
+		t.Errorf("Stats() = %d, %d", entries, size)
+	}
+
+	// too large for the budget
+	c.Put("e", make([]byte, 1000))
+	if _, ok := c.Get("e"); ok {
+		t.Errorf("oversized response was cached")
+	}
+
+	c.Flush()
+	if entries, size := c.Stats(); entries != 0 || size != 0 {
+		t.Errorf("Stats() = %d, %d after Flush", entries, size)
+	}
+}
+
+func TestCacheReplace(t *testing.T) {
+	c := NewCache(1024, 1, 0)
+	c.Put("a", []byte("old"))
+	c.Put("a", []byte("new"))
+	if response, ok := c.Get("a"); !ok || string(response) != "new" {
+		t.Errorf("Get(a) = %q, %v", response, ok)
+	}
+	if entries, size := c.Stats(); entries != 1 || size != elementSize("a", []byte("new")) {
+		t.Errorf("Stats() = %d, %d", entries, size)
+	}
+}
+
+func TestCacheTTL(t *testing.T) {
+	now := time.Date(2014, 3, 1, 12, 0, 0, 0, time.UTC)
+	c := NewCache(1024, 1, time.Hour)
+	c.now = func() time.Time { return now }
+	c.Put("a", []byte("response"))
+
+	now = now.Add(59 * time.Minute)
+	if _, ok := c.Get("a"); !ok {
+		t.Errorf("entry expired too early")
+	}
+	now = now.Add(time.Minute)
+	if _, ok := c.Get("a"); ok {
+		t.Errorf("entry did not expire")
+	}
+	if entries, _ := c.Stats(); entries != 0 {
+		t.Errorf("expired entry was not removed")
+	}
+}
+
+func TestCacheConcurrent(t *testing.T) {
+	c := NewCache(64*1024, CacheShards, 0)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				key := fmt.Sprintf("%d", (i*j)%300)
+				if response, ok := c.Get(key); ok && string(response) != key {
+					t.Errorf("Get(%s) = %s", key, response)
+				}
+				c.Put(key, []byte(key))
+			}
+		}(i)
+	}
+	wg.Wait()
+	if _, size := c.Stats(); size > 64*1024 {
+		t.Errorf("size %d exceeds the budget", size)
+	}
+}
+
+func TestRouteKey(t *testing.T) {
+	key := func(lat float64, metric graph.Metric, avoidFerries bool) string {
+		return (&RouteKey{
+			Waypoints:    []geo.Coordinate{{Lat: lat, Lng: 7.045882}, {Lat: 49.236178, Lng: 6.997427}},
+			Travelmode:   TravelmodeCar,
+			Metric:       metric,
+			AvoidFerries: avoidFerries,
+			Locale:       route.DefaultLocale,
+		}).String()
+	}
+	base := key(49.257207, graph.Time, false)
+	if key(49.25720701, graph.Time, false) != base {
+		t.Errorf("rounded coordinates differ")
+	}
+	if key(49.257208, graph.Time, false) == base {
+		t.Errorf("different coordinates share a key")
+	}
+	if key(49.257207, graph.Distance, false) == base {
+		t.Errorf("different metrics share a key")
+	}
+	if key(49.257207, graph.Time, true) == base {
+		t.Errorf("different avoid options share a key")
+	}
+
+	de, _ := route.NewLocale("de", route.UnitsMetric)
+	deAT, _ := route.NewLocale("de-AT", route.UnitsMetric)
+	k1 := &RouteKey{Waypoints: []geo.Coordinate{{}, {}}, Locale: de}
+	k2 := &RouteKey{Waypoints: []geo.Coordinate{{}, {}}, Locale: deAT}
+	if k1.String() != k2.String() {
+		t.Errorf("equivalent locales differ: %s, %s", k1, k2)
+	}
+
+	// Departures at the same time of the week share a key, a missing
+	// departure differs from every departure.
+	monday := time.Date(2014, 6, 2, 7, 30, 0, 0, time.UTC)
+	k1.Departure = monday
+	k2.Departure = monday.AddDate(0, 0, 7)
+	if k1.String() != k2.String() {
+		t.Errorf("departures a week apart differ: %s, %s", k1, k2)
+	}
+	k2.Departure = monday.Add(time.Minute)
+	if k1.String() == k2.String() {
+		t.Errorf("different departures share a key")
+	}
+	k2.Departure = time.Time{}
+	if k1.String() == k2.String() {
+		t.Errorf("a departure and no departure share a key")
+	}
+}
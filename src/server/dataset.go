@@ -0,0 +1,155 @@
+/*
+ * Copyright 2014 Florian Benz, Steven Schäfer, Bernhard Schommer
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Hot reload of the graph
+//
+// All data of a graph directory is bundled in a Dataset. Each request
+// acquires the current data set and releases it when it is done. A reload
+// (SIGHUP or the admin command /reload) opens and validates the new graph
+// directory, swaps it in for new requests, waits until all requests on the
+// old data set are finished and unmaps it afterwards.
+//
+// SIGHUP reloads the directory given by -dir. To rebuild a graph without
+// affecting the running server, -dir can be a symlink which is changed to
+// the new directory before sending SIGHUP.
+
+package main
+
+import (
+	"graph"
+	"kdtree"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+type Dataset struct {
+	Dir    string
+	Graph  *graph.ClusterGraph
+	KdTree *kdtree.ClusterKdTree
+	Loaded time.Time
+	// size of the memory mapped files in bytes
+	MappedSize int
+	// in-flight requests on this data set
+	users sync.WaitGroup
+}
+
+var (
+	// protects the pointer, not the data set itself
+	datasetMutex sync.RWMutex
+	dataset      *Dataset
+	// at most one reload at a time
+	reloadMutex sync.Mutex
+	// used by Reload, the tests replace them to work without graph files
+	openDataset  = OpenDataset
+	closeDataset = (*Dataset).Close
+)
+
+// OpenDataset loads the cluster graphs and the overlay graph as well as the
+// precomputed matrices for the metrics and the k-d trees.
+func OpenDataset(dir string) (*Dataset, error) {
+	clusterGraph, err := graph.OpenClusterGraph(dir, true /* load matrices */)
+	if err != nil {
+		return nil, err
+	}
+	if err := clusterGraph.Validate(); err != nil {
+		graph.CloseClusterGraph(clusterGraph)
+		return nil, err
+	}
+
+	// Load the k-d trees for the cluster and the overlay graph. In addition,
+	// the bounding boxes for the clusters are loaded.
+	kdTree, err := kdtree.LoadKdTree(clusterGraph, dir)
+	if err != nil {
+		graph.CloseClusterGraph(clusterGraph)
+		return nil, err
+	}
+	return &Dataset{
+		Dir:        dir,
+		Graph:      clusterGraph,
+		KdTree:     kdTree,
+		Loaded:     time.Now(),
+		MappedSize: clusterGraph.MappedSize() + kdTree.MappedSize(),
+	}, nil
+}
+
+// Close unmaps all files of the data set.
+func (d *Dataset) Close() error {
+	err := kdtree.CloseKdTree(d.KdTree)
+	if err2 := graph.CloseClusterGraph(d.Graph); err == nil {
+		err = err2
+	}
+	return err
+}
+
+// AcquireDataset returns the current data set, which stays valid until
+// Release is called.
+func AcquireDataset() *Dataset {
+	datasetMutex.RLock()
+	d := dataset
+	d.users.Add(1)
+	datasetMutex.RUnlock()
+	return d
+}
+
+func (d *Dataset) Release() {
+	d.users.Done()
+}
+
+// Reload replaces the current data set by the graph in dir. If the new
+// graph cannot be opened, the current one stays in place.
+func Reload(dir string) error {
+	reloadMutex.Lock()
+	defer reloadMutex.Unlock()
+
+	log.Println("Reloading graph from", dir)
+	d, err := openDataset(dir)
+	if err != nil {
+		return err
+	}
+
+	datasetMutex.Lock()
+	old := dataset
+	dataset = d
+	datasetMutex.Unlock()
+
+	// Requests on the old data set have to finish before we can unmap it.
+	// They may still add responses to the cache, so we flush it afterwards.
+	// New requests can hit the old responses until then.
+	old.users.Wait()
+	if FlagCaching {
+		cache.Flush()
+	}
+	if err := closeDataset(old); err != nil {
+		log.Println("Closing old graph: ", err)
+	}
+	log.Println("Reloaded graph from", dir)
+	return nil
+}
+
+// reloadOnSignal reloads the graph given by -dir on every SIGHUP.
+func reloadOnSignal() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	for _ = range signals {
+		if err := Reload(FlagDir); err != nil {
+			log.Println("Reload failed: ", err)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+/*
+ * Copyright 2014 Florian Benz, Steven Schäfer, Bernhard Schommer
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// Reload on test data sets. The directory "invalid" fails the validation,
+// because the test data set has no partition. Returns the current data set
+// and a channel which receives the data sets which are closed.
+func setupReload(t *testing.T) (*Dataset, chan *Dataset) {
+	datasetMutex.Lock()
+	oldDataset := dataset
+	dataset = testDataset()
+	current := dataset
+	datasetMutex.Unlock()
+
+	oldOpen, oldClose := openDataset, closeDataset
+	oldCaching, oldCache := FlagCaching, cache
+	closed := make(chan *Dataset, 2)
+	openDataset = func(dir string) (*Dataset, error) {
+		d := testDataset()
+		d.Dir = dir
+		if dir == "invalid" {
+			return nil, d.Graph.Validate()
+		}
+		return d, nil
+	}
+	closeDataset = func(d *Dataset) error {
+		closed <- d
+		return nil
+	}
+	FlagCaching = true
+	InitCache()
+
+	t.Cleanup(func() {
+		datasetMutex.Lock()
+		dataset = oldDataset
+		datasetMutex.Unlock()
+		openDataset, closeDataset = oldOpen, oldClose
+		FlagCaching, cache = oldCaching, oldCache
+	})
+	return current, closed
+}
+
+func TestReloadInvalid(t *testing.T) {
+	current, closed := setupReload(t)
+	CachePut("a", []byte("response"))
+
+	if err := Reload("invalid"); err == nil {
+		t.Fatalf("invalid graph was loaded")
+	}
+	data := AcquireDataset()
+	data.Release()
+	if data != current {
+		t.Errorf("data set was replaced by an invalid one")
+	}
+	if len(closed) != 0 {
+		t.Errorf("data set was closed")
+	}
+	if _, ok := CacheGet("a"); !ok {
+		t.Errorf("cache was flushed")
+	}
+}
+
+func TestReload(t *testing.T) {
+	current, closed := setupReload(t)
+	CachePut("a", []byte("response"))
+
+	// A request on the current data set is in flight during the reload.
+	data := AcquireDataset()
+	done := make(chan error)
+	go func() {
+		done <- Reload("new")
+	}()
+	for {
+		datasetMutex.RLock()
+		dir := dataset.Dir
+		datasetMutex.RUnlock()
+		if dir == "new" {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// New requests use the new data set, the old one stays open until the
+	// request is done. It may still put its response into the cache.
+	next := AcquireDataset()
+	next.Release()
+	if next == current || next.Dir != "new" {
+		t.Errorf("new requests do not use the new data set")
+	}
+	select {
+	case <-closed:
+		t.Fatalf("data set was closed during a request")
+	case err := <-done:
+		t.Fatalf("reload did not wait for the request: %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	CachePut("b", []byte("response"))
+	data.Release()
+
+	if err := <-done; err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+	select {
+	case d := <-closed:
+		if d != current {
+			t.Errorf("closed the wrong data set")
+		}
+	default:
+		t.Errorf("old data set was not closed")
+	}
+	for _, key := range []string{"a", "b"} {
+		if _, ok := CacheGet(key); ok {
+			t.Errorf("cache entry %s of the old data set survived the reload", key)
+		}
+	}
+}
@@ -18,6 +18,10 @@
 
 package main
 
+import (
+	"graph"
+)
+
 type Features struct {
 	TravelMode TravelMode `json:"travelmode"`
 	Metric     Metric     `json:"metric"`
@@ -38,3 +42,14 @@ type Metric struct {
 type Avoid struct {
 	Ferries bool `json:"ferries"`
 }
+
+// NewFeatures returns the features supported with the graph g. Avoiding
+// ferries needs the matrices of the ferry-free metrics, which graphs
+// customized by an older version of metric do not contain.
+func NewFeatures(g *graph.ClusterGraph) *Features {
+	return &Features{
+		TravelMode: TravelMode{Driving: true, Walking: true, Bicycling: true},
+		Metric:     Metric{Distance: true, Time: true},
+		Avoid:      Avoid{Ferries: g.Overlay.FerryFreeMatrices()},
+	}
+}
@@ -0,0 +1,105 @@
+/*
+ * Copyright 2014 Florian Benz, Steven Schäfer, Bernhard Schommer
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Output formats of the route response
+
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"net/url"
+	"route"
+	"strconv"
+)
+
+const (
+	ParameterFormat     = "format"
+	ParameterGeometries = "geometries"
+	ParameterOverview   = "overview"
+	ParameterSteps      = "steps"
+
+	FormatJSON    = "json"
+	FormatGeoJSON = "geojson"
+	FormatGPX     = "gpx"
+
+	ContentTypeJSON    = "application/json; charset=UTF-8"
+	ContentTypeGeoJSON = "application/geo+json; charset=UTF-8"
+	ContentTypeGPX     = "application/gpx+xml; charset=UTF-8"
+)
+
+// getFormat returns the format and the corresponding content type.
+func getFormat(format string) (string, string, error) {
+	switch format {
+	case FormatJSON:
+		return format, ContentTypeJSON, nil
+	case FormatGeoJSON:
+		return format, ContentTypeGeoJSON, nil
+	case FormatGPX:
+		return format, ContentTypeGPX, nil
+	}
+	return "", "", invalidOption(ParameterFormat, "wrong format")
+}
+
+// encodeResult serialises the result in the given format.
+func encodeResult(result *route.Result, format string) ([]byte, error) {
+	switch format {
+	case FormatGeoJSON:
+		return json.Marshal(result.GeoJSON())
+	case FormatGPX:
+		encoded, err := xml.Marshal(result.GPX())
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte(xml.Header), encoded...), nil
+	}
+	return json.Marshal(result)
+}
+
+// getGeometryOptions parses the geometries, overview and steps parameters.
+// By default the geometry is returned as coordinates for every step and
+// there is no overview.
+func getGeometryOptions(urlParameter url.Values) (route.GeometryOptions, error) {
+	options := route.GeometryOptions{
+		Format:   route.GeometryCoordinates,
+		Overview: route.OverviewFalse,
+		Steps:    true,
+	}
+	if urlParameter[ParameterGeometries] != nil {
+		options.Format = urlParameter[ParameterGeometries][0]
+		switch options.Format {
+		case route.GeometryCoordinates, route.GeometryPolyline, route.GeometryPolyline6:
+		default:
+			return options, invalidOption(ParameterGeometries, "wrong geometries")
+		}
+	}
+	if urlParameter[ParameterOverview] != nil {
+		options.Overview = urlParameter[ParameterOverview][0]
+		switch options.Overview {
+		case route.OverviewFalse, route.OverviewFull, route.OverviewSimplified:
+		default:
+			return options, invalidOption(ParameterOverview, "wrong overview")
+		}
+	}
+	if urlParameter[ParameterSteps] != nil {
+		steps, err := strconv.ParseBool(urlParameter[ParameterSteps][0])
+		if err != nil {
+			return options, invalidOption(ParameterSteps, "wrong steps flag")
+		}
+		options.Steps = steps
+	}
+	return options, nil
+}
@@ -0,0 +1,161 @@
+/*
+ * Copyright 2014 Florian Benz, Steven Schäfer, Bernhard Schommer
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Reachable areas within time or distance budgets
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"graph"
+	"net/http"
+	"route"
+	"strconv"
+	"strings"
+)
+
+const (
+	ParameterPoint    = "point"
+	ParameterBudgets  = "budgets"
+	ParameterReverse  = "reverse"
+	ParameterGeometry = "geometry"
+
+	SeparatorBudgets = ","
+
+	GeometryPolygon = "polygon"
+	GeometryEdges   = "edges"
+
+	// Maximum number of budgets in one request
+	MaxBudgets = 10
+	// Maximum budget in seconds for the time metric and in meter otherwise
+	MaxBudgetTime     = 2 * 60 * 60
+	MaxBudgetDistance = 100 * 1000
+)
+
+func getBudgets(s string, metric graph.Metric) ([]int, error) {
+	parts := strings.Split(s, SeparatorBudgets)
+	if len(parts) > MaxBudgets {
+		return nil, errors.New("too many budgets")
+	}
+	limit := MaxBudgetDistance
+	if metric == graph.Time {
+		limit = MaxBudgetTime
+	}
+	budgets := make([]int, len(parts))
+	for i, part := range parts {
+		budget, err := strconv.Atoi(part)
+		if err != nil || budget <= 0 {
+			return nil, errors.New("wrong budget")
+		}
+		if budget > limit {
+			return nil, errors.New("budget too large")
+		}
+		budgets[i] = budget
+	}
+	return budgets, nil
+}
+
+// isochrone returns the area reachable from the given point within each of
+// the budgets. Budgets are given in seconds for the time metric (default)
+// and in meter for the distance metric. With reverse=true the area from
+// which the point can be reached is returned instead.
+func isochrone(w http.ResponseWriter, r *http.Request) {
+	urlParameter := r.URL.Query()
+
+	if urlParameter[ParameterPoint] == nil || urlParameter[ParameterBudgets] == nil {
+		http.Error(w, "no point or budgets", http.StatusBadRequest)
+		return
+	}
+	points, err := getCoordinates(urlParameter[ParameterPoint][0])
+	if err != nil || len(points) != 1 {
+		http.Error(w, "wrong point", http.StatusBadRequest)
+		return
+	}
+
+	travelmode, err := getTravelmode(urlParameter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	record(w).travelmode = travelmode
+
+	metric := graph.Time
+	if urlParameter[ParameterMetric] != nil {
+		metric, err = getMetric(urlParameter[ParameterMetric][0])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	budgets, err := getBudgets(urlParameter[ParameterBudgets][0], metric)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	forward := true
+	if urlParameter[ParameterReverse] != nil {
+		reverse, err := strconv.ParseBool(urlParameter[ParameterReverse][0])
+		if err != nil {
+			http.Error(w, "wrong reverse flag", http.StatusBadRequest)
+			return
+		}
+		forward = !reverse
+	}
+
+	geometry := GeometryPolygon
+	if urlParameter[ParameterGeometry] != nil {
+		geometry = urlParameter[ParameterGeometry][0]
+		if geometry != GeometryPolygon && geometry != GeometryEdges {
+			http.Error(w, "wrong geometry", http.StatusBadRequest)
+			return
+		}
+	}
+
+	data := AcquireDataset()
+	defer data.Release()
+	ctx, cancel := plannerContext(r)
+	defer cancel()
+	planner := &route.IsochronePlanner{
+		Graph:     data.Graph,
+		KdTree:    data.KdTree,
+		Center:    points[0],
+		Budgets:   budgets,
+		Transport: getTransport(travelmode),
+		Metric:    metric,
+		Forward:   forward,
+		Polygons:  geometry == GeometryPolygon,
+		Edges:     geometry == GeometryEdges,
+		Context:   ctx,
+	}
+	result := planner.Run()
+	if err := planner.Err(); err != nil {
+		writeCancelled(w, err)
+		return
+	}
+
+	jsonResult, err := json.Marshal(result)
+	if err != nil {
+		http.Error(w, "unable to create a proper JSON object", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.Write(jsonResult)
+}
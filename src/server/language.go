@@ -0,0 +1,41 @@
+// Language and units of the textual output
+
+package main
+
+import (
+	"net/url"
+	"route"
+)
+
+const (
+	ParameterLanguage = "language"
+	ParameterUnits    = "units"
+
+	UnitsMetric   = "metric"
+	UnitsImperial = "imperial"
+)
+
+// getLocale parses the language and units parameters, which default to
+// English and metric units.
+func getLocale(urlParameter url.Values) (*route.Locale, error) {
+	units := route.UnitsMetric
+	if urlParameter[ParameterUnits] != nil {
+		switch urlParameter[ParameterUnits][0] {
+		case UnitsMetric:
+			units = route.UnitsMetric
+		case UnitsImperial:
+			units = route.UnitsImperial
+		default:
+			return nil, invalidOption(ParameterUnits, "wrong units")
+		}
+	}
+	language := route.DefaultLanguage
+	if urlParameter[ParameterLanguage] != nil {
+		language = urlParameter[ParameterLanguage][0]
+	}
+	locale, err := route.NewLocale(language, units)
+	if err != nil {
+		return nil, invalidOption(ParameterLanguage, "%v", err)
+	}
+	return locale, nil
+}
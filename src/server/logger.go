@@ -14,97 +14,323 @@
  * limitations under the License.
  */
 
-// Non-blocking logging and timing functionality
+// Access log and timing of requests
+//
+// Every request to the public server is written as one JSON object per line
+// to the access log. Apart from the request itself, the handlers may record
+// details such as the number of waypoints, the time spent in the phases of
+// the route planner and whether the response came from the cache.
+//
+// The log files are named access-<date>.jsonl and are rotated every day.
+// If a file exceeds the maximum size, we continue with access-<date>.1.jsonl,
+// access-<date>.2.jsonl and so on.
 
 package main
 
 import (
 	"bufio"
+	"encoding/json"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"path"
+	"route"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 const (
 	LogBufferSize = 1000
+	// Flush the buffered entries at least this often
+	LogFlushInterval = time.Second
 )
 
 var (
 	loggerChan chan *RequestInfo
+	// closed by the logger after the last request has been written
+	loggerDone chan struct{}
+	// Senders hold a read lock, so that CloseLogger can only close the
+	// channel when no send is in progress. Afterwards, loggerClosed is set
+	// and requests are dropped.
+	loggerMutex  sync.RWMutex
+	loggerClosed bool
 )
 
 type RequestInfo struct {
-	URL      string
-	Time     time.Time
-	Duration time.Duration
+	Time       time.Time `json:"time"`
+	Remote     string    `json:"remote"`
+	Method     string    `json:"method"`
+	URL        string    `json:"url"`
+	Endpoint   string    `json:"endpoint"`
+	Travelmode string    `json:"travelmode,omitempty"`
+	Status     int       `json:"status"`
+	Size       int       `json:"size"`
+	// all durations in microseconds
+	Duration  int64 `json:"duration_us"`
+	Waypoints int   `json:"waypoints,omitempty"`
+	// phases of the route planner, summed up over all legs
+	Snapping    int64 `json:"snapping_us,omitempty"`
+	LegSearch   int64 `json:"leg_search_us,omitempty"`
+	Elaboration int64 `json:"elaboration_us,omitempty"`
+	Settled     int64 `json:"settled,omitempty"`
+	CacheHit    bool  `json:"cache_hit"`
+}
+
+// responseRecorder remembers what a handler did with a request.
+type responseRecorder struct {
+	http.ResponseWriter
+	status     int
+	size       int
+	travelmode string
+	waypoints  int
+	stats      *route.PlannerStats
+	cacheHit   bool
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.size += n
+	return n, err
+}
+
+// record returns the recorder of the request, in which the handler can
+// store details for the access log and the metrics. If the request is not
+// instrumented (as in tests), the details are ignored.
+func record(w http.ResponseWriter) *responseRecorder {
+	if recorder, ok := w.(*responseRecorder); ok {
+		return recorder
+	}
+	return &responseRecorder{}
+}
+
+// instrument wraps the handler of the public server, so that we know how
+// many requests are in flight and how they were answered.
+func instrument(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		startTime := time.Now()
+		atomic.AddInt64(&requestsActive, 1)
+		atomic.AddInt64(&requestsTotal, 1)
+		defer atomic.AddInt64(&requestsActive, -1)
+
+		recorder := &responseRecorder{ResponseWriter: w}
+		mux.ServeHTTP(recorder, r)
+		duration := time.Now().Sub(startTime)
+
+		// Use the registered pattern, so that unknown URLs do not create
+		// new time series.
+		_, endpoint := mux.Handler(r)
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+		requestCounter.Inc(endpoint, recorder.travelmode, strconv.Itoa(recorder.status))
+		requestDuration.Observe(duration.Seconds(), endpoint)
+		if recorder.stats != nil {
+			observePlanner(*recorder.stats)
+		}
+
+		if !FlagLogging {
+			return
+		}
+		remote, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			remote = r.RemoteAddr
+		}
+		info := &RequestInfo{
+			Time:       startTime,
+			Remote:     remote,
+			Method:     r.Method,
+			URL:        r.URL.String(),
+			Endpoint:   endpoint,
+			Travelmode: recorder.travelmode,
+			Status:     recorder.status,
+			Size:       recorder.size,
+			Duration:   microseconds(duration),
+			Waypoints:  recorder.waypoints,
+			CacheHit:   recorder.cacheHit,
+		}
+		if stats := recorder.stats; stats != nil {
+			info.Snapping = microseconds(stats.Snapping)
+			info.LegSearch = microseconds(stats.LegSearch)
+			info.Elaboration = microseconds(stats.Elaboration)
+			info.Settled = stats.Settled
+		}
+		LogRequest(info)
+	})
+}
+
+func microseconds(d time.Duration) int64 {
+	return d.Nanoseconds() / 1000
 }
 
 // InitLogger sets up a buffered channel and starts a goroutine so that requests can be logged afterwards.
 func InitLogger() {
+	loggerMutex.Lock()
+	defer loggerMutex.Unlock()
 	loggerChan = make(chan *RequestInfo, LogBufferSize)
+	loggerDone = make(chan struct{})
+	loggerClosed = false
 	// exactly one logger runs concurrently
-	go logger()
+	go logger(&rotatingFile{dir: FlagLogDir, maxSize: int64(FlagLogMaxSize) << 20})
 }
 
-// LogRequest loggs requests in a non-blocking way. It is guaranteed that the request is logged.
-func LogRequest(r *http.Request, startTime, endTime time.Time) {
+// LogRequest hands the request over to the logger. It only blocks if the
+// logger falls behind, so it is guaranteed that the request is logged
+// unless the logger is already closed, e.g., while the server shuts down.
+func LogRequest(info *RequestInfo) {
 	if !FlagLogging {
 		return
 	}
+	loggerMutex.RLock()
+	defer loggerMutex.RUnlock()
+	if loggerChan == nil || loggerClosed {
+		return
+	}
+	loggerChan <- info
+}
 
-	// if the buffer is full, the request is not logged
-	if len(loggerChan) < LogBufferSize {
-		duration := endTime.Sub(startTime)
-		loggerChan <- &RequestInfo{r.URL.String(), startTime, duration}
+// CloseLogger writes all pending requests to disk and stops the logger.
+// Requests which are logged afterwards are dropped.
+func CloseLogger() {
+	loggerMutex.Lock()
+	if loggerChan == nil || loggerClosed {
+		loggerMutex.Unlock()
+		return
 	}
+	loggerClosed = true
+	close(loggerChan)
+	loggerMutex.Unlock()
+	<-loggerDone
 }
 
 // logger processes requests that should be logged, and writes them to disk.
-func logger() {
-	writeBuffer := make([]*RequestInfo, 0, LogBufferSize)
-	// wait until at least one request has to be written
-	for currentRequest := range loggerChan {
-		// fill the buffer with all pending requests
-		for currentRequest != nil {
-			writeBuffer = append(writeBuffer, currentRequest)
-			select {
-			case currentRequest = <-loggerChan:
-				// nothing
-			default:
-				currentRequest = nil
+func logger(file *rotatingFile) {
+	defer close(loggerDone)
+	defer file.Close()
+	ticker := time.NewTicker(LogFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case ri, ok := <-loggerChan:
+			if !ok {
+				return
+			}
+			line, err := json.Marshal(ri)
+			if err != nil {
+				log.Printf("logger marshal error %v\n", err.Error())
+				continue
+			}
+			if err := file.WriteLine(line); err != nil {
+				log.Printf("logger write error %v\n", err.Error())
+			}
+		case <-ticker.C:
+			if err := file.Flush(); err != nil {
+				log.Printf("logger flush error %v\n", err.Error())
 			}
 		}
+	}
+}
+
+// rotatingFile writes lines to the current log file and starts a new file
+// every day or if the maximum size would be exceeded.
+type rotatingFile struct {
+	dir     string
+	maxSize int64 // in bytes, no limit if <= 0
+	file    *os.File
+	writer  *bufio.Writer
+	day     string
+	index   int
+	size    int64
+}
+
+// The file name for the given day and index.
+func (f *rotatingFile) filename(day string, index int) string {
+	if index == 0 {
+		return path.Join(f.dir, "access-"+day+".jsonl")
+	}
+	return path.Join(f.dir, fmt.Sprintf("access-%s.%d.jsonl", day, index))
+}
 
-		// open file for appending (file is created if necessary)
-		filename := formatLoggerFilename(time.Now())
-		file, _ := os.OpenFile(filename, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
-		writer := bufio.NewWriter(file)
-
-		for _, ri := range writeBuffer {
-			// write a line for each request
-			writer.WriteString(ri.Time.Format(time.RFC3339 /* "2006-01-02T15:04:05Z07:00" */))
-			writer.WriteString(" ")
-			durationInMicroseconds := strconv.FormatInt(ri.Duration.Nanoseconds()/1000, 10 /* base */)
-			writer.WriteString(durationInMicroseconds)
-			writer.WriteString(" ")
-			writer.WriteString(ri.URL)
-			writer.WriteString("\n")
+// WriteLine appends the line and a line break, a line is never split
+// between two files.
+func (f *rotatingFile) WriteLine(line []byte) error {
+	day := time.Now().Format("2006-01-02")
+	length := int64(len(line) + 1)
+	full := f.maxSize > 0 && f.size > 0 && f.size+length > f.maxSize
+	if f.file == nil || day != f.day || full {
+		if err := f.rotate(day); err != nil {
+			return err
 		}
+	}
+	f.writer.Write(line)
+	f.writer.WriteByte('\n')
+	f.size += length
+	return nil
+}
 
-		err := writer.Flush()
-		if err != nil {
-			log.Printf("logger flush error %v\n", err.Error())
+// rotate closes the current file and opens the next one. Files which
+// already exist are continued unless they are full, so that a restart does
+// not overwrite the log.
+func (f *rotatingFile) rotate(day string) error {
+	if err := f.Close(); err != nil {
+		log.Printf("logger close error %v\n", err.Error())
+	}
+	if day != f.day {
+		f.day, f.index = day, 0
+	} else {
+		f.index++
+	}
+	for {
+		fi, err := os.Stat(f.filename(f.day, f.index))
+		if err != nil || f.maxSize <= 0 || fi.Size() < f.maxSize {
+			break
 		}
+		f.index++
+	}
+
+	file, err := os.OpenFile(f.filename(f.day, f.index), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	fi, err := file.Stat()
+	if err != nil {
 		file.Close()
+		return err
+	}
+	f.file = file
+	f.writer = bufio.NewWriter(file)
+	f.size = fi.Size()
+	return nil
+}
 
-		// reset buffer
-		writeBuffer = writeBuffer[:0]
+func (f *rotatingFile) Flush() error {
+	if f.writer == nil {
+		return nil
 	}
+	return f.writer.Flush()
 }
 
-// formatLoggerFilename returns the file name of the log file for the given date.
-func formatLoggerFilename(t time.Time) string {
-	return "log_" + strconv.Itoa(t.Year()) + "_" + strconv.Itoa(int(t.Month())) + "_" + strconv.Itoa(t.Day()) + ".txt"
+func (f *rotatingFile) Close() error {
+	if f.file == nil {
+		return nil
+	}
+	err := f.Flush()
+	if err2 := f.file.Close(); err == nil {
+		err = err2
+	}
+	f.file, f.writer = nil, nil
+	return err
 }
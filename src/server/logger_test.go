@@ -0,0 +1,85 @@
+/*
+ * Copyright 2014 Florian Benz, Steven Schäfer, Bernhard Schommer
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRotatingFile(t *testing.T) {
+	dir := t.TempDir()
+	f := &rotatingFile{dir: dir, maxSize: 20}
+	line := []byte("0123456789") // 11 bytes with the line break
+	for i := 0; i < 3; i++ {
+		if err := f.WriteLine(line); err != nil {
+			t.Fatalf("WriteLine failed: %v", err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	// Every file holds exactly one line, lines are never split.
+	day := time.Now().Format("2006-01-02")
+	for _, name := range []string{"access-" + day + ".jsonl", "access-" + day + ".1.jsonl", "access-" + day + ".2.jsonl"} {
+		data, err := ioutil.ReadFile(path.Join(dir, name))
+		if err != nil {
+			t.Fatalf("Missing log file: %v", err)
+		}
+		if !bytes.Equal(data, append(line, '\n')) {
+			t.Errorf("Unexpected content of %s: %q", name, data)
+		}
+	}
+
+	// A restart continues with the last file which is not full yet.
+	f = &rotatingFile{dir: dir, maxSize: 30}
+	f.WriteLine(line)
+	f.Close()
+	data, _ := ioutil.ReadFile(path.Join(dir, "access-"+day+".jsonl"))
+	if len(data) != 22 {
+		t.Errorf("Expected the first file to be continued, got %q", data)
+	}
+}
+
+// Requests which are logged while or after the logger is closed are
+// dropped, all others are written.
+func TestCloseLoggerConcurrent(t *testing.T) {
+	oldLogging, oldDir := FlagLogging, FlagLogDir
+	defer func() { FlagLogging, FlagLogDir = oldLogging, oldDir }()
+	FlagLogging, FlagLogDir = true, t.TempDir()
+	InitLogger()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 2*LogBufferSize; j++ {
+				LogRequest(&RequestInfo{Endpoint: "/routes"})
+			}
+		}()
+	}
+	CloseLogger()
+	wg.Wait()
+	CloseLogger()
+	LogRequest(&RequestInfo{Endpoint: "/routes"})
+}
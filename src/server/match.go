@@ -0,0 +1,136 @@
+/*
+ * Copyright 2014 Florian Benz, Steven Schäfer, Bernhard Schommer
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Matching of GPS traces onto the road network
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"route"
+	"strconv"
+	"strings"
+)
+
+const (
+	ParameterPoints     = "points"
+	ParameterTimestamps = "timestamps"
+
+	SeparatorTimestamps = ","
+
+	// Maximum number of points in one trace
+	MaxMatchPoints = 200
+)
+
+// Parse the time stamps (in seconds) of a trace with count points.
+func getTimestamps(s string, count int) ([]int64, error) {
+	parts := strings.Split(s, SeparatorTimestamps)
+	if len(parts) != count {
+		return nil, errors.New("number of timestamps does not match the number of points")
+	}
+	timestamps := make([]int64, len(parts))
+	for i, part := range parts {
+		timestamp, err := strconv.ParseInt(part, 10, 64)
+		if err != nil {
+			return nil, errors.New("wrong timestamp")
+		}
+		if i > 0 && timestamp < timestamps[i-1] {
+			return nil, errors.New("timestamps are not increasing")
+		}
+		timestamps[i] = timestamp
+	}
+	return timestamps, nil
+}
+
+// match returns the most likely path driven along the given GPS points,
+// together with the matched position and its confidence for every point.
+func match(w http.ResponseWriter, r *http.Request) {
+	urlParameter := r.URL.Query()
+
+	if urlParameter[ParameterPoints] == nil {
+		http.Error(w, "no points", http.StatusBadRequest)
+		return
+	}
+	points, err := getCoordinates(urlParameter[ParameterPoints][0])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(points) < 2 {
+		http.Error(w, "too few points", http.StatusBadRequest)
+		return
+	}
+	if len(points) > MaxMatchPoints {
+		http.Error(w, "too many points", http.StatusBadRequest)
+		return
+	}
+
+	timestamps := []int64(nil)
+	if urlParameter[ParameterTimestamps] != nil {
+		timestamps, err = getTimestamps(urlParameter[ParameterTimestamps][0], len(points))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	travelmode, err := getTravelmode(urlParameter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	record(w).travelmode = travelmode
+	record(w).waypoints = len(points)
+
+	locale, err := getLocale(urlParameter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	data := AcquireDataset()
+	defer data.Release()
+	ctx, cancel := plannerContext(r)
+	defer cancel()
+	planner := &route.MatchPlanner{
+		Graph:                 data.Graph,
+		KdTree:                data.KdTree,
+		Points:                points,
+		Timestamps:            timestamps,
+		Transport:             getTransport(travelmode),
+		ConcurrentKd:          true,
+		ConcurrentTransitions: true,
+		Context:               ctx,
+	}
+	result := planner.Run()
+	if err := planner.Err(); err != nil {
+		writeCancelled(w, err)
+		return
+	}
+	result.Localize(locale)
+
+	jsonResult, err := json.Marshal(result)
+	if err != nil {
+		http.Error(w, "unable to create a proper JSON object", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.Write(jsonResult)
+}
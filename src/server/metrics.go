@@ -0,0 +1,253 @@
+/*
+ * Copyright 2014 Florian Benz, Steven Schäfer, Bernhard Schommer
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Monitoring in the Prometheus text format
+//
+// The metrics are written in the text exposition format (version 0.0.4) by
+// hand, so that we do not depend on the Prometheus client library. Each
+// time series of a counter or histogram is identified by its rendered
+// label set, e.g., endpoint="/routes",status="200".
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"route"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	ContentTypeMetrics = "text/plain; version=0.0.4; charset=utf-8"
+
+	MetricsPrefix = "osmrouting_"
+)
+
+var (
+	// Upper bounds of the histogram buckets, in seconds respectively vertices
+	LatencyBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+	SettledBuckets = []float64{1e2, 1e3, 1e4, 1e5, 1e6, 1e7}
+
+	requestCounter  = newCounterVec("endpoint", "travelmode", "status")
+	requestDuration = newHistogramVec(LatencyBuckets, "endpoint")
+	phaseDuration   = newHistogramVec(LatencyBuckets, "phase")
+	settledVertices = newHistogramVec(SettledBuckets)
+
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+)
+
+type counterVec struct {
+	names  []string
+	mutex  sync.Mutex
+	values map[string]float64
+}
+
+type histogram struct {
+	counts []uint64 // per bucket, not cumulative
+	sum    float64
+	count  uint64
+}
+
+type histogramVec struct {
+	names   []string
+	buckets []float64
+	mutex   sync.Mutex
+	values  map[string]*histogram
+}
+
+func newCounterVec(names ...string) *counterVec {
+	return &counterVec{names: names, values: make(map[string]float64)}
+}
+
+func newHistogramVec(buckets []float64, names ...string) *histogramVec {
+	return &histogramVec{names: names, buckets: buckets, values: make(map[string]*histogram)}
+}
+
+// formatLabels renders the label set without the braces.
+func formatLabels(names, values []string) string {
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + `="` + labelEscaper.Replace(values[i]) + `"`
+	}
+	return strings.Join(pairs, ",")
+}
+
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func writeHeader(w io.Writer, name, help, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func writeSample(w io.Writer, name, labels string, value float64) {
+	if labels != "" {
+		labels = "{" + labels + "}"
+	}
+	fmt.Fprintf(w, "%s%s %s\n", name, labels, formatValue(value))
+}
+
+// Returns the keys of the map in a stable order.
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (c *counterVec) Add(value float64, labels ...string) {
+	key := formatLabels(c.names, labels)
+	c.mutex.Lock()
+	c.values[key] += value
+	c.mutex.Unlock()
+}
+
+func (c *counterVec) Inc(labels ...string) {
+	c.Add(1, labels...)
+}
+
+func (c *counterVec) write(w io.Writer, name, help string) {
+	writeHeader(w, name, help, "counter")
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	keys := make(map[string]bool)
+	for k := range c.values {
+		keys[k] = true
+	}
+	for _, k := range sortedKeys(keys) {
+		writeSample(w, name, k, c.values[k])
+	}
+}
+
+func (h *histogramVec) Observe(value float64, labels ...string) {
+	key := formatLabels(h.names, labels)
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	s, ok := h.values[key]
+	if !ok {
+		s = &histogram{counts: make([]uint64, len(h.buckets))}
+		h.values[key] = s
+	}
+	// values above the last bucket are only contained in +Inf
+	if i := sort.SearchFloat64s(h.buckets, value); i < len(h.buckets) {
+		s.counts[i]++
+	}
+	s.sum += value
+	s.count++
+}
+
+func (h *histogramVec) write(w io.Writer, name, help string) {
+	writeHeader(w, name, help, "histogram")
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	keys := make(map[string]bool)
+	for k := range h.values {
+		keys[k] = true
+	}
+	for _, k := range sortedKeys(keys) {
+		s := h.values[k]
+		prefix := k
+		if prefix != "" {
+			prefix += ","
+		}
+		cumulative := uint64(0)
+		for i, bound := range h.buckets {
+			cumulative += s.counts[i]
+			writeSample(w, name+"_bucket", prefix+`le="`+formatValue(bound)+`"`, float64(cumulative))
+		}
+		writeSample(w, name+"_bucket", prefix+`le="+Inf"`, float64(s.count))
+		writeSample(w, name+"_sum", k, s.sum)
+		writeSample(w, name+"_count", k, float64(s.count))
+	}
+}
+
+// observePlanner records the statistics of a route planner run.
+func observePlanner(stats route.PlannerStats) {
+	phaseDuration.Observe(stats.Snapping.Seconds(), "snapping")
+	phaseDuration.Observe(stats.LegSearch.Seconds(), "leg_search")
+	phaseDuration.Observe(stats.Elaboration.Seconds(), "elaboration")
+	settledVertices.Observe(float64(stats.Settled))
+}
+
+// metrics writes all metrics in the Prometheus text format.
+func metrics(w http.ResponseWriter, r *http.Request) {
+	var buf bytes.Buffer
+	p := MetricsPrefix
+
+	requestCounter.write(&buf, p+"requests_total", "Number of HTTP requests by endpoint, travel mode and status.")
+	requestDuration.write(&buf, p+"request_duration_seconds", "Time to answer a HTTP request.")
+	writeHeader(&buf, p+"requests_in_flight", "Number of HTTP requests currently being processed.", "gauge")
+	writeSample(&buf, p+"requests_in_flight", "", float64(atomic.LoadInt64(&requestsActive)))
+
+	phaseDuration.write(&buf, p+"route_phase_seconds", "Time spent in the phases of a route request, summed up over all legs.")
+	settledVertices.write(&buf, p+"route_settled_vertices", "Number of vertices settled by all searches of a route request.")
+
+	writeHeader(&buf, p+"cache_hits_total", "Number of route requests answered from the cache.", "counter")
+	writeSample(&buf, p+"cache_hits_total", "", float64(atomic.LoadInt64(&cacheHits)))
+	writeHeader(&buf, p+"cache_misses_total", "Number of route requests not found in the cache.", "counter")
+	writeSample(&buf, p+"cache_misses_total", "", float64(atomic.LoadInt64(&cacheMisses)))
+	writeHeader(&buf, p+"cache_evictions_total", "Number of responses evicted from the cache.", "counter")
+	writeSample(&buf, p+"cache_evictions_total", "", float64(atomic.LoadInt64(&cacheEvictions)))
+	if FlagCaching {
+		entries, size := cache.Stats()
+		writeHeader(&buf, p+"cache_entries", "Number of cached responses.", "gauge")
+		writeSample(&buf, p+"cache_entries", "", float64(entries))
+		writeHeader(&buf, p+"cache_bytes", "Total size of the cached responses.", "gauge")
+		writeSample(&buf, p+"cache_bytes", "", float64(size))
+	}
+
+	data := AcquireDataset()
+	mappedSize, loaded := data.MappedSize, data.Loaded
+	data.Release()
+	writeHeader(&buf, p+"graph_mapped_bytes", "Size of the memory mapped graph files.", "gauge")
+	writeSample(&buf, p+"graph_mapped_bytes", "", float64(mappedSize))
+	writeHeader(&buf, p+"graph_loaded_timestamp_seconds", "Time when the graph was loaded.", "gauge")
+	writeSample(&buf, p+"graph_loaded_timestamp_seconds", "", float64(loaded.Unix()))
+
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+	writeHeader(&buf, "go_goroutines", "Number of goroutines that currently exist.", "gauge")
+	writeSample(&buf, "go_goroutines", "", float64(runtime.NumGoroutine()))
+	writeHeader(&buf, "go_memstats_heap_alloc_bytes", "Number of heap bytes allocated and still in use.", "gauge")
+	writeSample(&buf, "go_memstats_heap_alloc_bytes", "", float64(memStats.HeapAlloc))
+	writeHeader(&buf, "go_memstats_heap_sys_bytes", "Number of heap bytes obtained from the system.", "gauge")
+	writeSample(&buf, "go_memstats_heap_sys_bytes", "", float64(memStats.HeapSys))
+	writeHeader(&buf, "go_memstats_sys_bytes", "Number of bytes obtained from the system.", "gauge")
+	writeSample(&buf, "go_memstats_sys_bytes", "", float64(memStats.Sys))
+	writeHeader(&buf, "go_gc_runs_total", "Number of completed GC cycles.", "counter")
+	writeSample(&buf, "go_gc_runs_total", "", float64(memStats.NumGC))
+
+	w.Header().Set("Content-Type", ContentTypeMetrics)
+	w.Write(buf.Bytes())
+}
@@ -0,0 +1,64 @@
+/*
+ * Copyright 2014 Florian Benz, Steven Schäfer, Bernhard Schommer
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestCounterVec(t *testing.T) {
+	c := newCounterVec("endpoint", "status")
+	c.Inc("/routes", "200")
+	c.Inc("/routes", "200")
+	c.Inc("/x\"y", "400")
+
+	var buf bytes.Buffer
+	c.write(&buf, "requests_total", "Number of requests.")
+	expected := `# HELP requests_total Number of requests.
+# TYPE requests_total counter
+requests_total{endpoint="/routes",status="200"} 2
+requests_total{endpoint="/x\"y",status="400"} 1
+`
+	if buf.String() != expected {
+		t.Errorf("Got\n%s\nexpected\n%s", buf.String(), expected)
+	}
+}
+
+func TestHistogramVec(t *testing.T) {
+	h := newHistogramVec([]float64{0.1, 1})
+	h.Observe(0.05)
+	h.Observe(0.1)
+	h.Observe(0.5)
+	h.Observe(3)
+
+	var buf bytes.Buffer
+	h.write(&buf, "latency_seconds", "Latency.")
+	expected := []string{
+		`latency_seconds_bucket{le="0.1"} 2`,
+		`latency_seconds_bucket{le="1"} 3`,
+		`latency_seconds_bucket{le="+Inf"} 4`,
+		`latency_seconds_sum 3.65`,
+		`latency_seconds_count 4`,
+	}
+	for _, line := range expected {
+		if !strings.Contains(buf.String(), line+"\n") {
+			t.Errorf("Missing %q in\n%s", line, buf.String())
+		}
+	}
+}
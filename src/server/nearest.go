@@ -0,0 +1,105 @@
+/*
+ * Copyright 2014 Florian Benz, Steven Schäfer, Bernhard Schommer
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Snapping of a coordinate to the closest points in the graph
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"route"
+	"strconv"
+)
+
+const (
+	ParameterNumber = "number"
+
+	// Maximum number of returned points
+	MaxNearest = 100
+)
+
+type NearestResult struct {
+	Waypoints []NearestWaypoint `json:"waypoints"`
+}
+
+type NearestWaypoint struct {
+	Location route.Point `json:"location"`
+	// Distance in meter between the requested and the snapped point
+	Distance float64 `json:"distance"`
+	// Cluster of the snapped point, -1 for the overlay graph
+	Cluster int `json:"cluster"`
+	// The snapped point is either the vertex itself (edge == -1) or on the
+	// edge starting at the vertex. Both are local to the cluster.
+	Vertex int `json:"vertex"`
+	Edge   int `json:"edge"`
+}
+
+// nearest returns the number (default 1) closest points in the graph for the
+// given point that are accessible with the travel mode.
+func nearest(w http.ResponseWriter, r *http.Request) {
+	urlParameter := r.URL.Query()
+
+	if urlParameter[ParameterPoint] == nil {
+		http.Error(w, "no point", http.StatusBadRequest)
+		return
+	}
+	points, err := getCoordinates(urlParameter[ParameterPoint][0])
+	if err != nil || len(points) != 1 {
+		http.Error(w, "wrong point", http.StatusBadRequest)
+		return
+	}
+
+	travelmode, err := getTravelmode(urlParameter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	record(w).travelmode = travelmode
+
+	number := 1
+	if urlParameter[ParameterNumber] != nil {
+		number, err = strconv.Atoi(urlParameter[ParameterNumber][0])
+		if err != nil || number <= 0 || number > MaxNearest {
+			http.Error(w, "wrong number", http.StatusBadRequest)
+			return
+		}
+	}
+
+	data := AcquireDataset()
+	defer data.Release()
+	neighbors := data.KdTree.KNearestNeighbors(points[0], getTransport(travelmode), number)
+	result := NearestResult{Waypoints: make([]NearestWaypoint, len(neighbors))}
+	for i, n := range neighbors {
+		result.Waypoints[i] = NearestWaypoint{
+			Location: route.StepToPoint(n.Coordinate),
+			Distance: n.Distance,
+			Cluster:  n.Location.Cluster,
+			Vertex:   int(n.Location.Vertex()),
+			Edge:     int(n.Location.Edge()),
+		}
+	}
+
+	jsonResult, err := json.Marshal(result)
+	if err != nil {
+		http.Error(w, "unable to create a proper JSON object", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.Write(jsonResult)
+}
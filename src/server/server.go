@@ -19,17 +19,17 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
-	"errors"
 	"flag"
 	"fmt"
 	"geo"
 	"graph"
 	"html/template"
 	"io"
-	"kdtree"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"route"
 	"runtime"
@@ -47,11 +47,22 @@ const (
 	ParameterMetric     = "metric"
 	ParameterAvoid      = "avoid"
 
+	ParameterAlternatives = "alternatives"
+	MaxAlternatives       = 3
+
+	// RFC 3339 time (or "now") at which the route starts. The conditional
+	// restrictions are evaluated in the time zone of the given offset.
+	ParameterDeparture = "departure"
+	DepartureNow       = "now"
+
 	SeparatorWaypoints = "|"
 	SeparatorLatLng    = ","
 
 	DefaultPort = 23401
 
+	// Status of a request whose client has disconnected (as used by nginx)
+	StatusClientClosedRequest = 499
+
 	TravelmodeCar  = "driving"
 	TravelmodeFoot = "walking"
 	TravelmodeBike = "bicycling"
@@ -61,26 +72,36 @@ const (
 )
 
 var (
-	featureResponse []byte
-
 	// command line flags
 	FlagDir        string
 	FlagPort       int
 	FlagLogging    bool
+	FlagLogDir     string
+	FlagLogMaxSize int
 	FlagCpuProfile string
 	FlagCaching    bool
+	FlagCacheSize  int
+	FlagCacheTTL   time.Duration
+	FlagTimeout    time.Duration
+	FlagAdmin      string
+	FlagAdminToken string
 
 	startupTime time.Time
-
-	clusterGraph *graph.ClusterGraph
 )
 
 func init() {
 	flag.StringVar(&FlagDir, "dir", "", "base directory of the graph")
 	flag.IntVar(&FlagPort, "port", DefaultPort, "the port where the server is running")
 	flag.BoolVar(&FlagLogging, "logging", false, "enables logging of requests")
+	flag.StringVar(&FlagLogDir, "logdir", ".", "directory of the access log")
+	flag.IntVar(&FlagLogMaxSize, "logsize", 100, "maximum size of an access log file in MB, 0 for no limit")
 	flag.StringVar(&FlagCpuProfile, "cpuprofile", "", "enables CPU profiling")
 	flag.BoolVar(&FlagCaching, "caching", false, "enables caching of route requests")
+	flag.IntVar(&FlagCacheSize, "cachesize", 100, "maximum size of the route cache in MB")
+	flag.DurationVar(&FlagCacheTTL, "cachettl", 0, "maximum age of a cached route, e.g. 1h, 0 for no limit")
+	flag.DurationVar(&FlagTimeout, "timeout", 30*time.Second, "maximum time to compute a response, 0 for no limit")
+	flag.StringVar(&FlagAdmin, "admin", "", "address (host:port or unix:path) of the admin API, disabled if empty")
+	flag.StringVar(&FlagAdminToken, "admintoken", "", "file containing the token of the admin API")
 }
 
 func main() {
@@ -97,34 +118,33 @@ func main() {
 	// map URLs to functions
 	http.HandleFunc("/", root)
 	http.HandleFunc("/routes", routes)
+	http.HandleFunc("/v2/routes", routesV2)
+	http.HandleFunc("/table", table)
+	http.HandleFunc("/isochrone", isochrone)
+	http.HandleFunc("/nearest", nearest)
+	http.HandleFunc("/match", match)
+	http.HandleFunc("/trip", trip)
 	http.HandleFunc("/features", features)
 	http.HandleFunc("/awesome", test)
 	http.HandleFunc("/status", status)
+	http.HandleFunc("/metrics", metrics)
 	http.HandleFunc("/forward", forward)
-	http.HandleFunc("/stop6bbw753i08wn1ca", stop)
 
-	// start the HTTP server
+	// start the HTTP server, which runs until it is shut down
 	log.Println("Serving...")
 	startupTime = time.Now()
-	err := http.ListenAndServe(":"+strconv.Itoa(FlagPort), nil)
+	err := serve(":" + strconv.Itoa(FlagPort))
 	if err != nil {
 		log.Fatal("ListenAndServe: ", err)
 	}
+	log.Println("Stopped")
 }
 
 // setup does some initialization before the HTTP server starts.
 func setup() error {
-	// Load the cluster graphs and the overlay graph as well as the
-	// precomputed matrices for the metrics.
+	// Load the graph, the matrices and the k-d trees.
 	var err error
-	clusterGraph, err = graph.OpenClusterGraph(FlagDir, true /* load matrices */)
-	if err != nil {
-		return err
-	}
-
-	// Load the k-d trees for the cluster and the overlay graph. In addition,
-	// the bounding boxes for the clusters are loaded.
-	err = kdtree.LoadKdTree(clusterGraph, FlagDir)
+	dataset, err = OpenDataset(FlagDir)
 	if err != nil {
 		return err
 	}
@@ -136,21 +156,6 @@ func setup() error {
 		InitCache()
 	}
 
-	// Create the feature response only once (no change at runtime).
-	supportedTravelmodes := TravelMode{Driving: true, Walking: true, Bicycling: true}
-	supportedMetrics := Metric{Distance: true, Time: true}
-	supportedRestrictions := Avoid{Ferries: false} // not implemented yet.
-	supportedFeatures := &Features{
-		TravelMode: supportedTravelmodes,
-		Metric:     supportedMetrics,
-		Avoid:      supportedRestrictions,
-	}
-	if fp, err := json.Marshal(supportedFeatures); err != nil {
-		return err
-	} else {
-		// only assign if the creation was successful
-		featureResponse = fp
-	}
 	return nil
 }
 
@@ -161,7 +166,6 @@ func root(w http.ResponseWriter, r *http.Request) {
 
 // routes returns routes according to the given parameters.
 func routes(w http.ResponseWriter, r *http.Request) {
-	startTime := time.Now()
 
 	// profiling if enabled
 	if FlagCpuProfile != "" {
@@ -188,29 +192,20 @@ func routes(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// travel mode, using strings as constant
-	travelmode := TravelmodeCar // Per default driving
-	if urlParameter[ParameterTravelmode] != nil {
-		if urlParameter[ParameterTravelmode][0] == TravelmodeCar ||
-			urlParameter[ParameterTravelmode][0] == TravelmodeFoot ||
-			urlParameter[ParameterTravelmode][0] == TravelmodeBike {
-			travelmode = urlParameter[ParameterTravelmode][0]
-		} else {
-			http.Error(w, "wrong travelmode", http.StatusBadRequest)
-			return
-		}
+	travelmode, err := getTravelmode(urlParameter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
+	record(w).travelmode = travelmode
 	transport := getTransport(travelmode)
 
 	// Metrics
 	metric := graph.Time
 	if urlParameter[ParameterMetric] != nil {
-		switch urlParameter[ParameterMetric][0] {
-		case MetricDistance:
-			metric = graph.Distance
-		case MetricTime:
-			// nothing to do here
-		default:
-			http.Error(w, "wrong metric", http.StatusBadRequest)
+		metric, err = getMetric(urlParameter[ParameterMetric][0])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 	}
@@ -218,7 +213,7 @@ func routes(w http.ResponseWriter, r *http.Request) {
 	// Restrictions
 	avoidFerries := false
 	if urlParameter[ParameterAvoid] != nil {
-		if urlParameter[ParameterAvoid][0] == "ferries" {
+		if urlParameter[ParameterAvoid][0] == AvoidFerries {
 			avoidFerries = true
 		} else {
 			http.Error(w, "wrong avoid", http.StatusBadRequest)
@@ -226,70 +221,234 @@ func routes(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	cachingKey := urlParameter[ParameterWaypoints][0] + travelmode
-	if FlagCaching {
+	// Alternative routes
+	alternatives := 0
+	if urlParameter[ParameterAlternatives] != nil {
+		alternatives, err = strconv.Atoi(urlParameter[ParameterAlternatives][0])
+		if err != nil || alternatives < 0 || alternatives > MaxAlternatives {
+			http.Error(w, "wrong alternatives", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Departure time
+	departure := time.Time{}
+	// A departure "now" moves with the clock, so the cached response would
+	// only be found by requests within the same minute. We do not cache
+	// these requests instead of filling the cache with entries which are
+	// hardly ever used.
+	caching := FlagCaching
+	if urlParameter[ParameterDeparture] != nil {
+		departure, err = getDeparture(urlParameter[ParameterDeparture][0])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		caching = caching && urlParameter[ParameterDeparture][0] != DepartureNow
+	}
+
+	if err := checkAlternatives(alternatives, len(waypoints), departure); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Output format
+	format, contentType := FormatJSON, ContentTypeJSON
+	if urlParameter[ParameterFormat] != nil {
+		format, contentType, err = getFormat(urlParameter[ParameterFormat][0])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Geometry representation, only used for the JSON format
+	geometryOptions, err := getGeometryOptions(urlParameter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Language and units of the texts
+	locale, err := getLocale(urlParameter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	cachingKey := (&RouteKey{
+		Waypoints:    waypoints,
+		Travelmode:   travelmode,
+		Metric:       metric,
+		AvoidFerries: avoidFerries,
+		Alternatives: alternatives,
+		Departure:    departure,
+		Format:       format,
+		Geometry:     geometryOptions,
+		Locale:       locale,
+	}).String()
+	record(w).waypoints = len(waypoints)
+	if caching {
 		if resp, ok := CacheGet(cachingKey); ok {
+			record(w).cacheHit = true
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+			w.Header().Set("Content-Type", contentType)
 			w.Write(resp)
 			return
 		}
 	}
 
 	// Do the actual route computation.
+	data := AcquireDataset()
+	defer data.Release()
+	if avoidFerries && !data.Graph.Overlay.FerryFreeMatrices() {
+		http.Error(w, "avoid ferries is not supported by the graph", http.StatusBadRequest)
+		return
+	}
+	ctx, cancel := plannerContext(r)
+	defer cancel()
 	planner := &route.RoutePlanner{
-		Graph:           clusterGraph,
+		Graph:           data.Graph,
+		KdTree:          data.KdTree,
 		Waypoints:       waypoints,
 		Transport:       transport,
 		Metric:          metric,
 		AvoidFerries:    avoidFerries,
+		Alternatives:    alternatives,
+		Departure:       departure,
 		ConcurrentKd:    true,
 		ConcurrentLegs:  true,
 		ConcurrentPaths: true,
+		Context:         ctx,
 	}
 	result := planner.Run()
+	record(w).stats = &planner.Stats
+	if err := planner.Err(); err != nil {
+		writeCancelled(w, err)
+		return
+	}
 
-	endTime := time.Now()
-	defer LogRequest(r, startTime, endTime)
-
-	jsonResult, err := json.Marshal(result)
+	result.Localize(locale)
+	if format == FormatJSON {
+		result.ApplyGeometryOptions(geometryOptions)
+	}
+	encodedResult, err := encodeResult(result, format)
 	if err != nil {
-		http.Error(w, "unable to create a proper JSON object", http.StatusInternalServerError)
+		http.Error(w, "unable to encode the result", http.StatusInternalServerError)
 		return
 	}
-	if FlagCaching {
-		CachePut(cachingKey, jsonResult)
+	if caching {
+		CachePut(cachingKey, encodedResult)
 	}
 
 	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
-	w.Write(jsonResult)
+	w.Header().Set("Content-Type", contentType)
+	w.Write(encodedResult)
+}
+
+// plannerContext returns the context of the computation of a request, which
+// is done as soon as the client disconnects or the limit given by -timeout
+// is exceeded.
+func plannerContext(r *http.Request) (context.Context, context.CancelFunc) {
+	if FlagTimeout > 0 {
+		return context.WithTimeout(r.Context(), FlagTimeout)
+	}
+	return context.WithCancel(r.Context())
+}
+
+// writeCancelled answers a request whose computation was stopped by the
+// given error of its planner context.
+func writeCancelled(w http.ResponseWriter, err error) {
+	if err == context.DeadlineExceeded {
+		http.Error(w, "computation timed out", http.StatusGatewayTimeout)
+	} else {
+		http.Error(w, "request cancelled", StatusClientClosedRequest)
+	}
 }
 
 // getWaypoints parses the given waypoints.
 func getWaypoints(waypointString string) ([]geo.Coordinate, error) {
-	waypointStrings := strings.Split(waypointString, SeparatorWaypoints)
-	if len(waypointStrings) < 2 {
-		return nil, errors.New("too few waypoints. at least 2 waypoints are required")
+	points, err := getCoordinates(waypointString)
+	if err != nil {
+		return nil, err
 	}
+	if len(points) < 2 {
+		return nil, newErrorV2(ErrorInvalidWaypoints, ParameterWaypoints,
+			"too few waypoints. at least 2 waypoints are required")
+	}
+	return points, nil
+}
 
+// getCoordinates parses a list of coordinates in the waypoint format.
+func getCoordinates(coordinateString string) ([]geo.Coordinate, error) {
+	waypointStrings := strings.Split(coordinateString, SeparatorWaypoints)
 	points := make([]geo.Coordinate, len(waypointStrings))
 	for i, v := range waypointStrings {
 		coordinateStrings := strings.Split(v, SeparatorLatLng)
 		if len(coordinateStrings) != 2 {
-			return nil, errors.New("wrong formatted coordinate in waypoint list: " + v)
+			return nil, newErrorV2(ErrorInvalidWaypoints, ParameterWaypoints,
+				"wrong formatted coordinate in waypoint list: %s", v)
 		}
 		lat, err := strconv.ParseFloat(coordinateStrings[0], 64 /* bitSize */)
 		if err != nil {
-			return nil, errors.New("wrong formatted number in waypoint list: " + coordinateStrings[0])
+			return nil, newErrorV2(ErrorInvalidWaypoints, ParameterWaypoints,
+				"wrong formatted number in waypoint list: %s", coordinateStrings[0])
 		}
 		lng, err := strconv.ParseFloat(coordinateStrings[1], 64 /* bitSize */)
 		if err != nil {
-			return nil, errors.New("wrong formatted number in waypoint list: " + coordinateStrings[1])
+			return nil, newErrorV2(ErrorInvalidWaypoints, ParameterWaypoints,
+				"wrong formatted number in waypoint list: %s", coordinateStrings[1])
 		}
 		points[i] = geo.Coordinate{lat, lng}
 	}
 	return points, nil
 }
 
+// getTravelmode parses the travelmode parameter, which defaults to driving.
+func getTravelmode(urlParameter url.Values) (string, error) {
+	if urlParameter[ParameterTravelmode] == nil {
+		return TravelmodeCar, nil
+	}
+	switch travelmode := urlParameter[ParameterTravelmode][0]; travelmode {
+	case TravelmodeCar, TravelmodeFoot, TravelmodeBike:
+		return travelmode, nil
+	}
+	return "", invalidOption(ParameterTravelmode, "wrong travelmode")
+}
+
+// getMetric parses the value of a metric parameter.
+func getMetric(metric string) (graph.Metric, error) {
+	switch metric {
+	case MetricDistance:
+		return graph.Distance, nil
+	case MetricTime:
+		return graph.Time, nil
+	}
+	return graph.Time, invalidOption(ParameterMetric, "wrong metric")
+}
+
+// getDeparture parses the value of a departure parameter.
+func getDeparture(departure string) (time.Time, error) {
+	if departure == DepartureNow {
+		return time.Now(), nil
+	}
+	t, err := time.Parse(time.RFC3339, departure)
+	if err != nil {
+		return time.Time{}, invalidOption(ParameterDeparture, "wrong departure")
+	}
+	return t, nil
+}
+
+// checkAlternatives rejects alternative routes where the planner does not
+// support them, instead of silently returning a single route.
+func checkAlternatives(alternatives, waypoints int, departure time.Time) error {
+	if alternatives > 0 && (waypoints != 2 || !departure.IsZero()) {
+		return invalidOption(ParameterAlternatives,
+			"alternatives are only supported between 2 waypoints without departure")
+	}
+	return nil
+}
+
 func getTransport(travelmode string) graph.Transport {
 	switch travelmode {
 	case TravelmodeCar:
@@ -302,23 +461,18 @@ func getTransport(travelmode string) graph.Transport {
 	return graph.Car
 }
 
-// features handles feature requests.
+// features handles feature requests. They depend on the current data set.
 func features(w http.ResponseWriter, r *http.Request) {
-	startTime := time.Now()
+	data := AcquireDataset()
+	response, err := json.Marshal(NewFeatures(data.Graph))
+	data.Release()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
-	w.Write(featureResponse)
-	LogRequest(r, startTime, time.Now())
-}
-
-// stop allows terminating the server a request.
-func stop(w http.ResponseWriter, r *http.Request) {
-	startTime := time.Now()
-	LogRequest(r, startTime, time.Now())
-	// wait 5 seconds so that the logger has time to write the request to file
-	time.Sleep(5 * time.Second)
-
-	os.Exit(1)
+	w.Write(response)
 }
 
 // forward redirects the routing request to another port. This is used by our test page so
@@ -367,8 +521,12 @@ func status(w http.ResponseWriter, r *http.Request) {
 	minutes := int64(uptime.Minutes()) % 60
 	statusInfo["uptimeHours"] = strconv.FormatInt(hours, 10 /* base */)
 	statusInfo["uptimeMinutes"] = strconv.FormatInt(minutes, 10 /* base */)
-	statusInfo["cacheCurrent"] = strconv.FormatInt(int64(cache.Size/1024), 10 /* base */)
-	statusInfo["cacheMax"] = strconv.FormatInt(int64(MaxCacheSize/1024), 10 /* base */)
+	cacheSize := 0
+	if FlagCaching {
+		_, cacheSize = cache.Stats()
+	}
+	statusInfo["cacheCurrent"] = strconv.FormatInt(int64(cacheSize/1024), 10 /* base */)
+	statusInfo["cacheMax"] = strconv.FormatInt(int64(FlagCacheSize*1024), 10 /* base */)
 
 	if err := statusTemplate.Execute(w, statusInfo); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
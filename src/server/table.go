@@ -0,0 +1,108 @@
+/*
+ * Copyright 2014 Florian Benz, Steven Schäfer, Bernhard Schommer
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Distance/duration matrices between many sources and destinations
+
+package main
+
+import (
+	"encoding/json"
+	"graph"
+	"net/http"
+	"route"
+)
+
+const (
+	ParameterSources      = "sources"
+	ParameterDestinations = "destinations"
+
+	// Maximum number of entries in one table (sources times destinations)
+	MaxTableSize = 100 * 100
+)
+
+// table returns the distances and/or durations between all pairs of sources
+// and destinations. Without a metric parameter both matrices are computed.
+func table(w http.ResponseWriter, r *http.Request) {
+	urlParameter := r.URL.Query()
+
+	if urlParameter[ParameterSources] == nil || urlParameter[ParameterDestinations] == nil {
+		http.Error(w, "no sources or destinations", http.StatusBadRequest)
+		return
+	}
+	sources, err := getCoordinates(urlParameter[ParameterSources][0])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	destinations, err := getCoordinates(urlParameter[ParameterDestinations][0])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(sources)*len(destinations) > MaxTableSize {
+		http.Error(w, "too many sources and destinations", http.StatusBadRequest)
+		return
+	}
+
+	travelmode, err := getTravelmode(urlParameter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	record(w).travelmode = travelmode
+	record(w).waypoints = len(sources) + len(destinations)
+
+	metrics := []graph.Metric{graph.Distance, graph.Time}
+	if urlParameter[ParameterMetric] != nil {
+		metric, err := getMetric(urlParameter[ParameterMetric][0])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		metrics = []graph.Metric{metric}
+	}
+
+	data := AcquireDataset()
+	defer data.Release()
+	ctx, cancel := plannerContext(r)
+	defer cancel()
+	planner := &route.TablePlanner{
+		Graph:          data.Graph,
+		KdTree:         data.KdTree,
+		Sources:        sources,
+		Destinations:   destinations,
+		Transport:      getTransport(travelmode),
+		Metrics:        metrics,
+		ConcurrentKd:   true,
+		ConcurrentRows: true,
+		Context:        ctx,
+	}
+	result := planner.Run()
+	if err := planner.Err(); err != nil {
+		writeCancelled(w, err)
+		return
+	}
+
+	jsonResult, err := json.Marshal(result)
+	if err != nil {
+		http.Error(w, "unable to create a proper JSON object", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.Write(jsonResult)
+}
@@ -0,0 +1,156 @@
+/*
+ * Copyright 2014 Florian Benz, Steven Schäfer, Bernhard Schommer
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Routes visiting all waypoints in the cheapest order
+
+package main
+
+import (
+	"encoding/json"
+	"graph"
+	"net/http"
+	"route"
+	"strconv"
+)
+
+const (
+	ParameterRoundtrip   = "roundtrip"
+	ParameterSource      = "source"
+	ParameterDestination = "destination"
+
+	SourceFirst     = "first"
+	SourceAny       = "any"
+	DestinationLast = "last"
+	DestinationAny  = "any"
+
+	// Maximum number of waypoints of a trip
+	MaxTripWaypoints = 100
+)
+
+// trip returns a route visiting all waypoints in the order which minimizes
+// the total duration or distance. By default this is a round trip starting
+// at the first waypoint. With roundtrip=false the source (first|any) and the
+// destination (last|any) can be fixed.
+func trip(w http.ResponseWriter, r *http.Request) {
+	urlParameter := r.URL.Query()
+
+	if urlParameter[ParameterWaypoints] == nil {
+		http.Error(w, "no waypoints", http.StatusBadRequest)
+		return
+	}
+	waypoints, err := getWaypoints(urlParameter[ParameterWaypoints][0])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(waypoints) > MaxTripWaypoints {
+		http.Error(w, "too many waypoints", http.StatusBadRequest)
+		return
+	}
+
+	travelmode, err := getTravelmode(urlParameter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	record(w).travelmode = travelmode
+	record(w).waypoints = len(waypoints)
+
+	metric := graph.Time
+	if urlParameter[ParameterMetric] != nil {
+		metric, err = getMetric(urlParameter[ParameterMetric][0])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	roundTrip := true
+	if urlParameter[ParameterRoundtrip] != nil {
+		roundTrip, err = strconv.ParseBool(urlParameter[ParameterRoundtrip][0])
+		if err != nil {
+			http.Error(w, "wrong roundtrip flag", http.StatusBadRequest)
+			return
+		}
+	}
+
+	fixedStart := true
+	if urlParameter[ParameterSource] != nil {
+		switch urlParameter[ParameterSource][0] {
+		case SourceFirst:
+			fixedStart = true
+		case SourceAny:
+			fixedStart = false
+		default:
+			http.Error(w, "wrong source", http.StatusBadRequest)
+			return
+		}
+	}
+
+	fixedEnd := false
+	if urlParameter[ParameterDestination] != nil {
+		switch urlParameter[ParameterDestination][0] {
+		case DestinationLast:
+			fixedEnd = true
+		case DestinationAny:
+			fixedEnd = false
+		default:
+			http.Error(w, "wrong destination", http.StatusBadRequest)
+			return
+		}
+	}
+
+	locale, err := getLocale(urlParameter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	data := AcquireDataset()
+	defer data.Release()
+	ctx, cancel := plannerContext(r)
+	defer cancel()
+	planner := &route.TripPlanner{
+		Graph:          data.Graph,
+		KdTree:         data.KdTree,
+		Waypoints:      waypoints,
+		Transport:      getTransport(travelmode),
+		Metric:         metric,
+		RoundTrip:      roundTrip,
+		FixedStart:     fixedStart,
+		FixedEnd:       fixedEnd,
+		ConcurrentKd:   true,
+		ConcurrentRows: true,
+		ConcurrentLegs: true,
+		Context:        ctx,
+	}
+	result := planner.Run()
+	if err := planner.Err(); err != nil {
+		writeCancelled(w, err)
+		return
+	}
+	result.Localize(locale)
+
+	jsonResult, err := json.Marshal(result)
+	if err != nil {
+		http.Error(w, "unable to create a proper JSON object", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.Write(jsonResult)
+}
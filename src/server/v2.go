@@ -0,0 +1,349 @@
+/*
+ * Copyright 2014 Florian Benz, Steven Schäfer, Bernhard Schommer
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Version 2 of the route API
+//
+// The request is a JSON object in the body of a POST request, see
+// RouteRequestV2. Errors are reported as JSON objects with a machine
+// readable code and the offending field of the request, e.g.,
+//   {"error": {"code": "InvalidWaypoints", "message": "...", "field": "waypoints[1].bearing"}}
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"geo"
+	"graph"
+	"net/http"
+	"route"
+	"time"
+)
+
+const (
+	// Maximum size of a request body in bytes
+	MaxRequestSize = 1 << 20
+	// Maximum number of waypoints of a single request
+	MaxWaypointsV2 = 200
+	// Allowed deviation from the bearing if none is given
+	DefaultBearingRange = 45
+
+	WaypointBreak = "break"
+	WaypointVia   = "via"
+
+	AvoidFerries = "ferries"
+)
+
+// Error codes of the version 2 API
+const (
+	ErrorMethodNotAllowed = "MethodNotAllowed"
+	ErrorInvalidRequest   = "InvalidRequest"
+	ErrorInvalidWaypoints = "InvalidWaypoints"
+	ErrorInvalidOptions   = "InvalidOptions"
+	ErrorNoSegment        = "NoSegment"
+	ErrorTimeout          = "Timeout"
+	ErrorCancelled        = "Cancelled"
+	ErrorInternal         = "InternalError"
+)
+
+type WaypointV2 struct {
+	Lat float64 `json:"lat"`
+	Lng float64 `json:"lng"`
+	// Direction of travel in degrees clockwise from north and the allowed
+	// deviation in degrees.
+	Bearing      *int `json:"bearing,omitempty"`
+	BearingRange *int `json:"bearing_range,omitempty"`
+	// Maximum distance in meter between the waypoint and the road
+	Radius *float64 `json:"radius,omitempty"`
+	// "break" (default) or "via"
+	Type string `json:"type,omitempty"`
+}
+
+type RouteRequestV2 struct {
+	Waypoints    []WaypointV2 `json:"waypoints"`
+	Travelmode   string       `json:"travelmode,omitempty"`
+	Metric       string       `json:"metric,omitempty"`
+	Avoid        []string     `json:"avoid,omitempty"`
+	Alternatives int          `json:"alternatives,omitempty"`
+	Departure    string       `json:"departure,omitempty"`
+	Language     string       `json:"language,omitempty"`
+	Units        string       `json:"units,omitempty"`
+	Geometries   string       `json:"geometries,omitempty"`
+	Overview     string       `json:"overview,omitempty"`
+	Steps        *bool        `json:"steps,omitempty"`
+}
+
+type ErrorV2 struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// The offending part of the request, e.g., "waypoints[2].bearing"
+	Field string `json:"field,omitempty"`
+}
+
+type ErrorResponseV2 struct {
+	Error ErrorV2 `json:"error"`
+}
+
+func (e *ErrorV2) Error() string {
+	return e.Message
+}
+
+func newErrorV2(code, field, format string, args ...interface{}) *ErrorV2 {
+	return &ErrorV2{Code: code, Field: field, Message: fmt.Sprintf(format, args...)}
+}
+
+// writeErrorV2 replies to the request with the error as JSON object.
+func writeErrorV2(w http.ResponseWriter, status int, e *ErrorV2) {
+	body, _ := json.Marshal(ErrorResponseV2{*e})
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", ContentTypeJSON)
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// invalidOption returns the error of the parameter helpers, which are
+// shared with the query string API, for an invalid value of the parameter.
+func invalidOption(parameter, format string, args ...interface{}) error {
+	return newErrorV2(ErrorInvalidOptions, parameter, format, args...)
+}
+
+// asErrorV2 returns the error of a parameter helper as ErrorV2.
+func asErrorV2(err error) *ErrorV2 {
+	if e, ok := err.(*ErrorV2); ok {
+		return e
+	}
+	return newErrorV2(ErrorInvalidOptions, "", "%v", err)
+}
+
+// routesV2 computes routes for a JSON request body, which is described by
+// RouteRequestV2. The response has the same format as the one of /routes.
+func routesV2(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		writeErrorV2(w, http.StatusMethodNotAllowed,
+			newErrorV2(ErrorMethodNotAllowed, "", "only POST requests are supported"))
+		return
+	}
+
+	var request RouteRequestV2
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, MaxRequestSize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&request); err != nil {
+		writeErrorV2(w, http.StatusBadRequest,
+			newErrorV2(ErrorInvalidRequest, "", "malformed request body: %v", err))
+		return
+	}
+
+	data := AcquireDataset()
+	defer data.Release()
+	planner, options, locale, e := plannerV2(&request, data)
+	if e != nil {
+		writeErrorV2(w, http.StatusBadRequest, e)
+		return
+	}
+	ctx, cancel := plannerContext(r)
+	defer cancel()
+	planner.Context = ctx
+	if request.Travelmode == "" {
+		record(w).travelmode = TravelmodeCar
+	} else {
+		record(w).travelmode = request.Travelmode
+	}
+	record(w).waypoints = len(request.Waypoints)
+	record(w).stats = &planner.Stats
+	if err := planner.Snap(); err != nil {
+		field := ""
+		if snapErr, ok := err.(*route.SnapError); ok {
+			field = fmt.Sprintf("waypoints[%d]", snapErr.Waypoint)
+		}
+		writeErrorV2(w, http.StatusBadRequest, newErrorV2(ErrorNoSegment, field, "%v", err))
+		return
+	}
+	result := planner.Run()
+	if err := planner.Err(); err != nil {
+		if err == context.DeadlineExceeded {
+			writeErrorV2(w, http.StatusGatewayTimeout,
+				newErrorV2(ErrorTimeout, "", "route computation timed out after %v", FlagTimeout))
+		} else {
+			writeErrorV2(w, StatusClientClosedRequest, newErrorV2(ErrorCancelled, "", "request cancelled"))
+		}
+		return
+	}
+
+	result.Localize(locale)
+	result.ApplyGeometryOptions(options)
+	jsonResult, err := json.Marshal(result)
+	if err != nil {
+		writeErrorV2(w, http.StatusInternalServerError,
+			newErrorV2(ErrorInternal, "", "unable to create a proper JSON object"))
+		return
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", ContentTypeJSON)
+	w.Write(jsonResult)
+}
+
+// plannerV2 validates the request and turns it into a route planner on the
+// given data set.
+func plannerV2(request *RouteRequestV2, data *Dataset) (*route.RoutePlanner, route.GeometryOptions, *route.Locale, *ErrorV2) {
+	geometryOptions := route.GeometryOptions{}
+	waypoints, waypointOptions, e := getWaypointsV2(request.Waypoints)
+	if e != nil {
+		return nil, geometryOptions, nil, e
+	}
+
+	// The remaining options share the parsing with the query string API.
+	parameters := make(map[string][]string)
+	set := func(name, value string) {
+		if value != "" {
+			parameters[name] = []string{value}
+		}
+	}
+	set(ParameterTravelmode, request.Travelmode)
+	set(ParameterLanguage, request.Language)
+	set(ParameterUnits, request.Units)
+	set(ParameterGeometries, request.Geometries)
+	set(ParameterOverview, request.Overview)
+	if request.Steps != nil {
+		set(ParameterSteps, fmt.Sprint(*request.Steps))
+	}
+
+	travelmode, err := getTravelmode(parameters)
+	if err != nil {
+		return nil, geometryOptions, nil, asErrorV2(err)
+	}
+	metric := graph.Time
+	if request.Metric != "" {
+		metric, err = getMetric(request.Metric)
+		if err != nil {
+			return nil, geometryOptions, nil, asErrorV2(err)
+		}
+	}
+	avoidFerries := false
+	for i, avoid := range request.Avoid {
+		if avoid != AvoidFerries {
+			return nil, geometryOptions, nil, newErrorV2(ErrorInvalidOptions,
+				fmt.Sprintf("avoid[%d]", i), "wrong avoid: %s", avoid)
+		}
+		avoidFerries = true
+	}
+	if avoidFerries && !data.Graph.Overlay.FerryFreeMatrices() {
+		return nil, geometryOptions, nil, newErrorV2(ErrorInvalidOptions, ParameterAvoid,
+			"avoid ferries is not supported by the graph")
+	}
+	if request.Alternatives < 0 || request.Alternatives > MaxAlternatives {
+		return nil, geometryOptions, nil, newErrorV2(ErrorInvalidOptions, ParameterAlternatives,
+			"alternatives has to be between 0 and %d", MaxAlternatives)
+	}
+	departure := time.Time{}
+	if request.Departure != "" {
+		departure, err = getDeparture(request.Departure)
+		if err != nil {
+			return nil, geometryOptions, nil, asErrorV2(err)
+		}
+	}
+	if err := checkAlternatives(request.Alternatives, len(waypoints), departure); err != nil {
+		return nil, geometryOptions, nil, asErrorV2(err)
+	}
+	locale, err := getLocale(parameters)
+	if err != nil {
+		return nil, geometryOptions, nil, asErrorV2(err)
+	}
+	geometryOptions, err = getGeometryOptions(parameters)
+	if err != nil {
+		return nil, geometryOptions, nil, asErrorV2(err)
+	}
+
+	planner := &route.RoutePlanner{
+		Graph:           data.Graph,
+		KdTree:          data.KdTree,
+		Waypoints:       waypoints,
+		Options:         waypointOptions,
+		Transport:       getTransport(travelmode),
+		Metric:          metric,
+		AvoidFerries:    avoidFerries,
+		Alternatives:    request.Alternatives,
+		Departure:       departure,
+		ConcurrentKd:    true,
+		ConcurrentLegs:  true,
+		ConcurrentPaths: true,
+	}
+	return planner, geometryOptions, locale, nil
+}
+
+// getWaypointsV2 validates the waypoints and their options.
+func getWaypointsV2(input []WaypointV2) ([]geo.Coordinate, []route.WaypointOptions, *ErrorV2) {
+	if len(input) < 2 {
+		return nil, nil, newErrorV2(ErrorInvalidWaypoints, "waypoints",
+			"too few waypoints. at least 2 waypoints are required")
+	}
+	if len(input) > MaxWaypointsV2 {
+		return nil, nil, newErrorV2(ErrorInvalidWaypoints, "waypoints",
+			"too many waypoints. at most %d waypoints are allowed", MaxWaypointsV2)
+	}
+
+	waypoints := make([]geo.Coordinate, len(input))
+	options := make([]route.WaypointOptions, len(input))
+	for i, w := range input {
+		field := fmt.Sprintf("waypoints[%d]", i)
+		if w.Lat < -90 || w.Lat > 90 || w.Lng < -180 || w.Lng > 180 {
+			return nil, nil, newErrorV2(ErrorInvalidWaypoints, field, "coordinate out of range")
+		}
+		waypoints[i] = geo.Coordinate{Lat: w.Lat, Lng: w.Lng}
+
+		if w.Bearing != nil {
+			if *w.Bearing < 0 || *w.Bearing >= 360 {
+				return nil, nil, newErrorV2(ErrorInvalidWaypoints, field+".bearing",
+					"bearing has to be between 0 and 359")
+			}
+			options[i].Bearing = *w.Bearing
+			options[i].BearingRange = DefaultBearingRange
+		}
+		if w.BearingRange != nil {
+			if w.Bearing == nil {
+				return nil, nil, newErrorV2(ErrorInvalidWaypoints, field+".bearing_range",
+					"bearing_range requires a bearing")
+			}
+			if *w.BearingRange <= 0 || *w.BearingRange > 180 {
+				return nil, nil, newErrorV2(ErrorInvalidWaypoints, field+".bearing_range",
+					"bearing_range has to be between 1 and 180")
+			}
+			options[i].BearingRange = *w.BearingRange
+		}
+		if w.Radius != nil {
+			if *w.Radius <= 0 {
+				return nil, nil, newErrorV2(ErrorInvalidWaypoints, field+".radius",
+					"radius has to be positive")
+			}
+			options[i].Radius = *w.Radius
+		}
+		switch w.Type {
+		case "", WaypointBreak:
+		case WaypointVia:
+			if i == 0 || i == len(input)-1 {
+				return nil, nil, newErrorV2(ErrorInvalidWaypoints, field+".type",
+					"the first and last waypoint cannot be via waypoints")
+			}
+			options[i].Via = true
+		default:
+			return nil, nil, newErrorV2(ErrorInvalidWaypoints, field+".type",
+				"wrong waypoint type: %s", w.Type)
+		}
+	}
+	return waypoints, options, nil
+}
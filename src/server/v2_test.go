@@ -0,0 +1,163 @@
+/*
+ * Copyright 2014 Florian Benz, Steven Schäfer, Bernhard Schommer
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"geo"
+	"graph"
+	"kdtree"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// A graph with a single vertex at the given coordinate.
+func vertexGraph(c geo.Coordinate) *graph.GraphFile {
+	lat, lng := c.Encode()
+	g := &graph.GraphFile{
+		FirstOut:    []uint32{0, 0},
+		FirstIn:     []uint32{graph.Sentinel},
+		Coordinates: []int32{lat, lng},
+	}
+	for t := range g.Access {
+		g.Access[t] = []byte{1}
+	}
+	return g
+}
+
+// A data set with a single vertex at 49.2, 7.0 in its only cluster and an
+// overlay vertex far away. It is good enough for the validation and the
+// snapping of waypoints.
+func testDataset() *Dataset {
+	g := vertexGraph(geo.Coordinate{Lat: 49.2, Lng: 7.0})
+	overlay := &graph.OverlayGraphFile{GraphFile: vertexGraph(geo.Coordinate{Lat: 50, Lng: 7.0})}
+	cluster, bbox := kdtree.NewKdTree(g)
+	return &Dataset{
+		Graph: &graph.ClusterGraph{Overlay: overlay, Cluster: []*graph.GraphFile{g}},
+		KdTree: &kdtree.ClusterKdTree{
+			Overlay: kdtree.NewOverlayKdTree(overlay),
+			Cluster: []*kdtree.KdTree{cluster},
+			BBoxes:  []geo.BBox{bbox},
+		},
+	}
+}
+
+func TestRoutesV2Errors(t *testing.T) {
+	datasetMutex.Lock()
+	old := dataset
+	dataset = testDataset()
+	datasetMutex.Unlock()
+	defer func() {
+		datasetMutex.Lock()
+		dataset = old
+		datasetMutex.Unlock()
+	}()
+
+	tooMany := make([]string, MaxWaypointsV2+1)
+	for i := range tooMany {
+		tooMany[i] = `{"lat": 49.2, "lng": 7.0}`
+	}
+	for _, test := range []struct {
+		name   string
+		body   string
+		status int
+		code   string
+		field  string
+	}{
+		{"malformed body", `{"waypoints": [`,
+			http.StatusBadRequest, ErrorInvalidRequest, ""},
+		{"unknown field", `{"waypoints": [], "foo": 1}`,
+			http.StatusBadRequest, ErrorInvalidRequest, ""},
+		{"too few waypoints", `{"waypoints": [{"lat": 49.2, "lng": 7.0}]}`,
+			http.StatusBadRequest, ErrorInvalidWaypoints, "waypoints"},
+		{"too many waypoints", `{"waypoints": [` + strings.Join(tooMany, ",") + `]}`,
+			http.StatusBadRequest, ErrorInvalidWaypoints, "waypoints"},
+		{"latitude out of range", `{"waypoints": [{"lat": 49.2, "lng": 7.0}, {"lat": 91, "lng": 7.0}]}`,
+			http.StatusBadRequest, ErrorInvalidWaypoints, "waypoints[1]"},
+		{"longitude out of range", `{"waypoints": [{"lat": 49.2, "lng": -181}, {"lat": 49.2, "lng": 7.0}]}`,
+			http.StatusBadRequest, ErrorInvalidWaypoints, "waypoints[0]"},
+		{"bad bearing", `{"waypoints": [{"lat": 49.2, "lng": 7.0, "bearing": 360}, {"lat": 49.2, "lng": 7.0}]}`,
+			http.StatusBadRequest, ErrorInvalidWaypoints, "waypoints[0].bearing"},
+		{"unknown transport", `{"waypoints": [{"lat": 49.2, "lng": 7.0}, {"lat": 49.2, "lng": 7.0}], "travelmode": "flying"}`,
+			http.StatusBadRequest, ErrorInvalidOptions, ParameterTravelmode},
+		{"unknown metric", `{"waypoints": [{"lat": 49.2, "lng": 7.0}, {"lat": 49.2, "lng": 7.0}], "metric": "beauty"}`,
+			http.StatusBadRequest, ErrorInvalidOptions, ParameterMetric},
+		{"unknown units", `{"waypoints": [{"lat": 49.2, "lng": 7.0}, {"lat": 49.2, "lng": 7.0}], "units": "furlongs"}`,
+			http.StatusBadRequest, ErrorInvalidOptions, ParameterUnits},
+		{"unknown language", `{"waypoints": [{"lat": 49.2, "lng": 7.0}, {"lat": 49.2, "lng": 7.0}], "language": "wrong "}`,
+			http.StatusBadRequest, ErrorInvalidOptions, ParameterLanguage},
+		{"unknown geometries", `{"waypoints": [{"lat": 49.2, "lng": 7.0}, {"lat": 49.2, "lng": 7.0}], "geometries": "wkt"}`,
+			http.StatusBadRequest, ErrorInvalidOptions, ParameterGeometries},
+		{"unknown overview", `{"waypoints": [{"lat": 49.2, "lng": 7.0}, {"lat": 49.2, "lng": 7.0}], "overview": "some"}`,
+			http.StatusBadRequest, ErrorInvalidOptions, ParameterOverview},
+		{"alternatives with departure", `{"waypoints": [{"lat": 49.2, "lng": 7.0}, {"lat": 49.2, "lng": 7.0}], "alternatives": 1, "departure": "now"}`,
+			http.StatusBadRequest, ErrorInvalidOptions, ParameterAlternatives},
+		{"avoid ferries without matrices", `{"waypoints": [{"lat": 49.2, "lng": 7.0}, {"lat": 49.2, "lng": 7.0}], "avoid": ["ferries"]}`,
+			http.StatusBadRequest, ErrorInvalidOptions, ParameterAvoid},
+		{"snapping failure", `{"waypoints": [{"lat": 49.2, "lng": 7.0}, {"lat": 49.21, "lng": 7.0, "radius": 100}]}`,
+			http.StatusBadRequest, ErrorNoSegment, "waypoints[1]"},
+	} {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest("POST", "http://x.de/v2/routes", strings.NewReader(test.body))
+		routesV2(recorder, request)
+
+		var response ErrorResponseV2
+		if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+			t.Errorf("%s: invalid error response %q", test.name, recorder.Body.String())
+			continue
+		}
+		got := fmt.Sprintf("%d %s %q", recorder.Code, response.Error.Code, response.Error.Field)
+		expected := fmt.Sprintf("%d %s %q", test.status, test.code, test.field)
+		if got != expected {
+			t.Errorf("%s: got %s (%s), expected %s", test.name, got, response.Error.Message, expected)
+		}
+	}
+}
+
+func TestRoutesV2Method(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	routesV2(recorder, httptest.NewRequest("GET", "http://x.de/v2/routes", nil))
+	if recorder.Code != http.StatusMethodNotAllowed || recorder.Header().Get("Allow") != "POST" {
+		t.Errorf("got status %d and Allow %q", recorder.Code, recorder.Header().Get("Allow"))
+	}
+}
+
+// The test data set has no matrices for the ferry-free metrics.
+func TestFeatures(t *testing.T) {
+	datasetMutex.Lock()
+	old := dataset
+	dataset = testDataset()
+	datasetMutex.Unlock()
+	defer func() {
+		datasetMutex.Lock()
+		dataset = old
+		datasetMutex.Unlock()
+	}()
+
+	recorder := httptest.NewRecorder()
+	features(recorder, httptest.NewRequest("GET", "http://x.de/features", nil))
+	var response Features
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("invalid features %q", recorder.Body.String())
+	}
+	if !response.TravelMode.Driving || !response.Metric.Time || response.Avoid.Ferries {
+		t.Errorf("got features %+v", response)
+	}
+}